@@ -0,0 +1,148 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/config"
+	"github.com/ChenSongJian/ginstagram/db"
+	"github.com/ChenSongJian/ginstagram/health"
+	"github.com/ChenSongJian/ginstagram/jobs"
+	"github.com/ChenSongJian/ginstagram/metrics"
+	"github.com/ChenSongJian/ginstagram/migrations"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/tracing"
+	"github.com/ChenSongJian/ginstagram/video"
+	"github.com/ChenSongJian/ginstagram/web"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// App is the server built from a Config: the database, the storage, the
+// services on top of them and the router serving them. Nothing in it is
+// shared with other Apps, except for the metrics in metrics.Registry.
+type App struct {
+	Config         config.Config
+	DB             *gorm.DB
+	Storage        storage.Storage
+	Deps           web.Deps
+	TranscodeQueue *jobs.TranscodeQueue
+	Monitor        *jobs.Monitor
+	Readiness      *health.Checker
+	Router         *gin.Engine
+	server         *http.Server
+	workers        *jobs.Group
+}
+
+// New connects to the database, applies pending migrations if configured to,
+// and builds the services and the router.
+func New(cfg config.Config) (*App, error) {
+	database, err := db.Open(cfg.DB)
+	if err != nil {
+		return nil, fmt.Errorf("database: %w", err)
+	}
+	if cfg.DB.AutoMigrate {
+		embedded, err := migrations.Embedded(database.Dialector.Name())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := migrations.NewMigrator(database, embedded).Up(0); err != nil {
+			return nil, fmt.Errorf("migrations: %w", err)
+		}
+	}
+	mediaStorage, err := storage.New(cfg.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+	return NewWithDB(cfg, database, mediaStorage), nil
+}
+
+// NewWithDB builds the services and the router on a database and storage that
+// are already set up.
+func NewWithDB(cfg config.Config, database *gorm.DB, mediaStorage storage.Storage) *App {
+	mediaService := services.NewDBMediaService(database)
+	transcoder := video.NewFFmpeg(cfg.Transcode.FFmpegPath, cfg.Transcode.FFprobePath)
+	transcodeQueue := jobs.NewTranscodeQueue(mediaService, mediaStorage, transcoder, cfg.Transcode.WorkDir)
+	monitor := jobs.NewMonitor()
+	readiness := health.NewChecker(
+		health.Database(database),
+		health.Migrations(database),
+		health.Storage(mediaStorage),
+		health.Check{Name: "workers", Run: func(ctx context.Context) error { return monitor.Check(time.Now()) }},
+	)
+	deps := web.Deps{
+		UserService:          services.NewDBUserService(database),
+		FollowService:        services.NewDBFollowService(database),
+		PostService:          services.NewDBPostService(database),
+		MediaService:         mediaService,
+		CommentService:       services.NewDBCommentService(database),
+		LikeService:          services.NewDBLikeService(database),
+		BookmarkService:      services.NewDBBookmarkService(database),
+		ReportService:        services.NewDBReportService(database),
+		UploadSessionService: services.NewDBUploadSessionService(database),
+		MediaStorage:         mediaStorage,
+		TranscodeQueue:       transcodeQueue,
+		UploadLimits:         cfg.Upload.Limits,
+		UploadSpoolDir:       cfg.Upload.SpoolDir,
+		JWTSecret:            cfg.JWTSecret,
+		CORSOrigins:          cfg.CORSOrigins,
+		Readiness:            readiness,
+	}
+	for _, plugin := range []gorm.Plugin{metrics.GORMPlugin{}, tracing.GORMPlugin{}} {
+		if err := database.Use(plugin); err != nil && !errors.Is(err, gorm.ErrRegistered) {
+			panic(err)
+		}
+	}
+	if sqlDB, err := database.DB(); err == nil {
+		metrics.SetDB(sqlDB)
+	}
+	router := web.NewRouter(deps)
+	return &App{
+		Config:         cfg,
+		DB:             database,
+		Storage:        mediaStorage,
+		Deps:           deps,
+		TranscodeQueue: transcodeQueue,
+		Monitor:        monitor,
+		Readiness:      readiness,
+		Router:         router,
+		server:         &http.Server{Addr: fmt.Sprintf(":%d", cfg.Port), Handler: router},
+		workers:        jobs.NewGroup(),
+	}
+}
+
+// StartJobs starts the background jobs, which run until Shutdown.
+func (app *App) StartJobs() {
+	deps := app.Deps
+	jobs.StartTrashPurger(app.workers, deps.UserService, deps.PostService, deps.CommentService, deps.MediaService, deps.MediaStorage,
+		time.Hour, app.Monitor)
+	jobs.StartUploadExpirer(app.workers, deps.UploadSessionService, deps.MediaStorage, time.Hour, app.Monitor)
+	jobs.StartOrphanReaper(app.workers, deps.MediaService, deps.MediaStorage, time.Hour, jobs.OrphanGracePeriod,
+		app.Config.OrphanReaperDryRun, app.Monitor)
+	app.TranscodeQueue.Start(app.workers, app.Config.Transcode.Workers, app.Monitor)
+}
+
+// Run serves the router on the configured port until Shutdown is called.
+func (app *App) Run() error {
+	if err := app.server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown makes readiness fail, keeps serving for the configured drain
+// delay so that load balancers take the server out of rotation, then stops
+// accepting requests and waits for those in flight and for the background
+// jobs to stop, until ctx is done.
+func (app *App) Shutdown(ctx context.Context) error {
+	app.Readiness.Drain()
+	select {
+	case <-time.After(app.Config.Shutdown.DrainDelay):
+	case <-ctx.Done():
+	}
+	return errors.Join(app.server.Shutdown(ctx), app.workers.Stop(ctx))
+}
@@ -0,0 +1,495 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/validation"
+	"github.com/joho/godotenv"
+)
+
+// Config is everything the server can be configured with. Load fills it from,
+// in increasing order of precedence, the defaults, a .env style file, the
+// environment and command line flags.
+type Config struct {
+	Port        int
+	JWTSecret   string
+	CORSOrigins []string
+	DB          DB
+	Storage     Storage
+	Upload      Upload
+	Transcode   Transcode
+	// OrphanReaperDryRun only logs what the orphan reaper would remove.
+	OrphanReaperDryRun bool
+	// LogLevel is the least severe level logged.
+	LogLevel slog.Level
+	Tracing  Tracing
+	Shutdown Shutdown
+}
+
+type DB struct {
+	// Driver is "postgres" or "sqlite".
+	Driver string
+	// SQLitePath is the SQLite database file, or ":memory:" for one that only
+	// lives as long as the process.
+	SQLitePath  string
+	Host        string
+	Port        int
+	User        string
+	Password    string
+	Name        string
+	SSLMode     string
+	TimeZone    string
+	AutoMigrate bool
+}
+
+// DSN is the connection string for a Postgres DB.
+func (db DB) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
+		db.Host, db.User, db.Password, db.Name, db.Port, db.SSLMode, db.TimeZone)
+}
+
+type Storage struct {
+	// Backend is "local" or "s3".
+	Backend       string
+	SigningSecret string
+	LocalRoot     string
+	BaseURL       string
+	S3Endpoint    string
+	S3AccessKey   string
+	S3SecretKey   string
+	S3Bucket      string
+	S3Region      string
+	S3UseSSL      bool
+}
+
+type Upload struct {
+	validation.Limits
+	// SpoolDir is local scratch space for the chunks of resumable uploads
+	// while they are received and finalized. The chunks themselves are
+	// staged in storage, so any instance can serve any request of an upload.
+	SpoolDir string
+}
+
+type Transcode struct {
+	FFmpegPath  string
+	FFprobePath string
+	Workers     int
+	WorkDir     string
+}
+
+type Tracing struct {
+	// Exporter is "none", "stdout" or "otlp".
+	Exporter string
+	// OTLPEndpoint is the host:port of the OTLP/HTTP collector.
+	OTLPEndpoint string
+	OTLPInsecure bool
+	// SampleRatio is the share of traces started by the server that are
+	// recorded, traces started by callers are recorded if they are.
+	SampleRatio float64
+}
+
+type Shutdown struct {
+	// DrainDelay is how long the server keeps serving once readiness fails,
+	// for load balancers to notice before it stops.
+	DrainDelay time.Duration
+	// Timeout bounds the time requests in flight get to finish.
+	Timeout time.Duration
+}
+
+// DefaultFile is the file read when neither -config nor CONFIG_FILE name one.
+const DefaultFile = ".env"
+
+func Default() Config {
+	return Config{
+		Port:        8080,
+		CORSOrigins: []string{"http://localhost:3000"},
+		DB: DB{
+			Driver:     "postgres",
+			SQLitePath: "ginstagram.db",
+			Host:       "localhost",
+			Port:       5432,
+			User:       "postgres",
+			Name:       "ginstagram",
+			SSLMode:    "disable",
+			TimeZone:   "Asia/Singapore",
+		},
+		Storage: Storage{
+			Backend:   "local",
+			LocalRoot: "media",
+			BaseURL:   "/api/v1/media",
+		},
+		Upload: Upload{
+			Limits:   validation.DefaultLimits,
+			SpoolDir: filepath.Join(os.TempDir(), "ginstagram-uploads"),
+		},
+		Transcode: Transcode{
+			FFmpegPath:  "ffmpeg",
+			FFprobePath: "ffprobe",
+			Workers:     1,
+			WorkDir:     filepath.Join(os.TempDir(), "ginstagram-transcode"),
+		},
+		Tracing: Tracing{
+			Exporter:     "none",
+			OTLPEndpoint: "localhost:4318",
+			SampleRatio:  1,
+		},
+		Shutdown: Shutdown{
+			DrainDelay: 5 * time.Second,
+			Timeout:    30 * time.Second,
+		},
+	}
+}
+
+// setting is a value that can be configured, known by the same name in the
+// file and the environment and by a lowercase, dashed name as a flag.
+type setting struct {
+	name     string
+	usage    string
+	secret   bool
+	required bool
+	set      func(string) error
+	get      func() string
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.name), "_", "-")
+}
+
+func stringSetting(name string, value *string, usage string) setting {
+	return setting{
+		name:  name,
+		usage: usage,
+		set:   func(v string) error { *value = v; return nil },
+		get:   func() string { return *value },
+	}
+}
+
+func secretSetting(name string, value *string, usage string) setting {
+	s := stringSetting(name, value, usage)
+	s.secret = true
+	return s
+}
+
+func required(s setting) setting {
+	s.required = true
+	return s
+}
+
+func intSetting(name string, value *int, usage string) setting {
+	return setting{
+		name:  name,
+		usage: usage,
+		set: func(v string) error {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", name, v)
+			}
+			*value = parsed
+			return nil
+		},
+		get: func() string { return strconv.Itoa(*value) },
+	}
+}
+
+func int64Setting(name string, value *int64, usage string) setting {
+	return setting{
+		name:  name,
+		usage: usage,
+		set: func(v string) error {
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", name, v)
+			}
+			*value = parsed
+			return nil
+		},
+		get: func() string { return strconv.FormatInt(*value, 10) },
+	}
+}
+
+func floatSetting(name string, value *float64, usage string) setting {
+	return setting{
+		name:  name,
+		usage: usage,
+		set: func(v string) error {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", name, v)
+			}
+			*value = parsed
+			return nil
+		},
+		get: func() string { return strconv.FormatFloat(*value, 'g', -1, 64) },
+	}
+}
+
+func durationSetting(name string, value *time.Duration, usage string) setting {
+	return setting{
+		name:  name,
+		usage: usage,
+		set: func(v string) error {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a duration like 30s", name, v)
+			}
+			*value = parsed
+			return nil
+		},
+		get: func() string { return value.String() },
+	}
+}
+
+func boolSetting(name string, value *bool, usage string) setting {
+	return setting{
+		name:  name,
+		usage: usage,
+		set: func(v string) error {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not true or false", name, v)
+			}
+			*value = parsed
+			return nil
+		},
+		get: func() string { return strconv.FormatBool(*value) },
+	}
+}
+
+func levelSetting(name string, value *slog.Level, usage string) setting {
+	return setting{
+		name:  name,
+		usage: usage,
+		set: func(v string) error {
+			if err := value.UnmarshalText([]byte(v)); err != nil {
+				return fmt.Errorf("%s: %q is not debug, info, warn or error", name, v)
+			}
+			return nil
+		},
+		get: func() string { return strings.ToLower(value.String()) },
+	}
+}
+
+func listSetting(name string, value *[]string, usage string) setting {
+	return setting{
+		name:  name,
+		usage: usage,
+		set: func(v string) error {
+			*value = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*value = append(*value, item)
+				}
+			}
+			return nil
+		},
+		get: func() string { return strings.Join(*value, ",") },
+	}
+}
+
+func (config *Config) settings() []setting {
+	return []setting{
+		intSetting("PORT", &config.Port, "port to listen on"),
+		required(secretSetting("JWT_SECRET", &config.JWTSecret, "key signing access tokens")),
+		listSetting("CORS_ORIGINS", &config.CORSOrigins, "comma separated origins allowed to call the API"),
+
+		stringSetting("STORAGE", &config.DB.Driver, "database the data is kept in, postgres or sqlite"),
+		stringSetting("SQLITE_PATH", &config.DB.SQLitePath, "SQLite database file, or :memory:"),
+		stringSetting("DB_HOST", &config.DB.Host, "database host"),
+		intSetting("DB_PORT", &config.DB.Port, "database port"),
+		stringSetting("DB_USER", &config.DB.User, "database user"),
+		secretSetting("DB_PASSWORD", &config.DB.Password, "database password"),
+		stringSetting("DB_NAME", &config.DB.Name, "database name"),
+		stringSetting("DB_SSLMODE", &config.DB.SSLMode, "database sslmode"),
+		stringSetting("DB_TIMEZONE", &config.DB.TimeZone, "time zone of the database session"),
+		boolSetting("DB_AUTO_MIGRATE", &config.DB.AutoMigrate, "apply pending migrations on startup"),
+
+		stringSetting("STORAGE_BACKEND", &config.Storage.Backend, "where uploads are stored, local or s3"),
+		required(secretSetting("STORAGE_SIGNING_SECRET", &config.Storage.SigningSecret, "key signing media URLs")),
+		stringSetting("STORAGE_LOCAL_ROOT", &config.Storage.LocalRoot, "directory local storage writes to"),
+		stringSetting("STORAGE_BASE_URL", &config.Storage.BaseURL, "URL local storage serves media at"),
+		stringSetting("S3_ENDPOINT", &config.Storage.S3Endpoint, "S3 endpoint"),
+		stringSetting("S3_ACCESS_KEY", &config.Storage.S3AccessKey, "S3 access key"),
+		secretSetting("S3_SECRET_KEY", &config.Storage.S3SecretKey, "S3 secret key"),
+		stringSetting("S3_BUCKET", &config.Storage.S3Bucket, "S3 bucket"),
+		stringSetting("S3_REGION", &config.Storage.S3Region, "S3 region"),
+		boolSetting("S3_USE_SSL", &config.Storage.S3UseSSL, "connect to S3 over TLS"),
+
+		int64Setting("UPLOAD_MAX_IMAGE_SIZE", &config.Upload.MaxImageSize, "largest image upload in bytes"),
+		intSetting("UPLOAD_MAX_IMAGE_PIXELS", &config.Upload.MaxImagePixels, "largest image upload in pixels"),
+		int64Setting("UPLOAD_MAX_VIDEO_SIZE", &config.Upload.MaxVideoSize, "largest video upload in bytes"),
+		int64Setting("UPLOAD_MAX_RESUMABLE_SIZE", &config.Upload.MaxResumableSize, "largest resumable upload in bytes"),
+		int64Setting("UPLOAD_QUOTA", &config.Upload.MaxStoredBytes, "bytes each user may store"),
+		intSetting("UPLOAD_MAX_PER_HOUR", &config.Upload.MaxUploadsPerHour, "uploads each user may make an hour"),
+		intSetting("UPLOAD_MAX_PENDING", &config.Upload.MaxPendingUploads, "unfinished resumable uploads each user may have"),
+		int64Setting("UPLOAD_MAX_PENDING_SIZE", &config.Upload.MaxPendingUploadBytes, "bytes of unfinished resumable uploads each user may have"),
+		intSetting("UPLOAD_MAX_CHUNKS", &config.Upload.MaxUploadChunks, "chunks a resumable upload may be sent in"),
+		stringSetting("UPLOAD_SPOOL_DIR", &config.Upload.SpoolDir, "scratch directory for resumable upload chunks"),
+
+		stringSetting("FFMPEG_PATH", &config.Transcode.FFmpegPath, "ffmpeg binary"),
+		stringSetting("FFPROBE_PATH", &config.Transcode.FFprobePath, "ffprobe binary"),
+		intSetting("TRANSCODE_WORKERS", &config.Transcode.Workers, "videos transcoded at a time"),
+		stringSetting("TRANSCODE_WORK_DIR", &config.Transcode.WorkDir, "scratch directory for transcoding"),
+
+		boolSetting("ORPHAN_REAPER_DRY_RUN", &config.OrphanReaperDryRun, "only log what the orphan reaper would remove"),
+		levelSetting("LOG_LEVEL", &config.LogLevel, "least severe level logged, debug, info, warn or error"),
+
+		stringSetting("TRACING_EXPORTER", &config.Tracing.Exporter, "where traces are exported, none, stdout or otlp"),
+		stringSetting("TRACING_OTLP_ENDPOINT", &config.Tracing.OTLPEndpoint, "host:port of the OTLP/HTTP collector"),
+		boolSetting("TRACING_OTLP_INSECURE", &config.Tracing.OTLPInsecure, "export to the collector over plain HTTP"),
+		floatSetting("TRACING_SAMPLE_RATIO", &config.Tracing.SampleRatio, "share of traces recorded, from 0 to 1"),
+
+		durationSetting("SHUTDOWN_DRAIN_DELAY", &config.Shutdown.DrainDelay, "time serving on after readiness fails on shutdown"),
+		durationSetting("SHUTDOWN_TIMEOUT", &config.Shutdown.Timeout, "time requests in flight get to finish on shutdown"),
+	}
+}
+
+// Load reads the configuration, args being the command line flags, and
+// validates it.
+func Load(args []string) (Config, error) {
+	config, err := Read(args)
+	if err != nil {
+		return config, err
+	}
+	return config, config.Validate()
+}
+
+// Read reads the configuration like Load without validating it, for commands
+// that only need part of it. The file is the one named by -config or
+// CONFIG_FILE, or .env if there is one.
+func Read(args []string) (Config, error) {
+	config := Default()
+	settings := config.settings()
+
+	flags := flag.NewFlagSet("ginstagram", flag.ContinueOnError)
+	file := flags.String("config", "", "file to read settings from, in KEY=value lines (default "+DefaultFile+")")
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		name := s.name
+		flags.Func(s.flagName(), s.usage, func(v string) error {
+			flagValues[name] = v
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+
+	fileValues := map[string]string{}
+	if *file == "" {
+		*file = os.Getenv("CONFIG_FILE")
+	}
+	if *file != "" {
+		values, err := godotenv.Read(*file)
+		if err != nil {
+			return config, fmt.Errorf("reading config file: %w", err)
+		}
+		fileValues = values
+	} else if values, err := godotenv.Read(DefaultFile); err == nil {
+		fileValues = values
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return config, fmt.Errorf("reading %s: %w", DefaultFile, err)
+	}
+
+	// empty values count as unset, as docker compose passes variables that
+	// are not set on as empty
+	var errs []error
+	for _, s := range settings {
+		for _, lookup := range []func(string) (string, bool){
+			func(name string) (string, bool) { v, ok := fileValues[name]; return v, ok },
+			os.LookupEnv,
+			func(name string) (string, bool) { v, ok := flagValues[name]; return v, ok },
+		} {
+			if v, ok := lookup(s.name); ok && v != "" {
+				if err := s.set(v); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return config, errors.Join(errs...)
+}
+
+// Validate checks that required settings are there and the rest make sense.
+func (config Config) Validate() error {
+	var errs []error
+	for _, s := range config.settings() {
+		if s.required && s.get() == "" {
+			errs = append(errs, fmt.Errorf("%s is required", s.name))
+		}
+	}
+	switch config.DB.Driver {
+	case "postgres":
+		if config.DB.Host == "" || config.DB.User == "" || config.DB.Name == "" {
+			errs = append(errs, errors.New("DB_HOST, DB_USER and DB_NAME are required for postgres"))
+		}
+	case "sqlite":
+		if config.DB.SQLitePath == "" {
+			errs = append(errs, errors.New("SQLITE_PATH is required for sqlite"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE %q is not postgres or sqlite", config.DB.Driver))
+	}
+	if config.Port < 1 || config.Port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT %d is not a valid port", config.Port))
+	}
+	if len(config.CORSOrigins) == 0 {
+		errs = append(errs, errors.New("CORS_ORIGINS needs at least one origin"))
+	}
+	switch config.Storage.Backend {
+	case "local":
+		if config.Storage.LocalRoot == "" {
+			errs = append(errs, errors.New("STORAGE_LOCAL_ROOT is required for local storage"))
+		}
+	case "s3":
+		if config.Storage.S3Endpoint == "" || config.Storage.S3Bucket == "" {
+			errs = append(errs, errors.New("S3_ENDPOINT and S3_BUCKET are required for s3 storage"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE_BACKEND %q is not local or s3", config.Storage.Backend))
+	}
+	limits := config.Upload.Limits
+	if limits.MaxImageSize <= 0 || limits.MaxImagePixels <= 0 || limits.MaxVideoSize <= 0 ||
+		limits.MaxResumableSize <= 0 || limits.MaxStoredBytes <= 0 || limits.MaxUploadsPerHour <= 0 ||
+		limits.MaxPendingUploads <= 0 || limits.MaxPendingUploadBytes <= 0 || limits.MaxUploadChunks <= 0 {
+		errs = append(errs, errors.New("upload limits must be positive"))
+	}
+	if config.Transcode.Workers < 1 {
+		errs = append(errs, errors.New("TRANSCODE_WORKERS must be at least 1"))
+	}
+	switch config.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if config.Tracing.OTLPEndpoint == "" {
+			errs = append(errs, errors.New("TRACING_OTLP_ENDPOINT is required for otlp"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER %q is not none, stdout or otlp", config.Tracing.Exporter))
+	}
+	if config.Tracing.SampleRatio < 0 || config.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("TRACING_SAMPLE_RATIO must be between 0 and 1"))
+	}
+	if config.Shutdown.DrainDelay < 0 || config.Shutdown.Timeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_DRAIN_DELAY must not be negative and SHUTDOWN_TIMEOUT must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes the effective configuration, with secrets redacted.
+func (config Config) Print(w io.Writer) {
+	for _, s := range config.settings() {
+		value := s.get()
+		if s.secret && value != "" {
+			value = "[redacted]"
+		}
+		fmt.Fprintf(w, "%s=%s\n", s.name, value)
+	}
+}
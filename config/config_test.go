@@ -0,0 +1,139 @@
+package config_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/config"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "ginstagram.env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const requiredSettings = "JWT_SECRET=jwt-key\nSTORAGE_SIGNING_SECRET=storage-key\n"
+
+func TestLoad_Defaults(t *testing.T) {
+	path := writeConfigFile(t, requiredSettings)
+
+	cfg, err := config.Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.Port != 8080 || cfg.DB.Host != "localhost" || cfg.Storage.Backend != "local" || cfg.Transcode.Workers != 1 {
+		t.Errorf("Unexpected defaults %+v", cfg)
+	}
+	if cfg.JWTSecret != "jwt-key" || cfg.Storage.SigningSecret != "storage-key" {
+		t.Errorf("Expected secrets from the file, got %q and %q", cfg.JWTSecret, cfg.Storage.SigningSecret)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfigFile(t, requiredSettings+"PORT=9000\nDB_HOST=file-host\nDB_NAME=file-db\nUPLOAD_QUOTA=100\nLOG_LEVEL=DEBUG\n")
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("DB_NAME", "env-db")
+
+	cfg, err := config.Load([]string{"-config", path, "-db-name", "flag-db", "-cors-origins", "https://a.example, https://b.example"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.Port != 9000 || cfg.Upload.MaxStoredBytes != 100 || cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("Expected settings from the file, got port %d, quota %d and level %s", cfg.Port, cfg.Upload.MaxStoredBytes, cfg.LogLevel)
+	}
+	if cfg.DB.Host != "env-host" {
+		t.Errorf("Expected the environment to override the file, got %q", cfg.DB.Host)
+	}
+	if cfg.DB.Name != "flag-db" {
+		t.Errorf("Expected flags to override the environment, got %q", cfg.DB.Name)
+	}
+	if strings.Join(cfg.CORSOrigins, " ") != "https://a.example https://b.example" {
+		t.Errorf("Unexpected CORS origins %q", cfg.CORSOrigins)
+	}
+}
+
+func TestLoad_EmptyValuesAreUnset(t *testing.T) {
+	path := writeConfigFile(t, requiredSettings+"DB_HOST=file-host\n")
+	t.Setenv("DB_HOST", "")
+	t.Setenv("TRANSCODE_WORKERS", "")
+
+	cfg, err := config.Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.DB.Host != "file-host" || cfg.Transcode.Workers != 1 {
+		t.Errorf("Expected empty variables to be ignored, got host %q and %d workers", cfg.DB.Host, cfg.Transcode.Workers)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"missing secrets", "", "JWT_SECRET is required"},
+		{"unparsable number", requiredSettings + "PORT=http\n", "PORT"},
+		{"invalid port", requiredSettings + "PORT=70000\n", "PORT 70000 is not a valid port"},
+		{"unknown backend", requiredSettings + "STORAGE_BACKEND=ftp\n", `STORAGE_BACKEND "ftp" is not local or s3`},
+		{"s3 without bucket", requiredSettings + "STORAGE_BACKEND=s3\nS3_ENDPOINT=s3.example\n", "S3_BUCKET"},
+		{"no workers", requiredSettings + "TRANSCODE_WORKERS=0\n", "TRANSCODE_WORKERS must be at least 1"},
+		{"negative quota", requiredSettings + "UPLOAD_QUOTA=-1\n", "upload limits must be positive"},
+		{"unknown trace exporter", requiredSettings + "TRACING_EXPORTER=jaeger\n", `TRACING_EXPORTER "jaeger" is not none, stdout or otlp`},
+		{"sample ratio above 1", requiredSettings + "TRACING_SAMPLE_RATIO=2\n", "TRACING_SAMPLE_RATIO must be between 0 and 1"},
+		{"unparsable duration", requiredSettings + "SHUTDOWN_TIMEOUT=30\n", `SHUTDOWN_TIMEOUT: "30" is not a duration like 30s`},
+		{"no shutdown timeout", requiredSettings + "SHUTDOWN_TIMEOUT=0s\n", "SHUTDOWN_TIMEOUT must be positive"},
+		{"unknown log level", requiredSettings + "LOG_LEVEL=loud\n", `LOG_LEVEL: "loud" is not debug, info, warn or error`},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			path := writeConfigFile(t, testCase.content)
+			_, err := config.Load([]string{"-config", path})
+			if err == nil || !strings.Contains(err.Error(), testCase.expected) {
+				t.Errorf("Expected an error containing %q, got %v", testCase.expected, err)
+			}
+		})
+	}
+}
+
+func TestRead_SkipsValidation(t *testing.T) {
+	path := writeConfigFile(t, "DB_HOST=db\n")
+
+	cfg, err := config.Read([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.DB.Host != "db" {
+		t.Errorf("Expected DB_HOST db, got %q", cfg.DB.Host)
+	}
+}
+
+func TestPrint_RedactsSecrets(t *testing.T) {
+	path := writeConfigFile(t, requiredSettings+"DB_PASSWORD=db-password\n")
+	cfg, err := config.Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var out bytes.Buffer
+	cfg.Print(&out)
+	printed := out.String()
+	for _, secret := range []string{"jwt-key", "storage-key", "db-password"} {
+		if strings.Contains(printed, secret) {
+			t.Errorf("Expected %q to be redacted in\n%s", secret, printed)
+		}
+	}
+	if !strings.Contains(printed, "JWT_SECRET=[redacted]\n") || !strings.Contains(printed, "DB_HOST=localhost\n") {
+		t.Errorf("Unexpected output\n%s", printed)
+	}
+	if !strings.Contains(printed, "S3_SECRET_KEY=\n") {
+		t.Errorf("Expected unset secrets to print empty\n%s", printed)
+	}
+}
@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	gosqlite "github.com/glebarez/go-sqlite"
+	"gorm.io/gorm"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	ConstraintUnique     = "unique"
+	ConstraintForeignKey = "foreign key"
+	ConstraintCheck      = "check"
+)
+
+// ConstraintError is a write SQLite refused over a constraint. It names the
+// constraint and reads the way Postgres reports the same violation, so that
+// callers handle both databases alike. Postgres errors are left as they are.
+type ConstraintError struct {
+	Kind       string
+	Table      string
+	Constraint string
+	Err        error
+}
+
+func (err *ConstraintError) Error() string {
+	switch err.Kind {
+	case ConstraintUnique:
+		return fmt.Sprintf("ERROR: duplicate key value violates unique constraint %q", err.Constraint)
+	case ConstraintForeignKey:
+		return fmt.Sprintf("ERROR: insert or update on table %q violates foreign key constraint %q", err.Table, err.Constraint)
+	default:
+		return fmt.Sprintf("ERROR: new row for relation %q violates check constraint %q", err.Table, err.Constraint)
+	}
+}
+
+// SQLState returns the SQLSTATE code Postgres reports the same violation with.
+func (err *ConstraintError) SQLState() string {
+	switch err.Kind {
+	case ConstraintUnique:
+		return "23505"
+	case ConstraintForeignKey:
+		return "23503"
+	default:
+		return "23514"
+	}
+}
+
+func (err *ConstraintError) Unwrap() error {
+	return err.Err
+}
+
+var (
+	uniqueFailed    = regexp.MustCompile(`UNIQUE constraint failed: ([\w.]+(?:, [\w.]+)*)`)
+	checkFailed     = regexp.MustCompile(`CHECK constraint failed: (\w+)`)
+	namedUnique     = regexp.MustCompile(`(?i)CONSTRAINT\s+(\w+)\s+UNIQUE\s*\(([^)]*)\)`)
+	inlineUnique    = regexp.MustCompile(`(?im)^\s*"?(\w+)"?\s[^,]*\bUNIQUE\b`)
+	uniqueIndex     = regexp.MustCompile(`(?i)CREATE\s+UNIQUE\s+INDEX\s+(\w+)\s+ON\s+\w+\s*\(([^)]*)\)`)
+	namedForeignKey = regexp.MustCompile(`(?i)CONSTRAINT\s+(\w+)\s+FOREIGN\s+KEY\s*\((\w+)\)`)
+)
+
+// registerConstraintErrors replaces the constraint errors of writes with
+// ConstraintErrors.
+func registerConstraintErrors(database *gorm.DB) error {
+	callbacks := database.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("ginstagram:constraint_errors", translateConstraintError); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("ginstagram:constraint_errors", translateConstraintError); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("ginstagram:constraint_errors", translateConstraintError)
+}
+
+func translateConstraintError(tx *gorm.DB) {
+	var sqliteErr *gosqlite.Error
+	if !errors.As(tx.Error, &sqliteErr) {
+		return
+	}
+	ctx := tx.Statement.Context
+	conn := tx.Statement.ConnPool
+	table := tx.Statement.Table
+	var constraintErr *ConstraintError
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		constraintErr = &ConstraintError{Kind: ConstraintUnique, Table: table, Err: sqliteErr}
+		if match := uniqueFailed.FindStringSubmatch(sqliteErr.Error()); match != nil {
+			var columns []string
+			for _, column := range strings.Split(match[1], ", ") {
+				constraintErr.Table, column, _ = strings.Cut(column, ".")
+				columns = append(columns, column)
+			}
+			constraintErr.Constraint = uniqueConstraint(ctx, conn, constraintErr.Table, columns,
+				sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+		}
+	case sqlite3.SQLITE_CONSTRAINT_CHECK:
+		constraintErr = &ConstraintError{Kind: ConstraintCheck, Table: table, Err: sqliteErr}
+		if match := checkFailed.FindStringSubmatch(sqliteErr.Error()); match != nil {
+			constraintErr.Constraint = match[1]
+		}
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		constraintErr = &ConstraintError{Kind: ConstraintForeignKey, Table: table, Err: sqliteErr}
+		// SQLite does not say which foreign key it was, so look for the one
+		// whose row is missing
+		constraintErr.Constraint = foreignKeyConstraint(ctx, conn, table, writtenValues(tx))
+	default:
+		return
+	}
+	tx.Error = constraintErr
+}
+
+// uniqueConstraint names the unique constraint or index of table on columns,
+// the way Postgres names those that were not named in the schema.
+func uniqueConstraint(ctx context.Context, conn gorm.ConnPool, table string, columns []string, primaryKey bool) string {
+	if primaryKey {
+		return table + "_pkey"
+	}
+	key := strings.Join(columns, ",")
+	var tableSQL string
+	conn.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&tableSQL)
+	for _, match := range namedUnique.FindAllStringSubmatch(tableSQL, -1) {
+		if columnList(match[2]) == key {
+			return match[1]
+		}
+	}
+	if len(columns) == 1 {
+		for _, match := range inlineUnique.FindAllStringSubmatch(tableSQL, -1) {
+			if match[1] == columns[0] {
+				return table + "_" + columns[0] + "_key"
+			}
+		}
+	}
+	rows, err := conn.QueryContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var indexSQL string
+			rows.Scan(&indexSQL)
+			if match := uniqueIndex.FindStringSubmatch(indexSQL); match != nil && columnList(match[2]) == key {
+				return match[1]
+			}
+		}
+	}
+	return table + "_" + strings.Join(columns, "_") + "_key"
+}
+
+func columnList(columns string) string {
+	var names []string
+	for _, column := range strings.Split(columns, ",") {
+		names = append(names, strings.Trim(strings.TrimSpace(column), `"`))
+	}
+	return strings.Join(names, ",")
+}
+
+// foreignKeyConstraint names the foreign key of table whose referenced row is
+// missing for the values written, or returns "" if it cannot tell.
+func foreignKeyConstraint(ctx context.Context, conn gorm.ConnPool, table string, values map[string]interface{}) string {
+	if table == "" {
+		return ""
+	}
+	type foreignKey struct{ from, parent, to string }
+	var foreignKeys []foreignKey
+	rows, err := conn.QueryContext(ctx, `SELECT "from", "table", "to" FROM pragma_foreign_key_list(?)`, table)
+	if err != nil {
+		return ""
+	}
+	for rows.Next() {
+		var key foreignKey
+		if rows.Scan(&key.from, &key.parent, &key.to) == nil {
+			foreignKeys = append(foreignKeys, key)
+		}
+	}
+	rows.Close()
+
+	for _, key := range foreignKeys {
+		value, ok := values[key.from]
+		if !ok || value == nil {
+			continue
+		}
+		var exists int
+		err := conn.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %q WHERE %q = ?`, key.parent, key.to), value).Scan(&exists)
+		if err != nil || exists > 0 {
+			continue
+		}
+		var tableSQL string
+		conn.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&tableSQL)
+		for _, match := range namedForeignKey.FindAllStringSubmatch(tableSQL, -1) {
+			if match[2] == key.from {
+				return match[1]
+			}
+		}
+		return table + "_" + key.from + "_fkey"
+	}
+	return ""
+}
+
+// writtenValues returns the column values of the row a create or update
+// wrote, as far as the statement tells.
+func writtenValues(tx *gorm.DB) map[string]interface{} {
+	values := make(map[string]interface{})
+	statement := tx.Statement
+	if statement.Schema != nil && statement.ReflectValue.Kind() == reflect.Struct {
+		for _, field := range statement.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			if value, zero := field.ValueOf(statement.Context, statement.ReflectValue); !zero {
+				values[field.DBName] = value
+			}
+		}
+	}
+	switch dest := statement.Dest.(type) {
+	case map[string]interface{}:
+		for column, value := range dest {
+			if statement.Schema != nil {
+				if field := statement.Schema.LookUpField(column); field != nil {
+					column = field.DBName
+				}
+			}
+			values[column] = value
+		}
+	}
+	return values
+}
@@ -2,40 +2,47 @@ package db
 
 import (
 	"fmt"
-	"log"
-	"os"
+	"net/url"
 
+	"github.com/ChenSongJian/ginstagram/config"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-
-	"github.com/joho/godotenv"
 )
 
-var DB *gorm.DB
-
-func InitDB() {
-	var dbHost, dbUser, dbPassword, dbName, dbPort string
-
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
-		dbHost = "localhost"
-		dbUser = "postgres"
-		dbPassword = "POSTGRES_PASSWORD"
-		dbName = "ginstagram"
-		dbPort = "5432"
-	} else {
-		dbHost = os.Getenv("DB_HOST")
-		dbUser = os.Getenv("DB_USER")
-		dbPassword = os.Getenv("DB_PASSWORD")
-		dbName = os.Getenv("DB_NAME")
-		dbPort = os.Getenv("DB_PORT")
+// Open connects to the configured database.
+func Open(cfg config.DB) (*gorm.DB, error) {
+	switch cfg.Driver {
+	case "postgres":
+		return gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{Logger: NewLogger()})
+	case "sqlite":
+		return OpenSQLite(cfg.SQLitePath)
+	default:
+		return nil, fmt.Errorf("unknown database %q", cfg.Driver)
 	}
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Singapore",
-		dbHost, dbUser, dbPassword, dbName, dbPort)
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// OpenSQLite opens the SQLite database at path, or a private in-memory one
+// if path is ":memory:". Foreign keys are enforced and LIKE is case sensitive
+// as they are in Postgres, and constraint errors read like Postgres's, see
+// ConstraintError.
+func OpenSQLite(path string) (*gorm.DB, error) {
+	pragmas := url.Values{"_pragma": {"foreign_keys(1)", "busy_timeout(5000)", "case_sensitive_like(1)"}}
+	database, err := gorm.Open(sqlite.Open(path+"?"+pragmas.Encode()), &gorm.Config{Logger: NewLogger()})
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		return nil, err
+	}
+	// SQLite takes one writer at a time anyway, and an in-memory database
+	// only exists for the connection that opened it
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetConnMaxLifetime(0)
+	sqlDB.SetConnMaxIdleTime(0)
+	if err := registerConstraintErrors(database); err != nil {
+		return nil, err
 	}
-	DB = db
+	return database, nil
 }
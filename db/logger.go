@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// SlowQueryThreshold is how long a query may take before it is logged as
+// slow.
+const SlowQueryThreshold = 200 * time.Millisecond
+
+// Logger logs the queries GORM makes to the default slog logger: every query
+// at debug level, slow ones at warn level and failed ones at error level, with
+// the request id of their context. Query parameters are left out, they hold
+// password hashes and tokens.
+type Logger struct {
+	SlowThreshold time.Duration
+}
+
+func NewLogger() *Logger {
+	return &Logger{SlowThreshold: SlowQueryThreshold}
+}
+
+// LogMode is ignored, the level of the slog logger decides what is logged.
+func (logger *Logger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return logger
+}
+
+func (logger *Logger) Info(ctx context.Context, msg string, data ...interface{}) {
+	slog.Default().InfoContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (logger *Logger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	slog.Default().WarnContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (logger *Logger) Error(ctx context.Context, msg string, data ...interface{}) {
+	slog.Default().ErrorContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (logger *Logger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	level := slog.LevelDebug
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level = slog.LevelError
+	case logger.SlowThreshold > 0 && elapsed > logger.SlowThreshold:
+		level = slog.LevelWarn
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Duration("duration", elapsed),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.Default().LogAttrs(ctx, level, "query", attrs...)
+}
+
+// ParamsFilter keeps the parameters of queries out of the logs.
+func (logger *Logger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
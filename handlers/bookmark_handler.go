@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type BookmarkReq struct {
+	CollectionId int `json:"collection_id"`
+}
+
+type ReorderBookmarksReq struct {
+	PostIds []int `json:"post_ids" binding:"required"`
+}
+
+type CollectionReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type ReorderCollectionsReq struct {
+	CollectionIds []int `json:"collection_ids" binding:"required"`
+}
+
+type CollectionResponse struct {
+	Id        int    `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+func ListBookmarks(bookmarkService services.BookmarkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		collectionId := 0
+		if collectionIdStr := c.Query("collection_id"); collectionIdStr != "" {
+			var err error
+			collectionId, err = strconv.Atoi(collectionIdStr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid collection_id"))
+				return
+			}
+		}
+		pageNum := c.Query("pageNum")
+		pageSize := c.Query("pageSize")
+		posts, mediaMap, pageInfo, err := bookmarkService.ListByUserId(c.Request.Context(), modelTokenUser.Id, collectionId, pageNum, pageSize)
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		pageInfo.Data = newPostResponses(posts, mediaMap)
+		c.JSON(http.StatusOK, pageInfo)
+	}
+}
+
+func BookmarkPost(userService services.UserService, followService services.FollowService,
+	postService services.PostService, bookmarkService services.BookmarkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		postIdStr := c.Param("postId")
+		postId, err := strconv.Atoi(postIdStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
+			return
+		}
+		var post models.Post
+		post, err = postService.GetById(c.Request.Context(), postId)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "post not found"})
+			return
+		}
+		if !authorizePostView(c, userService, followService, post, nil) {
+			return
+		}
+		var req BookmarkReq
+		if c.Request.Body != nil && c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+				return
+			}
+		}
+		if req.CollectionId != 0 {
+			collection, err := bookmarkService.GetCollectionById(c.Request.Context(), req.CollectionId)
+			if err != nil {
+				respondError(c, err, errorMessages{services.ErrNotFound: "collection not found"})
+				return
+			}
+			if collection.UserId != modelTokenUser.Id {
+				c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "no permission to use this collection"))
+				return
+			}
+		}
+		if err := bookmarkService.Create(c.Request.Context(), modelTokenUser.Id, postId, req.CollectionId); err != nil {
+			respondError(c, err, errorMessages{services.ErrConflict: "already bookmarked"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "bookmark created successfully"})
+	}
+}
+
+func MoveBookmark(bookmarkService services.BookmarkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		postIdStr := c.Param("postId")
+		postId, err := strconv.Atoi(postIdStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
+			return
+		}
+		var req BookmarkReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+		bookmark, err := bookmarkService.GetByUserIdAndPostId(c.Request.Context(), modelTokenUser.Id, postId)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "bookmark not found"})
+			return
+		}
+		if req.CollectionId != 0 {
+			collection, err := bookmarkService.GetCollectionById(c.Request.Context(), req.CollectionId)
+			if err != nil {
+				respondError(c, err, errorMessages{services.ErrNotFound: "collection not found"})
+				return
+			}
+			if collection.UserId != modelTokenUser.Id {
+				c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "no permission to use this collection"))
+				return
+			}
+		}
+		if err := bookmarkService.UpdateCollection(c.Request.Context(), bookmark.Id, req.CollectionId); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "bookmark updated successfully"})
+	}
+}
+
+func UnbookmarkPost(bookmarkService services.BookmarkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		postIdStr := c.Param("postId")
+		postId, err := strconv.Atoi(postIdStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
+			return
+		}
+		bookmark, err := bookmarkService.GetByUserIdAndPostId(c.Request.Context(), modelTokenUser.Id, postId)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "bookmark not found"})
+			return
+		}
+		if err := bookmarkService.DeleteById(c.Request.Context(), bookmark.Id); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "bookmark deleted successfully"})
+	}
+}
+
+func ReorderBookmarks(bookmarkService services.BookmarkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		var req ReorderBookmarksReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if err := bookmarkService.Reorder(c.Request.Context(), modelTokenUser.Id, req.PostIds); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "bookmarks reordered successfully"})
+	}
+}
+
+func ListCollections(bookmarkService services.BookmarkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		collections, err := bookmarkService.ListCollectionsByUserId(c.Request.Context(), modelTokenUser.Id)
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		collectionResponses := make([]CollectionResponse, len(collections))
+		for i, collection := range collections {
+			collectionResponses[i] = CollectionResponse{
+				Id:        collection.Id,
+				Name:      collection.Name,
+				CreatedAt: collection.CreatedAt.Format("2006-01-02 15:04:05"),
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"collections": collectionResponses})
+	}
+}
+
+func CreateCollection(bookmarkService services.BookmarkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		var req CollectionReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if err := bookmarkService.CreateCollection(c.Request.Context(), modelTokenUser.Id, req.Name); err != nil {
+			respondError(c, err, errorMessages{services.ErrConflict: "collection name already exists"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "collection created successfully"})
+	}
+}
+
+func DeleteCollection(bookmarkService services.BookmarkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		collectionIdStr := c.Param("collectionId")
+		collectionId, err := strconv.Atoi(collectionIdStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid collection id"))
+			return
+		}
+		collection, err := bookmarkService.GetCollectionById(c.Request.Context(), collectionId)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "collection not found"})
+			return
+		}
+		if collection.UserId != modelTokenUser.Id {
+			c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "no permission to delete this collection"))
+			return
+		}
+		if err := bookmarkService.DeleteCollectionById(c.Request.Context(), collectionId); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "collection deleted successfully"})
+	}
+}
+
+func ReorderCollections(bookmarkService services.BookmarkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		var req ReorderCollectionsReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if err := bookmarkService.ReorderCollections(c.Request.Context(), modelTokenUser.Id, req.CollectionIds); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "collections reordered successfully"})
+	}
+}
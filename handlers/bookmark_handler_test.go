@@ -0,0 +1,988 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/handlers"
+	"github.com/ChenSongJian/ginstagram/middlewares"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestListBookmarks_MissingToken(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.ListBookmarks(mockBookmarkService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "user not found in token"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListBookmarks_InvalidCollectionId(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/?collection_id=invalid", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListBookmarks(mockBookmarkService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "invalid collection_id"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListBookmarks_PostWithMedia(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.PostService.UserService.Users["author@test.com"] = models.User{
+		Id: 2,
+	}
+	mockBookmarkService.PostService.Posts[1] = mocks.PostRecord{
+		UserId:  2,
+		Title:   "saved post",
+		Content: "saved post",
+	}
+	mockBookmarkService.PostService.MediaService.Media[1] = mocks.MediaRecord{
+		PostId: 1,
+		Url:    "m0",
+	}
+	mockBookmarkService.Bookmarks[1] = mocks.BookmarkRecord{
+		UserId:   1,
+		PostId:   1,
+		Position: 1,
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListBookmarks(mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":1"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	expectedResponseBodyString = "media\":[{\"url\":\"m0\"}"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListBookmarks_PrivatePostNotFollowing(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.PostService.UserService.Users["author@test.com"] = models.User{
+		Id:        2,
+		IsPrivate: true,
+	}
+	mockBookmarkService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+	mockBookmarkService.Bookmarks[1] = mocks.BookmarkRecord{
+		UserId:   1,
+		PostId:   1,
+		Position: 1,
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListBookmarks(mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":0"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListBookmarks_PrivatePostFollowing(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.PostService.UserService.Users["author@test.com"] = models.User{
+		Id:        2,
+		IsPrivate: true,
+	}
+	mockBookmarkService.PostService.FollowService.Follows[1] = mocks.FollowRecord{
+		FollowerId: 1,
+		FolloweeId: 2,
+	}
+	mockBookmarkService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+	mockBookmarkService.Bookmarks[1] = mocks.BookmarkRecord{
+		UserId:   1,
+		PostId:   1,
+		Position: 1,
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListBookmarks(mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":1"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListBookmarks_FilterCollection(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.PostService.UserService.Users["author@test.com"] = models.User{
+		Id: 2,
+	}
+	mockBookmarkService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+		Title:  "in collection",
+	}
+	mockBookmarkService.PostService.Posts[2] = mocks.PostRecord{
+		UserId: 2,
+		Title:  "not in collection",
+	}
+	mockBookmarkService.Collections[1] = mocks.CollectionRecord{
+		UserId: 1,
+		Name:   "travel",
+	}
+	mockBookmarkService.Bookmarks[1] = mocks.BookmarkRecord{
+		UserId:       1,
+		PostId:       1,
+		CollectionId: 1,
+		Position:     1,
+	}
+	mockBookmarkService.Bookmarks[2] = mocks.BookmarkRecord{
+		UserId:   1,
+		PostId:   2,
+		Position: 2,
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/?collection_id=1", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListBookmarks(mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":1"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	expectedResponseBodyString = "title\":\"in collection"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestBookmarkPost_PostNotFound(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.BookmarkPost(mockBookmarkService.PostService.UserService, mockBookmarkService.PostService.FollowService,
+		mockBookmarkService.PostService, mockBookmarkService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestBookmarkPost_NoPermission(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.PostService.UserService.Users["author@test.com"] = models.User{
+		Id:        2,
+		IsPrivate: true,
+	}
+	mockBookmarkService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.BookmarkPost(mockBookmarkService.PostService.UserService, mockBookmarkService.PostService.FollowService,
+		mockBookmarkService.PostService, mockBookmarkService)(context)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+	expectedResponseBodyString := "post is private and you are not following the author"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestBookmarkPost_OtherUsersCollection(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 1,
+	}
+	mockBookmarkService.Collections[1] = mocks.CollectionRecord{
+		UserId: 2,
+		Name:   "travel",
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"collection_id": 1,
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.BookmarkPost(mockBookmarkService.PostService.UserService, mockBookmarkService.PostService.FollowService,
+		mockBookmarkService.PostService, mockBookmarkService)(context)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+	expectedResponseBodyString := "no permission to use this collection"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestBookmarkPost_Success(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 1,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.BookmarkPost(mockBookmarkService.PostService.UserService, mockBookmarkService.PostService.FollowService,
+		mockBookmarkService.PostService, mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "bookmark created successfully"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockBookmarkService.Bookmarks) != 1 {
+		t.Errorf("Expected 1 bookmark, got %d", len(mockBookmarkService.Bookmarks))
+	}
+}
+
+func TestBookmarkPost_AlreadyBookmarked(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 1,
+	}
+	mockBookmarkService.Bookmarks[1] = mocks.BookmarkRecord{
+		UserId: 1,
+		PostId: 1,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.BookmarkPost(mockBookmarkService.PostService.UserService, mockBookmarkService.PostService.FollowService,
+		mockBookmarkService.PostService, mockBookmarkService)(context)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, response.Code)
+	}
+	expectedResponseBodyString := "already bookmarked"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestMoveBookmark_Success(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.Collections[1] = mocks.CollectionRecord{
+		UserId: 1,
+		Name:   "travel",
+	}
+	mockBookmarkService.Bookmarks[1] = mocks.BookmarkRecord{
+		UserId: 1,
+		PostId: 1,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"collection_id": 1,
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+
+	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.MoveBookmark(mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if mockBookmarkService.Bookmarks[1].CollectionId != 1 {
+		t.Errorf("Expected collection id %d, got %d", 1, mockBookmarkService.Bookmarks[1].CollectionId)
+	}
+}
+
+func TestUnbookmarkPost_NotFound(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.Bookmarks[1] = mocks.BookmarkRecord{
+		UserId: 2,
+		PostId: 1,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("DELETE", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.UnbookmarkPost(mockBookmarkService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "bookmark not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestUnbookmarkPost_Success(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.Bookmarks[1] = mocks.BookmarkRecord{
+		UserId: 1,
+		PostId: 1,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("DELETE", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.UnbookmarkPost(mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if len(mockBookmarkService.Bookmarks) != 0 {
+		t.Errorf("Expected 0 bookmarks, got %d", len(mockBookmarkService.Bookmarks))
+	}
+}
+
+func TestReorderBookmarks_Success(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.Bookmarks[1] = mocks.BookmarkRecord{
+		UserId:   1,
+		PostId:   1,
+		Position: 1,
+	}
+	mockBookmarkService.Bookmarks[2] = mocks.BookmarkRecord{
+		UserId:   1,
+		PostId:   2,
+		Position: 2,
+	}
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"post_ids": []int{1, 2},
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+
+	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ReorderBookmarks(mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if mockBookmarkService.Bookmarks[1].Position <= mockBookmarkService.Bookmarks[2].Position {
+		t.Errorf("Expected post 1 to be ordered before post 2")
+	}
+}
+
+func TestCreateCollection_DuplicateName(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.Collections[1] = mocks.CollectionRecord{
+		UserId: 1,
+		Name:   "travel",
+	}
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"name": "travel",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.CreateCollection(mockBookmarkService)(context)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, response.Code)
+	}
+	expectedResponseBodyString := "collection name already exists"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestCreateCollection_Success(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"name": "travel",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.CreateCollection(mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "collection created successfully"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListCollections_Success(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.Collections[1] = mocks.CollectionRecord{
+		UserId: 1,
+		Name:   "travel",
+	}
+	mockBookmarkService.Collections[2] = mocks.CollectionRecord{
+		UserId: 2,
+		Name:   "food",
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListCollections(mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "name\":\"travel"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	unexpectedResponseBodyString := "name\":\"food"
+	if strings.Contains(response.Body.String(), unexpectedResponseBodyString) {
+		t.Errorf("Expected response body not to contain %s, got %s", unexpectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestDeleteCollection_NoPermission(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.Collections[1] = mocks.CollectionRecord{
+		UserId: 2,
+		Name:   "travel",
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "collectionId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("DELETE", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.DeleteCollection(mockBookmarkService)(context)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+	expectedResponseBodyString := "no permission to delete this collection"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestDeleteCollection_Success(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.Collections[1] = mocks.CollectionRecord{
+		UserId: 1,
+		Name:   "travel",
+	}
+	mockBookmarkService.Bookmarks[1] = mocks.BookmarkRecord{
+		UserId:       1,
+		PostId:       1,
+		CollectionId: 1,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "collectionId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("DELETE", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.DeleteCollection(mockBookmarkService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if mockBookmarkService.Bookmarks[1].CollectionId != 0 {
+		t.Errorf("Expected bookmark to be removed from the collection")
+	}
+}
+
+func TestBookmarkPost_ArchivedPost(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.PostService.UserService.Users["author@test.com"] = models.User{
+		Id: 2,
+	}
+	mockBookmarkService.PostService.Posts[1] = mocks.PostRecord{
+		UserId:     2,
+		IsArchived: true,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.BookmarkPost(mockBookmarkService.PostService.UserService, mockBookmarkService.PostService.FollowService,
+		mockBookmarkService.PostService, mockBookmarkService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockBookmarkService.Bookmarks) != 0 {
+		t.Errorf("Expected no bookmark, got %d", len(mockBookmarkService.Bookmarks))
+	}
+}
+
+func TestBookmarkPost_ShadowBannedAuthor(t *testing.T) {
+	mockBookmarkService := mocks.NewMockBookmarkService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockBookmarkService.PostService.UserService.Users["author@test.com"] = models.User{
+		Id:     2,
+		Status: models.UserStatusShadowBanned,
+	}
+	mockBookmarkService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.BookmarkPost(mockBookmarkService.PostService.UserService, mockBookmarkService.PostService.FollowService,
+		mockBookmarkService.PostService, mockBookmarkService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockBookmarkService.Bookmarks) != 0 {
+		t.Errorf("Expected no bookmark, got %d", len(mockBookmarkService.Bookmarks))
+	}
+}
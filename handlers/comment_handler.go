@@ -4,8 +4,10 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/ChenSongJian/ginstagram/metrics"
 	"github.com/ChenSongJian/ginstagram/models"
 	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -25,51 +27,40 @@ func ListCommentsByPostId(userService services.UserService, followService servic
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		postIdStr := c.Param("postId")
 		postId, err := strconv.Atoi(postIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
 			return
 		}
 		var post models.Post
-		post, err = postService.GetById(postId)
+		post, err = postService.GetById(c.Request.Context(), postId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
-				return
-			}
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		if post.UserId != modelTokenUser.Id {
-			var author models.User
-			author, _ = userService.GetById(post.UserId)
-			if author.IsPrivate {
-				if !followService.IsFollowing(modelTokenUser.Id, author.Id) {
-					c.JSON(http.StatusForbidden, gin.H{"error": "post is private and you are not following the author"})
-					return
-				}
-			}
+			respondError(c, err, errorMessages{services.ErrNotFound: "post not found"})
+			return
+		}
+		if !authorizePostView(c, userService, followService, post, nil) {
+			return
 		}
 		pageNum := c.Query("pageNum")
 		pageSize := c.Query("pageSize")
-		comments, pageInfo, err := commentService.ListByPostId(postId, pageNum, pageSize)
+		comments, pageInfo, err := commentService.ListByPostId(c.Request.Context(), postId, modelTokenUser.Id, pageNum, pageSize)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, nil)
 			return
 		}
 		commentResponses := make([]CommentResponse, 0)
 		for _, comment := range comments {
 			var user models.User
-			user, _ = userService.GetById(comment.UserId)
+			user, _ = userService.GetById(c.Request.Context(), comment.UserId)
 			commentResponses = append(commentResponses, CommentResponse{
 				Id:        comment.Id,
 				Content:   comment.Content,
@@ -87,50 +78,40 @@ func CreateComment(userService services.UserService, followService services.Foll
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		postIdStr := c.Param("postId")
 		postId, err := strconv.Atoi(postIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
 			return
 		}
 
 		var post models.Post
-		post, err = postService.GetById(postId)
+		post, err = postService.GetById(c.Request.Context(), postId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "post not found"})
-				return
-			}
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		if post.UserId != modelTokenUser.Id {
-			var author models.User
-			author, _ = userService.GetById(post.UserId)
-			if author.IsPrivate {
-				if !followService.IsFollowing(modelTokenUser.Id, author.Id) {
-					c.JSON(http.StatusForbidden, gin.H{"error": "post is private and you are not following the author"})
-					return
-				}
-			}
+			respondError(c, err, errorMessages{services.ErrNotFound: "post not found"})
+			return
+		}
+		if !authorizePostView(c, userService, followService, post, nil) {
+			return
 		}
 		var req CommentReq
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
 			return
 		}
-		if err := commentService.Create(postId, modelTokenUser.Id, req.Content); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := commentService.Create(c.Request.Context(), postId, modelTokenUser.Id, req.Content); err != nil {
+			respondError(c, err, nil)
 			return
 		}
+		metrics.CommentsCreated.Inc()
 		c.JSON(http.StatusOK, gin.H{"message": "comment created successfully"})
 	}
 }
@@ -140,41 +121,37 @@ func DeleteComment(userService services.UserService, followService services.Foll
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		postIdStr := c.Param("postId")
 		_, err := strconv.Atoi(postIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
 			return
 		}
 		commentIdStr := c.Param("commentId")
 		commentId, err := strconv.Atoi(commentIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid comment id"))
 			return
 		}
-		comment, err := commentService.GetById(commentId)
+		comment, err := commentService.GetById(c.Request.Context(), commentId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
-				return
-			}
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "comment not found"})
 			return
 		}
 		if comment.UserId != modelTokenUser.Id {
-			c.JSON(http.StatusForbidden, gin.H{"error": "you are not the author of the comment"})
+			c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "you are not the author of the comment"))
 			return
 		}
-		if err := commentService.DeleteById(commentId); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := commentService.DeleteById(c.Request.Context(), commentId); err != nil {
+			respondError(c, err, nil)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"message": "comment deleted successfully"})
@@ -44,7 +44,7 @@ func TestListComment_InvalidPostId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -60,7 +60,7 @@ func TestListComment_InvalidPostId(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListCommentsByPostId(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -82,7 +82,7 @@ func TestListComment_PostNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -98,7 +98,7 @@ func TestListComment_PostNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListCommentsByPostId(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusNotFound {
@@ -120,7 +120,7 @@ func TestListComment_NoPermission(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -143,7 +143,7 @@ func TestListComment_NoPermission(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListCommentsByPostId(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusForbidden {
@@ -165,7 +165,7 @@ func TestListComment_SuccessOwnPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -190,7 +190,7 @@ func TestListComment_SuccessOwnPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListCommentsByPostId(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusOK {
@@ -212,7 +212,7 @@ func TestListComment_SuccessPublicPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -241,7 +241,7 @@ func TestListComment_SuccessPublicPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListCommentsByPostId(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusOK {
@@ -263,7 +263,7 @@ func TestListComment_SuccessFollowingPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -296,7 +296,7 @@ func TestListComment_SuccessFollowingPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListCommentsByPostId(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusOK {
@@ -318,7 +318,7 @@ func TestListComment_SuccessPagination(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -351,7 +351,7 @@ func TestListComment_SuccessPagination(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/?pageSize=1&pageNum=2", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListCommentsByPostId(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusOK {
@@ -395,7 +395,7 @@ func TestCreateComment_InvalidPostId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -411,7 +411,7 @@ func TestCreateComment_InvalidPostId(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreateComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -433,7 +433,7 @@ func TestCreateComment_PostNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -449,11 +449,11 @@ func TestCreateComment_PostNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreateComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
 	}
 	expectedResponseBodyString := "post not found"
 	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
@@ -471,7 +471,7 @@ func TestCreateComment_NoPermission(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -495,7 +495,7 @@ func TestCreateComment_NoPermission(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreateComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusForbidden {
@@ -517,7 +517,7 @@ func TestCreateComment_MissingRequiredField(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -542,7 +542,7 @@ func TestCreateComment_MissingRequiredField(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreateComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -564,7 +564,7 @@ func TestCreateComment_SuccessOwnPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -591,7 +591,7 @@ func TestCreateComment_SuccessOwnPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreateComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusOK {
@@ -629,7 +629,7 @@ func TestCreateComment_SuccessPublicPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -660,7 +660,7 @@ func TestCreateComment_SuccessPublicPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreateComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusOK {
@@ -698,7 +698,7 @@ func TestCreateComment_SuccessFollowingPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -733,7 +733,7 @@ func TestCreateComment_SuccessFollowingPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreateComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusOK {
@@ -789,7 +789,7 @@ func TestDeleteComment_InvalidPostId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -809,7 +809,7 @@ func TestDeleteComment_InvalidPostId(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeleteComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -831,7 +831,7 @@ func TestDeleteComment_InvalidCommentId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -851,7 +851,7 @@ func TestDeleteComment_InvalidCommentId(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeleteComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -873,7 +873,7 @@ func TestDeleteComment_CommentNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -893,7 +893,7 @@ func TestDeleteComment_CommentNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeleteComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusNotFound {
@@ -915,7 +915,7 @@ func TestDeleteComment_NoPermission(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -939,7 +939,7 @@ func TestDeleteComment_NoPermission(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeleteComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusForbidden {
@@ -961,7 +961,7 @@ func TestDeleteComment_Success(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -985,7 +985,7 @@ func TestDeleteComment_Success(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeleteComment(mockCommentService.UserService, mockCommentService.FollowService,
 		mockCommentService.PostService, mockCommentService)(context)
 	if response.Code != http.StatusOK {
@@ -995,3 +995,246 @@ func TestDeleteComment_Success(t *testing.T) {
 		t.Errorf("Comment not deleted")
 	}
 }
+
+func TestListComment_HideShadowBannedCommenter(t *testing.T) {
+	mockCommentService := mocks.NewMockCommentService()
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockCommentService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 1,
+	}
+	mockCommentService.UserService.Users["test@email.com"] = models.User{
+		Id:     2,
+		Status: models.UserStatusShadowBanned,
+	}
+	mockCommentService.Comments[1] = mocks.CommentRecord{
+		PostId: 1,
+		UserId: 1,
+	}
+	mockCommentService.Comments[2] = mocks.CommentRecord{
+		PostId: 1,
+		UserId: 2,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListCommentsByPostId(mockCommentService.UserService, mockCommentService.FollowService,
+		mockCommentService.PostService, mockCommentService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":1"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListComment_ArchivedPost(t *testing.T) {
+	mockCommentService := mocks.NewMockCommentService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockCommentService.UserService.Users["author@test.com"] = models.User{
+		Id: 2,
+	}
+	mockCommentService.PostService.Posts[1] = mocks.PostRecord{
+		UserId:     2,
+		IsArchived: true,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListCommentsByPostId(mockCommentService.UserService, mockCommentService.FollowService,
+		mockCommentService.PostService, mockCommentService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestCreateComment_ArchivedPost(t *testing.T) {
+	mockCommentService := mocks.NewMockCommentService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockCommentService.UserService.Users["author@test.com"] = models.User{
+		Id: 2,
+	}
+	mockCommentService.PostService.Posts[1] = mocks.PostRecord{
+		UserId:     2,
+		IsArchived: true,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", strings.NewReader(`{"content": "hidden"}`))
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.CreateComment(mockCommentService.UserService, mockCommentService.FollowService,
+		mockCommentService.PostService, mockCommentService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockCommentService.Comments) != 0 {
+		t.Errorf("Expected no comment, got %d", len(mockCommentService.Comments))
+	}
+}
+
+func TestListComment_ShadowBannedAuthor(t *testing.T) {
+	mockCommentService := mocks.NewMockCommentService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockCommentService.UserService.Users["author@test.com"] = models.User{
+		Id:     2,
+		Status: models.UserStatusShadowBanned,
+	}
+	mockCommentService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListCommentsByPostId(mockCommentService.UserService, mockCommentService.FollowService,
+		mockCommentService.PostService, mockCommentService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestCreateComment_ShadowBannedAuthor(t *testing.T) {
+	mockCommentService := mocks.NewMockCommentService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockCommentService.UserService.Users["author@test.com"] = models.User{
+		Id:     2,
+		Status: models.UserStatusShadowBanned,
+	}
+	mockCommentService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", strings.NewReader(`{"content": "hidden"}`))
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.CreateComment(mockCommentService.UserService, mockCommentService.FollowService,
+		mockCommentService.PostService, mockCommentService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockCommentService.Comments) != 0 {
+		t.Errorf("Expected no comment, got %d", len(mockCommentService.Comments))
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// errorMessages are the messages to respond to service errors of each kind
+// with, in place of the kind's own.
+type errorMessages map[error]string
+
+var errorStatuses = []struct {
+	kind   error
+	status int
+}{
+	{services.ErrNotFound, http.StatusNotFound},
+	{services.ErrConflict, http.StatusConflict},
+	{services.ErrForbidden, http.StatusForbidden},
+	{services.ErrValidation, http.StatusBadRequest},
+}
+
+// respondError responds to an error a service failed with. An error of a known
+// kind gets the status of its kind and the message given for it; any other
+// error is an internal one, whose details are kept out of the response and
+// added to the context for logging.
+func respondError(c *gin.Context, err error, messages errorMessages) {
+	for _, errorStatus := range errorStatuses {
+		if errors.Is(err, errorStatus.kind) {
+			message, ok := messages[errorStatus.kind]
+			if !ok {
+				message = errorStatus.kind.Error()
+			}
+			c.AbortWithStatusJSON(errorStatus.status, utils.NewErrorResponse(errorStatus.status, message))
+			return
+		}
+	}
+	c.Error(err)
+	c.AbortWithStatusJSON(http.StatusInternalServerError, utils.NewErrorResponse(http.StatusInternalServerError, "internal server error"))
+}
@@ -3,10 +3,11 @@ package handlers
 import (
 	"net/http"
 	"strconv"
-	"strings"
 
+	"github.com/ChenSongJian/ginstagram/metrics"
 	"github.com/ChenSongJian/ginstagram/models"
 	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -25,7 +26,7 @@ func ListFollows(followService services.FollowService) gin.HandlerFunc {
 		followerIdStr := c.Query("follower_id")
 		followeeIdStr := c.Query("followee_id")
 		if (followerIdStr == "" && followeeIdStr == "") || (followerIdStr != "" && followeeIdStr != "") {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Either provide follower_id or followee_id, but not both and not neither."})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "Either provide follower_id or followee_id, but not both and not neither."))
 			return
 		}
 		var follows = make([]models.Follow, 0)
@@ -33,12 +34,12 @@ func ListFollows(followService services.FollowService) gin.HandlerFunc {
 			var followerId int
 			followerId, err := strconv.Atoi(followerIdStr)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid follower_id"})
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid follower_id"))
 				return
 			}
-			follows, err = followService.GetByFollowerId(followerId)
+			follows, err = followService.GetByFollowerId(c.Request.Context(), followerId)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				respondError(c, err, nil)
 				return
 			}
 		}
@@ -46,12 +47,12 @@ func ListFollows(followService services.FollowService) gin.HandlerFunc {
 			var followeeId int
 			followeeId, err := strconv.Atoi(followeeIdStr)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid followee_id"})
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid followee_id"))
 				return
 			}
-			follows, err = followService.GetByFolloweeId(followeeId)
+			follows, err = followService.GetByFolloweeId(c.Request.Context(), followeeId)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				respondError(c, err, nil)
 				return
 			}
 		}
@@ -63,35 +64,32 @@ func FollowUser(followService services.FollowService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		var req FollowUserReq
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
 			return
 		}
 		if req.UserId == modelTokenUser.Id {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "can not follow yourself"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "can not follow yourself"))
 			return
 		}
-		if err := followService.Create(modelTokenUser.Id, req.UserId); err != nil {
-			if strings.Contains(err.Error(), "violates foreign key constraint \"fk_user\"") {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
-				return
-			}
-			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "already following"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := followService.Create(c.Request.Context(), modelTokenUser.Id, req.UserId); err != nil {
+			respondError(c, err, errorMessages{
+				services.ErrNotFound:   "user not found",
+				services.ErrConflict:   "already following",
+				services.ErrValidation: "can not follow yourself",
+			})
 			return
 		}
+		metrics.FollowsCreated.Inc()
 		c.JSON(http.StatusOK, gin.H{"message": "follow user success"})
 	}
 }
@@ -100,32 +98,32 @@ func UnfollowUser(followService services.FollowService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		followIdStr := c.Param("followId")
 		followId, err := strconv.Atoi(followIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid follow id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid follow id"))
 			return
 		}
-		follow, err := followService.GetById(followId)
+		follow, err := followService.GetById(c.Request.Context(), followId)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "follow not found"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "follow not found"))
 			return
 		}
 		if follow.FollowerId != modelTokenUser.Id {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "not follower"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "not follower"))
 			return
 		}
 
-		if err := followService.Delete(followId); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := followService.Delete(c.Request.Context(), followId); err != nil {
+			respondError(c, err, nil)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"message": "unfollow user success"})
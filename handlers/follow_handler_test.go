@@ -182,7 +182,7 @@ func TestFollowUser_MissingRequiredField(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -194,7 +194,7 @@ func TestFollowUser_MissingRequiredField(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.FollowUser(mockFollowService)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
@@ -215,7 +215,7 @@ func TestFollowUser_FollowSelf(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -229,7 +229,7 @@ func TestFollowUser_FollowSelf(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.FollowUser(mockFollowService)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
@@ -250,7 +250,7 @@ func TestFollowUser_UserNotExists(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -264,10 +264,10 @@ func TestFollowUser_UserNotExists(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.FollowUser(mockFollowService)(context)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
 	}
 	expectedResponseBodyString := "user not found"
 	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
@@ -300,7 +300,7 @@ func TestFollowUser_AlreadyFollowing(t *testing.T) {
 	}
 
 	mockFollowService.Follows[1] = record
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -314,10 +314,10 @@ func TestFollowUser_AlreadyFollowing(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.FollowUser(mockFollowService)(context)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, response.Code)
 	}
 	expectedResponseBodyString := "already following"
 	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
@@ -343,7 +343,7 @@ func TestFollowUser_Success(t *testing.T) {
 		Email:    "test2@test.com",
 	}
 	mockFollowService.UserService.Users[testUser2.Email] = testUser2
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -357,7 +357,7 @@ func TestFollowUser_Success(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.FollowUser(mockFollowService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -405,7 +405,7 @@ func TestUnfollowUser_InvalidFollowId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -419,7 +419,7 @@ func TestUnfollowUser_InvalidFollowId(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnfollowUser(mockFollowService)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
@@ -439,7 +439,7 @@ func TestUnfollowUser_FollowNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -453,7 +453,7 @@ func TestUnfollowUser_FollowNotFound(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnfollowUser(mockFollowService)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
@@ -473,7 +473,7 @@ func TestUnfollowUser_NotFollower(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -491,7 +491,7 @@ func TestUnfollowUser_NotFollower(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnfollowUser(mockFollowService)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
@@ -511,7 +511,7 @@ func TestUnfollowUser_Success(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -529,7 +529,7 @@ func TestUnfollowUser_Success(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnfollowUser(mockFollowService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
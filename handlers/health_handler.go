@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ChenSongJian/ginstagram/health"
+	"github.com/gin-gonic/gin"
+)
+
+// Liveness reports that the process is up and serving. It checks nothing
+// else, a server that lost its database should not be restarted for it.
+func Liveness() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+	}
+}
+
+// Readiness runs the checks of checker and reports each of them, with
+// 503 Service Unavailable unless all pass and the server is not shutting
+// down.
+func Readiness(checker *health.Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checker.Run(c.Request.Context())
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
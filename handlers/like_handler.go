@@ -3,10 +3,11 @@ package handlers
 import (
 	"net/http"
 	"strconv"
-	"strings"
 
+	"github.com/ChenSongJian/ginstagram/metrics"
 	"github.com/ChenSongJian/ginstagram/models"
 	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -20,44 +21,33 @@ func ListLikesByPostId(userService services.UserService, followService services.
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		postIdStr := c.Param("postId")
 		postId, err := strconv.Atoi(postIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
 			return
 		}
 		var post models.Post
-		post, err = postService.GetById(postId)
+		post, err = postService.GetById(c.Request.Context(), postId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
-				return
-			}
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "post not found"})
 			return
 		}
-		if post.UserId != modelTokenUser.Id {
-			var author models.User
-			author, _ = userService.GetById(post.UserId)
-			if author.IsPrivate {
-				if !followService.IsFollowing(modelTokenUser.Id, author.Id) {
-					c.JSON(http.StatusForbidden, gin.H{"error": "post is private and you are not following the author"})
-					return
-				}
-			}
+		if !authorizePostView(c, userService, followService, post, nil) {
+			return
 		}
 		var likes []models.PostLike
-		likes, err = likeService.ListPostLikesByPostId(postId)
+		likes, err = likeService.ListPostLikesByPostId(c.Request.Context(), postId, modelTokenUser.Id)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
 			return
 		}
 		likeResponses := make([]LikeResponse, len(likes))
@@ -76,54 +66,35 @@ func LikePost(userService services.UserService, followService services.FollowSer
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		postIdStr := c.Param("postId")
 		postId, err := strconv.Atoi(postIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
 			return
 		}
 		var post models.Post
-		post, err = postService.GetById(postId)
+		post, err = postService.GetById(c.Request.Context(), postId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
-				return
-			}
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "post not found"})
 			return
 		}
-		if post.UserId != modelTokenUser.Id {
-			var author models.User
-			author, _ = userService.GetById(post.UserId)
-			if author.IsPrivate {
-				if !followService.IsFollowing(modelTokenUser.Id, author.Id) {
-					c.JSON(http.StatusForbidden, gin.H{"error": "post is private and you are not following the author"})
-					return
-				}
-			}
+		if !authorizePostView(c, userService, followService, post, nil) {
+			return
 		}
-		if err := likeService.CreatePostLike(postId, modelTokenUser.Id); err != nil {
-			if strings.Contains(err.Error(), "violates unique constraint \"unique_post_user_pair\"") {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "already liked"})
-				return
-			}
-			if strings.Contains(err.Error(), "violates foreign key constraint \"post_likes_user_id_fkey\"") {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := likeService.CreatePostLike(c.Request.Context(), postId, modelTokenUser.Id); err != nil {
+			respondError(c, err, errorMessages{services.ErrConflict: "already liked", services.ErrNotFound: "user not found"})
 			return
 		}
+		metrics.LikesCreated.WithLabelValues(metrics.LikePost).Inc()
 		c.JSON(http.StatusOK, gin.H{"message": "like created successfully"})
-
 	}
 }
 
@@ -132,36 +103,32 @@ func UnlikePost(userService services.UserService, followService services.FollowS
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		postLikeIdStr := c.Param("postLikeId")
 		postLikeId, err := strconv.Atoi(postLikeIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post like id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post like id"))
 			return
 		}
 		var postLike models.PostLike
-		postLike, err = likeService.GetByPostLikeId(postLikeId)
+		postLike, err = likeService.GetByPostLikeId(c.Request.Context(), postLikeId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "post like not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "post like not found"})
 			return
 		}
 		if postLike.UserId != modelTokenUser.Id {
-			c.JSON(http.StatusForbidden, gin.H{"error": "no permission to unlike"})
+			c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "no permission to unlike"))
 			return
 		}
-		if err := likeService.DeletePostLikeById(postLikeId); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := likeService.DeletePostLikeById(c.Request.Context(), postLikeId); err != nil {
+			respondError(c, err, nil)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"message": "like deleted successfully"})
@@ -174,71 +141,49 @@ func LikeComment(userService services.UserService, followService services.Follow
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		postIdStr := c.Param("postId")
 		postId, err := strconv.Atoi(postIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
 			return
 		}
 		var post models.Post
-		post, err = postService.GetById(postId)
+		post, err = postService.GetById(c.Request.Context(), postId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
-				return
-			}
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "post not found"})
 			return
 		}
-		if post.UserId != modelTokenUser.Id {
-			var author models.User
-			author, _ = userService.GetById(post.UserId)
-			if author.IsPrivate {
-				if !followService.IsFollowing(modelTokenUser.Id, author.Id) {
-					c.JSON(http.StatusForbidden, gin.H{"error": "post is private and you are not following the author"})
-					return
-				}
-			}
+		if !authorizePostView(c, userService, followService, post, nil) {
+			return
 		}
 		commentIdStr := c.Param("commentId")
 		commentId, err := strconv.Atoi(commentIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid comment id"))
 			return
 		}
-		comment, err := commentService.GetById(commentId)
+		comment, err := commentService.GetById(c.Request.Context(), commentId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
-				return
-			}
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "comment not found"})
 			return
 		}
 		if comment.PostId != postId {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "comment does not belong to the post"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "comment does not belong to the post"))
 			return
 		}
-		if err := likeService.CreateCommentLike(commentId, modelTokenUser.Id); err != nil {
-			if strings.Contains(err.Error(), "violates unique constraint \"unique_comment_user_pair\"") {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "already liked"})
-				return
-			}
-			if strings.Contains(err.Error(), "violates foreign key constraint \"comment_likes_user_id_fkey\"") {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := likeService.CreateCommentLike(c.Request.Context(), commentId, modelTokenUser.Id); err != nil {
+			respondError(c, err, errorMessages{services.ErrConflict: "already liked", services.ErrNotFound: "user not found"})
 			return
 		}
+		metrics.LikesCreated.WithLabelValues(metrics.LikeComment).Inc()
 		c.JSON(http.StatusOK, gin.H{"message": "like created successfully"})
 	}
 }
@@ -248,36 +193,32 @@ func UnlikeComment(userService services.UserService, followService services.Foll
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		commentLikeIdStr := c.Param("commentLikeId")
 		commentLikeId, err := strconv.Atoi(commentLikeIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post like id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post like id"))
 			return
 		}
 		var commentLike models.CommentLike
-		commentLike, err = likeService.GetByCommentLikeId(commentLikeId)
+		commentLike, err = likeService.GetByCommentLikeId(c.Request.Context(), commentLikeId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "comment like not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "comment like not found"})
 			return
 		}
 		if commentLike.UserId != modelTokenUser.Id {
-			c.JSON(http.StatusForbidden, gin.H{"error": "no permission to unlike"})
+			c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "no permission to unlike"))
 			return
 		}
-		if err := likeService.DeleteCommentLikeById(commentLikeId); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := likeService.DeleteCommentLikeById(c.Request.Context(), commentLikeId); err != nil {
+			respondError(c, err, nil)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"message": "like deleted successfully"})
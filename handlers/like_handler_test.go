@@ -43,7 +43,7 @@ func TestListLikeByPostId_InvalidPostId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -59,7 +59,7 @@ func TestListLikeByPostId_InvalidPostId(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListLikesByPostId(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -82,7 +82,7 @@ func TestListLikeByPostId_PostNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -98,7 +98,7 @@ func TestListLikeByPostId_PostNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListLikesByPostId(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusNotFound {
@@ -121,7 +121,7 @@ func TestListLikeByPostId_NoPermission(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -144,7 +144,7 @@ func TestListLikeByPostId_NoPermission(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListLikesByPostId(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusForbidden {
@@ -167,7 +167,7 @@ func TestListLikeByPostId_SuccessOwnPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -190,7 +190,7 @@ func TestListLikeByPostId_SuccessOwnPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListLikesByPostId(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -216,7 +216,7 @@ func TestListLikeByPostId_SuccessPublicPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -243,7 +243,7 @@ func TestListLikeByPostId_SuccessPublicPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListLikesByPostId(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -269,7 +269,7 @@ func TestListLikeByPostId_SuccessPrivateFollowingPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -300,7 +300,7 @@ func TestListLikeByPostId_SuccessPrivateFollowingPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListLikesByPostId(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -345,7 +345,7 @@ func TestLikePost_InvalidPostId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -361,7 +361,7 @@ func TestLikePost_InvalidPostId(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -384,7 +384,7 @@ func TestLikePost_PostNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -400,7 +400,7 @@ func TestLikePost_PostNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusNotFound {
@@ -423,7 +423,7 @@ func TestLikePost_UserNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -442,7 +442,7 @@ func TestLikePost_UserNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusNotFound {
@@ -465,7 +465,7 @@ func TestLikePost_NoPermission(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -488,7 +488,7 @@ func TestLikePost_NoPermission(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusForbidden {
@@ -511,7 +511,7 @@ func TestLikePost_SuccessOwnPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -531,7 +531,7 @@ func TestLikePost_SuccessOwnPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -556,7 +556,7 @@ func TestLikePost_SuccessPublicPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -580,7 +580,7 @@ func TestLikePost_SuccessPublicPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -605,7 +605,7 @@ func TestLikePost_SuccessPrivateFollowingPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -633,7 +633,7 @@ func TestLikePost_SuccessPrivateFollowingPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -658,7 +658,7 @@ func TestLikePost_DuplicatedLike(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -690,11 +690,11 @@ func TestLikePost_DuplicatedLike(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, response.Code)
 	}
 	expectedResponseBodyString := "already liked"
 	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
@@ -732,7 +732,7 @@ func TestUnlikePost_InvalidPostLikeId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -748,7 +748,7 @@ func TestUnlikePost_InvalidPostLikeId(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnlikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -771,7 +771,7 @@ func TestUnlikePost_PostLikeNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -787,7 +787,7 @@ func TestUnlikePost_PostLikeNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnlikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusNotFound {
@@ -810,7 +810,7 @@ func TestUnlikePost_NoPermission(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -830,7 +830,7 @@ func TestUnlikePost_NoPermission(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnlikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusForbidden {
@@ -853,7 +853,7 @@ func TestUnlikePost_Success(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -873,7 +873,7 @@ func TestUnlikePost_Success(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnlikePost(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -914,7 +914,7 @@ func TestLikeComment_InvalidPostId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -930,7 +930,7 @@ func TestLikeComment_InvalidPostId(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -953,7 +953,7 @@ func TestLikeComment_PostNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -969,7 +969,7 @@ func TestLikeComment_PostNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusNotFound {
@@ -992,7 +992,7 @@ func TestLikeComment_NoPermission(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1015,7 +1015,7 @@ func TestLikeComment_NoPermission(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusForbidden {
@@ -1038,7 +1038,7 @@ func TestLikeComment_InvalidCommentId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1061,7 +1061,7 @@ func TestLikeComment_InvalidCommentId(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -1084,7 +1084,7 @@ func TestLikeComment_CommentNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1107,7 +1107,7 @@ func TestLikeComment_CommentNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusNotFound {
@@ -1130,7 +1130,7 @@ func TestLikeComment_UserNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1157,7 +1157,7 @@ func TestLikeComment_UserNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusNotFound {
@@ -1180,7 +1180,7 @@ func TestLikeComment_CommentNotBelongToPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1206,7 +1206,7 @@ func TestLikeComment_CommentNotBelongToPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -1229,7 +1229,7 @@ func TestLikeComment_SuccessOwnPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1256,7 +1256,7 @@ func TestLikeComment_SuccessOwnPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -1278,7 +1278,7 @@ func TestLikeComment_SuccessPublicPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1309,7 +1309,7 @@ func TestLikeComment_SuccessPublicPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -1331,7 +1331,7 @@ func TestLikeComment_SuccessPrivateFollowingPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1366,7 +1366,7 @@ func TestLikeComment_SuccessPrivateFollowingPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -1388,7 +1388,7 @@ func TestLikeComment_DuplicatedLike(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1427,11 +1427,11 @@ func TestLikeComment_DuplicatedLike(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, response.Code)
 	}
 	expectedResponseBodyString := "already like"
 	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
@@ -1469,7 +1469,7 @@ func TestUnlikeComment_InvalidPostLikeId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1485,7 +1485,7 @@ func TestUnlikeComment_InvalidPostLikeId(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnlikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusBadRequest {
@@ -1508,7 +1508,7 @@ func TestUnlikeComment_PostLikeNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1524,7 +1524,7 @@ func TestUnlikeComment_PostLikeNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnlikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusNotFound {
@@ -1547,7 +1547,7 @@ func TestUnlikeComment_NoPermission(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1567,7 +1567,7 @@ func TestUnlikeComment_NoPermission(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnlikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusForbidden {
@@ -1590,7 +1590,7 @@ func TestUnlikeComment_Success(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1610,7 +1610,7 @@ func TestUnlikeComment_Success(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.UnlikeComment(mockLikeService.UserService, mockLikeService.FollowService,
 		mockLikeService.CommentService, mockLikeService)(context)
 	if response.Code != http.StatusOK {
@@ -1620,3 +1620,354 @@ func TestUnlikeComment_Success(t *testing.T) {
 		t.Errorf("Post like not deleted")
 	}
 }
+
+func TestListLikeByPostId_ArchivedPost(t *testing.T) {
+	mockLikeService := mocks.NewMockLikeService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockLikeService.UserService.Users["author@test.com"] = models.User{
+		Id: 2,
+	}
+	mockLikeService.PostService.Posts[1] = mocks.PostRecord{
+		UserId:     2,
+		IsArchived: true,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListLikesByPostId(mockLikeService.UserService, mockLikeService.FollowService,
+		mockLikeService.PostService, mockLikeService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestLikePost_ArchivedPost(t *testing.T) {
+	mockLikeService := mocks.NewMockLikeService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockLikeService.UserService.Users["author@test.com"] = models.User{
+		Id: 2,
+	}
+	mockLikeService.PostService.Posts[1] = mocks.PostRecord{
+		UserId:     2,
+		IsArchived: true,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.LikePost(mockLikeService.UserService, mockLikeService.FollowService,
+		mockLikeService.PostService, mockLikeService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockLikeService.PostLikes) != 0 {
+		t.Errorf("Expected no like, got %d", len(mockLikeService.PostLikes))
+	}
+}
+
+func TestLikeComment_ArchivedPost(t *testing.T) {
+	mockLikeService := mocks.NewMockLikeService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockLikeService.UserService.Users["author@test.com"] = models.User{
+		Id: 2,
+	}
+	mockLikeService.PostService.Posts[1] = mocks.PostRecord{
+		UserId:     2,
+		IsArchived: true,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+		{
+			Key:   "commentId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
+		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListLikeByPostId_ShadowBannedAuthor(t *testing.T) {
+	mockLikeService := mocks.NewMockLikeService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockLikeService.UserService.Users["author@test.com"] = models.User{
+		Id:     2,
+		Status: models.UserStatusShadowBanned,
+	}
+	mockLikeService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListLikesByPostId(mockLikeService.UserService, mockLikeService.FollowService,
+		mockLikeService.PostService, mockLikeService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestLikePost_ShadowBannedAuthor(t *testing.T) {
+	mockLikeService := mocks.NewMockLikeService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockLikeService.UserService.Users["author@test.com"] = models.User{
+		Id:     2,
+		Status: models.UserStatusShadowBanned,
+	}
+	mockLikeService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.LikePost(mockLikeService.UserService, mockLikeService.FollowService,
+		mockLikeService.PostService, mockLikeService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockLikeService.PostLikes) != 0 {
+		t.Errorf("Expected no like, got %d", len(mockLikeService.PostLikes))
+	}
+}
+
+func TestLikeComment_ShadowBannedAuthor(t *testing.T) {
+	mockLikeService := mocks.NewMockLikeService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockLikeService.UserService.Users["author@test.com"] = models.User{
+		Id:     2,
+		Status: models.UserStatusShadowBanned,
+	}
+	mockLikeService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+		{
+			Key:   "commentId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.LikeComment(mockLikeService.UserService, mockLikeService.FollowService,
+		mockLikeService.PostService, mockLikeService.CommentService, mockLikeService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListLikeByPostId_HideShadowBannedLiker(t *testing.T) {
+	mockLikeService := mocks.NewMockLikeService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockLikeService.UserService.Users["test@test.com"] = testUser
+	mockLikeService.UserService.Users["banned@test.com"] = models.User{
+		Id:     2,
+		Status: models.UserStatusShadowBanned,
+	}
+	mockLikeService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 1,
+	}
+	mockLikeService.PostLikes[1] = mocks.PostLikeRecord{
+		UserId: 2,
+		PostId: 1,
+	}
+	mockLikeService.PostLikes[2] = mocks.PostLikeRecord{
+		UserId: 1,
+		PostId: 1,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListLikesByPostId(mockLikeService.UserService, mockLikeService.FollowService,
+		mockLikeService.PostService, mockLikeService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	var body struct {
+		Likes []handlers.LikeResponse `json:"likes"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Errorf("Error unmarshaling response body: %v", err)
+		return
+	}
+	if len(body.Likes) != 1 || body.Likes[0].UserId != 1 {
+		t.Errorf("Expected only the like of user 1, got %+v", body.Likes)
+	}
+}
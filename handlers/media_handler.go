@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/middlewares"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const signedMediaUrlExpiry = 15 * time.Minute
+
+// authorizeMediaView checks that the caller may see the media stored under key.
+// Only keys of media rows, and of the variants and renditions made of them,
+// are ever served. Media attached to a post follows the visibility of that
+// post, profile images are public and uploads not attached yet may only be
+// seen by their uploader. Identical uploads share one file, which may be seen
+// by anyone who may see one of the posts it is attached to. It returns whether
+// the caller may see the media, having written the error response if not,
+// and whether it is public.
+func authorizeMediaView(c *gin.Context, userService services.UserService, followService services.FollowService,
+	postService services.PostService, mediaService services.MediaService, key string, authenticate gin.HandlerFunc) (bool, bool) {
+	if !storage.IsUploadKey(key) {
+		c.JSON(http.StatusNotFound, utils.NewErrorResponse(http.StatusNotFound, "media not found"))
+		return false, false
+	}
+	media, err := mediaService.ListByKey(c.Request.Context(), key)
+	if err != nil {
+		respondError(c, err, nil)
+		return false, false
+	}
+	if len(media) == 0 {
+		c.JSON(http.StatusNotFound, utils.NewErrorResponse(http.StatusNotFound, "media not found"))
+		return false, false
+	}
+	var posts []models.Post
+	var uploaderIds []int
+	for _, m := range media {
+		if m.PostId == 0 {
+			// not posted yet, so only its uploader may see it
+			uploaderIds = append(uploaderIds, m.UserId)
+			continue
+		}
+		post, err := postService.GetById(c.Request.Context(), m.PostId)
+		if err != nil {
+			if errors.Is(err, services.ErrNotFound) {
+				continue
+			}
+			respondError(c, err, nil)
+			return false, false
+		}
+		author, _ := userService.GetById(c.Request.Context(), post.UserId)
+		if !author.IsPrivate && author.Status != models.UserStatusShadowBanned && !post.IsArchived {
+			return true, true
+		}
+		posts = append(posts, post)
+	}
+	if len(posts) == 0 {
+		mediaIds := make([]int, len(media))
+		for i, m := range media {
+			mediaIds[i] = m.Id
+		}
+		// with every media row ignored, only a profile image still refers to it
+		referenced, err := mediaService.ReferencedKeys(c.Request.Context(), []string{key}, mediaIds)
+		if err != nil {
+			respondError(c, err, nil)
+			return false, false
+		}
+		if referenced[key] {
+			return true, true
+		}
+	}
+	// only the last post writes an error response, the others and the
+	// uploaders are checked quietly against the authenticated caller
+	if (len(posts) > 1 || len(uploaderIds) > 0) && c.GetHeader("Authorization") != "" {
+		if _, exists := c.Get("tokenUser"); !exists && authenticate != nil {
+			authenticate(c)
+			if c.IsAborted() {
+				return false, false
+			}
+		}
+		if tokenUser, ok := c.Get("tokenUser"); ok {
+			if modelTokenUser, ok := tokenUser.(models.User); ok {
+				if utils.IsInIntSlice(modelTokenUser.Id, uploaderIds) {
+					return true, false
+				}
+				for i := 0; i < len(posts)-1; i++ {
+					if canViewRestrictedPost(c.Request.Context(), userService, followService, modelTokenUser, posts[i]) {
+						return true, false
+					}
+				}
+			}
+		}
+	}
+	if len(posts) == 0 {
+		c.JSON(http.StatusNotFound, utils.NewErrorResponse(http.StatusNotFound, "media not found"))
+		return false, false
+	}
+	return authorizePostView(c, userService, followService, posts[len(posts)-1], authenticate), false
+}
+
+// canViewRestrictedPost is authorizePostView for a caller already
+// authenticated, without writing a response.
+func canViewRestrictedPost(ctx context.Context, userService services.UserService, followService services.FollowService,
+	viewer models.User, post models.Post) bool {
+	if viewer.Id == post.UserId {
+		return true
+	}
+	author, _ := userService.GetById(ctx, post.UserId)
+	if author.Status == models.UserStatusShadowBanned || post.IsArchived {
+		return false
+	}
+	return !author.IsPrivate || followService.IsFollowing(ctx, viewer.Id, post.UserId)
+}
+
+// ServeMedia streams an uploaded file with support for range requests and
+// conditional requests. A valid signature stands in for authentication so that
+// private media can be embedded where no Authorization header is sent.
+func ServeMedia(userService services.UserService, followService services.FollowService,
+	postService services.PostService, mediaService services.MediaService, mediaStorage storage.Storage, jwtSecret string) gin.HandlerFunc {
+	authenticate := middlewares.AuthMiddleware(jwtSecret, userService)
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		isPublic := false
+		if signature := c.Query("signature"); signature != "" {
+			verifier, ok := mediaStorage.(storage.SignatureVerifier)
+			if !ok || !verifier.VerifySignature(key, c.Query("expires"), signature) {
+				c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "invalid or expired signature"))
+				return
+			}
+		} else {
+			var ok bool
+			ok, isPublic = authorizeMediaView(c, userService, followService, postService, mediaService, key, authenticate)
+			if !ok {
+				return
+			}
+		}
+
+		reader, object, err := mediaStorage.Get(key)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+				c.JSON(http.StatusNotFound, utils.NewErrorResponse(http.StatusNotFound, "media not found"))
+				return
+			}
+			respondError(c, err, nil)
+			return
+		}
+		defer reader.Close()
+
+		// uploaded files are never rewritten, their keys carry a content hash
+		if isPublic {
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			c.Header("Cache-Control", "private, max-age=3600")
+		}
+		if object.ETag != "" {
+			c.Header("ETag", "\""+object.ETag+"\"")
+		}
+		if object.ContentType != "" {
+			c.Header("Content-Type", object.ContentType)
+		}
+		http.ServeContent(c.Writer, c.Request, key, object.ModTime, reader)
+	}
+}
+
+// SignMediaUrl hands out a short-lived URL for media the caller is allowed to
+// see.
+func SignMediaUrl(userService services.UserService, followService services.FollowService,
+	postService services.PostService, mediaService services.MediaService, mediaStorage storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		if ok, _ := authorizeMediaView(c, userService, followService, postService, mediaService, key, nil); !ok {
+			return
+		}
+		if _, err := mediaStorage.Stat(key); err != nil {
+			if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+				c.JSON(http.StatusNotFound, utils.NewErrorResponse(http.StatusNotFound, "media not found"))
+				return
+			}
+			respondError(c, err, nil)
+			return
+		}
+		signedUrl, err := mediaStorage.SignedURL(key, signedMediaUrlExpiry)
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"url": signedUrl, "expires_in": int(signedMediaUrlExpiry.Seconds())})
+	}
+}
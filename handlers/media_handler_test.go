@@ -0,0 +1,379 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/handlers"
+	"github.com/ChenSongJian/ginstagram/middlewares"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const testMediaKey = "uploads/2024-01-02/video.mp4"
+
+func newTestMediaStorage(t *testing.T) *storage.LocalStorage {
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/api/v1/media", []byte("secret"))
+	if err := mediaStorage.Put(testMediaKey, strings.NewReader("0123456789"), 10, "video/mp4"); err != nil {
+		t.Fatalf("Error storing media: %v", err)
+	}
+	return mediaStorage
+}
+
+func serveMedia(mockPostService *mocks.MockPostService, mediaStorage storage.Storage, request *http.Request) *httptest.ResponseRecorder {
+	return serveMediaKey(mockPostService, mediaStorage, request, testMediaKey)
+}
+
+func serveMediaKey(mockPostService *mocks.MockPostService, mediaStorage storage.Storage, request *http.Request, key string) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request = request
+	context.Params = []gin.Param{
+		{
+			Key:   "key",
+			Value: "/" + key,
+		},
+	}
+	handlers.ServeMedia(mockPostService.UserService, mockPostService.FollowService, mockPostService,
+		mockPostService.MediaService, mediaStorage, testJWTSecret)(context)
+	// gin writes a status without a body once the handler returns
+	context.Writer.WriteHeaderNow()
+	return response
+}
+
+func TestServeMedia_NotFound(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/api/v1/media", []byte("secret"))
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := serveMedia(mockPostService, mediaStorage, request)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+}
+
+func TestServeMedia_NotMedia(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".env"), []byte("JWT_SECRET=secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mediaStorage := storage.NewLocalStorage(root, "/api/v1/media", []byte("secret"))
+	untracked := "uploads/2024-01-02/untracked.jpg"
+	if err := mediaStorage.Put(untracked, strings.NewReader("data"), 4, "image/jpeg"); err != nil {
+		t.Fatalf("Error storing media: %v", err)
+	}
+
+	for _, key := range []string{".env", "ginstagram.db", "uploads/../.env", untracked} {
+		request, _ := http.NewRequest("GET", "/", nil)
+		response := serveMediaKey(mockPostService, mediaStorage, request, key)
+		if response.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusNotFound, key, response.Code)
+		}
+		if strings.Contains(response.Body.String(), "secret") {
+			t.Errorf("Expected %s not to be served, got %s", key, response.Body.String())
+		}
+	}
+}
+
+func TestServeMedia_PublicPost(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, PostId: 1}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := serveMedia(mockPostService, mediaStorage, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if response.Body.String() != "0123456789" {
+		t.Errorf("Expected full body, got %s", response.Body.String())
+	}
+	if response.Header().Get("Content-Type") != "video/mp4" {
+		t.Errorf("Expected content type video/mp4, got %s", response.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(response.Header().Get("Cache-Control"), "public") {
+		t.Errorf("Expected public cache control, got %s", response.Header().Get("Cache-Control"))
+	}
+	if response.Header().Get("ETag") == "" || response.Header().Get("Last-Modified") == "" {
+		t.Errorf("Expected ETag and Last-Modified headers, got %v", response.Header())
+	}
+}
+
+func TestServeMedia_Range(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, UserId: 1, PostId: 1}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Range", "bytes=2-5")
+	response := serveMedia(mockPostService, mediaStorage, request)
+	if response.Code != http.StatusPartialContent {
+		t.Fatalf("Expected status code %d, got %d", http.StatusPartialContent, response.Code)
+	}
+	if response.Body.String() != "2345" {
+		t.Errorf("Expected partial body 2345, got %s", response.Body.String())
+	}
+	if response.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("Expected content range bytes 2-5/10, got %s", response.Header().Get("Content-Range"))
+	}
+}
+
+func TestServeMedia_NotModified(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, UserId: 1, PostId: 1}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	etag := serveMedia(mockPostService, mediaStorage, request).Header().Get("ETag")
+
+	request, _ = http.NewRequest("GET", "/", nil)
+	request.Header.Set("If-None-Match", etag)
+	response := serveMedia(mockPostService, mediaStorage, request)
+	if response.Code != http.StatusNotModified {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotModified, response.Code)
+	}
+}
+
+func TestServeMedia_Unattached(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.UserService.Users["uploader@test.com"] = models.User{Id: 1}
+	mockPostService.UserService.Users["other@test.com"] = models.User{Id: 2}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, UserId: 1}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	if response := serveMedia(mockPostService, mediaStorage, request); response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a visitor, got %d", http.StatusNotFound, response.Code)
+	}
+	for _, testCase := range []struct {
+		userId       int
+		expectedCode int
+	}{
+		{userId: 1, expectedCode: http.StatusOK},
+		{userId: 2, expectedCode: http.StatusNotFound},
+	} {
+		token, err := middlewares.GenerateToken(testJWTSecret, models.User{Id: testCase.userId, Email: "test@test.com"}, true)
+		if err != nil {
+			t.Fatalf("Error generating token: %v", err)
+		}
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := serveMedia(mockPostService, mediaStorage, request)
+		if response.Code != testCase.expectedCode {
+			t.Errorf("Expected status code %d for user %d, got %d", testCase.expectedCode, testCase.userId, response.Code)
+		}
+		if response.Code == http.StatusOK && !strings.Contains(response.Header().Get("Cache-Control"), "private") {
+			t.Errorf("Expected private cache control, got %s", response.Header().Get("Cache-Control"))
+		}
+	}
+}
+
+func TestServeMedia_ProfileImage(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.MediaService.UserService.Users["uploader@test.com"] = models.User{Id: 1, ProfileImageUrl: testMediaKey}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, UserId: 1}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := serveMedia(mockPostService, mediaStorage, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if !strings.Contains(response.Header().Get("Cache-Control"), "public") {
+		t.Errorf("Expected public cache control, got %s", response.Header().Get("Cache-Control"))
+	}
+}
+
+func TestServeMedia_PrivatePostVisitor(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1, IsPrivate: true}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, PostId: 1}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := serveMedia(mockPostService, mediaStorage, request)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+}
+
+func TestServeMedia_PrivatePostNotFollowing(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1, IsPrivate: true}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.UserService.Users["test@test.com"] = models.User{Id: 2}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, PostId: 1}
+	token, err := middlewares.GenerateToken(testJWTSecret, models.User{Id: 2, Email: "test@test.com"}, true)
+	if err != nil {
+		t.Fatalf("Error generating token: %v", err)
+	}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	response := serveMedia(mockPostService, mediaStorage, request)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+}
+
+func TestServeMedia_PrivatePostFollower(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1, IsPrivate: true}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, PostId: 1}
+	mockPostService.UserService.Users["test@test.com"] = models.User{Id: 2}
+	mockPostService.FollowService.Follows[1] = mocks.FollowRecord{FollowerId: 2, FolloweeId: 1}
+	token, err := middlewares.GenerateToken(testJWTSecret, models.User{Id: 2, Email: "test@test.com"}, true)
+	if err != nil {
+		t.Fatalf("Error generating token: %v", err)
+	}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	response := serveMedia(mockPostService, mediaStorage, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if !strings.Contains(response.Header().Get("Cache-Control"), "private") {
+		t.Errorf("Expected private cache control, got %s", response.Header().Get("Cache-Control"))
+	}
+}
+
+func TestServeMedia_SharedWithPublicPost(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1, IsPrivate: true}
+	mockPostService.UserService.Users["other@test.com"] = models.User{Id: 3}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.Posts[2] = mocks.PostRecord{UserId: 3}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, PostId: 1}
+	mockPostService.MediaService.Media[2] = mocks.MediaRecord{Url: testMediaKey, PostId: 2}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := serveMedia(mockPostService, mediaStorage, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if !strings.Contains(response.Header().Get("Cache-Control"), "public") {
+		t.Errorf("Expected public cache control, got %s", response.Header().Get("Cache-Control"))
+	}
+}
+
+func TestServeMedia_SharedPrivatePosts(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1, IsPrivate: true}
+	mockPostService.UserService.Users["other@test.com"] = models.User{Id: 3, IsPrivate: true}
+	mockPostService.UserService.Users["test@test.com"] = models.User{Id: 2}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.Posts[2] = mocks.PostRecord{UserId: 3}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, PostId: 1}
+	mockPostService.MediaService.Media[2] = mocks.MediaRecord{Url: testMediaKey, PostId: 2}
+
+	for _, testCase := range []struct {
+		userId       int
+		expectedCode int
+	}{
+		{userId: 1, expectedCode: http.StatusOK},
+		{userId: 3, expectedCode: http.StatusOK},
+		{userId: 2, expectedCode: http.StatusForbidden},
+	} {
+		token, err := middlewares.GenerateToken(testJWTSecret, models.User{Id: testCase.userId, Email: "test@test.com"}, true)
+		if err != nil {
+			t.Fatalf("Error generating token: %v", err)
+		}
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := serveMedia(mockPostService, mediaStorage, request)
+		if response.Code != testCase.expectedCode {
+			t.Errorf("Expected status code %d for user %d, got %d", testCase.expectedCode, testCase.userId, response.Code)
+		}
+	}
+}
+
+func TestServeMedia_InvalidSignature(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+
+	query := url.Values{}
+	query.Set("expires", "9999999999")
+	query.Set("signature", "forged")
+	request, _ := http.NewRequest("GET", "/?"+query.Encode(), nil)
+	response := serveMedia(mockPostService, mediaStorage, request)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+}
+
+func TestSignMediaUrl_PrivatePostAuthor(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mediaStorage := newTestMediaStorage(t)
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1, IsPrivate: true}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: testMediaKey, PostId: 1}
+	token, err := middlewares.GenerateToken(testJWTSecret, models.User{Id: 1, Email: "author@test.com"}, true)
+	if err != nil {
+		t.Fatalf("Error generating token: %v", err)
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+	context.Params = []gin.Param{
+		{
+			Key:   "key",
+			Value: "/" + testMediaKey,
+		},
+	}
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.SignMediaUrl(mockPostService.UserService, mockPostService.FollowService, mockPostService,
+		mockPostService.MediaService, mediaStorage)(context)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	var body struct {
+		Url string `json:"url"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	signedUrl, err := url.Parse(body.Url)
+	if err != nil {
+		t.Fatalf("Error parsing signed url: %v", err)
+	}
+
+	// a visitor without a token can use the signed url
+	request, _ := http.NewRequest("GET", "/?"+signedUrl.RawQuery, nil)
+	mediaResponse := serveMedia(mockPostService, mediaStorage, request)
+	if mediaResponse.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, mediaResponse.Code)
+	}
+
+	expiredUrl, _ := mediaStorage.SignedURL(testMediaKey, -time.Minute)
+	parsed, _ := url.Parse(expiredUrl)
+	request, _ = http.NewRequest("GET", "/?"+parsed.RawQuery, nil)
+	mediaResponse = serveMedia(mockPostService, mediaStorage, request)
+	if mediaResponse.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, mediaResponse.Code)
+	}
+}
@@ -1,28 +1,99 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ChenSongJian/ginstagram/imaging"
+	"github.com/ChenSongJian/ginstagram/metrics"
 	"github.com/ChenSongJian/ginstagram/middlewares"
 	"github.com/ChenSongJian/ginstagram/models"
 	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"github.com/ChenSongJian/ginstagram/video"
 	"github.com/gin-gonic/gin"
 )
 
+// PostReq references media by the ids returned from the upload endpoint.
 type PostReq struct {
-	Title   string   `json:"title" binding:"required"`
-	Content string   `json:"content" binding:"required"`
-	Media   []string `json:"media"`
+	Title   string `json:"title" binding:"required"`
+	Content string `json:"content" binding:"required"`
+	Media   []int  `json:"media"`
+}
+
+type DeletedPostResponse struct {
+	PostResponse
+	DeletedAt string `json:"deleted_at"`
 }
 
 type PostResponse struct {
-	Id        int      `json:"id"`
-	CreatedAt string   `json:"created_at"`
-	Title     string   `json:"title"`
-	Content   string   `json:"content"`
-	UserId    int      `json:"user_id"`
-	Media     []string `json:"media"`
+	Id         int             `json:"id"`
+	CreatedAt  string          `json:"created_at"`
+	Title      string          `json:"title"`
+	Content    string          `json:"content"`
+	UserId     int             `json:"user_id"`
+	IsArchived bool            `json:"is_archived"`
+	Media      []MediaResponse `json:"media"`
+}
+
+// MediaResponse lists the sized variants of an image next to the original so
+// that clients can pick the right resolution. Videos list their renditions
+// once they are transcoded; until then their status is processing and only
+// the original can be played.
+type MediaResponse struct {
+	Url         string            `json:"url"`
+	Variants    map[string]string `json:"variants,omitempty"`
+	Renditions  *video.Outputs    `json:"renditions,omitempty"`
+	Status      string            `json:"status,omitempty"`
+	Id          int               `json:"id,omitempty"`
+	Filename    string            `json:"filename,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Width       int               `json:"width,omitempty"`
+	Height      int               `json:"height,omitempty"`
+	DurationMs  int64             `json:"duration_ms,omitempty"`
+}
+
+func newPostResponse(post models.Post, media []models.Media) PostResponse {
+	var mediaResponses []MediaResponse
+	for _, m := range media {
+		var renditions *video.Outputs
+		if strings.HasPrefix(m.ContentType, "video/") && m.Status == models.MediaStatusReady {
+			outputs := video.OutputKeys(m.Url)
+			renditions = &outputs
+		}
+		mediaResponses = append(mediaResponses, MediaResponse{
+			Url:         m.Url,
+			Variants:    imaging.VariantKeys(m.Url),
+			Renditions:  renditions,
+			Status:      m.Status,
+			Id:          m.Id,
+			Filename:    m.Filename,
+			ContentType: m.ContentType,
+			Width:       m.Width,
+			Height:      m.Height,
+			DurationMs:  m.DurationMs,
+		})
+	}
+	return PostResponse{
+		Id:         post.Id,
+		CreatedAt:  post.CreatedAt.Format("2006-01-02 15:04:05"),
+		Title:      post.Title,
+		Content:    post.Content,
+		UserId:     post.UserId,
+		IsArchived: post.IsArchived,
+		Media:      mediaResponses,
+	}
+}
+
+func newPostResponses(posts []models.Post, mediaMap map[int][]models.Media) []PostResponse {
+	var postResponses = make([]PostResponse, 0)
+	for _, post := range posts {
+		postResponses = append(postResponses, newPostResponse(post, mediaMap[post.Id]))
+	}
+	return postResponses
 }
 
 func ListPublicPosts(postService services.PostService, mediaService services.MediaService) gin.HandlerFunc {
@@ -31,31 +102,12 @@ func ListPublicPosts(postService services.PostService, mediaService services.Med
 		pageNum := c.Query("pageNum")
 		pageSize := c.Query("pageSize")
 		keyword := c.Query("keyword")
-		posts, mediaMap, pageInfo, err := postService.List(pageNum, pageSize, keyword)
+		posts, mediaMap, pageInfo, err := postService.List(c.Request.Context(), pageNum, pageSize, keyword)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, nil)
 			return
 		}
-		var postResponses = make([]PostResponse, 0)
-		for _, post := range posts {
-			media, ok := mediaMap[post.Id]
-			if !ok {
-				media = []models.Media{}
-			}
-			var mediaUrls []string
-			for _, m := range media {
-				mediaUrls = append(mediaUrls, m.Url)
-			}
-			postResponses = append(postResponses, PostResponse{
-				Id:        post.Id,
-				CreatedAt: post.CreatedAt.Format("2006-01-02 15:04:05"),
-				Title:     post.Title,
-				Content:   post.Content,
-				UserId:    post.UserId,
-				Media:     mediaUrls,
-			})
-		}
-		pageInfo.Data = postResponses
+		pageInfo.Data = newPostResponses(posts, mediaMap)
 		c.JSON(http.StatusOK, pageInfo)
 	}
 }
@@ -64,126 +116,122 @@ func ListPosts(postService services.PostService, mediaService services.MediaServ
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		pageNum := c.Query("pageNum")
 		pageSize := c.Query("pageSize")
 		keyword := c.Query("keyword")
-		posts, mediaMap, pageInfo, err := postService.ListByUserId(modelTokenUser.Id, pageNum, pageSize, keyword)
+		posts, mediaMap, pageInfo, err := postService.ListByUserId(c.Request.Context(), modelTokenUser.Id, pageNum, pageSize, keyword)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, nil)
 			return
 		}
-		var postResponses = make([]PostResponse, 0)
-		for _, post := range posts {
-			media, ok := mediaMap[post.Id]
-			if !ok {
-				media = []models.Media{}
-			}
-			var mediaUrls []string
-			for _, m := range media {
-				mediaUrls = append(mediaUrls, m.Url)
-			}
-			postResponses = append(postResponses, PostResponse{
-				Id:        post.Id,
-				CreatedAt: post.CreatedAt.Format("2006-01-02 15:04:05"),
-				Title:     post.Title,
-				Content:   post.Content,
-				UserId:    post.UserId,
-				Media:     mediaUrls,
-			})
-		}
-		pageInfo.Data = postResponses
+		pageInfo.Data = newPostResponses(posts, mediaMap)
 		c.JSON(http.StatusOK, pageInfo)
 	}
 }
 
 func GetPostById(userService services.UserService, followService services.FollowService,
-	postService services.PostService, mediaService services.MediaService) gin.HandlerFunc {
+	postService services.PostService, mediaService services.MediaService, jwtSecret string) gin.HandlerFunc {
+	authenticate := middlewares.AuthMiddleware(jwtSecret, userService)
 	return func(c *gin.Context) {
 		postIdStr := c.Param("postId")
 		postId, err := strconv.Atoi(postIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
 			return
 		}
-		post, err := postService.GetById(postId)
+		post, err := postService.GetById(c.Request.Context(), postId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "post not found"})
+			return
+		}
+		if !authorizePostView(c, userService, followService, post, authenticate) {
+			return
+		}
+		media, err := mediaService.GetByPostId(c.Request.Context(), postId)
+		if err != nil {
+			respondError(c, err, nil)
 			return
 		}
-		var author models.User
-		author, _ = userService.GetById(post.UserId)
-		if author.IsPrivate {
+		c.JSON(http.StatusOK, newPostResponse(post, media))
+	}
+}
+
+// authorizePostView checks that the caller may see post. Posts that are not
+// public need a logged in caller, who is authenticated on the spot with
+// authenticate unless a route behind AuthMiddleware did so already; such
+// routes pass nil. When the caller is not allowed it writes the error response
+// and returns false.
+func authorizePostView(c *gin.Context, userService services.UserService, followService services.FollowService, post models.Post,
+	authenticate gin.HandlerFunc) bool {
+	var author models.User
+	author, _ = userService.GetById(c.Request.Context(), post.UserId)
+	isShadowBanned := author.Status == models.UserStatusShadowBanned
+	if author.IsPrivate || isShadowBanned || post.IsArchived {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
 			authHeader := c.GetHeader("Authorization")
 			if authHeader == "" {
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "post is private, please login and retry again"})
-				return
-			}
-			middlewares.AuthMiddleware()(c)
-			tokenUser, exists := c.Get("tokenUser")
-			if !exists {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
-				return
-			}
-			modelTokenUser, ok := tokenUser.(models.User)
-			if !ok {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
-				return
+				if isShadowBanned || post.IsArchived {
+					c.JSON(http.StatusNotFound, utils.NewErrorResponse(http.StatusNotFound, "post not found"))
+					return false
+				}
+				c.AbortWithStatusJSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "post is private, please login and retry again"))
+				return false
 			}
-			if modelTokenUser.Id != post.UserId {
-				if !followService.IsFollowing(modelTokenUser.Id, post.UserId) {
-					c.JSON(http.StatusForbidden, gin.H{"error": "post is private and you are not following the author"})
-					return
+			if authenticate != nil {
+				authenticate(c)
+				if c.IsAborted() {
+					return false
 				}
 			}
+			tokenUser, exists = c.Get("tokenUser")
+			if !exists {
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+				return false
+			}
 		}
-		media, err := mediaService.GetByPostId(postId)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		var mediaUrls []string
-		for _, m := range media {
-			mediaUrls = append(mediaUrls, m.Url)
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return false
 		}
-		postResponse := PostResponse{
-			Id:        post.Id,
-			CreatedAt: post.CreatedAt.Format("2006-01-02 15:04:05"),
-			Title:     post.Title,
-			Content:   post.Content,
-			UserId:    post.UserId,
-			Media:     mediaUrls,
+		if modelTokenUser.Id != post.UserId {
+			if isShadowBanned || post.IsArchived {
+				c.JSON(http.StatusNotFound, utils.NewErrorResponse(http.StatusNotFound, "post not found"))
+				return false
+			}
+			if author.IsPrivate && !followService.IsFollowing(c.Request.Context(), modelTokenUser.Id, post.UserId) {
+				c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "post is private and you are not following the author"))
+				return false
+			}
 		}
-		c.JSON(http.StatusOK, postResponse)
 	}
+	return true
 }
 
 func CreatePost(postService services.PostService, mediaService services.MediaService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		var req PostReq
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
 			return
 		}
 		post := models.Post{
@@ -192,26 +240,46 @@ func CreatePost(postService services.PostService, mediaService services.MediaSer
 			UserId:  modelTokenUser.Id,
 		}
 		if len(req.Media) < 1 || len(req.Media) > 9 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "please upload at least one and no more than 9 media"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "please upload at least one and no more than 9 media"))
 			return
 		}
-		postId, err := postService.Create(post)
+		media, err := mediaService.GetByIds(c.Request.Context(), req.Media)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, nil)
 			return
 		}
-		var media []models.Media
-		for _, m := range req.Media {
-			media = append(media, models.Media{
-				Url:    m,
-				PostId: postId,
-			})
+		mediaById := make(map[int]models.Media)
+		for _, m := range media {
+			mediaById[m.Id] = m
+		}
+		seen := make(map[int]bool)
+		for _, mediaId := range req.Media {
+			m, found := mediaById[mediaId]
+			if !found || m.UserId != modelTokenUser.Id {
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, fmt.Sprintf("media %d not found", mediaId)))
+				return
+			}
+			if seen[mediaId] {
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, fmt.Sprintf("media %d is listed more than once", mediaId)))
+				return
+			}
+			seen[mediaId] = true
+			if m.PostId != 0 {
+				c.JSON(http.StatusConflict, utils.NewErrorResponse(http.StatusConflict, fmt.Sprintf("media %d is already attached to a post", mediaId)))
+				return
+			}
+			// media still processing may be posted, it shows as such until
+			// it is ready
+			if m.Status == models.MediaStatusFailed {
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, fmt.Sprintf("media %d could not be processed", mediaId)))
+				return
+			}
 		}
-		if err := mediaService.Create(media); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			_ = postService.DeleteById(postId)
+		if _, err := postService.Create(c.Request.Context(), post, req.Media); err != nil {
+			respondError(c, err, errorMessages{services.ErrConflict: "media is already attached to a post"})
 			return
 		}
+		metrics.PostsCreated.Inc()
 		c.JSON(http.StatusOK, gin.H{"message": "post created successfully"})
 	}
 }
@@ -220,39 +288,178 @@ func DeletePost(postService services.PostService, mediaService services.MediaSer
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		postIdStr := c.Param("postId")
 		postId, err := strconv.Atoi(postIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
 			return
 		}
 		var post models.Post
-		post, err = postService.GetById(postId)
+		post, err = postService.GetById(c.Request.Context(), postId)
 		if err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "post not found"})
 			return
 		}
 		if post.UserId != modelTokenUser.Id {
-			c.JSON(http.StatusForbidden, gin.H{"error": "no permission to delete this post"})
+			c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "no permission to delete this post"))
 			return
 		}
-		err = postService.DeleteById(modelTokenUser.Id)
+		err = postService.DeleteById(c.Request.Context(), postId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, nil)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"message": "post deleted successfully"})
 	}
 }
+
+func ListDeletedPosts(postService services.PostService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		pageNum := c.Query("pageNum")
+		pageSize := c.Query("pageSize")
+		posts, mediaMap, pageInfo, err := postService.ListDeletedByUserId(c.Request.Context(), modelTokenUser.Id, pageNum, pageSize)
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		postResponses := make([]DeletedPostResponse, len(posts))
+		for i, post := range posts {
+			postResponses[i] = DeletedPostResponse{
+				PostResponse: newPostResponse(post, mediaMap[post.Id]),
+				DeletedAt:    post.DeletedAt.Time.Format("2006-01-02 15:04:05"),
+			}
+		}
+		pageInfo.Data = postResponses
+		c.JSON(http.StatusOK, pageInfo)
+	}
+}
+
+func RestorePost(postService services.PostService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		postIdStr := c.Param("postId")
+		postId, err := strconv.Atoi(postIdStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
+			return
+		}
+		post, err := postService.GetDeletedById(c.Request.Context(), postId)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "deleted post not found"})
+			return
+		}
+		if post.UserId != modelTokenUser.Id {
+			c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "no permission to restore this post"))
+			return
+		}
+		if time.Since(post.DeletedAt.Time) > services.TrashRetention {
+			c.JSON(http.StatusGone, utils.NewErrorResponse(http.StatusGone, "post can no longer be restored"))
+			return
+		}
+		if err := postService.RestoreById(c.Request.Context(), postId); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "post restored successfully"})
+	}
+}
+
+func ListArchivedPosts(postService services.PostService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		pageNum := c.Query("pageNum")
+		pageSize := c.Query("pageSize")
+		posts, mediaMap, pageInfo, err := postService.ListArchivedByUserId(c.Request.Context(), modelTokenUser.Id, pageNum, pageSize)
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		pageInfo.Data = newPostResponses(posts, mediaMap)
+		c.JSON(http.StatusOK, pageInfo)
+	}
+}
+
+func ArchivePost(postService services.PostService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		updatePostArchived(c, postService, true)
+	}
+}
+
+func UnarchivePost(postService services.PostService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		updatePostArchived(c, postService, false)
+	}
+}
+
+func updatePostArchived(c *gin.Context, postService services.PostService, archived bool) {
+	tokenUser, exists := c.Get("tokenUser")
+	if !exists {
+		c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+		return
+	}
+	modelTokenUser, ok := tokenUser.(models.User)
+	if !ok {
+		c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+		return
+	}
+	postIdStr := c.Param("postId")
+	postId, err := strconv.Atoi(postIdStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid post id"))
+		return
+	}
+	post, err := postService.GetById(c.Request.Context(), postId)
+	if err != nil {
+		respondError(c, err, errorMessages{services.ErrNotFound: "post not found"})
+		return
+	}
+	if post.UserId != modelTokenUser.Id {
+		c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "no permission to archive this post"))
+		return
+	}
+	if err := postService.UpdateArchived(c.Request.Context(), postId, archived); err != nil {
+		respondError(c, err, nil)
+		return
+	}
+	if archived {
+		c.JSON(http.StatusOK, gin.H{"message": "post archived successfully"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "post unarchived successfully"})
+}
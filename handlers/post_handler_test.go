@@ -7,11 +7,13 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ChenSongJian/ginstagram/handlers"
 	"github.com/ChenSongJian/ginstagram/middlewares"
 	"github.com/ChenSongJian/ginstagram/mocks"
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
 	"github.com/ChenSongJian/ginstagram/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -124,7 +126,7 @@ func TestListPublicPost_PostWithMedia(t *testing.T) {
 	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
 		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
 	}
-	expectedResponseBodyString = "media\":[\"m0"
+	expectedResponseBodyString = "media\":[{\"url\":\"m0\"}"
 	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
 		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
 	}
@@ -276,7 +278,7 @@ func TestListPost_NoRecord(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -285,7 +287,7 @@ func TestListPost_NoRecord(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListPosts(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -310,7 +312,7 @@ func TestListPost_PublicUserViewOwnPost(t *testing.T) {
 		Email:     "test@test.com",
 		IsPrivate: false,
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -324,7 +326,7 @@ func TestListPost_PublicUserViewOwnPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListPosts(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -348,7 +350,7 @@ func TestListPost_PrivateUserViewOwnPost(t *testing.T) {
 		Email:     "test@test.com",
 		IsPrivate: true,
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -362,7 +364,7 @@ func TestListPost_PrivateUserViewOwnPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListPosts(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -386,7 +388,7 @@ func TestListPost_UserViewPublicPost(t *testing.T) {
 		Email:     "test@test.com",
 		IsPrivate: true,
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -404,7 +406,7 @@ func TestListPost_UserViewPublicPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListPosts(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -428,7 +430,7 @@ func TestListPost_UserViewPrivatePostWithoutFollowing(t *testing.T) {
 		Email:     "test@test.com",
 		IsPrivate: true,
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -446,7 +448,7 @@ func TestListPost_UserViewPrivatePostWithoutFollowing(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListPosts(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -470,7 +472,7 @@ func TestListPost_UserViewPrivatePostWithFollowing(t *testing.T) {
 		Email:     "test@test.com",
 		IsPrivate: true,
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -492,7 +494,7 @@ func TestListPost_UserViewPrivatePostWithFollowing(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListPosts(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -516,7 +518,7 @@ func TestListPost_PostWithMedia(t *testing.T) {
 		Email:     "test@test.com",
 		IsPrivate: true,
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -542,7 +544,7 @@ func TestListPost_PostWithMedia(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListPosts(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -551,7 +553,7 @@ func TestListPost_PostWithMedia(t *testing.T) {
 	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
 		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
 	}
-	expectedResponseBodyString = "media\":[\"m0"
+	expectedResponseBodyString = "media\":[{\"url\":\"m0\"}"
 	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
 		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
 	}
@@ -570,7 +572,7 @@ func TestListPost_SearchTitleKeyword(t *testing.T) {
 		Email:     "test@test.com",
 		IsPrivate: true,
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -589,7 +591,7 @@ func TestListPost_SearchTitleKeyword(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/?keyword=test2", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListPosts(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -617,7 +619,7 @@ func TestListPost_SearchContentKeyword(t *testing.T) {
 		Email:     "test@test.com",
 		IsPrivate: true,
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -636,7 +638,7 @@ func TestListPost_SearchContentKeyword(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/?keyword=test2", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListPosts(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -664,7 +666,7 @@ func TestListPost_Pagination(t *testing.T) {
 		Email:     "test@test.com",
 		IsPrivate: true,
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -683,7 +685,7 @@ func TestListPost_Pagination(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/?pageNum=2&pageSize=1", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.ListPosts(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -714,7 +716,7 @@ func TestGetPostById_InvalidPostId(t *testing.T) {
 
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 
-	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService)(context)
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
 	}
@@ -740,7 +742,7 @@ func TestGetPostById_PostNotFound(t *testing.T) {
 
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 
-	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService)(context)
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
 	if response.Code != http.StatusNotFound {
 		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
 	}
@@ -773,7 +775,7 @@ func TestGetPostById_VisitorViewPrivatePost(t *testing.T) {
 
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 
-	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService)(context)
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
 	if response.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
 	}
@@ -807,7 +809,7 @@ func TestGetPostById_VisitorViewPublicPost(t *testing.T) {
 
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 
-	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService)(context)
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
 	}
@@ -829,7 +831,7 @@ func TestGetPostById_UserViewOwnPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -848,7 +850,7 @@ func TestGetPostById_UserViewOwnPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService)(context)
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
 	}
@@ -870,7 +872,7 @@ func TestGetPostById_UserViewPublicPost(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -893,7 +895,7 @@ func TestGetPostById_UserViewPublicPost(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService)(context)
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
 	}
@@ -915,7 +917,7 @@ func TestGetPostById_UserViewPrivatePostNotFollowing(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -927,6 +929,7 @@ func TestGetPostById_UserViewPrivatePostNotFollowing(t *testing.T) {
 		Id:        2,
 		IsPrivate: true,
 	}
+	mockPostService.UserService.Users["test@test.com"] = testUser
 
 	context.Params = []gin.Param{
 		{
@@ -938,7 +941,7 @@ func TestGetPostById_UserViewPrivatePostNotFollowing(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService)(context)
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
 	if response.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
 	}
@@ -960,7 +963,7 @@ func TestGetPostById_UserViewPrivatePostAndFollowing(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -987,7 +990,7 @@ func TestGetPostById_UserViewPrivatePostAndFollowing(t *testing.T) {
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService)(context)
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
 	}
@@ -1029,7 +1032,7 @@ func TestCreatePost_MissingRequiredField(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1045,7 +1048,7 @@ func TestCreatePost_MissingRequiredField(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreatePost(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
@@ -1068,7 +1071,7 @@ func TestCreatePost_NoMedia(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1085,7 +1088,7 @@ func TestCreatePost_NoMedia(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreatePost(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
@@ -1108,7 +1111,7 @@ func TestCreatePost_TooManyMedia(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1116,7 +1119,7 @@ func TestCreatePost_TooManyMedia(t *testing.T) {
 	jsonBody, err := json.Marshal(map[string]interface{}{
 		"title":   "Test Post",
 		"content": "Test Content",
-		"media":   []string{"m0", "m1", "m2", "m3", "m4", "m5", "m6", "m7", "m8", "m9"},
+		"media":   []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
 	})
 	if err != nil {
 		t.Errorf("Error marshaling request body: %v", err)
@@ -1126,7 +1129,7 @@ func TestCreatePost_TooManyMedia(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreatePost(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
@@ -1149,16 +1152,18 @@ func TestCreatePost_Success(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
 	}
+	mediaId0, _ := mockMediaService.Create(context, models.Media{Url: "m0", UserId: 1})
+	mediaId1, _ := mockMediaService.Create(context, models.Media{Url: "m1", UserId: 1})
 	testMediaUrls := []string{"m0", "m1"}
 	jsonBody, err := json.Marshal(map[string]interface{}{
 		"title":   "Test Post",
 		"content": "Test Content",
-		"media":   testMediaUrls,
+		"media":   []int{mediaId0, mediaId1},
 	})
 	if err != nil {
 		t.Errorf("Error marshaling request body: %v", err)
@@ -1168,7 +1173,7 @@ func TestCreatePost_Success(t *testing.T) {
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.CreatePost(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -1180,9 +1185,11 @@ func TestCreatePost_Success(t *testing.T) {
 		UserId:  1,
 	}
 	found := false
-	for _, post := range mockPostService.Posts {
+	postId := 0
+	for id, post := range mockPostService.Posts {
 		if postRecord == post {
 			found = true
+			postId = id
 			break
 		}
 	}
@@ -1192,7 +1199,9 @@ func TestCreatePost_Success(t *testing.T) {
 
 	mediaUrls := []string{}
 	for _, media := range mockMediaService.Media {
-		mediaUrls = append(mediaUrls, media.Url)
+		if media.PostId == postId {
+			mediaUrls = append(mediaUrls, media.Url)
+		}
 	}
 	if len(mediaUrls) != len(testMediaUrls) {
 		t.Errorf("Expected %d media, got %d", len(testMediaUrls), len(mediaUrls))
@@ -1248,7 +1257,7 @@ func TestDeletePost_InvalidPostId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1257,7 +1266,7 @@ func TestDeletePost_InvalidPostId(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeletePost(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
@@ -1285,7 +1294,7 @@ func TestDeletePost_PostNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1294,7 +1303,7 @@ func TestDeletePost_PostNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeletePost(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusNotFound {
 		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
@@ -1322,7 +1331,7 @@ func TestDeletePost_DifferentPostUserIdAndTokenUserId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1336,7 +1345,7 @@ func TestDeletePost_DifferentPostUserIdAndTokenUserId(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeletePost(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
@@ -1356,7 +1365,7 @@ func TestDeletePost_Success(t *testing.T) {
 	context.Params = []gin.Param{
 		{
 			Key:   "postId",
-			Value: "1",
+			Value: "2",
 		},
 	}
 	testUser := models.User{
@@ -1364,12 +1373,17 @@ func TestDeletePost_Success(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
 	}
 	mockPostService.Posts[1] = mocks.PostRecord{
+		Title:   "Other Post",
+		Content: "Other Content",
+		UserId:  1,
+	}
+	mockPostService.Posts[2] = mocks.PostRecord{
 		Title:   "Test Post",
 		Content: "Test Content",
 		UserId:  1,
@@ -1386,23 +1400,793 @@ func TestDeletePost_Success(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
 
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeletePost(mockPostService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
 	}
 
-	if _, ok := mockPostService.Posts[1]; ok {
-		t.Errorf("Expected post %d to be deleted, but it is still present", 1)
+	if _, ok := mockPostService.Posts[2]; ok {
+		t.Errorf("Expected post %d to be deleted, but it is still present", 2)
 	}
 
-	for _, media := range mockMediaService.Media {
-		if media.PostId == 1 {
-			t.Errorf("Expected media %d to be deleted, but it is still present", 1)
-		}
+	if _, ok := mockPostService.DeletedPosts[2]; !ok {
+		t.Errorf("Expected post %d to be in the trash", 2)
+	}
+
+	if _, ok := mockPostService.Posts[1]; !ok {
+		t.Errorf("Expected post %d to be kept", 1)
+	}
+
+	// media is kept until the post is purged so that it can be restored
+	if len(mockMediaService.Media) != 2 {
+		t.Errorf("Expected %d media, got %d", 2, len(mockMediaService.Media))
+	}
+}
+
+func TestListPublicPost_ShadowBannedAuthor(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	mockPostService.UserService.Users["email"] = models.User{
+		Id:     1,
+		Status: models.UserStatusShadowBanned,
+	}
+	mockPostService.Posts[1] = mocks.PostRecord{
+		UserId:  1,
+		Title:   "hidden post",
+		Content: "hidden post",
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.ListPublicPosts(mockPostService, mockMediaService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":0"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListPost_ShadowBannedUserViewOwnPost(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	testUser.Status = models.UserStatusShadowBanned
+	mockPostService.UserService.Users["test@test.com"] = testUser
+	mockPostService.Posts[1] = mocks.PostRecord{
+		UserId: 1,
+		Title:  "own post",
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListPosts(mockPostService, mockMediaService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":1"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestListPost_UserViewShadowBannedFollowingPost(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockPostService.UserService.Users["author@test.com"] = models.User{
+		Id:        2,
+		IsPrivate: true,
+		Status:    models.UserStatusShadowBanned,
+	}
+	mockPostService.FollowService.Follows[1] = mocks.FollowRecord{
+		FollowerId: 1,
+		FolloweeId: 2,
+	}
+	mockPostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.ListPosts(mockPostService, mockMediaService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":0"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestGetPostById_VisitorViewShadowBannedPost(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	mockPostService.Posts[1] = mocks.PostRecord{
+		UserId: 1,
+	}
+	mockPostService.UserService.Users["email@email.com"] = models.User{
+		Id:     1,
+		Status: models.UserStatusShadowBanned,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestGetPostById_ShadowBannedUserViewOwnPost(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockPostService.Posts[1] = mocks.PostRecord{
+		UserId: 1,
+	}
+	mockPostService.UserService.Users["test@test.com"] = models.User{
+		Id:     1,
+		Status: models.UserStatusShadowBanned,
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+}
+
+func TestListDeletedPosts_Success(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1, Title: "trashed"}
+	mockPostService.Posts[2] = mocks.PostRecord{UserId: 1, Title: "live"}
+	mockPostService.Posts[3] = mocks.PostRecord{UserId: 2, Title: "someone else's"}
+	mockPostService.DeleteById(context, 1)
+	mockPostService.DeleteById(context, 3)
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.ListDeletedPosts(mockPostService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":1"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if !strings.Contains(response.Body.String(), "trashed") || !strings.Contains(response.Body.String(), "deleted_at") {
+		t.Errorf("Expected trashed post with deleted_at, got %s", response.Body.String())
+	}
+}
+
+func TestGetPostById_DeletedPost(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.DeleteById(context, 1)
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+}
+
+func TestRestorePost_NotFound(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+
+	handlers.RestorePost(mockPostService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "deleted post not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestRestorePost_NotOwner(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 2})
+
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockPostService.DeleteById(context, 1)
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+
+	handlers.RestorePost(mockPostService)(context)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
 	}
+}
+
+func TestRestorePost_Expired(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
 
-	if len(mockMediaService.Media) != 1 {
-		t.Errorf("Expected %d media, got %d", 1, len(mockMediaService.Media))
+	mockPostService.DeletedPosts[1] = mocks.PostRecord{
+		UserId:    1,
+		DeletedAt: time.Now().Add(-services.TrashRetention - time.Hour),
+	}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+
+	handlers.RestorePost(mockPostService)(context)
+	if response.Code != http.StatusGone {
+		t.Errorf("Expected status code %d, got %d", http.StatusGone, response.Code)
+	}
+}
+
+func TestRestorePost_Success(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1, Title: "restored"}
+	mockPostService.DeleteById(context, 1)
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+
+	handlers.RestorePost(mockPostService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if post, ok := mockPostService.Posts[1]; !ok || post.Title != "restored" {
+		t.Errorf("Expected post to be restored, got %v", mockPostService.Posts)
+	}
+}
+
+func TestArchivePost_NotFound(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+
+	handlers.ArchivePost(mockPostService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+}
+
+func TestArchivePost_NotOwner(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 2})
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+
+	handlers.ArchivePost(mockPostService)(context)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+	if mockPostService.Posts[1].IsArchived {
+		t.Errorf("Expected post to stay unarchived")
+	}
+}
+
+func TestArchivePost_Success(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+
+	handlers.ArchivePost(mockPostService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if !mockPostService.Posts[1].IsArchived {
+		t.Errorf("Expected post to be archived")
+	}
+}
+
+func TestUnarchivePost_Success(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1, IsArchived: true}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("DELETE", "/", nil)
+
+	handlers.UnarchivePost(mockPostService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if mockPostService.Posts[1].IsArchived {
+		t.Errorf("Expected post to be unarchived")
+	}
+}
+
+func TestListArchivedPosts_Success(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1, Title: "archived", IsArchived: true}
+	mockPostService.Posts[2] = mocks.PostRecord{UserId: 1, Title: "live"}
+	mockPostService.Posts[3] = mocks.PostRecord{UserId: 2, Title: "other", IsArchived: true}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.ListArchivedPosts(mockPostService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":1"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if !strings.Contains(response.Body.String(), "\"title\":\"archived\"") {
+		t.Errorf("Expected archived post in response, got %s", response.Body.String())
+	}
+}
+
+func TestListPost_ExcludeArchivedPost(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1, IsArchived: true}
+	mockPostService.Posts[2] = mocks.PostRecord{UserId: 1}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.ListPosts(mockPostService, mockMediaService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":1"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestGetPostById_UserViewOtherArchivedPost(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       2,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1, IsArchived: true}
+	mockPostService.UserService.Users["test@test.com"] = testUser
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+}
+
+func TestGetPostById_UserViewOwnArchivedPost(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	testUser := models.User{
+		Id:       1,
+		Username: "test",
+		Email:    "test@test.com",
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+	if err != nil {
+		t.Errorf("Error generating token: %v", err)
+		return
+	}
+	mockPostService.UserService.Users["test@test.com"] = testUser
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1, IsArchived: true}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "is_archived\":true"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestGetPostById_ImageVariants(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	mockPostService.UserService.Users["author@test.com"] = models.User{Id: 1}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1}
+	mockMediaService.Media[1] = mocks.MediaRecord{Url: "uploads/2024-01-02/abc-photo.jpg", PostId: 1}
+
+	context.Params = []gin.Param{
+		{
+			Key:   "postId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.GetPostById(mockPostService.UserService, mockPostService.FollowService, mockPostService, mockMediaService, testJWTSecret)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "\"thumbnail\":\"uploads/2024-01-02/abc-photo_thumbnail.jpg\""
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestCreatePost_MediaNotFound(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	mediaId := 1000
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"title":   "Test Post",
+		"content": "Test Content",
+		"media":   []int{mediaId},
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	context.Set("tokenUser", models.User{Id: 1})
+
+	handlers.CreatePost(mockPostService, mockMediaService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "media 1000 not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockPostService.Posts) != 0 {
+		t.Errorf("Expected no post to be created, got %d", len(mockPostService.Posts))
+	}
+}
+
+func TestCreatePost_MediaOfAnotherUser(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	mediaId, _ := mockMediaService.Create(context, models.Media{Url: "m0", UserId: 2})
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"title":   "Test Post",
+		"content": "Test Content",
+		"media":   []int{mediaId},
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	context.Set("tokenUser", models.User{Id: 1})
+
+	handlers.CreatePost(mockPostService, mockMediaService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockPostService.Posts) != 0 {
+		t.Errorf("Expected no post to be created, got %d", len(mockPostService.Posts))
+	}
+}
+
+func TestCreatePost_MediaAlreadyAttached(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	mediaId, _ := mockMediaService.Create(context, models.Media{Url: "m0", UserId: 1, PostId: 5})
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"title":   "Test Post",
+		"content": "Test Content",
+		"media":   []int{mediaId},
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	context.Set("tokenUser", models.User{Id: 1})
+
+	handlers.CreatePost(mockPostService, mockMediaService)(context)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, response.Code)
+	}
+	expectedResponseBodyString := "is already attached to a post"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockPostService.Posts) != 0 {
+		t.Errorf("Expected no post to be created, got %d", len(mockPostService.Posts))
+	}
+}
+
+func TestCreatePost_MediaFailedProcessing(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	mediaId, _ := mockMediaService.Create(context, models.Media{Url: "m0.mp4", UserId: 1, ContentType: "video/mp4", Status: models.MediaStatusFailed})
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"title":   "Test Post",
+		"content": "Test Content",
+		"media":   []int{mediaId},
+	})
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	context.Set("tokenUser", models.User{Id: 1})
+
+	handlers.CreatePost(mockPostService, mockMediaService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "could not be processed"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockPostService.Posts) != 0 {
+		t.Errorf("Expected no post to be created, got %d", len(mockPostService.Posts))
+	}
+}
+
+func TestCreatePost_MediaProcessing(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	mediaId, _ := mockMediaService.Create(context, models.Media{Url: "m0.mp4", UserId: 1, ContentType: "video/mp4", Status: models.MediaStatusProcessing})
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"title":   "Test Post",
+		"content": "Test Content",
+		"media":   []int{mediaId},
+	})
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	context.Set("tokenUser", models.User{Id: 1})
+
+	handlers.CreatePost(mockPostService, mockMediaService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if mockMediaService.Media[mediaId].PostId == 0 {
+		t.Error("Expected media still processing to be attached")
+	}
+}
+
+func TestListPublicPost_VideoRenditions(t *testing.T) {
+	mockPostService := mocks.NewMockPostService()
+	mockMediaService := mockPostService.MediaService
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	mockPostService.UserService.Users["email"] = models.User{Id: 1}
+	mockPostService.Posts[1] = mocks.PostRecord{UserId: 1, Title: "video post", Content: "video post"}
+	mockMediaService.Media[1] = mocks.MediaRecord{PostId: 1, Url: "v1.webm", ContentType: "video/webm", Status: models.MediaStatusProcessing}
+	mockMediaService.Media[2] = mocks.MediaRecord{PostId: 1, Url: "v2.webm", ContentType: "video/webm", Status: models.MediaStatusReady}
+
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.ListPublicPosts(mockPostService, mockMediaService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "{\"url\":\"v1.webm\",\"status\":\"processing\""
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	expectedResponseBodyString = "{\"url\":\"v2.webm\",\"renditions\":{\"mp4\":\"v2_h264.mp4\",\"poster\":\"v2_poster.jpg\",\"hls\":\"v2_hls/index.m3u8\"},\"status\":\"ready\""
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
 	}
 }
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type ReportReq struct {
+	TargetType  string `json:"target_type" binding:"required,oneof=post comment user"`
+	TargetId    int    `json:"target_id" binding:"required"`
+	Reason      string `json:"reason" binding:"required,oneof=spam harassment hate_speech nudity violence misinformation other"`
+	Description string `json:"description" binding:"max=1000"`
+}
+
+type ResolveReportReq struct {
+	Action      string `json:"action" binding:"required,oneof=dismiss remove_content suspend_user"`
+	Note        string `json:"note"`
+	SuspendDays int    `json:"suspend_days" binding:"min=0"`
+}
+
+type ReportResponse struct {
+	Id          int    `json:"id"`
+	CreatedAt   string `json:"created_at"`
+	ReporterId  int    `json:"reporter_id"`
+	TargetType  string `json:"target_type"`
+	TargetId    int    `json:"target_id"`
+	Reason      string `json:"reason"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+}
+
+type ModerationActionResponse struct {
+	Id          int    `json:"id"`
+	CreatedAt   string `json:"created_at"`
+	ReportId    int    `json:"report_id"`
+	ModeratorId int    `json:"moderator_id"`
+	TargetType  string `json:"target_type"`
+	TargetId    int    `json:"target_id"`
+	Action      string `json:"action"`
+	Note        string `json:"note"`
+}
+
+const defaultSuspendDays = 7
+
+// targetOwnerId returns the id of the user responsible for the reported target.
+func targetOwnerId(ctx context.Context, userService services.UserService, postService services.PostService,
+	commentService services.CommentService, targetType string, targetId int) (int, error) {
+	switch targetType {
+	case models.ReportTargetPost:
+		post, err := postService.GetById(ctx, targetId)
+		return post.UserId, err
+	case models.ReportTargetComment:
+		comment, err := commentService.GetById(ctx, targetId)
+		return comment.UserId, err
+	default:
+		user, err := userService.GetById(ctx, targetId)
+		return user.Id, err
+	}
+}
+
+func CreateReport(userService services.UserService, postService services.PostService,
+	commentService services.CommentService, reportService services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		var req ReportReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+		ownerId, err := targetOwnerId(c.Request.Context(), userService, postService, commentService, req.TargetType, req.TargetId)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: req.TargetType + " not found"})
+			return
+		}
+		if ownerId == modelTokenUser.Id {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "can not report yourself"))
+			return
+		}
+		report := models.Report{
+			ReporterId:  modelTokenUser.Id,
+			TargetType:  req.TargetType,
+			TargetId:    req.TargetId,
+			Reason:      req.Reason,
+			Description: req.Description,
+		}
+		if err := reportService.Create(c.Request.Context(), report); err != nil {
+			respondError(c, err, errorMessages{services.ErrConflict: "already reported"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "report created successfully"})
+	}
+}
+
+func ListReports(reportService services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := c.DefaultQuery("status", models.ReportStatusOpen)
+		pageNum := c.Query("pageNum")
+		pageSize := c.Query("pageSize")
+		reports, pageInfo, err := reportService.List(c.Request.Context(), status, pageNum, pageSize)
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		reportResponses := make([]ReportResponse, len(reports))
+		for i, report := range reports {
+			reportResponses[i] = ReportResponse{
+				Id:          report.Id,
+				CreatedAt:   report.CreatedAt.Format("2006-01-02 15:04:05"),
+				ReporterId:  report.ReporterId,
+				TargetType:  report.TargetType,
+				TargetId:    report.TargetId,
+				Reason:      report.Reason,
+				Description: report.Description,
+				Status:      report.Status,
+			}
+		}
+		pageInfo.Data = reportResponses
+		c.JSON(http.StatusOK, pageInfo)
+	}
+}
+
+func ResolveReport(reportService services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		reportIdStr := c.Param("reportId")
+		reportId, err := strconv.Atoi(reportIdStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid report id"))
+			return
+		}
+		var req ResolveReportReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+		report, err := reportService.GetById(c.Request.Context(), reportId)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "report not found"})
+			return
+		}
+		if report.Status != models.ReportStatusOpen {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "report already resolved"))
+			return
+		}
+
+		if req.Action == models.ModerationActionRemoveContent && report.TargetType == models.ReportTargetUser {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "can not remove a user, suspend instead"))
+			return
+		}
+		var suspendedUntil *time.Time
+		if req.Action == models.ModerationActionSuspendUser {
+			suspendDays := req.SuspendDays
+			if suspendDays == 0 {
+				suspendDays = defaultSuspendDays
+			}
+			until := time.Now().AddDate(0, 0, suspendDays)
+			suspendedUntil = &until
+		}
+
+		err = reportService.Resolve(c.Request.Context(), report, modelTokenUser.Id, req.Action, req.Note, suspendedUntil)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: report.TargetType + " not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "report resolved successfully"})
+	}
+}
+
+func ListModerationActions(reportService services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetType := c.Query("target_type")
+		targetId := 0
+		if targetIdStr := c.Query("target_id"); targetIdStr != "" {
+			var err error
+			targetId, err = strconv.Atoi(targetIdStr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid target_id"))
+				return
+			}
+		}
+		actions, err := reportService.ListActions(c.Request.Context(), targetType, targetId)
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		actionResponses := make([]ModerationActionResponse, len(actions))
+		for i, action := range actions {
+			actionResponses[i] = ModerationActionResponse{
+				Id:          action.Id,
+				CreatedAt:   action.CreatedAt.Format("2006-01-02 15:04:05"),
+				ReportId:    action.ReportId,
+				ModeratorId: action.ModeratorId,
+				TargetType:  action.TargetType,
+				TargetId:    action.TargetId,
+				Action:      action.Action,
+				Note:        action.Note,
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"actions": actionResponses})
+	}
+}
@@ -0,0 +1,473 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/handlers"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateReport_MissingToken(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+
+	context.Request, _ = http.NewRequest("POST", "/", nil)
+
+	handlers.CreateReport(mockReportService.UserService, mockReportService.PostService,
+		mockReportService.CommentService, mockReportService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "user not found in token"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestCreateReport_InvalidReason(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"target_type": "post",
+		"target_id":   1,
+		"reason":      "boring",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+
+	handlers.CreateReport(mockReportService.UserService, mockReportService.PostService,
+		mockReportService.CommentService, mockReportService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "Reason"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestCreateReport_TargetNotFound(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"target_type": "comment",
+		"target_id":   1,
+		"reason":      "spam",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+
+	handlers.CreateReport(mockReportService.UserService, mockReportService.PostService,
+		mockReportService.CommentService, mockReportService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+	expectedResponseBodyString := "comment not found"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestCreateReport_ReportSelf(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+	mockReportService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 1,
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"target_type": "post",
+		"target_id":   1,
+		"reason":      "spam",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+
+	handlers.CreateReport(mockReportService.UserService, mockReportService.PostService,
+		mockReportService.CommentService, mockReportService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "can not report yourself"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestCreateReport_Duplicate(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+	mockReportService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+	mockReportService.Reports[1] = models.Report{
+		Id:         1,
+		ReporterId: 1,
+		TargetType: models.ReportTargetPost,
+		TargetId:   1,
+		Status:     models.ReportStatusOpen,
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"target_type": "post",
+		"target_id":   1,
+		"reason":      "spam",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+
+	handlers.CreateReport(mockReportService.UserService, mockReportService.PostService,
+		mockReportService.CommentService, mockReportService)(context)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, response.Code)
+	}
+	expectedResponseBodyString := "already reported"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestCreateReport_Success(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+	mockReportService.UserService.Users["test@test.com"] = models.User{
+		Id: 2,
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"target_type": "user",
+		"target_id":   2,
+		"reason":      "harassment",
+		"description": "sends abusive messages",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+
+	handlers.CreateReport(mockReportService.UserService, mockReportService.PostService,
+		mockReportService.CommentService, mockReportService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if len(mockReportService.Reports) != 1 {
+		t.Errorf("Expected 1 report, got %d", len(mockReportService.Reports))
+	}
+	if len(mockReportService.Actions) != 1 || mockReportService.Actions[0].Action != models.ModerationActionReport {
+		t.Errorf("Expected the report to be recorded in the audit trail, got %+v", mockReportService.Actions)
+	}
+}
+
+func TestListReports_DefaultOpen(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+	mockReportService.Reports[1] = models.Report{
+		Id:     1,
+		Reason: "spam",
+		Status: models.ReportStatusOpen,
+	}
+	mockReportService.Reports[2] = models.Report{
+		Id:     2,
+		Reason: "violence",
+		Status: models.ReportStatusDismissed,
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.ListReports(mockReportService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "total_records\":1"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	expectedResponseBodyString = "reason\":\"spam"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestResolveReport_AlreadyResolved(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+	mockReportService.Reports[1] = models.Report{
+		Id:     1,
+		Status: models.ReportStatusDismissed,
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 9})
+	context.Params = []gin.Param{
+		{
+			Key:   "reportId",
+			Value: "1",
+		},
+	}
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"action": "dismiss",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+
+	handlers.ResolveReport(mockReportService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "report already resolved"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestResolveReport_Dismiss(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+	mockReportService.Reports[1] = models.Report{
+		Id:         1,
+		TargetType: models.ReportTargetPost,
+		TargetId:   1,
+		Status:     models.ReportStatusOpen,
+	}
+	mockReportService.Reports[2] = models.Report{
+		Id:         2,
+		TargetType: models.ReportTargetPost,
+		TargetId:   1,
+		Status:     models.ReportStatusOpen,
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 9})
+	context.Params = []gin.Param{
+		{
+			Key:   "reportId",
+			Value: "1",
+		},
+	}
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"action": "dismiss",
+		"note":   "not spam",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+
+	handlers.ResolveReport(mockReportService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if mockReportService.Reports[1].Status != models.ReportStatusDismissed {
+		t.Errorf("Expected report status %s, got %s", models.ReportStatusDismissed, mockReportService.Reports[1].Status)
+	}
+	if mockReportService.Reports[2].Status != models.ReportStatusOpen {
+		t.Errorf("Expected report status %s, got %s", models.ReportStatusOpen, mockReportService.Reports[2].Status)
+	}
+	if len(mockReportService.Actions) != 1 || mockReportService.Actions[0].ModeratorId != 9 {
+		t.Errorf("Expected moderation action by moderator 9, got %v", mockReportService.Actions)
+	}
+}
+
+func TestResolveReport_RemoveContent(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+	mockReportService.PostService.Posts[1] = mocks.PostRecord{
+		UserId: 2,
+	}
+	mockReportService.Reports[1] = models.Report{
+		Id:         1,
+		TargetType: models.ReportTargetPost,
+		TargetId:   1,
+		Status:     models.ReportStatusOpen,
+	}
+	mockReportService.Reports[2] = models.Report{
+		Id:         2,
+		TargetType: models.ReportTargetPost,
+		TargetId:   1,
+		Status:     models.ReportStatusOpen,
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 9})
+	context.Params = []gin.Param{
+		{
+			Key:   "reportId",
+			Value: "1",
+		},
+	}
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"action": "remove_content",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+
+	handlers.ResolveReport(mockReportService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if _, ok := mockReportService.PostService.Posts[1]; ok {
+		t.Error("Expected reported post to be removed")
+	}
+	if _, ok := mockReportService.PostService.DeletedPosts[1]; ok {
+		t.Error("Expected reported post not to be restorable from the trash")
+	}
+	for _, report := range mockReportService.Reports {
+		if report.Status != models.ReportStatusActioned {
+			t.Errorf("Expected report status %s, got %s", models.ReportStatusActioned, report.Status)
+		}
+	}
+}
+
+func TestResolveReport_RemoveUser(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+	mockReportService.Reports[1] = models.Report{
+		Id:         1,
+		TargetType: models.ReportTargetUser,
+		TargetId:   2,
+		Status:     models.ReportStatusOpen,
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 9})
+	context.Params = []gin.Param{
+		{
+			Key:   "reportId",
+			Value: "1",
+		},
+	}
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"action": "remove_content",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+
+	handlers.ResolveReport(mockReportService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "can not remove a user"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestResolveReport_SuspendCommentAuthor(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+	mockReportService.UserService.Users["author@test.com"] = models.User{
+		Id:    2,
+		Email: "author@test.com",
+	}
+	mockReportService.CommentService.Comments[1] = mocks.CommentRecord{
+		PostId: 1,
+		UserId: 2,
+	}
+	mockReportService.Reports[1] = models.Report{
+		Id:         1,
+		TargetType: models.ReportTargetComment,
+		TargetId:   1,
+		Status:     models.ReportStatusOpen,
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 9})
+	context.Params = []gin.Param{
+		{
+			Key:   "reportId",
+			Value: "1",
+		},
+	}
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"action":       "suspend_user",
+		"suspend_days": 3,
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+
+	handlers.ResolveReport(mockReportService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if mockReportService.UserService.Users["author@test.com"].SuspendedUntil == nil {
+		t.Error("Expected comment author to be suspended")
+	}
+}
+
+func TestListModerationActions_FilterTarget(t *testing.T) {
+	mockReportService := mocks.NewMockReportService()
+	mockReportService.Actions = []models.ModerationAction{
+		{Id: 1, TargetType: models.ReportTargetPost, TargetId: 1, Action: models.ModerationActionDismiss},
+		{Id: 2, TargetType: models.ReportTargetPost, TargetId: 2, Action: models.ModerationActionRemoveContent},
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request, _ = http.NewRequest("GET", "/?target_type=post&target_id=2", nil)
+
+	handlers.ListModerationActions(mockReportService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	expectedResponseBodyString := "action\":\"remove_content"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	unexpectedResponseBodyString := "action\":\"dismiss"
+	if strings.Contains(response.Body.String(), unexpectedResponseBodyString) {
+		t.Errorf("Expected response body not to contain %s, got %s", unexpectedResponseBodyString, response.Body.String())
+	}
+}
@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/jobs"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"github.com/ChenSongJian/ginstagram/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Resumable uploads follow the core tus protocol (https://tus.io): a client
+// creates an upload, sends chunks with PATCH at the offset it was told, asks
+// for the offset with HEAD after an interruption, and finally turns the upload
+// into media.
+const tusVersion = "1.0.0"
+
+type ResumableUploadReq struct {
+	Filename string `json:"filename" binding:"required"`
+	Size     int64  `json:"size" binding:"required,gt=0"`
+}
+
+func removeUpload(ctx context.Context, uploadSessionService services.UploadSessionService, mediaStorage storage.Storage, uploadId string) error {
+	if err := storage.DeleteStaged(mediaStorage, uploadId); err != nil {
+		return err
+	}
+	return uploadSessionService.DeleteById(ctx, uploadId)
+}
+
+// stageChunk stores the first size bytes of chunkFile as the chunk at the
+// offset of the upload, then moves the offset on. Of concurrent requests for
+// the same offset, whichever instance serves them, only one moves it on; the
+// others remove their chunk again and get the ErrNotFound of UpdateOffset.
+func stageChunk(ctx context.Context, uploadSessionService services.UploadSessionService, mediaStorage storage.Storage,
+	session models.UploadSession, chunkFile *os.File, size int64) error {
+	if _, err := chunkFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key := storage.StagingKey(session.Id, session.Offset, session.Offset+size, hex.EncodeToString(nonce))
+	if err := mediaStorage.Put(key, io.LimitReader(chunkFile, size), size, "application/octet-stream"); err != nil {
+		return err
+	}
+	if err := uploadSessionService.UpdateOffset(ctx, session.Id, session.Offset, session.Offset+size); err != nil {
+		// a chunk left behind is skipped when the upload is assembled and
+		// removed along with the upload
+		mediaStorage.Delete(key)
+		return err
+	}
+	return nil
+}
+
+// assembleUpload copies the staged chunks of a complete upload, in order, into
+// a temporary file in spoolDir. Chunks left behind by requests that lost the
+// race for an offset are skipped. Uploads staged in more than maxChunks chunks
+// are refused.
+func assembleUpload(mediaStorage storage.Storage, session models.UploadSession, spoolDir string, maxChunks int) (*os.File, error) {
+	chunks, err := storage.ListStaged(mediaStorage, session.Id)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) > maxChunks {
+		return nil, errors.New("upload " + session.Id + " is staged in too many chunks")
+	}
+	ordered, ok := chainChunks(chunks, session.Size)
+	if !ok {
+		return nil, errors.New("staged chunks of upload " + session.Id + " are incomplete")
+	}
+
+	if err := os.MkdirAll(spoolDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	spoolFile, err := os.CreateTemp(spoolDir, session.Id+"-*")
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range ordered {
+		if err := copyChunk(spoolFile, mediaStorage, chunk); err != nil {
+			spoolFile.Close()
+			os.Remove(spoolFile.Name())
+			return nil, err
+		}
+	}
+	return spoolFile, nil
+}
+
+// chainChunks picks chunks covering [0, size) end to end, in order. Chunks come
+// sorted by start, so going through them backwards every chunk ending where a
+// chain to size starts is known to lead to size when it is reached.
+func chainChunks(chunks []storage.Chunk, size int64) ([]storage.Chunk, bool) {
+	next := map[int64]storage.Chunk{}
+	for i := len(chunks) - 1; i >= 0; i-- {
+		chunk := chunks[i]
+		if _, ok := next[chunk.Start]; ok {
+			continue
+		}
+		if _, ok := next[chunk.End]; ok || chunk.End == size {
+			next[chunk.Start] = chunk
+		}
+	}
+	var ordered []storage.Chunk
+	for offset := int64(0); offset < size; {
+		chunk, ok := next[offset]
+		if !ok {
+			return nil, false
+		}
+		ordered = append(ordered, chunk)
+		offset = chunk.End
+	}
+	return ordered, true
+}
+
+func copyChunk(w io.Writer, mediaStorage storage.Storage, chunk storage.Chunk) error {
+	reader, _, err := mediaStorage.Get(chunk.Key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.CopyN(w, reader, chunk.End-chunk.Start)
+	return err
+}
+
+func setUploadHeaders(c *gin.Context, session models.UploadSession) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Size, 10))
+	c.Header("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-store")
+}
+
+// getOwnUpload loads the upload named in the path for the caller, writing the
+// error response if it does not exist, belongs to someone else or expired.
+func getOwnUpload(c *gin.Context, uploadSessionService services.UploadSessionService) (models.UploadSession, bool) {
+	tokenUser, exists := c.Get("tokenUser")
+	if !exists {
+		c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+		return models.UploadSession{}, false
+	}
+	modelTokenUser, ok := tokenUser.(models.User)
+	if !ok {
+		c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+		return models.UploadSession{}, false
+	}
+	uploadId := c.Param("uploadId")
+	if _, err := hex.DecodeString(uploadId); err != nil || len(uploadId) != 32 {
+		c.JSON(http.StatusNotFound, utils.NewErrorResponse(http.StatusNotFound, "upload not found"))
+		return models.UploadSession{}, false
+	}
+	session, err := uploadSessionService.GetById(c.Request.Context(), uploadId)
+	if err != nil {
+		respondError(c, err, errorMessages{services.ErrNotFound: "upload not found"})
+		return models.UploadSession{}, false
+	}
+	if session.UserId != modelTokenUser.Id {
+		c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "you can only access your own uploads"))
+		return models.UploadSession{}, false
+	}
+	if !time.Now().Before(session.ExpiresAt) {
+		c.JSON(http.StatusGone, utils.NewErrorResponse(http.StatusGone, "upload has expired"))
+		return models.UploadSession{}, false
+	}
+	return session, true
+}
+
+// CreateUpload starts a resumable upload of the declared size. Each user may
+// have a limited number and volume of unfinished uploads at a time, which also
+// count against their storage quota until finalized.
+func CreateUpload(uploadSessionService services.UploadSessionService, mediaService services.MediaService,
+	limits validation.Limits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		var req ResumableUploadReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if req.Size > max(limits.MaxImageSize, limits.MaxResumableSize) {
+			c.JSON(http.StatusRequestEntityTooLarge, utils.NewErrorResponse(http.StatusRequestEntityTooLarge, "File size exceeds limit"))
+			return
+		}
+
+		now := time.Now()
+		pendingCount, pendingBytes, err := uploadSessionService.SumPendingByUserId(c.Request.Context(), modelTokenUser.Id, now)
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		if pendingCount >= int64(limits.MaxPendingUploads) {
+			c.JSON(http.StatusTooManyRequests, utils.NewErrorResponse(http.StatusTooManyRequests, "too many unfinished uploads"))
+			return
+		}
+		if pendingBytes+req.Size > limits.MaxPendingUploadBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, utils.NewErrorResponse(http.StatusRequestEntityTooLarge, "unfinished uploads exceed quota"))
+			return
+		}
+		if !checkUploadQuota(c, mediaService, limits, modelTokenUser.Id, pendingBytes+req.Size, true) {
+			return
+		}
+
+		idBytes := make([]byte, 16)
+		if _, err := rand.Read(idBytes); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		session := models.UploadSession{
+			Id:        hex.EncodeToString(idBytes),
+			UserId:    modelTokenUser.Id,
+			Filename:  validation.SanitizeFilename(req.Filename),
+			Size:      req.Size,
+			ExpiresAt: now.Add(services.UploadSessionTTL),
+		}
+		if err := uploadSessionService.Create(c.Request.Context(), session); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+
+		setUploadHeaders(c, session)
+		c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+session.Id)
+		c.JSON(http.StatusCreated, gin.H{
+			"id":         session.Id,
+			"offset":     session.Offset,
+			"size":       session.Size,
+			"expires_at": session.ExpiresAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+}
+
+// GetUploadOffset tells a client where to resume an upload.
+func GetUploadOffset(uploadSessionService services.UploadSessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, ok := getOwnUpload(c, uploadSessionService)
+		if !ok {
+			return
+		}
+		setUploadHeaders(c, session)
+		c.Status(http.StatusOK)
+	}
+}
+
+// UploadChunk appends the request body to an upload. The Upload-Offset header
+// must match the current offset of the upload; whatever part of the body
+// arrives before an interruption is kept. The body is received into spoolDir
+// and then staged in storage, in no more than limits.MaxUploadChunks chunks.
+func UploadChunk(uploadSessionService services.UploadSessionService, mediaStorage storage.Storage, spoolDir string,
+	limits validation.Limits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, ok := getOwnUpload(c, uploadSessionService)
+		if !ok {
+			return
+		}
+		if c.ContentType() != "application/offset+octet-stream" {
+			c.JSON(http.StatusUnsupportedMediaType, utils.NewErrorResponse(http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream"))
+			return
+		}
+		offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid Upload-Offset header"))
+			return
+		}
+
+		if offset != session.Offset {
+			setUploadHeaders(c, session)
+			c.JSON(http.StatusConflict, utils.NewErrorResponse(http.StatusConflict, "upload offset mismatch"))
+			return
+		}
+		staged, err := storage.ListStaged(mediaStorage, session.Id)
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		if len(staged) >= limits.MaxUploadChunks {
+			setUploadHeaders(c, session)
+			c.JSON(http.StatusRequestEntityTooLarge, utils.NewErrorResponse(http.StatusRequestEntityTooLarge, "upload has too many chunks"))
+			return
+		}
+
+		if err := os.MkdirAll(spoolDir, os.ModePerm); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		chunkFile, err := os.CreateTemp(spoolDir, session.Id+"-*")
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		defer os.Remove(chunkFile.Name())
+		defer chunkFile.Close()
+		remaining := session.Size - offset
+		written, copyErr := io.Copy(chunkFile, io.LimitReader(c.Request.Body, remaining+1))
+		if written > remaining {
+			c.JSON(http.StatusRequestEntityTooLarge, utils.NewErrorResponse(http.StatusRequestEntityTooLarge, "chunk exceeds declared upload size"))
+			return
+		}
+		if written > 0 {
+			err := stageChunk(c.Request.Context(), uploadSessionService, mediaStorage, session, chunkFile, written)
+			if errors.Is(err, services.ErrNotFound) {
+				// another request wrote this chunk first
+				if session, err = uploadSessionService.GetById(c.Request.Context(), session.Id); err != nil {
+					respondError(c, err, errorMessages{services.ErrNotFound: "upload not found"})
+					return
+				}
+				setUploadHeaders(c, session)
+				c.JSON(http.StatusConflict, utils.NewErrorResponse(http.StatusConflict, "upload offset mismatch"))
+				return
+			}
+			if err != nil {
+				respondError(c, err, nil)
+				return
+			}
+			session.Offset += written
+		}
+		if copyErr != nil {
+			setUploadHeaders(c, session)
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "Error reading chunk"))
+			return
+		}
+		setUploadHeaders(c, session)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// FinalizeUpload validates a complete upload and turns it into media that can
+// be attached to a post, exactly as UploadMedia does. Images keep their usual
+// size limit; videos may be as large as limits.MaxResumableSize. The upload is
+// moved to finalizing first, so a retry or a concurrent request can not make
+// media of it twice; it goes back to uploading only if finalizing failed on
+// the server, and otherwise stays finalizing until it is removed or expires.
+func FinalizeUpload(uploadSessionService services.UploadSessionService, mediaService services.MediaService,
+	mediaStorage storage.Storage, spoolDir string, limits validation.Limits, transcodeQueue jobs.MediaQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, ok := getOwnUpload(c, uploadSessionService)
+		if !ok {
+			return
+		}
+		if session.Offset != session.Size {
+			setUploadHeaders(c, session)
+			c.JSON(http.StatusConflict, utils.NewErrorResponse(http.StatusConflict, "upload is incomplete"))
+			return
+		}
+		// media stored since the upload was created may have used up the
+		// quota; the upload is kept in case the user makes room for it
+		if !checkUploadQuota(c, mediaService, limits, session.UserId, session.Size, false) {
+			return
+		}
+		err := uploadSessionService.UpdateStatus(c.Request.Context(), session.Id, models.UploadStatusUploading, models.UploadStatusFinalizing)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrConflict: "upload is already being finalized"})
+			return
+		}
+		spoolFile, err := assembleUpload(mediaStorage, session, spoolDir, limits.MaxUploadChunks)
+		if err != nil {
+			uploadSessionService.UpdateStatus(c.Request.Context(), session.Id, models.UploadStatusFinalizing, models.UploadStatusUploading)
+			respondError(c, err, nil)
+			return
+		}
+		defer os.Remove(spoolFile.Name())
+		defer spoolFile.Close()
+
+		// only the declared bytes count, whatever the spool file holds
+		upload := io.NewSectionReader(spoolFile, 0, session.Size)
+		if mediaType, err := limits.Check(upload, session.Size, true); err != nil {
+			writeValidationError(c, err)
+		} else {
+			storeMedia(c, mediaService, mediaStorage, transcodeQueue, session.UserId, upload, session.Size, mediaType, session.Filename,
+				limits.MaxImagePixels)
+		}
+		// a file that is not valid media will not become valid on a retry
+		if c.Writer.Status() < http.StatusInternalServerError {
+			removeUpload(c.Request.Context(), uploadSessionService, mediaStorage, session.Id)
+		} else {
+			uploadSessionService.UpdateStatus(c.Request.Context(), session.Id, models.UploadStatusFinalizing, models.UploadStatusUploading)
+		}
+	}
+}
+
+// DeleteUpload abandons an upload.
+func DeleteUpload(uploadSessionService services.UploadSessionService, mediaStorage storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, ok := getOwnUpload(c, uploadSessionService)
+		if !ok {
+			return
+		}
+		if err := removeUpload(c.Request.Context(), uploadSessionService, mediaStorage, session.Id); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.Header("Tus-Resumable", tusVersion)
+		c.Status(http.StatusNoContent)
+	}
+}
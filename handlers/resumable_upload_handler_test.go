@@ -0,0 +1,343 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/handlers"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func callUploadHandler(handler gin.HandlerFunc, userId int, uploadId string, request *http.Request) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request = request
+	context.Set("tokenUser", models.User{Id: userId})
+	context.Params = []gin.Param{
+		{
+			Key:   "uploadId",
+			Value: uploadId,
+		},
+	}
+	handler(context)
+	context.Writer.WriteHeaderNow()
+	return response
+}
+
+func createUpload(t *testing.T, mockUploadSessionService *mocks.MockUploadSessionService, size int) string {
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"filename": "photo.png",
+		"size":     size,
+	})
+	request, _ := http.NewRequest("POST", "/api/v1/upload/resumable", bytes.NewReader(jsonBody))
+	response := callUploadHandler(handlers.CreateUpload(mockUploadSessionService, mocks.NewMockMediaService(), validation.DefaultLimits), 1, "", request)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, response.Code, response.Body.String())
+	}
+	var body struct {
+		Id string `json:"id"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &body)
+	if response.Header().Get("Location") != "/api/v1/upload/resumable/"+body.Id {
+		t.Errorf("Unexpected location %s", response.Header().Get("Location"))
+	}
+	return body.Id
+}
+
+func newChunkRequest(offset int, chunk []byte) *http.Request {
+	request, _ := http.NewRequest("PATCH", "/", bytes.NewReader(chunk))
+	request.Header.Set("Content-Type", "application/offset+octet-stream")
+	request.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	return request
+}
+
+func TestResumableUpload_Success(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	spoolDir := t.TempDir()
+	content := pngBytes()
+	uploadId := createUpload(t, mockUploadSessionService, len(content))
+
+	half := len(content) / 2
+	response := callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, validation.DefaultLimits), 1, uploadId, newChunkRequest(0, content[:half]))
+	if response.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, response.Code, response.Body.String())
+	}
+
+	request, _ := http.NewRequest("HEAD", "/", nil)
+	response = callUploadHandler(handlers.GetUploadOffset(mockUploadSessionService), 1, uploadId, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if response.Header().Get("Upload-Offset") != strconv.Itoa(half) || response.Header().Get("Upload-Length") != strconv.Itoa(len(content)) {
+		t.Errorf("Unexpected upload headers %v", response.Header())
+	}
+
+	request, _ = http.NewRequest("POST", "/", nil)
+	response = callUploadHandler(handlers.FinalizeUpload(mockUploadSessionService, mockMediaService, mediaStorage, spoolDir, validation.DefaultLimits, mocks.NewMockMediaQueue()), 1, uploadId, request)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for an incomplete upload, got %d", http.StatusConflict, response.Code)
+	}
+
+	response = callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, validation.DefaultLimits), 1, uploadId, newChunkRequest(half, content[half:]))
+	if response.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, response.Code, response.Body.String())
+	}
+
+	request, _ = http.NewRequest("POST", "/", nil)
+	response = callUploadHandler(handlers.FinalizeUpload(mockUploadSessionService, mockMediaService, mediaStorage, spoolDir, validation.DefaultLimits, mocks.NewMockMediaQueue()), 1, uploadId, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, response.Code, response.Body.String())
+	}
+	var body struct {
+		Id int `json:"id"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &body)
+	media, found := mockMediaService.Media[body.Id]
+	if !found || media.UserId != 1 || media.ContentType != "image/png" {
+		t.Errorf("Expected media owned by the uploader, got %+v", media)
+	}
+	if len(mockUploadSessionService.Sessions) != 0 {
+		t.Errorf("Expected finalized upload to be removed, got %v", mockUploadSessionService.Sessions)
+	}
+}
+
+func TestResumableUpload_AcrossInstances(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	content := pngBytes()
+	uploadId := createUpload(t, mockUploadSessionService, len(content))
+
+	// every request is served by an instance with its own spool directory
+	half := len(content) / 2
+	response := callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, t.TempDir(), validation.DefaultLimits), 1, uploadId, newChunkRequest(0, content[:half]))
+	if response.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, response.Code, response.Body.String())
+	}
+	// left behind by a request for the same offset that lost the race
+	leftover := storage.StagingKey(uploadId, 0, 3, "lost")
+	if err := mediaStorage.Put(leftover, strings.NewReader("abc"), 3, "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+	response = callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, t.TempDir(), validation.DefaultLimits), 1, uploadId, newChunkRequest(half, content[half:]))
+	if response.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, response.Code, response.Body.String())
+	}
+
+	request, _ := http.NewRequest("POST", "/", nil)
+	response = callUploadHandler(handlers.FinalizeUpload(mockUploadSessionService, mockMediaService, mediaStorage, t.TempDir(), validation.DefaultLimits, mocks.NewMockMediaQueue()), 1, uploadId, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, response.Code, response.Body.String())
+	}
+	var body struct {
+		Id int `json:"id"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &body)
+	reader, object, err := mediaStorage.Get(mockMediaService.Media[body.Id].Url)
+	if err != nil {
+		t.Fatalf("Error getting media: %v", err)
+	}
+	reader.Close()
+	if object.Size != int64(len(content)) {
+		t.Errorf("Expected the chunks to be assembled into %d bytes, got %d", len(content), object.Size)
+	}
+	if chunks, _ := storage.ListStaged(mediaStorage, uploadId); len(chunks) != 0 {
+		t.Errorf("Expected the staged chunks to be removed, got %+v", chunks)
+	}
+}
+
+func TestFinalizeUpload_AlreadyFinalizing(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	spoolDir := t.TempDir()
+	content := pngBytes()
+	uploadId := createUpload(t, mockUploadSessionService, len(content))
+	callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, validation.DefaultLimits), 1, uploadId, newChunkRequest(0, content))
+	session := mockUploadSessionService.Sessions[uploadId]
+	session.Status = models.UploadStatusFinalizing
+	mockUploadSessionService.Sessions[uploadId] = session
+
+	request, _ := http.NewRequest("POST", "/", nil)
+	response := callUploadHandler(handlers.FinalizeUpload(mockUploadSessionService, mockMediaService, mediaStorage, spoolDir, validation.DefaultLimits, mocks.NewMockMediaQueue()), 1, uploadId, request)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, response.Code)
+	}
+	expectedResponseBodyString := "upload is already being finalized"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockMediaService.Media) != 0 {
+		t.Errorf("Expected no media to be created, got %v", mockMediaService.Media)
+	}
+}
+
+func TestUploadChunk_OffsetMismatch(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	spoolDir := t.TempDir()
+	uploadId := createUpload(t, mockUploadSessionService, 10)
+
+	response := callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, validation.DefaultLimits), 1, uploadId, newChunkRequest(4, []byte("abc")))
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, response.Code)
+	}
+	if response.Header().Get("Upload-Offset") != "0" {
+		t.Errorf("Expected current offset 0, got %s", response.Header().Get("Upload-Offset"))
+	}
+}
+
+func TestUploadChunk_TooManyChunks(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	spoolDir := t.TempDir()
+	uploadId := createUpload(t, mockUploadSessionService, 4)
+	limits := validation.DefaultLimits
+	limits.MaxUploadChunks = 1
+
+	response := callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, limits), 1, uploadId, newChunkRequest(0, []byte("da")))
+	if response.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d", http.StatusNoContent, response.Code)
+	}
+	response = callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, limits), 1, uploadId, newChunkRequest(2, []byte("ta")))
+	if response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, response.Code)
+	}
+	if mockUploadSessionService.Sessions[uploadId].Offset != 2 {
+		t.Errorf("Expected offset to stay 2, got %d", mockUploadSessionService.Sessions[uploadId].Offset)
+	}
+}
+
+func TestUploadChunk_ExceedsSize(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	spoolDir := t.TempDir()
+	uploadId := createUpload(t, mockUploadSessionService, 4)
+
+	response := callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, validation.DefaultLimits), 1, uploadId, newChunkRequest(0, []byte("too long")))
+	if response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, response.Code)
+	}
+	if mockUploadSessionService.Sessions[uploadId].Offset != 0 {
+		t.Errorf("Expected offset to stay 0, got %d", mockUploadSessionService.Sessions[uploadId].Offset)
+	}
+}
+
+func TestUploadChunk_OtherUser(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	spoolDir := t.TempDir()
+	uploadId := createUpload(t, mockUploadSessionService, 4)
+
+	response := callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, validation.DefaultLimits), 2, uploadId, newChunkRequest(0, []byte("data")))
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+}
+
+func TestUploadChunk_Expired(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	spoolDir := t.TempDir()
+	uploadId := createUpload(t, mockUploadSessionService, 4)
+	session := mockUploadSessionService.Sessions[uploadId]
+	session.ExpiresAt = time.Now().Add(-time.Minute)
+	mockUploadSessionService.Sessions[uploadId] = session
+
+	response := callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, validation.DefaultLimits), 1, uploadId, newChunkRequest(0, []byte("data")))
+	if response.Code != http.StatusGone {
+		t.Errorf("Expected status code %d, got %d", http.StatusGone, response.Code)
+	}
+}
+
+func TestCreateUpload_Quota(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	for i := 0; i < 5; i++ {
+		createUpload(t, mockUploadSessionService, 10)
+	}
+
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"filename": "video.mp4",
+		"size":     10,
+	})
+	request, _ := http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	response := callUploadHandler(handlers.CreateUpload(mockUploadSessionService, mocks.NewMockMediaService(), validation.DefaultLimits), 1, "", request)
+	if response.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, response.Code)
+	}
+	expectedResponseBodyString := "too many unfinished uploads"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestCreateUpload_TooLarge(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"filename": "video.mp4",
+		"size":     int64(2) << 30,
+	})
+	request, _ := http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	response := callUploadHandler(handlers.CreateUpload(mockUploadSessionService, mocks.NewMockMediaService(), validation.DefaultLimits), 1, "", request)
+	if response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, response.Code)
+	}
+}
+
+func TestFinalizeUpload_UnsupportedType(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	spoolDir := t.TempDir()
+	content := []byte("plain text")
+	uploadId := createUpload(t, mockUploadSessionService, len(content))
+	callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, validation.DefaultLimits), 1, uploadId, newChunkRequest(0, content))
+
+	request, _ := http.NewRequest("POST", "/", nil)
+	response := callUploadHandler(handlers.FinalizeUpload(mockUploadSessionService, mockMediaService, mediaStorage, spoolDir, validation.DefaultLimits, mocks.NewMockMediaQueue()), 1, uploadId, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "Unsupported file type"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+	if len(mockMediaService.Media) != 0 || len(mockUploadSessionService.Sessions) != 0 {
+		t.Errorf("Expected no media and the upload to be discarded")
+	}
+}
+
+func TestFinalizeUpload_QuotaExceeded(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	spoolDir := t.TempDir()
+	content := []byte("plain text")
+	uploadId := createUpload(t, mockUploadSessionService, len(content))
+	callUploadHandler(handlers.UploadChunk(mockUploadSessionService, mediaStorage, spoolDir, validation.DefaultLimits), 1, uploadId, newChunkRequest(0, content))
+	// stored elsewhere while the upload was under way
+	limits := validation.DefaultLimits
+	limits.MaxStoredBytes = 100
+	mockMediaService.Media[1] = mocks.MediaRecord{Url: "a.jpg", UserId: 1, Size: 95, CreatedAt: time.Now()}
+
+	request, _ := http.NewRequest("POST", "/", nil)
+	response := callUploadHandler(handlers.FinalizeUpload(mockUploadSessionService, mockMediaService, mediaStorage, spoolDir, limits, mocks.NewMockMediaQueue()), 1, uploadId, request)
+	if response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, response.Code)
+	}
+	if _, ok := mockUploadSessionService.Sessions[uploadId]; !ok {
+		t.Error("Expected the upload to be kept")
+	}
+}
@@ -4,109 +4,309 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"image"
 	"io"
-	"mime/multipart"
+	"log"
+	"math"
 	"net/http"
-	"os"
-	"strings"
+	"strconv"
 	"time"
 
+	"github.com/ChenSongJian/ginstagram/imaging"
+	"github.com/ChenSongJian/ginstagram/jobs"
+	"github.com/ChenSongJian/ginstagram/metrics"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"github.com/ChenSongJian/ginstagram/validation"
+	"github.com/ChenSongJian/ginstagram/video"
 	"github.com/gin-gonic/gin"
 )
 
-func UploadMedia(c *gin.Context) {
-	err := c.Request.ParseMultipartForm(20 << 20)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File size exceeds limit"})
-		return
-	}
+// multipartOverhead is what a multipart body may add to the file it carries.
+const multipartOverhead = 1 << 20
 
-	fileHeader := c.Request.MultipartForm.File["file"]
-	if len(fileHeader) != 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only one file allowed to upload"})
-		return
+// UploadMedia stores a file and records it as media owned by the caller. The
+// returned id is what a post references to attach the media.
+func UploadMedia(mediaService services.MediaService, mediaStorage storage.Storage, limits validation.Limits,
+	transcodeQueue jobs.MediaQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+
+		if !checkUploadQuota(c, mediaService, limits, modelTokenUser.Id, 0, true) {
+			return
+		}
+		maxBodySize := max(limits.MaxImageSize, limits.MaxVideoSize) + multipartOverhead
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
+		err := c.Request.ParseMultipartForm(20 << 20)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "File size exceeds limit"))
+			return
+		}
+
+		fileHeader := c.Request.MultipartForm.File["file"]
+		if len(fileHeader) != 1 {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "Only one file allowed to upload"))
+			return
+		}
+
+		file, err := fileHeader[0].Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "Error retrieving file"))
+			return
+		}
+		defer file.Close()
+
+		mediaType, err := limits.Check(file, fileHeader[0].Size, false)
+		if err != nil {
+			writeValidationError(c, err)
+			return
+		}
+		if !checkUploadQuota(c, mediaService, limits, modelTokenUser.Id, fileHeader[0].Size, false) {
+			return
+		}
+		storeMedia(c, mediaService, mediaStorage, transcodeQueue, modelTokenUser.Id, file, fileHeader[0].Size, mediaType,
+			validation.SanitizeFilename(fileHeader[0].Filename), limits.MaxImagePixels)
 	}
+}
 
-	file, err := fileHeader[0].Open()
+// checkUploadQuota checks that a user may store size more bytes and, with
+// isNewUpload set, start another upload within the hourly limit. It writes the
+// error response if not.
+func checkUploadQuota(c *gin.Context, mediaService services.MediaService, limits validation.Limits,
+	userId int, size int64, isNewUpload bool) bool {
+	now := time.Now()
+	usage, err := mediaService.UsageByUserId(c.Request.Context(), userId, now.Add(-time.Hour))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error retrieving file"})
-		return
+		respondError(c, err, nil)
+		return false
 	}
-	defer file.Close()
-
-	buffer := make([]byte, 512)
-	n, err := file.Read(buffer)
-	if err != nil && err != io.EOF {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading file"})
-		return
+	if isNewUpload && usage.RecentUploads >= int64(limits.MaxUploadsPerHour) {
+		retryAfter := usage.OldestRecentUpload.Add(time.Hour).Sub(now)
+		c.Header("Retry-After", strconv.Itoa(max(int(math.Ceil(retryAfter.Seconds())), 1)))
+		c.JSON(http.StatusTooManyRequests, utils.NewErrorResponse(http.StatusTooManyRequests, "upload rate limit exceeded"))
+		return false
 	}
-	if n == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Uploaded file is empty"})
-		return
+	if usage.StoredBytes+size > limits.MaxStoredBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, utils.NewErrorResponse(http.StatusRequestEntityTooLarge, "storage quota exceeded"))
+		return false
 	}
+	return true
+}
 
-	fileType := http.DetectContentType(buffer)
-	fileSize := fileHeader[0].Size
-
-	var maxFileSize int64
-	if strings.HasPrefix(fileType, "video/") {
-		maxFileSize = 20 << 20
-	} else if strings.HasPrefix(fileType, "image/") {
-		maxFileSize = 5 << 20
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported file type"})
-		return
-	}
-	if fileSize > maxFileSize {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File size exceeds limit"})
-		return
+// GetUploadUsage shows the caller how much of their quota and hourly upload
+// limit they have used.
+func GetUploadUsage(mediaService services.MediaService, uploadSessionService services.UploadSessionService,
+	limits validation.Limits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
+			return
+		}
+		now := time.Now()
+		usage, err := mediaService.UsageByUserId(c.Request.Context(), modelTokenUser.Id, now.Add(-time.Hour))
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		pendingCount, pendingBytes, err := uploadSessionService.SumPendingByUserId(c.Request.Context(), modelTokenUser.Id, now)
+		if err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"stored_bytes":            usage.StoredBytes,
+			"quota_bytes":             limits.MaxStoredBytes,
+			"media_count":             usage.MediaCount,
+			"uploads_last_hour":       usage.RecentUploads,
+			"max_uploads_per_hour":    limits.MaxUploadsPerHour,
+			"unfinished_uploads":      pendingCount,
+			"unfinished_upload_bytes": pendingBytes,
+		})
 	}
+}
 
-	current := time.Now()
-	folderName := fmt.Sprintf("%d-%02d-%02d", current.Year(), current.Month(), current.Day())
-
-	fileHash := generateFileHash(fileHeader[0], current.String())
-	fileName := fileHeader[0].Filename
-	fileExtension := strings.ToLower(fileName[strings.LastIndex(fileName, ".")+1:])
-	fileNameWithoutExt := fileName[:strings.LastIndex(fileName, ".")]
-	newFileName := fmt.Sprintf("%s-%s.%s", fileHash, fileNameWithoutExt, fileExtension)
+// writeValidationError responds to an upload that validation.Limits.Check
+// rejected.
+func writeValidationError(c *gin.Context, err error) {
+	var invalidFile *validation.InvalidFileError
+	switch {
+	case errors.Is(err, validation.ErrEmptyFile):
+		c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "Uploaded file is empty"))
+	case errors.Is(err, validation.ErrUnsupportedType):
+		c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "Unsupported file type"))
+	case errors.Is(err, validation.ErrFileTooLarge):
+		c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "File size exceeds limit"))
+	case errors.As(err, &invalidFile):
+		c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid %s: %v", invalidFile.Kind, invalidFile.Err)))
+	default:
+		c.JSON(http.StatusInternalServerError, utils.NewErrorResponse(http.StatusInternalServerError, "Error reading file"))
+	}
+}
 
-	uploadDir := fmt.Sprintf("uploads/%s", folderName)
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		err := os.MkdirAll(uploadDir, os.ModePerm)
+// storeMedia stores an upload that passed validation and records it as media
+// of userId. Videos are queued for transcoding and processing until done,
+// unless the same video was uploaded and transcoded before. It writes the
+// response.
+func storeMedia(c *gin.Context, mediaService services.MediaService, mediaStorage storage.Storage,
+	transcodeQueue jobs.MediaQueue, userId int, file io.ReadSeeker, fileSize int64, mediaType validation.MediaType,
+	filename string, maxImagePixels int) {
+	media := models.Media{
+		UserId:      userId,
+		Filename:    filename,
+		ContentType: mediaType.ContentType,
+		Status:      models.MediaStatusReady,
+	}
+	if !imaging.IsSupported(mediaType.ContentType) {
+		switch mediaType.ContentType {
+		case "video/mp4":
+			info, err := video.Probe(file)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "Invalid video: "+err.Error()))
+				return
+			}
+			media.Width, media.Height, media.DurationMs = info.Width, info.Height, info.Duration.Milliseconds()
+		case "image/gif":
+			// animations are kept as they are
+			if config, _, err := image.DecodeConfig(file); err == nil {
+				media.Width, media.Height = config.Width, config.Height
+			}
+		}
+		hasher := sha256.New()
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			c.JSON(http.StatusInternalServerError, utils.NewErrorResponse(http.StatusInternalServerError, "Error reading file"))
+			return
+		}
+		if _, err := io.Copy(hasher, file); err != nil {
+			c.JSON(http.StatusInternalServerError, utils.NewErrorResponse(http.StatusInternalServerError, "Error reading file"))
+			return
+		}
+		media.Sha256 = hex.EncodeToString(hasher.Sum(nil))
+		media.Size = fileSize
+		media.Url = storage.BlobKey(media.Sha256, mediaType.Ext)
+		if mediaType.Kind == validation.KindVideo {
+			media.Status = models.MediaStatusProcessing
+			shared, err := mediaService.ListByKey(c.Request.Context(), media.Url)
+			if err != nil {
+				respondError(c, err, nil)
+				return
+			}
+			for _, m := range shared {
+				if m.Status == models.MediaStatusReady {
+					media.Status, media.Width, media.Height, media.DurationMs = m.Status, m.Width, m.Height, m.DurationMs
+					break
+				}
+			}
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			c.JSON(http.StatusInternalServerError, utils.NewErrorResponse(http.StatusInternalServerError, "Error reading file"))
+			return
+		}
+		mediaId, err := mediaService.Create(c.Request.Context(), media)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create upload directory: " + err.Error()})
+			respondError(c, err, nil)
+			return
+		}
+		if err := putBlob(mediaStorage, media.Url, file, fileSize, mediaType.ContentType); err != nil {
+			discardMedia(c, mediaService, mediaId)
 			return
 		}
+		countUpload(mediaType, fileSize)
+		if media.Status == models.MediaStatusProcessing {
+			transcodeQueue.Enqueue(mediaId)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "File uploaded successfully", "id": mediaId, "filename": media.Url,
+			"status": media.Status})
+		return
 	}
 
-	fileNameWithPath := fmt.Sprintf("%s/%s", uploadDir, newFileName)
-	out, err := os.Create(fileNameWithPath)
+	data, err := io.ReadAll(file)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create the file for writing."})
+		c.JSON(http.StatusInternalServerError, utils.NewErrorResponse(http.StatusInternalServerError, "Error reading file"))
 		return
 	}
-	defer out.Close()
+	processed, err := imaging.Process(data, mediaType.ContentType, maxImagePixels)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "Invalid image: "+err.Error()))
+		return
+	}
+	checksum := sha256.Sum256(processed.Original)
+	media.Sha256 = hex.EncodeToString(checksum[:])
+	media.Url = storage.BlobKey(media.Sha256, processed.Ext)
+	media.ContentType = processed.ContentType
+	media.Size = int64(len(processed.Original))
+	media.Width, media.Height = processed.Width, processed.Height
 
-	_, err = io.Copy(out, io.MultiReader(bytes.NewReader(buffer[:n]), file))
+	mediaId, err := mediaService.Create(c.Request.Context(), media)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error copying file."})
+		respondError(c, err, nil)
 		return
 	}
+	// the original goes last so that a blob found in storage always has all of
+	// its variants
+	variantKeys := imaging.VariantKeys(media.Url)
+	if _, err := mediaStorage.Stat(media.Url); errors.Is(err, storage.ErrNotFound) {
+		for name, variant := range processed.Variants {
+			err = mediaStorage.Put(variantKeys[name], bytes.NewReader(variant), int64(len(variant)), processed.ContentType)
+			if err != nil {
+				discardMedia(c, mediaService, mediaId)
+				return
+			}
+		}
+		err = mediaStorage.Put(media.Url, bytes.NewReader(processed.Original), media.Size, processed.ContentType)
+		if err != nil {
+			discardMedia(c, mediaService, mediaId)
+			return
+		}
+	} else if err != nil {
+		discardMedia(c, mediaService, mediaId)
+		return
+	}
+	countUpload(mediaType, fileSize)
 
-	c.JSON(http.StatusOK, gin.H{"message": "File uploaded successfully", "filename": fileNameWithPath})
+	c.JSON(http.StatusOK, gin.H{"message": "File uploaded successfully", "id": mediaId, "filename": media.Url,
+		"variants": variantKeys, "status": media.Status})
 }
 
-func generateFileHash(fileHeader *multipart.FileHeader, additionalData string) string {
-	file, err := fileHeader.Open()
-	if err != nil {
-		return ""
+func countUpload(mediaType validation.MediaType, size int64) {
+	metrics.Uploads.WithLabelValues(mediaType.ContentType).Inc()
+	metrics.UploadBytes.WithLabelValues(mediaType.ContentType).Add(float64(size))
+}
+
+// putBlob stores a blob unless it is there already.
+// discardMedia deletes the row of media whose files could not be stored and
+// responds with the error.
+func discardMedia(c *gin.Context, mediaService services.MediaService, mediaId int) {
+	if err := mediaService.DeleteById(c.Request.Context(), mediaId); err != nil {
+		log.Printf("unable to delete media %d after failing to store it: %v", mediaId, err)
 	}
-	defer file.Close()
+	c.JSON(http.StatusInternalServerError, utils.NewErrorResponse(http.StatusInternalServerError, "Error storing file."))
+}
 
-	hasher := sha256.New()
-	io.Copy(hasher, file)
-	io.WriteString(hasher, additionalData)
-	return hex.EncodeToString(hasher.Sum(nil))
+// putBlob stores a blob unless it is already there. Its media row must exist,
+// which keeps the cleanup jobs from removing the blob once it is found.
+func putBlob(mediaStorage storage.Storage, key string, r io.Reader, size int64, contentType string) error {
+	_, err := mediaStorage.Stat(key)
+	if err == nil || !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return mediaStorage.Put(key, r, size, contentType)
 }
@@ -0,0 +1,390 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/handlers"
+	"github.com/ChenSongJian/ginstagram/imaging"
+	"github.com/ChenSongJian/ginstagram/metrics"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newUploadRequest(t *testing.T, fileName string, content []byte) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatalf("Error creating form file: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+	request, _ := http.NewRequest("POST", "/", body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+func pngBytes() []byte {
+	var buffer bytes.Buffer
+	png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	return buffer.Bytes()
+}
+
+func TestUploadMedia_UnsupportedType(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request = newUploadRequest(t, "notes.txt", []byte("plain text"))
+
+	handlers.UploadMedia(mockMediaService, mediaStorage, validation.DefaultLimits, mocks.NewMockMediaQueue())(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "Unsupported file type"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestUploadMedia_Success(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	content := pngBytes()
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request = newUploadRequest(t, "photo.png", content)
+	uploads := testutil.ToFloat64(metrics.Uploads.WithLabelValues("image/png"))
+	uploadBytes := testutil.ToFloat64(metrics.UploadBytes.WithLabelValues("image/png"))
+
+	handlers.UploadMedia(mockMediaService, mediaStorage, validation.DefaultLimits, mocks.NewMockMediaQueue())(context)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if testutil.ToFloat64(metrics.Uploads.WithLabelValues("image/png")) != uploads+1 ||
+		testutil.ToFloat64(metrics.UploadBytes.WithLabelValues("image/png")) != uploadBytes+float64(len(content)) {
+		t.Errorf("Expected the upload of %d bytes to be counted", len(content))
+	}
+	var body struct {
+		Id       int               `json:"id"`
+		Filename string            `json:"filename"`
+		Variants map[string]string `json:"variants"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	reader, _, err := mediaStorage.Get(body.Filename)
+	if err != nil {
+		t.Fatalf("Expected uploaded file in storage, got %v", err)
+	}
+	defer reader.Close()
+	stored, _ := io.ReadAll(reader)
+	checksum := sha256.Sum256(stored)
+	expectedFilename := "uploads/sha256/" + hex.EncodeToString(checksum[:1]) + "/" + hex.EncodeToString(checksum[:]) + ".png"
+	if body.Filename != expectedFilename {
+		t.Errorf("Expected filename %s, got %s", expectedFilename, body.Filename)
+	}
+	if _, err := png.Decode(bytes.NewReader(stored)); err != nil {
+		t.Errorf("Expected stored file to be a png, got %v", err)
+	}
+	if len(body.Variants) == 0 {
+		t.Errorf("Expected variants in response, got %s", response.Body.String())
+	}
+	for name, key := range body.Variants {
+		if _, err := mediaStorage.Stat(key); err != nil {
+			t.Errorf("Expected %s variant in storage, got %v", name, err)
+		}
+	}
+	media, found := mockMediaService.Media[body.Id]
+	if !found {
+		t.Fatalf("Expected media %d to be recorded", body.Id)
+	}
+	if media.Url != body.Filename || media.UserId != 1 || media.PostId != 0 || media.ContentType != "image/png" ||
+		media.Size != int64(len(stored)) || media.Width != 2 || media.Height != 2 ||
+		media.Sha256 != hex.EncodeToString(checksum[:]) || media.Status != models.MediaStatusReady {
+		t.Errorf("Unexpected media record %+v", media)
+	}
+}
+
+func TestUploadMedia_MissingToken(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request = newUploadRequest(t, "photo.png", pngBytes())
+
+	handlers.UploadMedia(mockMediaService, mediaStorage, validation.DefaultLimits, mocks.NewMockMediaQueue())(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "user not found in token"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestUploadMedia_InvalidImage(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	content := pngBytes()[:40]
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request = newUploadRequest(t, "broken.png", content)
+
+	handlers.UploadMedia(mockMediaService, mediaStorage, validation.DefaultLimits, mocks.NewMockMediaQueue())(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "Invalid image"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestUploadMedia_Deduplicated(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+
+	var filenames []string
+	for _, userId := range []int{1, 2} {
+		response := httptest.NewRecorder()
+		context, _ := gin.CreateTestContext(response)
+		context.Set("tokenUser", models.User{Id: userId})
+		context.Request = newUploadRequest(t, "photo.png", pngBytes())
+
+		handlers.UploadMedia(mockMediaService, mediaStorage, validation.DefaultLimits, mocks.NewMockMediaQueue())(context)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, response.Code)
+		}
+		var body struct {
+			Filename string `json:"filename"`
+		}
+		if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Error unmarshaling response body: %v", err)
+		}
+		filenames = append(filenames, body.Filename)
+	}
+	if filenames[0] != filenames[1] {
+		t.Errorf("Expected identical uploads to share a blob, got %v", filenames)
+	}
+	if len(mockMediaService.Media) != 2 {
+		t.Errorf("Expected a media record per upload, got %d", len(mockMediaService.Media))
+	}
+
+	var keys []string
+	mediaStorage.List("uploads/", func(object storage.Object) error {
+		keys = append(keys, object.Key)
+		return nil
+	})
+	if expectedKeys := len(imaging.Variants) + 1; len(keys) != expectedKeys {
+		t.Errorf("Expected %d stored files, got %v", expectedKeys, keys)
+	}
+}
+
+func TestUploadMedia_SanitizedFilename(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request = newUploadRequest(t, "../../no-extension", pngBytes())
+
+	handlers.UploadMedia(mockMediaService, mediaStorage, validation.DefaultLimits, mocks.NewMockMediaQueue())(context)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	var body struct {
+		Id       int    `json:"id"`
+		Filename string `json:"filename"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if !strings.HasSuffix(body.Filename, ".png") {
+		t.Errorf("Expected extension from the detected type, got %s", body.Filename)
+	}
+	if filename := mockMediaService.Media[body.Id].Filename; filename != "no-extension" {
+		t.Errorf("Expected sanitized filename no-extension, got %s", filename)
+	}
+}
+
+func mp4Box(boxType string, body ...[]byte) []byte {
+	content := bytes.Join(body, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(content)))
+	copy(header[4:], boxType)
+	return append(header, content...)
+}
+
+// mp4Bytes is the smallest MP4 that probes: a 640x360 track lasting 3s.
+var mp4Bytes = func() []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 3000)
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], 640<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 360<<16)
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41")),
+		mp4Box("moov", mp4Box("mvhd", mvhd), mp4Box("trak", mp4Box("tkhd", tkhd))),
+	}, nil)
+}()
+
+func TestUploadMedia_VideoQueued(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mockMediaQueue := mocks.NewMockMediaQueue()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request = newUploadRequest(t, "clip.mp4", mp4Bytes)
+
+	handlers.UploadMedia(mockMediaService, mediaStorage, validation.DefaultLimits, mockMediaQueue)(context)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, response.Code, response.Body.String())
+	}
+	var body struct {
+		Id     int    `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if body.Status != models.MediaStatusProcessing || mockMediaService.Media[body.Id].Status != models.MediaStatusProcessing {
+		t.Errorf("Expected the video to be processing, got %s", body.Status)
+	}
+	if len(mockMediaQueue.Enqueued) != 1 || mockMediaQueue.Enqueued[0] != body.Id {
+		t.Errorf("Expected media %d to be queued, got %v", body.Id, mockMediaQueue.Enqueued)
+	}
+}
+
+func TestUploadMedia_VideoTranscodedBefore(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mockMediaQueue := mocks.NewMockMediaQueue()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	checksum := sha256.Sum256(mp4Bytes)
+	sha256Hex := hex.EncodeToString(checksum[:])
+	mockMediaService.Media[1] = mocks.MediaRecord{Url: storage.BlobKey(sha256Hex, "mp4"), UserId: 2, Sha256: sha256Hex,
+		ContentType: "video/mp4", Status: models.MediaStatusReady, Width: 640, Height: 360, DurationMs: 3000}
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request = newUploadRequest(t, "clip.mp4", mp4Bytes)
+
+	handlers.UploadMedia(mockMediaService, mediaStorage, validation.DefaultLimits, mockMediaQueue)(context)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, response.Code, response.Body.String())
+	}
+	var body struct {
+		Id int `json:"id"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if media := mockMediaService.Media[body.Id]; media.Status != models.MediaStatusReady || media.DurationMs != 3000 {
+		t.Errorf("Expected the video transcoded before to be ready, got %+v", media)
+	}
+	if len(mockMediaQueue.Enqueued) != 0 {
+		t.Errorf("Expected nothing to be queued, got %v", mockMediaQueue.Enqueued)
+	}
+}
+
+func TestUploadMedia_RateLimited(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	limits := validation.DefaultLimits
+	limits.MaxUploadsPerHour = 2
+	mockMediaService.Media[1] = mocks.MediaRecord{Url: "a.jpg", UserId: 1, CreatedAt: time.Now().Add(-30 * time.Minute)}
+	mockMediaService.Media[2] = mocks.MediaRecord{Url: "b.jpg", UserId: 1, CreatedAt: time.Now()}
+	mockMediaService.Media[3] = mocks.MediaRecord{Url: "c.jpg", UserId: 1, CreatedAt: time.Now().Add(-2 * time.Hour)}
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request = newUploadRequest(t, "photo.png", pngBytes())
+
+	handlers.UploadMedia(mockMediaService, mediaStorage, limits, mocks.NewMockMediaQueue())(context)
+	if response.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, response.Code)
+	}
+	retryAfter, _ := strconv.Atoi(response.Header().Get("Retry-After"))
+	if retryAfter < 29*60 || retryAfter > 30*60 {
+		t.Errorf("Expected to retry once the oldest upload of the hour ages out, got %d", retryAfter)
+	}
+	if len(mockMediaService.Media) != 3 {
+		t.Errorf("Expected no media to be created")
+	}
+}
+
+func TestUploadMedia_QuotaExceeded(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	limits := validation.DefaultLimits
+	limits.MaxStoredBytes = 1000
+	mockMediaService.Media[1] = mocks.MediaRecord{Url: "a.jpg", UserId: 1, Size: 990, CreatedAt: time.Now().Add(-2 * time.Hour)}
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request = newUploadRequest(t, "photo.png", pngBytes())
+
+	handlers.UploadMedia(mockMediaService, mediaStorage, limits, mocks.NewMockMediaQueue())(context)
+	if response.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, response.Code)
+	}
+	expectedResponseBodyString := "storage quota exceeded"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestGetUploadUsage(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mockMediaService.Media[1] = mocks.MediaRecord{Url: "a.jpg", UserId: 1, Size: 100, CreatedAt: time.Now()}
+	mockMediaService.Media[2] = mocks.MediaRecord{Url: "b.jpg", UserId: 1, Size: 50, CreatedAt: time.Now().Add(-2 * time.Hour)}
+	mockMediaService.Media[3] = mocks.MediaRecord{Url: "c.jpg", UserId: 2, Size: 1000, CreatedAt: time.Now()}
+	createUpload(t, mockUploadSessionService, 10)
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	handlers.GetUploadUsage(mockMediaService, mockUploadSessionService, validation.DefaultLimits)(context)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	var body struct {
+		StoredBytes           int64 `json:"stored_bytes"`
+		QuotaBytes            int64 `json:"quota_bytes"`
+		MediaCount            int64 `json:"media_count"`
+		UploadsLastHour       int64 `json:"uploads_last_hour"`
+		UnfinishedUploadBytes int64 `json:"unfinished_upload_bytes"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Error unmarshaling response body: %v", err)
+	}
+	if body.StoredBytes != 150 || body.MediaCount != 2 || body.UploadsLastHour != 1 || body.UnfinishedUploadBytes != 10 ||
+		body.QuotaBytes != validation.DefaultLimits.MaxStoredBytes {
+		t.Errorf("Unexpected usage %s", response.Body.String())
+	}
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
 
+	"github.com/ChenSongJian/ginstagram/metrics"
 	"github.com/ChenSongJian/ginstagram/middlewares"
 	"github.com/ChenSongJian/ginstagram/models"
 	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
 	"github.com/ChenSongJian/ginstagram/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -21,7 +25,7 @@ type UserRegisterReq struct {
 type UserUpdateReq struct {
 	Username        string `json:"username" binding:"required"`
 	Bio             string `json:"bio" binding:"required"`
-	ProfileImageUrl string `json:"profile_image_url" binding:"required"`
+	ProfileImageUrl string `json:"profile_image_url"`
 	IsPrivate       bool   `json:"is_private"`
 }
 
@@ -30,6 +34,12 @@ type UserLoginReq struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type UserStatusReq struct {
+	Status         string     `json:"status" binding:"required,oneof=active suspended banned shadow_banned"`
+	Reason         string     `json:"reason" binding:"required"`
+	SuspendedUntil *time.Time `json:"suspended_until"`
+}
+
 type UserResponse struct {
 	Id              int    `json:"id"`
 	Username        string `json:"username"`
@@ -43,12 +53,12 @@ func RegisterUser(userService services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req UserRegisterReq
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
 			return
 		}
 
 		if !utils.IsComplex(req.Password) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "password must be complex"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "password must be complex"))
 			return
 		}
 
@@ -59,13 +69,8 @@ func RegisterUser(userService services.UserService) gin.HandlerFunc {
 			Email:        req.Email,
 		}
 
-		if err := userService.Create(user); err != nil {
-			duplicateErrorMsg := "ERROR: duplicate key value violates unique constraint"
-			if strings.Contains(err.Error(), duplicateErrorMsg) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "email already exists"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := userService.Create(c.Request.Context(), user); err != nil {
+			respondError(c, err, errorMessages{services.ErrConflict: "email already exists"})
 			return
 		}
 
@@ -78,9 +83,9 @@ func ListUsers(userService services.UserService) gin.HandlerFunc {
 		pageNum := c.Query("pageNum")
 		pageSize := c.Query("pageSize")
 		keyword := c.Query("keyword")
-		users, pageInfo, err := userService.List(pageNum, pageSize, keyword)
+		users, pageInfo, err := userService.List(c.Request.Context(), pageNum, pageSize, keyword)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, nil)
 			return
 		}
 		userResponses := make([]UserResponse, len(users))
@@ -104,16 +109,12 @@ func GetUserById(userService services.UserService) gin.HandlerFunc {
 		userIdStr := c.Param("userId")
 		userId, err := strconv.Atoi(userIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid user id"))
 			return
 		}
-		user, err := userService.GetById(userId)
+		user, err := userService.GetById(c.Request.Context(), userId)
 		if err != nil {
-			if strings.Contains(err.Error(), "record not found") {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "user not found"})
 			return
 		}
 		userResponse := UserResponse{
@@ -128,46 +129,79 @@ func GetUserById(userService services.UserService) gin.HandlerFunc {
 	}
 }
 
-func UpdateUser(userService services.UserService) gin.HandlerFunc {
+// ownsUpload reports whether key is where a file the user uploaded, or one
+// made from it, is stored.
+func ownsUpload(ctx context.Context, mediaService services.MediaService, userId int, key string) (bool, error) {
+	if !storage.IsUploadKey(key) {
+		return false, nil
+	}
+	media, err := mediaService.ListByKey(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range media {
+		if m.UserId == userId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func UpdateUser(userService services.UserService, mediaService services.MediaService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "invalid token user type"))
 			return
 		}
 		userIdStr := c.Param("userId")
 		userId, err := strconv.Atoi(userIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid user id"))
 			return
 		}
 		if userId != modelTokenUser.Id {
-			c.JSON(http.StatusForbidden, gin.H{"error": "no permission to update user info"})
+			c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "no permission to update user info"))
 			return
 		}
 
 		var req UserUpdateReq
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		// the profile image is served and eventually deleted as an upload, so
+		// it has to be one of the caller's
+		current, err := userService.GetById(c.Request.Context(), userId)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "user not found"})
 			return
 		}
+		if req.ProfileImageUrl != "" && req.ProfileImageUrl != current.ProfileImageUrl {
+			owned, err := ownsUpload(c.Request.Context(), mediaService, userId, req.ProfileImageUrl)
+			if err != nil {
+				respondError(c, err, nil)
+				return
+			}
+			if !owned {
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "profile_image_url must be the url of one of your uploads"))
+				return
+			}
+		}
 
 		modelTokenUser.Username = req.Username
 		modelTokenUser.Bio = req.Bio
 		modelTokenUser.ProfileImageUrl = req.ProfileImageUrl
 		modelTokenUser.IsPrivate = req.IsPrivate
 
-		if err := userService.UpdateByModel(modelTokenUser); err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := userService.UpdateByModel(c.Request.Context(), modelTokenUser); err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "user not found"})
 			return
 		}
 
@@ -187,31 +221,27 @@ func DeleteUser(userService services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "invalid token user type"))
 			return
 		}
 		userIdStr := c.Param("userId")
 		userId, err := strconv.Atoi(userIdStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid user id"))
 			return
 		}
 		if userId != modelTokenUser.Id {
-			c.JSON(http.StatusForbidden, gin.H{"error": "no permission to delete user info"})
+			c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "no permission to delete user info"))
 			return
 		}
 
-		if err := userService.DeleteById(userId); err != nil {
-			if err.Error() == "record not found" {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := userService.DeleteById(c.Request.Context(), userId); err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "user not found"})
 			return
 		}
 
@@ -220,25 +250,52 @@ func DeleteUser(userService services.UserService) gin.HandlerFunc {
 	}
 }
 
+// RestoreUser brings a deleted account back out of the trash. The owner can no
+// longer log in, so the request is authenticated with their credentials.
+func RestoreUser(userService services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req UserLoginReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		user, err := userService.GetDeletedByEmail(c.Request.Context(), req.Email)
+		if err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "deleted user not found"})
+			return
+		}
+		if !utils.CompareHash(user.PasswordHash, req.Password) {
+			c.JSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "invalid password"))
+			return
+		}
+		if time.Since(user.DeletedAt.Time) > services.TrashRetention {
+			c.JSON(http.StatusGone, utils.NewErrorResponse(http.StatusGone, "user can no longer be restored"))
+			return
+		}
+		if err := userService.RestoreById(c.Request.Context(), user.Id); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "User restored successfully"})
+	}
+}
+
 func GetCurrentUserInfo(userService services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
-		user, err := userService.GetById(modelTokenUser.Id)
+		user, err := userService.GetById(c.Request.Context(), modelTokenUser.Id)
 		if err != nil {
-			if strings.Contains(err.Error(), "record not found") {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "user not found"})
 			return
 		}
 		userResponse := UserResponse{
@@ -253,98 +310,158 @@ func GetCurrentUserInfo(userService services.UserService) gin.HandlerFunc {
 	}
 }
 
-func LoginUser(userService services.UserService) gin.HandlerFunc {
+func LoginUser(userService services.UserService, jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req UserLoginReq
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
 			return
 		}
 
-		user, err := userService.GetByEmail(req.Email)
+		user, err := userService.GetByEmail(c.Request.Context(), req.Email)
 		if err != nil {
-			if strings.Contains(err.Error(), "record not found") {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return
+			if errors.Is(err, services.ErrNotFound) {
+				metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "user not found"})
 			return
 		}
 
 		if !utils.CompareHash(user.PasswordHash, req.Password) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid password"})
+			metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
+			c.JSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "invalid password"))
+			return
+		}
+		if err := middlewares.CheckAccountStatus(user); err != nil {
+			metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
+			c.JSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, err.Error()))
 			return
 		}
-		token, err := middlewares.GenerateToken(user, true)
+		token, err := middlewares.GenerateToken(jwtSecret, user, true)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, nil)
 			return
 		}
+		metrics.Logins.WithLabelValues(metrics.LoginSuccess).Inc()
 		c.JSON(http.StatusOK, gin.H{"token": token})
 	}
 }
 
-func LogoutUser(userService services.UserService) gin.HandlerFunc {
+func LogoutUser(userService services.UserService, jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
 		var user models.User
-		user, err := userService.GetByEmail(modelTokenUser.Email)
+		user, err := userService.GetByEmail(c.Request.Context(), modelTokenUser.Email)
 		if err != nil {
-			if strings.Contains(err.Error(), "record not found") {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "user not found"})
 			return
 		}
 		if user.Email != modelTokenUser.Email || user.PasswordHash != modelTokenUser.PasswordHash {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token user"})
+			c.JSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "invalid token user"))
 			return
 		}
-		token, err := middlewares.GenerateToken(user, false)
+		token, err := middlewares.GenerateToken(jwtSecret, user, false)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, nil)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"token": token})
 	}
 }
 
-func RefreshToken(userService services.UserService) gin.HandlerFunc {
+func RefreshToken(userService services.UserService, jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenUser, exists := c.Get("tokenUser")
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user not found in token"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "user not found in token"))
 			return
 		}
 		modelTokenUser, ok := tokenUser.(models.User)
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token user type"})
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid token user type"))
 			return
 		}
-		user, err := userService.GetById(modelTokenUser.Id)
+		user, err := userService.GetById(c.Request.Context(), modelTokenUser.Id)
 		if err != nil {
-			if strings.Contains(err.Error(), "record not found") {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, errorMessages{services.ErrNotFound: "user not found"})
 			return
 		}
-		token, err := middlewares.GenerateToken(user, true)
+		token, err := middlewares.GenerateToken(jwtSecret, user, true)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err, nil)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"token": token})
 	}
 }
+
+var userStatusActions = map[string]string{
+	models.UserStatusActive:       models.ModerationActionReinstateUser,
+	models.UserStatusSuspended:    models.ModerationActionSuspendUser,
+	models.UserStatusBanned:       models.ModerationActionBanUser,
+	models.UserStatusShadowBanned: models.ModerationActionShadowBanUser,
+}
+
+func UpdateUserStatus(userService services.UserService, reportService services.ReportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "invalid token user type"))
+			return
+		}
+		userIdStr := c.Param("userId")
+		userId, err := strconv.Atoi(userIdStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "invalid user id"))
+			return
+		}
+		if userId == modelTokenUser.Id {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "can not change your own status"))
+			return
+		}
+
+		var req UserStatusReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if req.Status == models.UserStatusSuspended {
+			if req.SuspendedUntil == nil || !req.SuspendedUntil.After(time.Now()) {
+				c.JSON(http.StatusBadRequest, utils.NewErrorResponse(http.StatusBadRequest, "suspended_until must be in the future"))
+				return
+			}
+		} else {
+			req.SuspendedUntil = nil
+		}
+
+		if err := userService.UpdateStatus(c.Request.Context(), userId, req.Status, req.Reason, req.SuspendedUntil); err != nil {
+			respondError(c, err, errorMessages{services.ErrNotFound: "user not found"})
+			return
+		}
+		if err := reportService.RecordAction(c.Request.Context(), models.ModerationAction{
+			ModeratorId: modelTokenUser.Id,
+			TargetType:  models.ReportTargetUser,
+			TargetId:    userId,
+			Action:      userStatusActions[req.Status],
+			Note:        req.Reason,
+		}); err != nil {
+			respondError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "user status updated successfully"})
+	}
+}
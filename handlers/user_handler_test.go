@@ -2,20 +2,35 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ChenSongJian/ginstagram/handlers"
 	"github.com/ChenSongJian/ginstagram/middlewares"
 	"github.com/ChenSongJian/ginstagram/mocks"
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+const testJWTSecret = "test-jwt-secret"
+
+// activeUsers finds every user as an active account, for tests that only need
+// AuthMiddleware to read the token.
+type activeUsers struct{ services.UserService }
+
+func (activeUsers) GetById(ctx context.Context, userId int) (models.User, error) {
+	return models.User{Id: userId, Status: models.UserStatusActive}, nil
+}
+
 func TestRegisterUser_MissingRequiredField(t *testing.T) {
 	mockUserService := mocks.NewMockUserService()
 	response := httptest.NewRecorder()
@@ -131,7 +146,7 @@ func TestRegisterUser_DuplicatedEmail(t *testing.T) {
 		PasswordHash: "Password123",
 		Email:        "Email@example.com",
 	}
-	mockUserService.Create(duplicateUser)
+	mockUserService.Create(context.Background(), duplicateUser)
 
 	response := httptest.NewRecorder()
 	context, _ := gin.CreateTestContext(response)
@@ -149,8 +164,8 @@ func TestRegisterUser_DuplicatedEmail(t *testing.T) {
 	context.Request.Header.Set("Content-Type", "application/json")
 
 	handlers.RegisterUser(mockUserService)(context)
-	if response.Code != http.StatusBadRequest {
-		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, response.Code)
 	}
 	expectedResponseBodyString := "email already exists"
 	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
@@ -162,6 +177,7 @@ func TestListUsers_NoUser(t *testing.T) {
 	mockUserService := mocks.NewMockUserService()
 	response := httptest.NewRecorder()
 	context, _ := gin.CreateTestContext(response)
+	context.Request = httptest.NewRequest("GET", "/", nil)
 
 	handlers.ListUsers(mockUserService)(context)
 	if response.Code != http.StatusOK {
@@ -181,9 +197,10 @@ func TestListUsers_Success(t *testing.T) {
 		PasswordHash: "PasswordHash",
 		Email:        "Email@example.com",
 	}
-	mockUserService.Create(dummyUser)
+	mockUserService.Create(context.Background(), dummyUser)
 	response := httptest.NewRecorder()
 	context, _ := gin.CreateTestContext(response)
+	context.Request = httptest.NewRequest("GET", "/", nil)
 
 	handlers.ListUsers(mockUserService)(context)
 	if response.Code != http.StatusOK {
@@ -203,10 +220,10 @@ func TestListUsers_SuccessWithPagination(t *testing.T) {
 		PasswordHash: "PasswordHash",
 		Email:        "Email@example.com",
 	}
-	mockUserService.Create(dummyUser)
+	mockUserService.Create(context.Background(), dummyUser)
 	dummyUser.Id = 2
 	dummyUser.Email = "Email2@example.com"
-	mockUserService.Create(dummyUser)
+	mockUserService.Create(context.Background(), dummyUser)
 	response := httptest.NewRecorder()
 	context, _ := gin.CreateTestContext(response)
 	context.Request, _ = http.NewRequest("GET", "/?pageNum=1&pageSize=1", nil)
@@ -229,11 +246,11 @@ func TestListUsers_WithKeyword(t *testing.T) {
 		PasswordHash: "PasswordHash",
 		Email:        "Email@example.com",
 	}
-	mockUserService.Create(dummyUser)
+	mockUserService.Create(context.Background(), dummyUser)
 	dummyUser.Id = 2
 	dummyUser.Username = "user2"
 	dummyUser.Email = "Email2@example.com"
-	mockUserService.Create(dummyUser)
+	mockUserService.Create(context.Background(), dummyUser)
 	response := httptest.NewRecorder()
 	context, _ := gin.CreateTestContext(response)
 	context.Request, _ = http.NewRequest("GET", "/?keyword=user2", nil)
@@ -277,9 +294,10 @@ func TestGetUserById_UserNotFound(t *testing.T) {
 		PasswordHash: "PasswordHash",
 		Email:        "Email@example.com",
 	}
-	mockUserService.Create(dummyUser)
+	mockUserService.Create(context.Background(), dummyUser)
 	response := httptest.NewRecorder()
 	context, _ := gin.CreateTestContext(response)
+	context.Request = httptest.NewRequest("GET", "/", nil)
 	context.Params = []gin.Param{
 		{
 			Key:   "userId",
@@ -305,9 +323,10 @@ func TestGetUserById_Success(t *testing.T) {
 		PasswordHash: "PasswordHash",
 		Email:        "Email@example.com",
 	}
-	mockUserService.Create(dummyUser)
+	mockUserService.Create(context.Background(), dummyUser)
 	response := httptest.NewRecorder()
 	context, _ := gin.CreateTestContext(response)
+	context.Request = httptest.NewRequest("GET", "/", nil)
 	context.Params = []gin.Param{
 		{
 			Key:   "userId",
@@ -352,8 +371,8 @@ func TestUpdateUser_MissingToken(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
-	middlewares.AuthMiddleware()(context)
-	handlers.UpdateUser(mockUserService)(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.UpdateUser(mockUserService, mocks.NewMockMediaService())(context)
 	if response.Code != http.StatusUnauthorized {
 		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.Code)
 	}
@@ -371,7 +390,7 @@ func TestUpdateUser_InvalidUserId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -394,8 +413,8 @@ func TestUpdateUser_InvalidUserId(t *testing.T) {
 	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
-	handlers.UpdateUser(mockUserService)(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.UpdateUser(mockUserService, mocks.NewMockMediaService())(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
 	}
@@ -413,7 +432,7 @@ func TestUpdateUser_DifferentUserIdAndTokenUserId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -436,8 +455,8 @@ func TestUpdateUser_DifferentUserIdAndTokenUserId(t *testing.T) {
 	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
-	handlers.UpdateUser(mockUserService)(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.UpdateUser(mockUserService, mocks.NewMockMediaService())(context)
 	if response.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
 	}
@@ -455,7 +474,7 @@ func TestUpdateUser_MiisingRequiredField(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -478,8 +497,8 @@ func TestUpdateUser_MiisingRequiredField(t *testing.T) {
 	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
-	handlers.UpdateUser(mockUserService)(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.UpdateUser(mockUserService, mocks.NewMockMediaService())(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
 	}
@@ -500,7 +519,7 @@ func TestUpdateUser_UserNotFound(t *testing.T) {
 	mockUserService.Users["test@email.com"] = models.User{
 		Id: 2,
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -526,8 +545,8 @@ func TestUpdateUser_UserNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
-	handlers.UpdateUser(mockUserService)(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.UpdateUser(mockUserService, mocks.NewMockMediaService())(context)
 	if response.Code != http.StatusNotFound {
 		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
 	}
@@ -546,7 +565,12 @@ func TestUpdateUser_Success(t *testing.T) {
 		Email:    "test@test.com",
 	}
 	mockUserService.Users[testUser.Email] = testUser
-	token, err := middlewares.GenerateToken(testUser, true)
+	mockMediaService := mocks.NewMockMediaService()
+	mockMediaService.Media[1] = mocks.MediaRecord{
+		Url:    "uploads/2024-01-01/profile.jpg",
+		UserId: 1,
+	}
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -562,7 +586,7 @@ func TestUpdateUser_Success(t *testing.T) {
 	jsonBody, err := json.Marshal(map[string]interface{}{
 		"username":          "username",
 		"bio":               "bio",
-		"profile_image_url": "profile_image_url",
+		"profile_image_url": "uploads/2024-01-01/profile_thumbnail.jpg",
 		"is_private":        true,
 	})
 	if err != nil {
@@ -572,8 +596,8 @@ func TestUpdateUser_Success(t *testing.T) {
 	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
-	handlers.UpdateUser(mockUserService)(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.UpdateUser(mockUserService, mockMediaService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
 	}
@@ -585,11 +609,62 @@ func TestUpdateUser_Success(t *testing.T) {
 	}
 	if responseBody.Id != testUser.Id || responseBody.Username != "username" ||
 		responseBody.Email != testUser.Email || responseBody.Bio != "bio" ||
-		responseBody.ProfileImageUrl != "profile_image_url" || responseBody.IsPrivate != true {
+		responseBody.ProfileImageUrl != "uploads/2024-01-01/profile_thumbnail.jpg" || responseBody.IsPrivate != true {
 		t.Errorf("Expected response body %v, got %v", testUser, responseBody)
 	}
 }
 
+func TestUpdateUser_ProfileImageNotOwnUpload(t *testing.T) {
+	for _, profileImageUrl := range []string{".env", "ginstagram.db", "../x", "uploads/../.env", "uploads/2024-01-01/other.jpg"} {
+		mockUserService := mocks.NewMockUserService()
+		response := httptest.NewRecorder()
+		testUser := models.User{
+			Id:       1,
+			Username: "test",
+			Email:    "test@test.com",
+		}
+		mockUserService.Users[testUser.Email] = testUser
+		mockMediaService := mocks.NewMockMediaService()
+		mockMediaService.Media[1] = mocks.MediaRecord{
+			Url:    "uploads/2024-01-01/other.jpg",
+			UserId: 2,
+		}
+		token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
+		if err != nil {
+			t.Errorf("Error generating token: %v", err)
+			return
+		}
+
+		context, _ := gin.CreateTestContext(response)
+		context.Params = []gin.Param{
+			{
+				Key:   "userId",
+				Value: "1",
+			},
+		}
+		jsonBody, err := json.Marshal(map[string]interface{}{
+			"username":          "username",
+			"bio":               "bio",
+			"profile_image_url": profileImageUrl,
+		})
+		if err != nil {
+			t.Errorf("Error marshaling request body: %v", err)
+			return
+		}
+		context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
+		context.Request.Header.Set("Content-Type", "application/json")
+		context.Request.Header.Set("Authorization", "Bearer "+token)
+		middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+		handlers.UpdateUser(mockUserService, mockMediaService)(context)
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, profileImageUrl, response.Code)
+		}
+		if mockUserService.Users[testUser.Email].ProfileImageUrl != "" {
+			t.Errorf("Expected profile image to be left alone, got %s", mockUserService.Users[testUser.Email].ProfileImageUrl)
+		}
+	}
+}
+
 func TestDeleteUser_MissingToken(t *testing.T) {
 	mockUserService := mocks.NewMockUserService()
 	response := httptest.NewRecorder()
@@ -602,7 +677,7 @@ func TestDeleteUser_MissingToken(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Content-Type", "application/json")
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeleteUser(mockUserService)(context)
 	if response.Code != http.StatusUnauthorized {
 		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.Code)
@@ -623,7 +698,7 @@ func TestDeleteUser_InvalidUserId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -638,7 +713,7 @@ func TestDeleteUser_InvalidUserId(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Content-Type", "application/json")
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeleteUser(mockUserService)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
@@ -659,7 +734,7 @@ func TestDeleteUser_DifferentUserIdAndTokenUserId(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -674,7 +749,7 @@ func TestDeleteUser_DifferentUserIdAndTokenUserId(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Content-Type", "application/json")
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeleteUser(mockUserService)(context)
 	if response.Code != http.StatusForbidden {
 		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
@@ -695,7 +770,7 @@ func TestDeleteUser_UserNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -710,7 +785,7 @@ func TestDeleteUser_UserNotFound(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Content-Type", "application/json")
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeleteUser(mockUserService)(context)
 	if response.Code != http.StatusNotFound {
 		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
@@ -732,7 +807,7 @@ func TestDeleteUser_Success(t *testing.T) {
 		Email:    "test@test.com",
 	}
 	mockUserService.Users[testUser.Email] = testUser
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -747,7 +822,7 @@ func TestDeleteUser_Success(t *testing.T) {
 	context.Request, _ = http.NewRequest("DELETE", "/", nil)
 	context.Request.Header.Set("Content-Type", "application/json")
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.DeleteUser(mockUserService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -784,14 +859,14 @@ func TestGetCurrentUserInfo_UserNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
 	}
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.GetCurrentUserInfo(mockUserService)(context)
 	if response.Code != http.StatusNotFound {
 		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
@@ -813,14 +888,14 @@ func TestGetCurrentUserInfo_Success(t *testing.T) {
 		Email:    "test@test.com",
 	}
 	mockUserService.Users[testUser.Email] = testUser
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
 	}
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	handlers.GetCurrentUserInfo(mockUserService)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
@@ -855,7 +930,7 @@ func TestLoginUser_MissingRequiredField(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
-	handlers.LoginUser(mockUserService)(context)
+	handlers.LoginUser(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
 	}
@@ -879,7 +954,7 @@ func TestLoginUser_InvalidEmail(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
-	handlers.LoginUser(mockUserService)(context)
+	handlers.LoginUser(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
 	}
@@ -903,7 +978,7 @@ func TestLoginUser_EmailNotFound(t *testing.T) {
 	}
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
-	handlers.LoginUser(mockUserService)(context)
+	handlers.LoginUser(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusNotFound {
 		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
 	}
@@ -945,7 +1020,7 @@ func TestLoginUser_InvalidPassword(t *testing.T) {
 	context, _ = gin.CreateTestContext(response)
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
-	handlers.LoginUser(mockUserService)(context)
+	handlers.LoginUser(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusUnauthorized {
 		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.Code)
 	}
@@ -987,7 +1062,7 @@ func TestLoginUser_Success(t *testing.T) {
 	context, _ = gin.CreateTestContext(response)
 	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
 	context.Request.Header.Set("Content-Type", "application/json")
-	handlers.LoginUser(mockUserService)(context)
+	handlers.LoginUser(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
 	}
@@ -997,6 +1072,38 @@ func TestLoginUser_Success(t *testing.T) {
 	}
 }
 
+func TestLoginUser_Suspended(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	suspendedUntil := time.Now().Add(time.Hour)
+	mockUserService.Users["email@example.com"] = models.User{
+		Id:             1,
+		Email:          "email@example.com",
+		PasswordHash:   utils.GenerateHash("Password123"),
+		Status:         models.UserStatusSuspended,
+		SuspendedUntil: &suspendedUntil,
+	}
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	jsonBody, err := json.Marshal(map[string]string{
+		"email":    "email@example.com",
+		"password": "Password123",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	context.Request.Header.Set("Content-Type", "application/json")
+	handlers.LoginUser(mockUserService, testJWTSecret)(context)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+	expectedResponseBodyString := "account is suspended until"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
 func TestLogoutUser_MissingToken(t *testing.T) {
 	mockUserService := mocks.NewMockUserService()
 	response := httptest.NewRecorder()
@@ -1004,7 +1111,7 @@ func TestLogoutUser_MissingToken(t *testing.T) {
 
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 
-	handlers.LogoutUser(mockUserService)(context)
+	handlers.LogoutUser(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
 	}
@@ -1021,7 +1128,7 @@ func TestLogoutUser_TokenUserNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1030,9 +1137,9 @@ func TestLogoutUser_TokenUserNotFound(t *testing.T) {
 	context, _ := gin.CreateTestContext(response)
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 
-	handlers.LogoutUser(mockUserService)(context)
+	handlers.LogoutUser(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusNotFound {
 		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
 	}
@@ -1049,7 +1156,7 @@ func TestLogoutUser_Success(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
@@ -1059,9 +1166,9 @@ func TestLogoutUser_Success(t *testing.T) {
 	context, _ := gin.CreateTestContext(response)
 	context.Request, _ = http.NewRequest("POST", "/", nil)
 	context.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 
-	handlers.LogoutUser(mockUserService)(context)
+	handlers.LogoutUser(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
 	}
@@ -1078,7 +1185,7 @@ func TestRefreshToken_MissingToken(t *testing.T) {
 
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 
-	handlers.RefreshToken(mockUserService)(context)
+	handlers.RefreshToken(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusBadRequest {
 		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
 	}
@@ -1098,15 +1205,15 @@ func TestResfreshToken_UserNotFound(t *testing.T) {
 		Username: "test",
 		Email:    "test@test.com",
 	}
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
 	}
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
-	handlers.RefreshToken(mockUserService)(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.RefreshToken(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusNotFound {
 		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
 	}
@@ -1127,15 +1234,15 @@ func TestResfreshToken_Success(t *testing.T) {
 		Email:    "test@test.com",
 	}
 	mockUserService.Users[testUser.Email] = testUser
-	token, err := middlewares.GenerateToken(testUser, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, testUser, true)
 	if err != nil {
 		t.Errorf("Error generating token: %v", err)
 		return
 	}
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer "+token)
-	middlewares.AuthMiddleware()(context)
-	handlers.RefreshToken(mockUserService)(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
+	handlers.RefreshToken(mockUserService, testJWTSecret)(context)
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
 	}
@@ -1144,3 +1251,285 @@ func TestResfreshToken_Success(t *testing.T) {
 		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
 	}
 }
+
+func TestLoginUser_Banned(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockUserService.Users["email@example.com"] = models.User{
+		Id:           1,
+		Email:        "email@example.com",
+		PasswordHash: utils.GenerateHash("Password123"),
+		Status:       models.UserStatusBanned,
+	}
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	jsonBody, err := json.Marshal(map[string]string{
+		"email":    "email@example.com",
+		"password": "Password123",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	context.Request.Header.Set("Content-Type", "application/json")
+	handlers.LoginUser(mockUserService, testJWTSecret)(context)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+	expectedResponseBodyString := "account is banned"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestUpdateUserStatus_Self(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockReportService := mocks.NewMockReportService()
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Params = []gin.Param{
+		{
+			Key:   "userId",
+			Value: "1",
+		},
+	}
+	context.Request, _ = http.NewRequest("PUT", "/", nil)
+	handlers.UpdateUserStatus(mockUserService, mockReportService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "can not change your own status"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestUpdateUserStatus_SuspendWithoutDate(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockReportService := mocks.NewMockReportService()
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Params = []gin.Param{
+		{
+			Key:   "userId",
+			Value: "2",
+		},
+	}
+	jsonBody, err := json.Marshal(map[string]string{
+		"status": "suspended",
+		"reason": "spam",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
+	handlers.UpdateUserStatus(mockUserService, mockReportService)(context)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, response.Code)
+	}
+	expectedResponseBodyString := "suspended_until must be in the future"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestUpdateUserStatus_UserNotFound(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockReportService := mocks.NewMockReportService()
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Params = []gin.Param{
+		{
+			Key:   "userId",
+			Value: "2",
+		},
+	}
+	jsonBody, err := json.Marshal(map[string]string{
+		"status": "banned",
+		"reason": "spam",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
+	handlers.UpdateUserStatus(mockUserService, mockReportService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+}
+
+func TestUpdateUserStatus_Success(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockReportService := mocks.NewMockReportService()
+	mockUserService.Users["spammer@example.com"] = models.User{
+		Id:    2,
+		Email: "spammer@example.com",
+	}
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Set("tokenUser", models.User{Id: 1})
+	context.Params = []gin.Param{
+		{
+			Key:   "userId",
+			Value: "2",
+		},
+	}
+	jsonBody, err := json.Marshal(map[string]string{
+		"status":          "suspended",
+		"reason":          "spam",
+		"suspended_until": time.Now().Add(time.Hour).Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("PUT", "/", bytes.NewReader(jsonBody))
+	handlers.UpdateUserStatus(mockUserService, mockReportService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	user := mockUserService.Users["spammer@example.com"]
+	if user.Status != models.UserStatusSuspended || user.StatusReason != "spam" || user.SuspendedUntil == nil {
+		t.Errorf("Expected user to be suspended for spam, got %+v", user)
+	}
+	if len(mockReportService.Actions) != 1 || mockReportService.Actions[0].Action != models.ModerationActionSuspendUser {
+		t.Errorf("Expected suspend action in audit trail, got %v", mockReportService.Actions)
+	}
+}
+
+func TestDeleteUser_CanNotLogin(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockUserService.Users["email@example.com"] = models.User{
+		Id:           1,
+		Email:        "email@example.com",
+		PasswordHash: utils.GenerateHash("Password123"),
+	}
+	mockUserService.DeleteById(context.Background(), 1)
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	jsonBody, err := json.Marshal(map[string]string{
+		"email":    "email@example.com",
+		"password": "Password123",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	handlers.LoginUser(mockUserService, testJWTSecret)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+}
+
+func TestRestoreUser_NotDeleted(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockUserService.Users["email@example.com"] = models.User{
+		Id:           1,
+		Email:        "email@example.com",
+		PasswordHash: utils.GenerateHash("Password123"),
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	jsonBody, err := json.Marshal(map[string]string{
+		"email":    "email@example.com",
+		"password": "Password123",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	handlers.RestoreUser(mockUserService)(context)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, response.Code)
+	}
+}
+
+func TestRestoreUser_InvalidPassword(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockUserService.Users["email@example.com"] = models.User{
+		Id:           1,
+		Email:        "email@example.com",
+		PasswordHash: utils.GenerateHash("Password123"),
+	}
+	mockUserService.DeleteById(context.Background(), 1)
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	jsonBody, err := json.Marshal(map[string]string{
+		"email":    "email@example.com",
+		"password": "WrongPassword",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	handlers.RestoreUser(mockUserService)(context)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.Code)
+	}
+}
+
+func TestRestoreUser_Expired(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockUserService.DeletedUsers["email@example.com"] = models.User{
+		Id:           1,
+		Email:        "email@example.com",
+		PasswordHash: utils.GenerateHash("Password123"),
+		DeletedAt:    gorm.DeletedAt{Time: time.Now().Add(-services.TrashRetention - time.Hour), Valid: true},
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	jsonBody, err := json.Marshal(map[string]string{
+		"email":    "email@example.com",
+		"password": "Password123",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	handlers.RestoreUser(mockUserService)(context)
+	if response.Code != http.StatusGone {
+		t.Errorf("Expected status code %d, got %d", http.StatusGone, response.Code)
+	}
+}
+
+func TestRestoreUser_Success(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockUserService.Users["email@example.com"] = models.User{
+		Id:           1,
+		Email:        "email@example.com",
+		PasswordHash: utils.GenerateHash("Password123"),
+	}
+	mockUserService.DeleteById(context.Background(), 1)
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	jsonBody, err := json.Marshal(map[string]string{
+		"email":    "email@example.com",
+		"password": "Password123",
+	})
+	if err != nil {
+		t.Errorf("Error marshaling request body: %v", err)
+		return
+	}
+	context.Request, _ = http.NewRequest("POST", "/", bytes.NewReader(jsonBody))
+	handlers.RestoreUser(mockUserService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if _, err := mockUserService.GetByEmail(context, "email@example.com"); err != nil {
+		t.Errorf("Expected user to be restored, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ChenSongJian/ginstagram/migrations"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"gorm.io/gorm"
+)
+
+// Database checks that the database answers.
+func Database(database *gorm.DB) Check {
+	return Check{Name: "database", Run: func(ctx context.Context) error {
+		sqlDB, err := database.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}}
+}
+
+// Migrations checks that every migration built into the binary is applied.
+func Migrations(database *gorm.DB) Check {
+	return Check{Name: "migrations", Run: func(ctx context.Context) error {
+		embedded, err := migrations.Embedded(database.Dialector.Name())
+		if err != nil {
+			return err
+		}
+		pending, err := migrations.NewMigrator(database, embedded).Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			names := make([]string, len(pending))
+			for i, migration := range pending {
+				names[i] = fmt.Sprintf("%d_%s", migration.Version, migration.Name)
+			}
+			return fmt.Errorf("%d pending: %s", len(pending), strings.Join(names, ", "))
+		}
+		return nil
+	}}
+}
+
+// ProbePrefix is where Storage writes its probes, under the uploads since
+// nothing else may be stored but out of the way of the files of media.
+const ProbePrefix = storage.UploadPrefix + "health/"
+
+// Storage checks that objects can be written to and removed from storage.
+func Storage(mediaStorage storage.Storage) Check {
+	return Check{Name: "storage", Run: func(ctx context.Context) error {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		key := ProbePrefix + "probe-" + hex.EncodeToString(id)
+		probe := []byte("ok")
+		if err := mediaStorage.Put(key, bytes.NewReader(probe), int64(len(probe)), "text/plain"); err != nil {
+			return fmt.Errorf("writing: %w", err)
+		}
+		if err := mediaStorage.Delete(key); err != nil {
+			return fmt.Errorf("removing: %w", err)
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,110 @@
+// Package health checks whether the server can serve requests: whether its
+// database, schema, storage and background workers are in order, and whether
+// it is shutting down.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckTimeout bounds the time each check may take.
+const CheckTimeout = 2 * time.Second
+
+// The statuses of a check and of a Report.
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDraining = "draining"
+)
+
+// Check is one thing readiness depends on. Run returns why it is not ready,
+// or nil.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Result is the outcome of a Check.
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of every Check of a Checker, ok if all of them are.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether the server may be sent requests.
+func (report Report) Ready() bool {
+	return report.Status == StatusOK
+}
+
+// Checker runs the checks readiness depends on. The zero value has no checks
+// and is ready until it drains.
+type Checker struct {
+	checks   []Check
+	draining atomic.Bool
+}
+
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{checks: checks}
+}
+
+// Drain makes the checker report not ready from now on, so that load
+// balancers stop sending requests before the server stops.
+func (checker *Checker) Drain() {
+	checker.draining.Store(true)
+}
+
+// Run runs the checks at the same time, each for up to CheckTimeout.
+func (checker *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checker.checks))}
+	var lock sync.Mutex
+	var wait sync.WaitGroup
+	for _, check := range checker.checks {
+		wait.Add(1)
+		go func(check Check) {
+			defer wait.Done()
+			result := run(ctx, check)
+			lock.Lock()
+			defer lock.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFailing
+			}
+		}(check)
+	}
+	wait.Wait()
+	if checker.draining.Load() {
+		report.Status = StatusDraining
+	}
+	return report
+}
+
+// run runs a check, giving up on it once it times out even if it does not
+// watch its context.
+func run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.Run(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result := Result{Status: StatusOK, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
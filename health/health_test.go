@@ -0,0 +1,68 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/health"
+	"github.com/ChenSongJian/ginstagram/storage"
+)
+
+func TestChecker_Run(t *testing.T) {
+	checker := health.NewChecker(
+		health.Check{Name: "up", Run: func(ctx context.Context) error { return nil }},
+		health.Check{Name: "down", Run: func(ctx context.Context) error { return errors.New("connection refused") }},
+	)
+	report := checker.Run(context.Background())
+	if report.Ready() || report.Status != health.StatusFailing {
+		t.Errorf("Expected the report to fail, got %+v", report)
+	}
+	if report.Checks["up"].Status != health.StatusOK || report.Checks["down"].Error != "connection refused" {
+		t.Errorf("Unexpected checks %+v", report.Checks)
+	}
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	checker := health.NewChecker(health.Check{Name: "stuck", Run: func(ctx context.Context) error {
+		<-block
+		return nil
+	}})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	report := checker.Run(ctx)
+	if report.Ready() || report.Checks["stuck"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("Expected the stuck check to time out, got %+v", report)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Expected not to wait for the stuck check, took %s", time.Since(start))
+	}
+}
+
+func TestChecker_Drain(t *testing.T) {
+	checker := health.NewChecker()
+	if report := checker.Run(context.Background()); !report.Ready() {
+		t.Errorf("Expected a checker without checks to be ready, got %+v", report)
+	}
+	checker.Drain()
+	if report := checker.Run(context.Background()); report.Ready() || report.Status != health.StatusDraining {
+		t.Errorf("Expected a draining checker not to be ready, got %+v", report)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	if err := health.Storage(mediaStorage).Run(context.Background()); err != nil {
+		t.Fatalf("Expected writable storage to pass, got %v", err)
+	}
+	err := mediaStorage.List(health.ProbePrefix, func(object storage.Object) error {
+		return errors.New("probe left behind: " + object.Key)
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,173 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Variant is a resized copy made of every processed image. Thumbnails are
+// cropped to a square, the others keep their aspect ratio and are never
+// scaled up.
+type Variant struct {
+	Name     string
+	MaxWidth int
+	Square   int
+}
+
+var Variants = []Variant{
+	{Name: "thumbnail", Square: 150},
+	{Name: "small", MaxWidth: 320},
+	{Name: "medium", MaxWidth: 640},
+	{Name: "large", MaxWidth: 1080},
+}
+
+const jpegQuality = 85
+
+var ErrUnsupportedImage = errors.New("unsupported image")
+var ErrImageTooLarge = errors.New("image dimensions exceed limit")
+
+// Processed is an upload ready to be stored. Re-encoding drops every piece of
+// metadata the original carried, EXIF and GPS included.
+type Processed struct {
+	Ext         string
+	ContentType string
+	Width       int
+	Height      int
+	Original    []byte
+	Variants    map[string][]byte
+}
+
+func IsSupported(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Process decodes a JPEG, PNG or WebP image, turns it upright according to its
+// EXIF orientation and encodes the original and its variants. PNG input and
+// images with transparency stay PNG, everything else becomes JPEG. Images of
+// more than maxPixels are rejected before decoding so that a small, highly
+// compressed file can not exhaust memory.
+func Process(data []byte, contentType string, maxPixels int) (Processed, error) {
+	if !IsSupported(contentType) {
+		return Processed{}, ErrUnsupportedImage
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, err
+	}
+	if config.Width*config.Height > maxPixels {
+		return Processed{}, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, err
+	}
+	img = applyOrientation(img, exifOrientation(data))
+
+	ext := "jpg"
+	if contentType == "image/png" || !isOpaque(img) {
+		ext = "png"
+	}
+	processed := Processed{
+		Ext:         ext,
+		ContentType: ContentTypeOf(ext),
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Variants:    make(map[string][]byte),
+	}
+	if processed.Original, err = encode(img, ext); err != nil {
+		return Processed{}, err
+	}
+	for _, variant := range Variants {
+		encoded, err := encode(resize(img, variant), ext)
+		if err != nil {
+			return Processed{}, err
+		}
+		processed.Variants[variant.Name] = encoded
+	}
+	return processed, nil
+}
+
+func ContentTypeOf(ext string) string {
+	if ext == "png" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// VariantKeys returns the storage keys of the variants of the image stored
+// under key, by variant name. Keys that are not processed images have none.
+func VariantKeys(key string) map[string]string {
+	ext := key[strings.LastIndex(key, ".")+1:]
+	if ext != "jpg" && ext != "png" {
+		return nil
+	}
+	keys := make(map[string]string, len(Variants))
+	for _, variant := range Variants {
+		keys[variant.Name] = strings.TrimSuffix(key, "."+ext) + "_" + variant.Name + "." + ext
+	}
+	return keys
+}
+
+// OriginalKey maps the key of a variant back to the image it was made from.
+// Any other key is returned unchanged.
+func OriginalKey(key string) string {
+	dot := strings.LastIndex(key, ".")
+	if dot < 0 {
+		return key
+	}
+	for _, variant := range Variants {
+		suffix := "_" + variant.Name
+		if strings.HasSuffix(key[:dot], suffix) {
+			return strings.TrimSuffix(key[:dot], suffix) + key[dot:]
+		}
+	}
+	return key
+}
+
+func resize(img image.Image, variant Variant) image.Image {
+	bounds := img.Bounds()
+	if variant.Square > 0 {
+		side := min(bounds.Dx(), bounds.Dy())
+		x := bounds.Min.X + (bounds.Dx()-side)/2
+		y := bounds.Min.Y + (bounds.Dy()-side)/2
+		dst := image.NewNRGBA(image.Rect(0, 0, variant.Square, variant.Square))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, image.Rect(x, y, x+side, y+side), draw.Src, nil)
+		return dst
+	}
+	if bounds.Dx() <= variant.MaxWidth {
+		return img
+	}
+	height := bounds.Dy() * variant.MaxWidth / bounds.Dx()
+	dst := image.NewNRGBA(image.Rect(0, 0, variant.MaxWidth, max(height, 1)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+func encode(img image.Image, ext string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	if ext == "png" {
+		err = png.Encode(&buffer, img)
+	} else {
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	return buffer.Bytes(), err
+}
+
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
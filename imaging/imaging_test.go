@@ -0,0 +1,140 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// jpegWithOrientation encodes a w×h JPEG whose left half is red and right half
+// blue, with an EXIF block carrying the orientation and a GPS pointer.
+func jpegWithOrientation(t *testing.T, w int, h int, orientation uint16) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("Error encoding jpeg: %v", err)
+	}
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 2)
+	tiff = append(tiff, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0x00, 0x00)
+	tiff = append(tiff, 0x88, 0x25, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00)
+	tiff = append(tiff, 0x00, 0x00, 0x00, 0x00)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+
+	data := encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	data := jpegWithOrientation(t, 4, 2, 6)
+	if orientation := exifOrientation(data); orientation != 6 {
+		t.Errorf("Expected orientation 6, got %d", orientation)
+	}
+	if orientation := exifOrientation([]byte("not an image")); orientation != 1 {
+		t.Errorf("Expected orientation 1, got %d", orientation)
+	}
+}
+
+func TestProcess_OrientationAndMetadata(t *testing.T) {
+	data := jpegWithOrientation(t, 40, 20, 6)
+	processed, err := Process(data, "image/jpeg", 40_000_000)
+	if err != nil {
+		t.Fatalf("Error processing image: %v", err)
+	}
+	if processed.Width != 20 || processed.Height != 40 {
+		t.Errorf("Expected 20x40 after rotation, got %dx%d", processed.Width, processed.Height)
+	}
+	if bytes.Contains(processed.Original, []byte("Exif")) {
+		t.Errorf("Expected EXIF metadata to be stripped")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(processed.Original))
+	if err != nil {
+		t.Fatalf("Error decoding processed image: %v", err)
+	}
+	// rotating clockwise puts the red left half on top
+	r, _, b, _ := img.At(10, 2).RGBA()
+	if r < b {
+		t.Errorf("Expected red at the top after rotation")
+	}
+}
+
+func TestProcess_Variants(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	var encoded bytes.Buffer
+	png.Encode(&encoded, img)
+
+	processed, err := Process(encoded.Bytes(), "image/png", 40_000_000)
+	if err != nil {
+		t.Fatalf("Error processing image: %v", err)
+	}
+	if processed.Ext != "png" {
+		t.Errorf("Expected png output, got %s", processed.Ext)
+	}
+	expectedSizes := map[string]image.Point{
+		"thumbnail": {150, 150},
+		"small":     {320, 160},
+		"medium":    {640, 320},
+		"large":     {800, 400},
+	}
+	for name, size := range expectedSizes {
+		config, err := png.DecodeConfig(bytes.NewReader(processed.Variants[name]))
+		if err != nil {
+			t.Fatalf("Error decoding %s variant: %v", name, err)
+		}
+		if config.Width != size.X || config.Height != size.Y {
+			t.Errorf("Expected %s variant %v, got %dx%d", name, size, config.Width, config.Height)
+		}
+	}
+}
+
+func TestProcess_Unsupported(t *testing.T) {
+	if _, err := Process([]byte("GIF89a"), "image/gif", 40_000_000); err != ErrUnsupportedImage {
+		t.Errorf("Expected %v, got %v", ErrUnsupportedImage, err)
+	}
+	if _, err := Process([]byte("garbage"), "image/jpeg", 40_000_000); err == nil {
+		t.Errorf("Expected an error decoding garbage")
+	}
+}
+
+func TestProcess_TooManyPixels(t *testing.T) {
+	var encoded bytes.Buffer
+	png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	if _, err := Process(encoded.Bytes(), "image/png", 15); err != ErrImageTooLarge {
+		t.Errorf("Expected %v, got %v", ErrImageTooLarge, err)
+	}
+}
+
+func TestVariantKeys(t *testing.T) {
+	keys := VariantKeys("uploads/2024-01-02/abc-photo.jpg")
+	if keys["thumbnail"] != "uploads/2024-01-02/abc-photo_thumbnail.jpg" {
+		t.Errorf("Unexpected thumbnail key %s", keys["thumbnail"])
+	}
+	for _, key := range keys {
+		if original := OriginalKey(key); original != "uploads/2024-01-02/abc-photo.jpg" {
+			t.Errorf("Expected original key for %s, got %s", key, original)
+		}
+	}
+	if keys := VariantKeys("uploads/2024-01-02/video.mp4"); keys != nil {
+		t.Errorf("Expected no variants for video, got %v", keys)
+	}
+}
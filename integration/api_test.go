@@ -0,0 +1,309 @@
+package integration_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/app"
+	"github.com/ChenSongJian/ginstagram/config"
+	"github.com/ChenSongJian/ginstagram/health"
+	"github.com/ChenSongJian/ginstagram/integration"
+	"github.com/ChenSongJian/ginstagram/logging"
+	"github.com/ChenSongJian/ginstagram/metrics"
+	"github.com/ChenSongJian/ginstagram/middlewares"
+	"github.com/ChenSongJian/ginstagram/migrations"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newApp(t *testing.T) *app.App {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	cfg.JWTSecret = "secret"
+	cfg.Upload.SpoolDir = t.TempDir()
+	return app.NewWithDB(cfg, integration.NewDB(t), storage.NewLocalStorage(t.TempDir(), "/api/v1/media", []byte("secret")))
+}
+
+func request(t *testing.T, router http.Handler, method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&reader).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, req)
+	return response
+}
+
+// registerAndLogin registers a user through the API and returns their id and
+// access token.
+func registerAndLogin(t *testing.T, server *app.App, username string) (int, string) {
+	t.Helper()
+	email := username + "@test.com"
+	credentials := map[string]string{"username": username, "email": email, "password": "Passw0rd!"}
+	if response := request(t, server.Router, "POST", "/api/v1/user/", "", credentials); response.Code != http.StatusOK {
+		t.Fatalf("Registering %s: %d %s", username, response.Code, response.Body)
+	}
+	response := request(t, server.Router, "POST", "/api/v1/user/login", "", credentials)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Logging in %s: %d %s", username, response.Code, response.Body)
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &body)
+	user, err := server.Deps.UserService.GetByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.Id, body.Token
+}
+
+func TestAPI_RegisterTwice(t *testing.T) {
+	server := newApp(t)
+	registerAndLogin(t, server, "alice")
+	credentials := map[string]string{"username": "alice", "email": "alice@test.com", "password": "Passw0rd!"}
+	response := request(t, server.Router, "POST", "/api/v1/user/", "", credentials)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d %s", http.StatusConflict, response.Code, response.Body)
+	}
+	var body utils.ErrorResponse
+	json.Unmarshal(response.Body.Bytes(), &body)
+	if body.Code != utils.ErrorCodeConflict || body.Error != "email already exists" {
+		t.Errorf("Unexpected error response %+v", body)
+	}
+}
+
+func TestAPI_DeletePost(t *testing.T) {
+	server := newApp(t)
+	aliceId, _ := registerAndLogin(t, server, "alice")
+	bobId, bobToken := registerAndLogin(t, server, "bob")
+
+	// give posts ids other than their authors' so that mixing them up shows
+	var postIds []int
+	for _, userId := range []int{aliceId, bobId, aliceId, bobId} {
+		postId, err := server.Deps.PostService.Create(context.Background(), models.Post{Title: "title", Content: "content", UserId: userId}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		postIds = append(postIds, postId)
+	}
+	deleted := postIds[3]
+
+	response := request(t, server.Router, "DELETE", "/api/v1/post/"+strconv.Itoa(deleted), bobToken, nil)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, response.Code, response.Body)
+	}
+	for _, postId := range postIds {
+		_, err := server.Deps.PostService.GetById(context.Background(), postId)
+		if postId == deleted && err == nil {
+			t.Errorf("Expected post %d to be deleted", postId)
+		}
+		if postId != deleted && err != nil {
+			t.Errorf("Expected post %d to be kept, got %v", postId, err)
+		}
+	}
+
+	response = request(t, server.Router, "DELETE", "/api/v1/post/"+strconv.Itoa(postIds[0]), bobToken, nil)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d %s", http.StatusForbidden, response.Code, response.Body)
+	}
+}
+
+func TestAPI_LogsQueriesWithRequestId(t *testing.T) {
+	server := newApp(t)
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&logs, slog.LevelDebug))
+	defer slog.SetDefault(previous)
+
+	credentials := map[string]string{"username": "alice", "email": "alice@test.com", "password": "Passw0rd!"}
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(credentials)
+	req, _ := http.NewRequest("POST", "/api/v1/user/", &body)
+	req.Header.Set(middlewares.RequestIdHeader, "register-1")
+	response := httptest.NewRecorder()
+	server.Router.ServeHTTP(response, req)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, response.Code, response.Body)
+	}
+
+	queries := 0
+	for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("Expected JSON lines, got %q", line)
+		}
+		if entry["request_id"] != "register-1" {
+			t.Errorf("Expected every line to carry the request id, got %v", entry)
+		}
+		if entry["msg"] == "query" {
+			queries++
+		}
+	}
+	if queries == 0 {
+		t.Error("Expected the queries to be logged")
+	}
+	if bytes.Contains(logs.Bytes(), []byte("Passw0rd!")) || bytes.Contains(logs.Bytes(), []byte("alice@test.com")) {
+		t.Errorf("Expected query parameters to be left out, got %s", logs.String())
+	}
+}
+
+func TestAPI_Metrics(t *testing.T) {
+	server := newApp(t)
+	logins := testutil.ToFloat64(metrics.Logins.WithLabelValues(metrics.LoginSuccess))
+	failures := testutil.ToFloat64(metrics.Logins.WithLabelValues(metrics.LoginFailure))
+	follows := testutil.ToFloat64(metrics.FollowsCreated)
+
+	_, aliceToken := registerAndLogin(t, server, "alice")
+	bobId, _ := registerAndLogin(t, server, "bob")
+	wrongPassword := map[string]string{"email": "alice@test.com", "password": "wrong"}
+	if response := request(t, server.Router, "POST", "/api/v1/user/login", "", wrongPassword); response.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusUnauthorized, response.Code, response.Body)
+	}
+	if response := request(t, server.Router, "POST", "/api/v1/follow/", aliceToken, map[string]int{"user_id": bobId}); response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, response.Code, response.Body)
+	}
+	request(t, server.Router, "GET", "/api/v1/user/"+strconv.Itoa(bobId), "", nil)
+
+	if delta := testutil.ToFloat64(metrics.Logins.WithLabelValues(metrics.LoginSuccess)) - logins; delta != 2 {
+		t.Errorf("Expected 2 more successful logins, got %v", delta)
+	}
+	if delta := testutil.ToFloat64(metrics.Logins.WithLabelValues(metrics.LoginFailure)) - failures; delta != 1 {
+		t.Errorf("Expected 1 more failed login, got %v", delta)
+	}
+	if delta := testutil.ToFloat64(metrics.FollowsCreated) - follows; delta != 1 {
+		t.Errorf("Expected 1 more follow, got %v", delta)
+	}
+
+	response := request(t, server.Router, "GET", "/metrics", "", nil)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	for _, expected := range []string{
+		`ginstagram_http_requests_total{method="GET",route="/api/v1/user/:userId",status="200"}`,
+		`ginstagram_http_request_duration_seconds_bucket{method="POST",route="/api/v1/user/login"`,
+		`ginstagram_db_query_duration_seconds_count{operation="create",table="users"}`,
+		`go_sql_open_connections{db_name="ginstagram"}`,
+	} {
+		if !strings.Contains(response.Body.String(), expected) {
+			t.Errorf("Expected the metrics to contain %s", expected)
+		}
+	}
+}
+
+func TestAPI_Traces(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	server := newApp(t)
+	_, token := registerAndLogin(t, server, "alice")
+	if response := request(t, server.Router, "GET", "/api/v1/post/", token, nil); response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, response.Code, response.Body)
+	}
+
+	var requestSpan sdktrace.ReadOnlySpan
+	ended := recorder.Ended()
+	for _, span := range ended {
+		if span.Name() == "GET /api/v1/post/" {
+			requestSpan = span
+		}
+	}
+	if requestSpan == nil || requestSpan.SpanKind() != trace.SpanKindServer {
+		t.Fatalf("Expected a server span for the request, got %v", ended)
+	}
+	// the names of the spans of the request and of their parents
+	names := map[trace.SpanID]string{}
+	for _, span := range ended {
+		if span.SpanContext().TraceID() == requestSpan.SpanContext().TraceID() {
+			names[span.SpanContext().SpanID()] = span.Name()
+		}
+	}
+	children := map[[2]string]bool{}
+	for _, span := range ended {
+		if span.SpanContext().TraceID() == requestSpan.SpanContext().TraceID() {
+			children[[2]string{span.Name(), names[span.Parent().SpanID()]}] = true
+		}
+	}
+	for _, child := range [][2]string{
+		{"PostService.ListByUserId", "GET /api/v1/post/"},
+		{"visibleUserIds", "PostService.ListByUserId"},
+		{"db.query", "visibleUserIds"},
+		{"publicUserIds", "visibleUserIds"},
+		{"db.query", "publicUserIds"},
+		{"db.query", "PostService.ListByUserId"},
+	} {
+		if !children[child] {
+			t.Errorf("Expected a %s span in %s, got %v", child[0], child[1], children)
+		}
+	}
+}
+
+func TestAPI_Health(t *testing.T) {
+	server := newApp(t)
+	if response := request(t, server.Router, "GET", "/healthz", "", nil); response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+
+	readiness := func(expectedCode int) health.Report {
+		t.Helper()
+		response := request(t, server.Router, "GET", "/readyz", "", nil)
+		if response.Code != expectedCode {
+			t.Errorf("Expected status code %d, got %d %s", expectedCode, response.Code, response.Body)
+		}
+		var report health.Report
+		json.Unmarshal(response.Body.Bytes(), &report)
+		return report
+	}
+	report := readiness(http.StatusOK)
+	for _, check := range []string{"database", "migrations", "storage", "workers"} {
+		if result, ok := report.Checks[check]; !ok || result.Status != health.StatusOK {
+			t.Errorf("Expected the %s check to pass, got %+v", check, report.Checks)
+		}
+	}
+
+	embedded, err := migrations.Embedded(server.DB.Dialector.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.NewMigrator(server.DB, embedded).Down(1); err != nil {
+		t.Fatal(err)
+	}
+	report = readiness(http.StatusServiceUnavailable)
+	if result := report.Checks["migrations"]; result.Status != health.StatusFailing || !strings.Contains(result.Error, "1 pending") {
+		t.Errorf("Expected the migrations check to fail, got %+v", result)
+	}
+	if _, err := migrations.NewMigrator(server.DB, embedded).Up(0); err != nil {
+		t.Fatal(err)
+	}
+	readiness(http.StatusOK)
+
+	server.Config.Shutdown.DrainDelay = 0
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if report := readiness(http.StatusServiceUnavailable); report.Status != health.StatusDraining {
+		t.Errorf("Expected readiness to fail while shutting down, got %+v", report)
+	}
+}
@@ -0,0 +1,496 @@
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/integration"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+)
+
+// expectError checks that err is of kind and, unless constraint is empty, that
+// it broke that constraint.
+func expectError(t *testing.T, err error, kind error, constraint string) {
+	t.Helper()
+	if !errors.Is(err, kind) {
+		t.Errorf("Expected %v, got %v", kind, err)
+	}
+	if constraint != "" && !services.IsConstraint(err, constraint) {
+		t.Errorf("Expected %v to break %s", err, constraint)
+	}
+}
+
+func expectNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
+func postIds(posts []models.Post) []int {
+	ids := []int{}
+	for _, post := range posts {
+		ids = append(ids, post.Id)
+	}
+	return ids
+}
+
+func expectIds(t *testing.T, actual []int, expected ...int) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Errorf("Expected ids %v, got %v", expected, actual)
+		return
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("Expected ids %v, got %v", expected, actual)
+			return
+		}
+	}
+}
+
+func TestUserContract(t *testing.T) {
+	integration.Run(t, func(t *testing.T, s integration.Services, fixtures integration.Fixtures) {
+		ctx := context.Background()
+		if fixtures.Alice.Id == 0 || fixtures.Alice.Id == fixtures.Bob.Id {
+			t.Fatalf("Expected created users to get their own ids, got %d and %d", fixtures.Alice.Id, fixtures.Bob.Id)
+		}
+		if fixtures.Alice.Status != models.UserStatusActive {
+			t.Errorf("Expected a created user to be active, got %s", fixtures.Alice.Status)
+		}
+		user, err := s.User.GetById(ctx, fixtures.Bob.Id)
+		expectNoError(t, err)
+		if user.Email != fixtures.Bob.Email {
+			t.Errorf("Expected user %s, got %s", fixtures.Bob.Email, user.Email)
+		}
+		_, err = s.User.GetById(ctx, 404)
+		expectError(t, err, services.ErrNotFound, "")
+
+		err = s.User.Create(ctx, models.User{Username: "other", PasswordHash: "hash", Email: fixtures.Alice.Email})
+		expectError(t, err, services.ErrConflict, "users_email_key")
+
+		users, page, err := s.User.List(ctx, "1", "10", "")
+		expectNoError(t, err)
+		if page.TotalRecords != 3 || len(users) != 3 || users[0].Id != fixtures.Alice.Id {
+			t.Errorf("Expected the 3 users in order of creation, got %d of %d", len(users), page.TotalRecords)
+		}
+		users, page, err = s.User.List(ctx, "2", "2", "")
+		expectNoError(t, err)
+		if page.TotalRecords != 3 || page.TotalPages != 2 || len(users) != 1 || users[0].Id != fixtures.Carol.Id {
+			t.Errorf("Expected carol alone on the second page, got %+v of %+v", users, page)
+		}
+		users, _, err = s.User.List(ctx, "1", "10", "of bob")
+		expectNoError(t, err)
+		if len(users) != 1 || users[0].Id != fixtures.Bob.Id {
+			t.Errorf("Expected the bio keyword to find bob, got %+v", users)
+		}
+
+		expectNoError(t, s.User.UpdateStatus(ctx, fixtures.Bob.Id, models.UserStatusSuspended, "spam", nil))
+		user, err = s.User.GetById(ctx, fixtures.Bob.Id)
+		expectNoError(t, err)
+		if user.Status != models.UserStatusSuspended {
+			t.Errorf("Expected bob to be suspended, got %s", user.Status)
+		}
+
+		expectNoError(t, s.User.DeleteById(ctx, fixtures.Bob.Id))
+		_, err = s.User.GetById(ctx, fixtures.Bob.Id)
+		expectError(t, err, services.ErrNotFound, "")
+		deleted, err := s.User.GetDeletedByEmail(ctx, fixtures.Bob.Email)
+		expectNoError(t, err)
+		if deleted.Id != fixtures.Bob.Id {
+			t.Errorf("Expected deleted user %d, got %d", fixtures.Bob.Id, deleted.Id)
+		}
+		expectNoError(t, s.User.RestoreById(ctx, fixtures.Bob.Id))
+		_, err = s.User.GetById(ctx, fixtures.Bob.Id)
+		expectNoError(t, err)
+	})
+}
+
+func TestFollowContract(t *testing.T) {
+	integration.Run(t, func(t *testing.T, s integration.Services, fixtures integration.Fixtures) {
+		ctx := context.Background()
+		if !s.Follow.IsFollowing(ctx, fixtures.Alice.Id, fixtures.Carol.Id) || s.Follow.IsFollowing(ctx, fixtures.Carol.Id, fixtures.Alice.Id) {
+			t.Error("Expected alice to follow carol and not the other way round")
+		}
+		expectError(t, s.Follow.Create(ctx, fixtures.Alice.Id, fixtures.Carol.Id), services.ErrConflict, "unique_user_follower_pair")
+		expectError(t, s.Follow.Create(ctx, fixtures.Alice.Id, fixtures.Alice.Id), services.ErrValidation, "different_user_and_follower")
+		expectError(t, s.Follow.Create(ctx, fixtures.Alice.Id, 404), services.ErrNotFound, "fk_user")
+
+		follows, err := s.Follow.GetByFollowerId(ctx, fixtures.Alice.Id)
+		expectNoError(t, err)
+		if len(follows) != 1 || follows[0].UserId != fixtures.Carol.Id || follows[0].FollowerId != fixtures.Alice.Id {
+			t.Fatalf("Expected alice to follow carol, got %+v", follows)
+		}
+		follow, err := s.Follow.GetById(ctx, follows[0].Id)
+		expectNoError(t, err)
+		if follow.UserId != fixtures.Carol.Id {
+			t.Errorf("Expected the follow of carol, got %+v", follow)
+		}
+		followers, err := s.Follow.GetByFolloweeId(ctx, fixtures.Carol.Id)
+		expectNoError(t, err)
+		if len(followers) != 1 || followers[0].Id != follow.Id {
+			t.Errorf("Expected carol to have alice as follower, got %+v", followers)
+		}
+
+		expectNoError(t, s.Follow.Delete(ctx, follow.Id))
+		if s.Follow.IsFollowing(ctx, fixtures.Alice.Id, fixtures.Carol.Id) {
+			t.Error("Expected alice to no longer follow carol")
+		}
+		_, err = s.Follow.GetById(ctx, follow.Id)
+		expectError(t, err, services.ErrNotFound, "")
+	})
+}
+
+func TestPostContract(t *testing.T) {
+	integration.Run(t, func(t *testing.T, s integration.Services, fixtures integration.Fixtures) {
+		ctx := context.Background()
+		posts, _, page, err := s.Post.List(ctx, "1", "10", "")
+		expectNoError(t, err)
+		expectIds(t, postIds(posts), fixtures.BobPost, fixtures.AlicePost)
+		if page.TotalRecords != 2 {
+			t.Errorf("Expected 2 public posts, got %d", page.TotalRecords)
+		}
+		posts, _, _, err = s.Post.List(ctx, "1", "10", "by bob")
+		expectNoError(t, err)
+		expectIds(t, postIds(posts), fixtures.BobPost)
+
+		posts, _, _, err = s.Post.ListByUserId(ctx, fixtures.Alice.Id, "1", "10", "")
+		expectNoError(t, err)
+		expectIds(t, postIds(posts), fixtures.CarolPost, fixtures.BobPost, fixtures.AlicePost)
+		posts, _, page, err = s.Post.ListByUserId(ctx, fixtures.Alice.Id, "2", "2", "")
+		expectNoError(t, err)
+		expectIds(t, postIds(posts), fixtures.AlicePost)
+		if page.TotalRecords != 3 || page.TotalPages != 2 {
+			t.Errorf("Expected 3 posts on 2 pages, got %+v", page)
+		}
+		posts, _, _, err = s.Post.ListByUserId(ctx, fixtures.Bob.Id, "1", "10", "")
+		expectNoError(t, err)
+		expectIds(t, postIds(posts), fixtures.BobPost, fixtures.AlicePost)
+
+		expectNoError(t, s.Post.UpdateArchived(ctx, fixtures.BobPost, true))
+		posts, _, _, err = s.Post.List(ctx, "1", "10", "")
+		expectNoError(t, err)
+		expectIds(t, postIds(posts), fixtures.AlicePost)
+		posts, _, _, err = s.Post.ListArchivedByUserId(ctx, fixtures.Bob.Id, "1", "10")
+		expectNoError(t, err)
+		expectIds(t, postIds(posts), fixtures.BobPost)
+		expectNoError(t, s.Post.UpdateArchived(ctx, fixtures.BobPost, false))
+
+		expectNoError(t, s.Post.DeleteById(ctx, fixtures.BobPost))
+		_, err = s.Post.GetById(ctx, fixtures.BobPost)
+		expectError(t, err, services.ErrNotFound, "")
+		post, err := s.Post.GetById(ctx, fixtures.AlicePost)
+		expectNoError(t, err)
+		if post.UserId != fixtures.Alice.Id {
+			t.Errorf("Expected the post of alice, got %+v", post)
+		}
+		posts, _, _, err = s.Post.ListDeletedByUserId(ctx, fixtures.Bob.Id, "1", "10")
+		expectNoError(t, err)
+		expectIds(t, postIds(posts), fixtures.BobPost)
+		_, err = s.Post.GetDeletedById(ctx, fixtures.BobPost)
+		expectNoError(t, err)
+		expectNoError(t, s.Post.RestoreById(ctx, fixtures.BobPost))
+		_, err = s.Post.GetById(ctx, fixtures.BobPost)
+		expectNoError(t, err)
+	})
+}
+
+func TestCommentContract(t *testing.T) {
+	integration.Run(t, func(t *testing.T, s integration.Services, fixtures integration.Fixtures) {
+		ctx := context.Background()
+		for _, content := range []string{"first", "second", "third"} {
+			expectNoError(t, s.Comment.Create(ctx, fixtures.AlicePost, fixtures.Bob.Id, content))
+		}
+		comments, page, err := s.Comment.ListByPostId(ctx, fixtures.AlicePost, fixtures.Alice.Id, "1", "2")
+		expectNoError(t, err)
+		if page.TotalRecords != 3 || page.TotalPages != 2 || len(comments) != 2 || comments[0].Content != "third" {
+			t.Fatalf("Expected the 2 newest of 3 comments, got %+v of %+v", comments, page)
+		}
+		last, page, err := s.Comment.ListByPostId(ctx, fixtures.AlicePost, fixtures.Alice.Id, "2", "2")
+		expectNoError(t, err)
+		if page.TotalRecords != 3 || len(last) != 1 || last[0].Content != "first" {
+			t.Errorf("Expected the oldest comment on the second page, got %+v of %+v", last, page)
+		}
+
+		comment, err := s.Comment.GetById(ctx, comments[0].Id)
+		expectNoError(t, err)
+		if comment.Id != comments[0].Id || comment.Content != "third" || comment.UserId != fixtures.Bob.Id {
+			t.Errorf("Expected the third comment, got %+v", comment)
+		}
+		expectNoError(t, s.Comment.DeleteById(ctx, comment.Id))
+		_, err = s.Comment.GetById(ctx, comment.Id)
+		expectError(t, err, services.ErrNotFound, "")
+		_, page, err = s.Comment.ListByPostId(ctx, fixtures.AlicePost, fixtures.Alice.Id, "1", "2")
+		expectNoError(t, err)
+		if page.TotalRecords != 2 {
+			t.Errorf("Expected 2 comments left, got %d", page.TotalRecords)
+		}
+
+		expectNoError(t, s.User.UpdateStatus(ctx, fixtures.Bob.Id, models.UserStatusShadowBanned, "spam", nil))
+		_, page, err = s.Comment.ListByPostId(ctx, fixtures.AlicePost, fixtures.Alice.Id, "1", "2")
+		expectNoError(t, err)
+		if page.TotalRecords != 0 {
+			t.Errorf("Expected the comments of a shadow-banned user to be hidden, got %d", page.TotalRecords)
+		}
+		_, page, err = s.Comment.ListByPostId(ctx, fixtures.AlicePost, fixtures.Bob.Id, "1", "2")
+		expectNoError(t, err)
+		if page.TotalRecords != 2 {
+			t.Errorf("Expected a shadow-banned user to see their own comments, got %d", page.TotalRecords)
+		}
+	})
+}
+
+func TestLikeContract(t *testing.T) {
+	integration.Run(t, func(t *testing.T, s integration.Services, fixtures integration.Fixtures) {
+		ctx := context.Background()
+		expectNoError(t, s.Like.CreatePostLike(ctx, fixtures.AlicePost, fixtures.Bob.Id))
+		expectError(t, s.Like.CreatePostLike(ctx, fixtures.AlicePost, fixtures.Bob.Id), services.ErrConflict, "unique_post_user_pair")
+		expectError(t, s.Like.CreatePostLike(ctx, fixtures.AlicePost, 404), services.ErrNotFound, "post_likes_user_id_fkey")
+
+		likes, err := s.Like.ListPostLikesByPostId(ctx, fixtures.AlicePost, fixtures.Alice.Id)
+		expectNoError(t, err)
+		if len(likes) != 1 || likes[0].UserId != fixtures.Bob.Id || likes[0].PostId != fixtures.AlicePost {
+			t.Fatalf("Expected bob to like the post of alice, got %+v", likes)
+		}
+		expectNoError(t, s.User.UpdateStatus(ctx, fixtures.Bob.Id, models.UserStatusShadowBanned, "", nil))
+		if likes, _ := s.Like.ListPostLikesByPostId(ctx, fixtures.AlicePost, fixtures.Alice.Id); len(likes) != 0 {
+			t.Errorf("Expected the like of shadow-banned bob to be hidden from alice, got %+v", likes)
+		}
+		if likes, _ := s.Like.ListPostLikesByPostId(ctx, fixtures.AlicePost, fixtures.Bob.Id); len(likes) != 1 {
+			t.Errorf("Expected shadow-banned bob to see their own like, got %+v", likes)
+		}
+		expectNoError(t, s.User.UpdateStatus(ctx, fixtures.Bob.Id, models.UserStatusActive, "", nil))
+		like, err := s.Like.GetByPostLikeId(ctx, likes[0].Id)
+		expectNoError(t, err)
+		if like.Id != likes[0].Id || like.UserId != fixtures.Bob.Id {
+			t.Errorf("Expected the like of bob, got %+v", like)
+		}
+		expectNoError(t, s.Like.DeletePostLikeById(ctx, like.Id))
+		_, err = s.Like.GetByPostLikeId(ctx, like.Id)
+		expectError(t, err, services.ErrNotFound, "")
+
+		expectNoError(t, s.Comment.Create(ctx, fixtures.AlicePost, fixtures.Alice.Id, "comment"))
+		comments, _, err := s.Comment.ListByPostId(ctx, fixtures.AlicePost, fixtures.Alice.Id, "1", "10")
+		expectNoError(t, err)
+		commentId := comments[0].Id
+		expectNoError(t, s.Like.CreateCommentLike(ctx, commentId, fixtures.Bob.Id))
+		expectError(t, s.Like.CreateCommentLike(ctx, commentId, fixtures.Bob.Id), services.ErrConflict, "unique_comment_user_pair")
+		expectError(t, s.Like.CreateCommentLike(ctx, commentId, 404), services.ErrNotFound, "comment_likes_user_id_fkey")
+		_, err = s.Like.GetByCommentLikeId(ctx, 404)
+		expectError(t, err, services.ErrNotFound, "")
+	})
+}
+
+func TestBookmarkContract(t *testing.T) {
+	integration.Run(t, func(t *testing.T, s integration.Services, fixtures integration.Fixtures) {
+		ctx := context.Background()
+		expectNoError(t, s.Bookmark.CreateCollection(ctx, fixtures.Alice.Id, "saved"))
+		expectError(t, s.Bookmark.CreateCollection(ctx, fixtures.Alice.Id, "saved"), services.ErrConflict, "unique_user_collection_name")
+		collections, err := s.Bookmark.ListCollectionsByUserId(ctx, fixtures.Alice.Id)
+		expectNoError(t, err)
+		if len(collections) != 1 || collections[0].Name != "saved" {
+			t.Fatalf("Expected the saved collection, got %+v", collections)
+		}
+		collectionId := collections[0].Id
+
+		expectNoError(t, s.Bookmark.Create(ctx, fixtures.Alice.Id, fixtures.BobPost, collectionId))
+		expectNoError(t, s.Bookmark.Create(ctx, fixtures.Alice.Id, fixtures.CarolPost, 0))
+		expectError(t, s.Bookmark.Create(ctx, fixtures.Alice.Id, fixtures.BobPost, 0), services.ErrConflict, "unique_bookmark_user_post_pair")
+
+		posts, _, page, err := s.Bookmark.ListByUserId(ctx, fixtures.Alice.Id, 0, "1", "10")
+		expectNoError(t, err)
+		expectIds(t, postIds(posts), fixtures.CarolPost, fixtures.BobPost)
+		if page.TotalRecords != 2 {
+			t.Errorf("Expected 2 bookmarks, got %d", page.TotalRecords)
+		}
+		posts, _, _, err = s.Bookmark.ListByUserId(ctx, fixtures.Alice.Id, collectionId, "1", "10")
+		expectNoError(t, err)
+		expectIds(t, postIds(posts), fixtures.BobPost)
+
+		bookmark, err := s.Bookmark.GetByUserIdAndPostId(ctx, fixtures.Alice.Id, fixtures.BobPost)
+		expectNoError(t, err)
+		expectNoError(t, s.Bookmark.DeleteById(ctx, bookmark.Id))
+		_, err = s.Bookmark.GetByUserIdAndPostId(ctx, fixtures.Alice.Id, fixtures.BobPost)
+		expectError(t, err, services.ErrNotFound, "")
+	})
+}
+
+func TestReportContract(t *testing.T) {
+	integration.Run(t, func(t *testing.T, s integration.Services, fixtures integration.Fixtures) {
+		ctx := context.Background()
+		report := models.Report{ReporterId: fixtures.Alice.Id, TargetType: models.ReportTargetPost, TargetId: fixtures.BobPost, Reason: "spam"}
+		expectNoError(t, s.Report.Create(ctx, report))
+		expectError(t, s.Report.Create(ctx, report), services.ErrConflict, "unique_reporter_target")
+		expectNoError(t, s.Report.Create(ctx, models.Report{ReporterId: fixtures.Bob.Id, TargetType: models.ReportTargetUser, TargetId: fixtures.Carol.Id, Reason: "spam"}))
+
+		reports, page, err := s.Report.List(ctx, models.ReportStatusOpen, "1", "10")
+		expectNoError(t, err)
+		if page.TotalRecords != 2 || len(reports) != 2 || reports[0].ReporterId != fixtures.Alice.Id {
+			t.Fatalf("Expected the 2 open reports oldest first, got %+v", reports)
+		}
+		secondPage, page, err := s.Report.List(ctx, models.ReportStatusOpen, "2", "1")
+		expectNoError(t, err)
+		if page.TotalRecords != 2 || page.TotalPages != 2 || len(secondPage) != 1 || secondPage[0].ReporterId != fixtures.Bob.Id {
+			t.Errorf("Expected the second of 2 open reports, got %+v in %+v", secondPage, page)
+		}
+		got, err := s.Report.GetById(ctx, reports[0].Id)
+		expectNoError(t, err)
+		if got.TargetId != fixtures.BobPost || got.Status != models.ReportStatusOpen {
+			t.Errorf("Expected the open report of the post of bob, got %+v", got)
+		}
+		_, err = s.Report.GetById(ctx, 404)
+		expectError(t, err, services.ErrNotFound, "")
+
+		actions, err := s.Report.ListActions(ctx, models.ReportTargetPost, fixtures.BobPost)
+		expectNoError(t, err)
+		if len(actions) != 1 || actions[0].Action != models.ModerationActionReport || actions[0].ModeratorId != fixtures.Alice.Id {
+			t.Errorf("Expected the report to be in the audit trail, got %+v", actions)
+		}
+
+		// nothing changes when the decision can not be carried out
+		missing := models.Report{ReporterId: fixtures.Alice.Id, TargetType: models.ReportTargetComment, TargetId: 404, Reason: "spam"}
+		expectNoError(t, s.Report.Create(ctx, missing))
+		reports, _, err = s.Report.List(ctx, models.ReportStatusOpen, "1", "10")
+		expectNoError(t, err)
+		suspendedUntil := time.Now().Add(time.Hour)
+		expectError(t, s.Report.Resolve(ctx, reports[2], 9, models.ModerationActionSuspendUser, "", &suspendedUntil), services.ErrNotFound, "")
+		if got, _ := s.Report.GetById(ctx, reports[2].Id); got.Status != models.ReportStatusOpen {
+			t.Errorf("Expected the report to stay open, got %s", got.Status)
+		}
+		if actions, _ := s.Report.ListActions(ctx, models.ReportTargetComment, 404); len(actions) != 1 {
+			t.Errorf("Expected only the report in the audit trail, got %+v", actions)
+		}
+
+		expectNoError(t, s.Report.Resolve(ctx, got, 9, models.ModerationActionRemoveContent, "spam", nil))
+		_, err = s.Post.GetById(ctx, fixtures.BobPost)
+		expectError(t, err, services.ErrNotFound, "")
+		// removed for good, not left in the trash for its author to restore
+		_, err = s.Post.GetDeletedById(ctx, fixtures.BobPost)
+		expectError(t, err, services.ErrNotFound, "")
+		if got, _ := s.Report.GetById(ctx, got.Id); got.Status != models.ReportStatusActioned {
+			t.Errorf("Expected the report to be actioned, got %s", got.Status)
+		}
+		actions, err = s.Report.ListActions(ctx, models.ReportTargetPost, fixtures.BobPost)
+		expectNoError(t, err)
+		if len(actions) != 2 {
+			t.Errorf("Expected the removal in the audit trail, got %+v", actions)
+		}
+
+		expectNoError(t, s.Report.Resolve(ctx, reports[1], 9, models.ModerationActionSuspendUser, "spam", &suspendedUntil))
+		carol, err := s.User.GetById(ctx, fixtures.Carol.Id)
+		expectNoError(t, err)
+		if carol.Status != models.UserStatusSuspended || carol.SuspendedUntil == nil {
+			t.Errorf("Expected carol to be suspended, got %+v", carol)
+		}
+	})
+}
+
+func TestMediaContract(t *testing.T) {
+	integration.Run(t, func(t *testing.T, s integration.Services, fixtures integration.Fixtures) {
+		ctx := context.Background()
+		mediaId, err := s.Media.Create(ctx, models.Media{UserId: fixtures.Alice.Id, Url: "uploads/a.png", ContentType: "image/png",
+			Size: 100, Sha256: strings.Repeat("a", 64), Status: models.MediaStatusReady})
+		expectNoError(t, err)
+		media, err := s.Media.GetById(ctx, mediaId)
+		expectNoError(t, err)
+		if media.Url != "uploads/a.png" || media.UserId != fixtures.Alice.Id {
+			t.Errorf("Expected the created media, got %+v", media)
+		}
+		expectNoError(t, s.Media.AttachToPost(ctx, fixtures.AlicePost, fixtures.Alice.Id, []int{mediaId}))
+		attached, err := s.Media.GetByPostId(ctx, fixtures.AlicePost)
+		expectNoError(t, err)
+		if len(attached) != 1 || attached[0].Id != mediaId {
+			t.Errorf("Expected the media to be attached, got %+v", attached)
+		}
+		unattachedId, err := s.Media.Create(ctx, models.Media{UserId: fixtures.Alice.Id, Url: "uploads/b.png", ContentType: "image/png",
+			Size: 100, Sha256: strings.Repeat("a", 64), Status: models.MediaStatusReady})
+		expectNoError(t, err)
+		usage, err := s.Media.UsageByUserId(ctx, fixtures.Alice.Id, time.Now().Add(-time.Hour))
+		expectNoError(t, err)
+		if usage.StoredBytes != 100 || usage.MediaCount != 2 || usage.RecentUploads != 2 {
+			t.Errorf("Unexpected usage %+v", usage)
+		}
+
+		// a post is created with its media or not at all
+		_, _, before, err := s.Post.ListByUserId(ctx, fixtures.Alice.Id, "1", "10", "")
+		expectNoError(t, err)
+		_, err = s.Post.Create(ctx, models.Post{Title: "t", UserId: fixtures.Alice.Id}, []int{unattachedId, mediaId})
+		if !errors.Is(err, services.ErrConflict) {
+			t.Errorf("Expected attached media to conflict, got %v", err)
+		}
+		_, _, page, err := s.Post.ListByUserId(ctx, fixtures.Alice.Id, "1", "10", "")
+		expectNoError(t, err)
+		_, _, trashPage, err := s.Post.ListDeletedByUserId(ctx, fixtures.Alice.Id, "1", "10")
+		expectNoError(t, err)
+		if page.TotalRecords != before.TotalRecords || trashPage.TotalRecords != 0 {
+			t.Errorf("Expected no post to be left behind, got %d posts and %d in the trash", page.TotalRecords-before.TotalRecords, trashPage.TotalRecords)
+		}
+		postId, err := s.Post.Create(ctx, models.Post{Title: "t", UserId: fixtures.Alice.Id}, []int{unattachedId})
+		expectNoError(t, err)
+		if attached, _ := s.Media.GetByPostId(ctx, postId); len(attached) != 1 || attached[0].Id != unattachedId {
+			t.Errorf("Expected the media to be attached to the new post, got %+v", attached)
+		}
+
+		// a blob goes only once nothing refers to it
+		blobKey := storage.BlobKey(strings.Repeat("b", 64), "png")
+		blobId, err := s.Media.Create(ctx, models.Media{UserId: fixtures.Alice.Id, Url: blobKey, ContentType: "image/png",
+			Size: 100, Sha256: strings.Repeat("b", 64), Status: models.MediaStatusReady})
+		expectNoError(t, err)
+		calls := 0
+		removeFiles := func() error {
+			calls++
+			return nil
+		}
+		removed, err := s.Media.RemoveBlob(ctx, blobKey, nil, removeFiles)
+		expectNoError(t, err)
+		if removed || calls != 0 {
+			t.Errorf("Expected a referenced blob to be kept")
+		}
+		removed, err = s.Media.RemoveBlob(ctx, blobKey, []int{blobId}, removeFiles)
+		expectNoError(t, err)
+		if !removed || calls != 1 {
+			t.Errorf("Expected an unreferenced blob to be removed")
+		}
+		if _, err := s.Media.RemoveBlob(ctx, "uploads/a.png", nil, removeFiles); !errors.Is(err, services.ErrValidation) {
+			t.Errorf("Expected a key that is not a blob to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestUploadSessionContract(t *testing.T) {
+	integration.Run(t, func(t *testing.T, s integration.Services, fixtures integration.Fixtures) {
+		ctx := context.Background()
+		session := models.UploadSession{Id: "session", UserId: fixtures.Alice.Id, Filename: "a.mp4", Size: 100, ExpiresAt: time.Now().Add(time.Hour)}
+		expectNoError(t, s.UploadSession.Create(ctx, session))
+		expectNoError(t, s.UploadSession.UpdateOffset(ctx, "session", 0, 40))
+		got, err := s.UploadSession.GetById(ctx, "session")
+		expectNoError(t, err)
+		if got.Offset != 40 {
+			t.Errorf("Expected offset 40, got %d", got.Offset)
+		}
+		if err := s.UploadSession.UpdateOffset(ctx, "session", 0, 80); err == nil {
+			t.Error("Expected an update from a stale offset to fail")
+		}
+		if got.Status != models.UploadStatusUploading {
+			t.Errorf("Expected a new upload to be uploading, got %q", got.Status)
+		}
+		expectNoError(t, s.UploadSession.UpdateStatus(ctx, "session", models.UploadStatusUploading, models.UploadStatusFinalizing))
+		err = s.UploadSession.UpdateStatus(ctx, "session", models.UploadStatusUploading, models.UploadStatusFinalizing)
+		if !errors.Is(err, services.ErrConflict) {
+			t.Errorf("Expected finalizing twice to conflict, got %v", err)
+		}
+		count, total, err := s.UploadSession.SumPendingByUserId(ctx, fixtures.Alice.Id, time.Now())
+		expectNoError(t, err)
+		if count != 1 || total != 100 {
+			t.Errorf("Expected 1 pending session of 100 bytes, got %d of %d", count, total)
+		}
+		expectNoError(t, s.UploadSession.DeleteById(ctx, "session"))
+		_, err = s.UploadSession.GetById(ctx, "session")
+		expectError(t, err, services.ErrNotFound, "")
+	})
+}
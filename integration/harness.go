@@ -0,0 +1,160 @@
+// Package integration runs the services and the API against a throwaway
+// SQLite database, and holds the contract tests that check the mocks the
+// handler tests use behave like the services they stand in for.
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/db"
+	"github.com/ChenSongJian/ginstagram/migrations"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"gorm.io/gorm"
+)
+
+// Services is one implementation of every service, sharing their data the
+// way the services on one database do.
+type Services struct {
+	User          services.UserService
+	Follow        services.FollowService
+	Post          services.PostService
+	Media         services.MediaService
+	Comment       services.CommentService
+	Like          services.LikeService
+	Bookmark      services.BookmarkService
+	Report        services.ReportService
+	UploadSession services.UploadSessionService
+}
+
+// NewDB returns a private in-memory SQLite database with every migration
+// applied, closed when the test ends.
+func NewDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	database, err := db.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	embedded, err := migrations.Embedded(database.Dialector.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.NewMigrator(database, embedded).Up(0); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+// DBServices returns the services on a database.
+func DBServices(database *gorm.DB) Services {
+	return Services{
+		User:          services.NewDBUserService(database),
+		Follow:        services.NewDBFollowService(database),
+		Post:          services.NewDBPostService(database),
+		Media:         services.NewDBMediaService(database),
+		Comment:       services.NewDBCommentService(database),
+		Like:          services.NewDBLikeService(database),
+		Bookmark:      services.NewDBBookmarkService(database),
+		Report:        services.NewDBReportService(database),
+		UploadSession: services.NewDBUploadSessionService(database),
+	}
+}
+
+// MockServices returns the mocks, wired to each other so that they see the
+// same users, follows, posts and comments.
+func MockServices() Services {
+	users := mocks.NewMockUserService()
+	follows := mocks.NewMockFollowService()
+	follows.UserService = *users
+	media := mocks.NewMockMediaService()
+	media.UserService = users
+	users.MediaService = media
+	posts := mocks.NewMockPostService()
+	posts.UserService, posts.FollowService, posts.MediaService = users, follows, media
+	comments := mocks.NewMockCommentService()
+	comments.UserService, comments.FollowService, comments.PostService = users, follows, posts
+	likes := mocks.NewMockLikeService()
+	likes.UserService, likes.FollowService, likes.PostService, likes.CommentService = users, follows, posts, comments
+	bookmarks := mocks.NewMockBookmarkService()
+	bookmarks.PostService = posts
+	reports := mocks.NewMockReportService()
+	reports.UserService, reports.PostService, reports.CommentService = users, posts, comments
+	return Services{
+		User:          users,
+		Follow:        follows,
+		Post:          posts,
+		Media:         media,
+		Comment:       comments,
+		Like:          likes,
+		Bookmark:      bookmarks,
+		Report:        reports,
+		UploadSession: mocks.NewMockUploadSessionService(),
+	}
+}
+
+// Fixtures are the users and posts Seed creates: Alice and Bob are public,
+// Carol is private and followed by Alice, and each of them has written a post.
+type Fixtures struct {
+	Alice     models.User
+	Bob       models.User
+	Carol     models.User
+	AlicePost int
+	BobPost   int
+	CarolPost int
+}
+
+// Seed creates the fixtures through the services.
+func Seed(t testing.TB, s Services) Fixtures {
+	t.Helper()
+	var fixtures Fixtures
+	for _, user := range []struct {
+		fixture   *models.User
+		post      *int
+		username  string
+		isPrivate bool
+	}{
+		{&fixtures.Alice, &fixtures.AlicePost, "alice", false},
+		{&fixtures.Bob, &fixtures.BobPost, "bob", false},
+		{&fixtures.Carol, &fixtures.CarolPost, "carol", true},
+	} {
+		email := user.username + "@test.com"
+		err := s.User.Create(context.Background(), models.User{Username: user.username, PasswordHash: "hash", Email: email,
+			Bio: "bio of " + user.username, IsPrivate: user.isPrivate})
+		if err != nil {
+			t.Fatalf("creating %s: %v", user.username, err)
+		}
+		if *user.fixture, err = s.User.GetByEmail(context.Background(), email); err != nil {
+			t.Fatalf("loading %s: %v", user.username, err)
+		}
+		*user.post, err = s.Post.Create(context.Background(), models.Post{Title: "post by " + user.username, Content: "content", UserId: user.fixture.Id}, nil)
+		if err != nil {
+			t.Fatalf("creating the post of %s: %v", user.username, err)
+		}
+	}
+	if err := s.Follow.Create(context.Background(), fixtures.Alice.Id, fixtures.Carol.Id); err != nil {
+		t.Fatalf("following carol: %v", err)
+	}
+	return fixtures
+}
+
+// Run runs a contract test against the services on a fresh database and
+// against the mocks, each seeded with the fixtures.
+func Run(t *testing.T, contract func(t *testing.T, s Services, fixtures Fixtures)) {
+	implementations := map[string]func(t *testing.T) Services{
+		"db":   func(t *testing.T) Services { return DBServices(NewDB(t)) },
+		"mock": func(t *testing.T) Services { return MockServices() },
+	}
+	for _, name := range []string{"db", "mock"} {
+		t.Run(name, func(t *testing.T) {
+			s := implementations[name](t)
+			contract(t, s, Seed(t, s))
+		})
+	}
+}
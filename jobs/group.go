@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs background workers on a context that Stop cancels, so that
+// they can be stopped and waited for when the server shuts down.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewGroup() *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in the background with the context of the group.
+func (group *Group) Go(fn func(ctx context.Context)) {
+	group.wg.Add(1)
+	go func() {
+		defer group.wg.Done()
+		fn(group.ctx)
+	}()
+}
+
+// Stop cancels the context of the workers and waits for them to return, until
+// ctx is done.
+func (group *Group) Stop(ctx context.Context) error {
+	group.cancel()
+	done := make(chan struct{})
+	go func() {
+		group.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,41 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/jobs"
+)
+
+func TestGroup_Stop(t *testing.T) {
+	group := jobs.NewGroup()
+	stopped := make(chan struct{})
+	group.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	if err := group.Stop(context.Background()); err != nil {
+		t.Fatalf("Expected the workers to stop, got %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("Expected Stop to wait for the workers")
+	}
+}
+
+func TestGroup_StopTimeout(t *testing.T) {
+	group := jobs.NewGroup()
+	release := make(chan struct{})
+	defer close(release)
+	group.Go(func(ctx context.Context) {
+		<-release
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := group.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Stop to give up on a stuck worker, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Monitor keeps track of the background workers, so that readiness fails
+// when one of them is stuck. Workers beat when they start and whenever they
+// finish a run, saying when to expect the next beat. A nil Monitor ignores
+// beats.
+type Monitor struct {
+	lock sync.Mutex
+	due  map[string]time.Time
+}
+
+func NewMonitor() *Monitor {
+	return &Monitor{due: make(map[string]time.Time)}
+}
+
+// Beat records that the worker named name is alive and beats again within
+// next.
+func (monitor *Monitor) Beat(name string, next time.Duration) {
+	if monitor == nil {
+		return
+	}
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	monitor.due[name] = time.Now().Add(next)
+}
+
+// Check returns an error naming the workers whose beat is overdue at now.
+func (monitor *Monitor) Check(now time.Time) error {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	var overdue []string
+	for name, due := range monitor.due {
+		if now.After(due) {
+			overdue = append(overdue, fmt.Sprintf("%s (due %s ago)", name, now.Sub(due).Round(time.Second)))
+		}
+	}
+	if len(overdue) > 0 {
+		sort.Strings(overdue)
+		return fmt.Errorf("workers not responding: %s", strings.Join(overdue, ", "))
+	}
+	return nil
+}
+
+// every runs fn every interval in group, beating to monitor as name, until
+// the group is stopped. A run may take up to an interval before the worker
+// counts as stuck.
+func every(group *Group, monitor *Monitor, name string, interval time.Duration, fn func(ctx context.Context, now time.Time)) {
+	monitor.Beat(name, 2*interval)
+	group.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				fn(ctx, now)
+				monitor.Beat(name, 2*interval)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
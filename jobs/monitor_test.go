@@ -0,0 +1,28 @@
+package jobs_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/jobs"
+)
+
+func TestMonitor(t *testing.T) {
+	monitor := jobs.NewMonitor()
+	if err := monitor.Check(time.Now()); err != nil {
+		t.Errorf("Expected no workers to be fine, got %v", err)
+	}
+	monitor.Beat("purger", time.Hour)
+	monitor.Beat("transcoder_0", time.Minute)
+	if err := monitor.Check(time.Now()); err != nil {
+		t.Errorf("Expected workers that just beat to be fine, got %v", err)
+	}
+	err := monitor.Check(time.Now().Add(10 * time.Minute))
+	if err == nil || !strings.Contains(err.Error(), "transcoder_0") || strings.Contains(err.Error(), "purger") {
+		t.Errorf("Expected only the transcoder to be overdue, got %v", err)
+	}
+
+	var unmonitored *jobs.Monitor
+	unmonitored.Beat("purger", time.Hour)
+}
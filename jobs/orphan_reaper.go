@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+)
+
+// OrphanGracePeriod is how long an upload may stay unattached before it is
+// reaped, which leaves clients time to create the post it was uploaded for.
+const OrphanGracePeriod = 24 * time.Hour
+
+const orphanBatchSize = 100
+
+// ReapOrphans removes media that was uploaded before now minus gracePeriod but
+// never attached to a post, then every file under uploads/ older than that
+// which no media row or profile image refers to anymore, such as the blobs of
+// purged posts. Chunks staged for resumable uploads are left to the upload
+// expirer. It returns the keys of the files removed. With dryRun set it
+// only logs and returns what it would remove.
+func ReapOrphans(ctx context.Context, mediaService services.MediaService, mediaStorage storage.Storage,
+	now time.Time, gracePeriod time.Duration, dryRun bool) ([]string, error) {
+	cutoff := now.Add(-gracePeriod)
+	var removed []string
+	var unattachedIds []int
+	remove := func(key string) {
+		if dryRun {
+			log.Printf("orphan reaper: would remove %s", key)
+			removed = append(removed, key)
+			return
+		}
+		// a blob is removed under its lock so that an upload of the same
+		// bytes cannot start using it in between
+		var err error
+		if _, ok := storage.BlobSha256(key); ok {
+			var blobRemoved bool
+			blobRemoved, err = mediaService.RemoveBlob(ctx, key, unattachedIds, func() error {
+				return mediaStorage.Delete(key)
+			})
+			if err == nil && !blobRemoved {
+				return
+			}
+		} else {
+			err = mediaStorage.Delete(key)
+		}
+		if err != nil {
+			log.Printf("orphan reaper: unable to remove %s: %v", key, err)
+			return
+		}
+		log.Printf("orphan reaper: removed %s", key)
+		removed = append(removed, key)
+	}
+
+	unattached, err := mediaService.ListUnattachedBefore(ctx, cutoff)
+	if err != nil {
+		return removed, err
+	}
+	for _, media := range unattached {
+		unattachedIds = append(unattachedIds, media.Id)
+		if dryRun {
+			log.Printf("orphan reaper: would remove unattached media %d", media.Id)
+			continue
+		}
+		if err := mediaService.DeleteById(ctx, media.Id); err != nil {
+			return removed, err
+		}
+		log.Printf("orphan reaper: removed unattached media %d", media.Id)
+	}
+
+	// a blob goes once no media references it; in a dry run the unattached
+	// media above is still there and must not count
+	var batch []string
+	reapBatch := func() error {
+		referenced, err := mediaService.ReferencedKeys(ctx, batch, unattachedIds)
+		if err != nil {
+			return err
+		}
+		for _, key := range batch {
+			if !referenced[key] {
+				remove(key)
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	err = mediaStorage.List(storage.UploadPrefix, func(object storage.Object) error {
+		if !object.ModTime.Before(cutoff) || strings.HasPrefix(object.Key, storage.StagingPrefix) {
+			return nil
+		}
+		batch = append(batch, object.Key)
+		if len(batch) < orphanBatchSize {
+			return nil
+		}
+		return reapBatch()
+	})
+	if err != nil {
+		return removed, err
+	}
+	if len(batch) > 0 {
+		if err := reapBatch(); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// StartOrphanReaper runs ReapOrphans every interval in group.
+func StartOrphanReaper(group *Group, mediaService services.MediaService, mediaStorage storage.Storage,
+	interval time.Duration, gracePeriod time.Duration, dryRun bool, monitor *Monitor) {
+	every(group, monitor, "orphan_reaper", interval, func(ctx context.Context, now time.Time) {
+		if _, err := ReapOrphans(ctx, mediaService, mediaStorage, now, gracePeriod, dryRun); err != nil {
+			log.Printf("orphan reaper failed: %v", err)
+		}
+	})
+}
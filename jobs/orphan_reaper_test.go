@@ -0,0 +1,150 @@
+package jobs_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/imaging"
+	"github.com/ChenSongJian/ginstagram/jobs"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/video"
+)
+
+// setUpOrphans stores an attached upload, an unattached one, a profile image,
+// a file nothing refers to and a chunk staged for a resumable upload, all older
+// than the grace period once the returned time is used as now.
+func setUpOrphans(t *testing.T) (*mocks.MockMediaService, storage.Storage, time.Time) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	files := []string{
+		"uploads/2024-01-01/attached.jpg",
+		"uploads/2024-01-01/unattached.jpg",
+		"uploads/2024-01-01/profile.jpg",
+		"uploads/2024-01-01/orphan.mp4",
+		storage.StagingKey("upload", 0, 4, "nonce"),
+	}
+	for _, variantKey := range imaging.VariantKeys("uploads/2024-01-01/attached.jpg") {
+		files = append(files, variantKey)
+	}
+	for _, variantKey := range imaging.VariantKeys("uploads/2024-01-01/unattached.jpg") {
+		files = append(files, variantKey)
+	}
+	for _, file := range files {
+		if err := mediaStorage.Put(file, strings.NewReader("data"), 4, "image/jpeg"); err != nil {
+			t.Fatalf("Error storing file: %v", err)
+		}
+	}
+
+	now := time.Now().Add(2 * jobs.OrphanGracePeriod)
+	uploadedAt := time.Now()
+	mockMediaService.Media[1] = mocks.MediaRecord{Url: "uploads/2024-01-01/attached.jpg", UserId: 1, PostId: 1, CreatedAt: uploadedAt}
+	mockMediaService.Media[2] = mocks.MediaRecord{Url: "uploads/2024-01-01/unattached.jpg", UserId: 1, CreatedAt: uploadedAt}
+	mockMediaService.Media[3] = mocks.MediaRecord{Url: "uploads/2024-01-01/profile.jpg", UserId: 1, CreatedAt: uploadedAt}
+	mockMediaService.UserService.Users["test@test.com"] = models.User{Id: 1, ProfileImageUrl: "uploads/2024-01-01/profile.jpg"}
+	return mockMediaService, mediaStorage, now
+}
+
+var expectedOrphans = []string{
+	"uploads/2024-01-01/orphan.mp4",
+	"uploads/2024-01-01/unattached.jpg",
+	"uploads/2024-01-01/unattached_large.jpg",
+	"uploads/2024-01-01/unattached_medium.jpg",
+	"uploads/2024-01-01/unattached_small.jpg",
+	"uploads/2024-01-01/unattached_thumbnail.jpg",
+}
+
+func TestReapOrphans(t *testing.T) {
+	mockMediaService, mediaStorage, now := setUpOrphans(t)
+
+	removed, err := jobs.ReapOrphans(context.Background(), mockMediaService, mediaStorage, now, jobs.OrphanGracePeriod, false)
+	if err != nil {
+		t.Fatalf("Error reaping orphans: %v", err)
+	}
+	sort.Strings(removed)
+	if strings.Join(removed, ",") != strings.Join(expectedOrphans, ",") {
+		t.Errorf("Expected removed %v, got %v", expectedOrphans, removed)
+	}
+	if _, ok := mockMediaService.Media[2]; ok {
+		t.Errorf("Expected unattached media to be deleted")
+	}
+	if len(mockMediaService.Media) != 2 {
+		t.Errorf("Expected attached media and profile image to be kept, got %v", mockMediaService.Media)
+	}
+	for _, file := range expectedOrphans {
+		if _, err := mediaStorage.Stat(file); err != storage.ErrNotFound {
+			t.Errorf("Expected %s to be removed", file)
+		}
+	}
+	for _, file := range []string{"uploads/2024-01-01/attached.jpg", "uploads/2024-01-01/attached_thumbnail.jpg", "uploads/2024-01-01/profile.jpg"} {
+		if _, err := mediaStorage.Stat(file); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", file, err)
+		}
+	}
+}
+
+func TestReapOrphans_DryRun(t *testing.T) {
+	mockMediaService, mediaStorage, now := setUpOrphans(t)
+
+	removed, err := jobs.ReapOrphans(context.Background(), mockMediaService, mediaStorage, now, jobs.OrphanGracePeriod, true)
+	if err != nil {
+		t.Fatalf("Error reaping orphans: %v", err)
+	}
+	sort.Strings(removed)
+	if strings.Join(removed, ",") != strings.Join(expectedOrphans, ",") {
+		t.Errorf("Expected reported %v, got %v", expectedOrphans, removed)
+	}
+	if len(mockMediaService.Media) != 3 {
+		t.Errorf("Expected no media to be deleted in a dry run, got %v", mockMediaService.Media)
+	}
+	for _, file := range expectedOrphans {
+		if _, err := mediaStorage.Stat(file); err != nil {
+			t.Errorf("Expected %s to be kept in a dry run, got %v", file, err)
+		}
+	}
+}
+
+func TestReapOrphans_GracePeriod(t *testing.T) {
+	mockMediaService, mediaStorage, _ := setUpOrphans(t)
+
+	removed, err := jobs.ReapOrphans(context.Background(), mockMediaService, mediaStorage, time.Now(), jobs.OrphanGracePeriod, false)
+	if err != nil {
+		t.Fatalf("Error reaping orphans: %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("Expected recent uploads to be kept, got %v", removed)
+	}
+}
+
+func TestReapOrphans_VideoRenditions(t *testing.T) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	kept, orphaned := strings.Repeat("ab", 32), strings.Repeat("cd", 32)
+	var files []string
+	for _, sha256 := range []string{kept, orphaned} {
+		key := storage.BlobKey(sha256, "mp4")
+		files = append(files, key, video.OutputKey(key, "poster.jpg"), video.OutputKey(key, "hls/360p/seg_000.ts"))
+	}
+	for _, file := range files {
+		if err := mediaStorage.Put(file, strings.NewReader("data"), 4, "video/mp4"); err != nil {
+			t.Fatalf("Error storing file: %v", err)
+		}
+	}
+	mockMediaService.Media[1] = mocks.MediaRecord{Url: storage.BlobKey(kept, "mp4"), Sha256: kept, UserId: 1, PostId: 1,
+		CreatedAt: time.Now()}
+
+	removed, err := jobs.ReapOrphans(context.Background(), mockMediaService, mediaStorage, time.Now().Add(2*jobs.OrphanGracePeriod), jobs.OrphanGracePeriod, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(removed)
+	expected := files[3:]
+	sort.Strings(expected)
+	if strings.Join(removed, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected only the unreferenced video and its renditions to be removed, got %v", removed)
+	}
+}
@@ -0,0 +1,226 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/video"
+)
+
+// TranscodeTimeout bounds the time spent on a single video.
+const TranscodeTimeout = 30 * time.Minute
+
+// idleBeat is how often idle transcoding workers beat.
+const idleBeat = time.Minute
+
+// MediaQueue takes media to be processed in the background.
+type MediaQueue interface {
+	Enqueue(mediaId int)
+}
+
+// TranscodeQueue transcodes uploaded videos on a pool of workers. The queue
+// itself lives in memory; media still processing when the server stops, or
+// that did not fit in the queue, is queued again by Start.
+type TranscodeQueue struct {
+	mediaService services.MediaService
+	mediaStorage storage.Storage
+	transcoder   video.Transcoder
+	workDir      string
+	pending      chan int
+}
+
+func NewTranscodeQueue(mediaService services.MediaService, mediaStorage storage.Storage,
+	transcoder video.Transcoder, workDir string) *TranscodeQueue {
+	return &TranscodeQueue{
+		mediaService: mediaService,
+		mediaStorage: mediaStorage,
+		transcoder:   transcoder,
+		workDir:      workDir,
+		pending:      make(chan int, 1024),
+	}
+}
+
+// Enqueue queues media for transcoding. It does not block: when the queue is
+// full the media is left processing, to be queued again by the next Start.
+func (queue *TranscodeQueue) Enqueue(mediaId int) {
+	select {
+	case queue.pending <- mediaId:
+	default:
+		log.Printf("transcode: queue is full, media %d stays processing until restart", mediaId)
+	}
+}
+
+// Start starts workers in group, beating to monitor while they wait and
+// around every video, and queues the media left processing by a previous run.
+// Stopping the group cancels the videos being transcoded, which stay
+// processing.
+func (queue *TranscodeQueue) Start(group *Group, workers int, monitor *Monitor) {
+	for i := 0; i < workers; i++ {
+		name := fmt.Sprintf("transcoder_%d", i)
+		monitor.Beat(name, 2*idleBeat)
+		group.Go(func(ctx context.Context) {
+			ticker := time.NewTicker(idleBeat)
+			defer ticker.Stop()
+			for {
+				select {
+				case mediaId := <-queue.pending:
+					monitor.Beat(name, TranscodeTimeout+idleBeat)
+					transcodeCtx, cancel := context.WithTimeout(ctx, TranscodeTimeout)
+					err := TranscodeMedia(transcodeCtx, queue.mediaService, queue.mediaStorage, queue.transcoder, queue.workDir, mediaId)
+					cancel()
+					if err != nil {
+						log.Printf("transcode: media %d failed: %v", mediaId, err)
+					}
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+				monitor.Beat(name, 2*idleBeat)
+			}
+		})
+	}
+	group.Go(func(ctx context.Context) {
+		media, err := queue.mediaService.ListByStatus(ctx, models.MediaStatusProcessing)
+		if err != nil {
+			log.Printf("transcode: unable to list media still processing: %v", err)
+			return
+		}
+		// unlike Enqueue this waits for room in the queue
+		for _, m := range media {
+			select {
+			case queue.pending <- m.Id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// TranscodeMedia transcodes a video that is processing, stores what
+// video.Transcoder makes of it next to it and marks every media row sharing
+// the video ready, or failed if it cannot be transcoded. Media that is not
+// processing anymore, because it was deleted or another row sharing the video
+// got there first, is left alone.
+func TranscodeMedia(ctx context.Context, mediaService services.MediaService, mediaStorage storage.Storage,
+	transcoder video.Transcoder, workDir string, mediaId int) error {
+	media, err := mediaService.GetById(ctx, mediaId)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if media.Status != models.MediaStatusProcessing {
+		return nil
+	}
+	shared, err := mediaService.ListByKey(ctx, media.Url)
+	if err != nil {
+		return err
+	}
+	for _, m := range shared {
+		if m.Status == models.MediaStatusReady {
+			return mediaService.UpdateProcessed(ctx, media.Sha256, models.MediaStatusReady, m.Width, m.Height, m.DurationMs)
+		}
+	}
+
+	info, err := transcode(ctx, mediaStorage, transcoder, workDir, media.Url)
+	if err != nil {
+		if updateErr := mediaService.UpdateProcessed(ctx, media.Sha256, models.MediaStatusFailed,
+			media.Width, media.Height, media.DurationMs); updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+	log.Printf("transcode: media %d is ready", mediaId)
+	return mediaService.UpdateProcessed(ctx, media.Sha256, models.MediaStatusReady,
+		info.Width, info.Height, info.Duration.Milliseconds())
+}
+
+func transcode(ctx context.Context, mediaStorage storage.Storage, transcoder video.Transcoder,
+	workDir string, key string) (video.Info, error) {
+	if err := os.MkdirAll(workDir, 0o700); err != nil {
+		return video.Info{}, err
+	}
+	dir, err := os.MkdirTemp(workDir, "transcode-")
+	if err != nil {
+		return video.Info{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input"+path.Ext(key))
+	if err := download(mediaStorage, key, input); err != nil {
+		return video.Info{}, err
+	}
+	outDir := filepath.Join(dir, "out")
+	if err := os.MkdirAll(filepath.Join(outDir, "hls"), 0o700); err != nil {
+		return video.Info{}, err
+	}
+	info, err := transcoder.Transcode(ctx, input, outDir)
+	if err != nil {
+		return video.Info{}, err
+	}
+
+	// the poster goes last, clients take it as the sign that the rest is there
+	var names []string
+	err = filepath.WalkDir(outDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(outDir, file)
+		if err == nil && name != "poster.jpg" {
+			names = append(names, filepath.ToSlash(name))
+		}
+		return err
+	})
+	if err != nil {
+		return video.Info{}, err
+	}
+	for _, name := range append(names, "poster.jpg") {
+		if err := upload(mediaStorage, filepath.Join(outDir, filepath.FromSlash(name)), video.OutputKey(key, name)); err != nil {
+			return video.Info{}, err
+		}
+	}
+	return info, nil
+}
+
+func download(mediaStorage storage.Storage, key string, file string) error {
+	r, _, err := mediaStorage.Get(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func upload(mediaStorage storage.Storage, file string, key string) error {
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	info, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	return mediaStorage.Put(key, r, info.Size(), mime.TypeByExtension(path.Ext(key)))
+}
@@ -0,0 +1,207 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/jobs"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/video"
+)
+
+// fakeTranscoder writes the files a video.Transcoder is expected to write
+// without looking at the input.
+type fakeTranscoder struct {
+	calls int
+	err   error
+}
+
+func (transcoder *fakeTranscoder) Transcode(ctx context.Context, input string, outDir string) (video.Info, error) {
+	transcoder.calls++
+	if transcoder.err != nil {
+		return video.Info{}, transcoder.err
+	}
+	if _, err := os.Stat(input); err != nil {
+		return video.Info{}, err
+	}
+	for _, name := range []string{"h264.mp4", "poster.jpg", "hls/index.m3u8", "hls/360p/index.m3u8", "hls/360p/seg_000.ts"} {
+		file := filepath.Join(outDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return video.Info{}, err
+		}
+		if err := os.WriteFile(file, []byte(name), 0o644); err != nil {
+			return video.Info{}, err
+		}
+	}
+	return video.Info{Width: 640, Height: 360, Duration: 3 * time.Second}, nil
+}
+
+var videoSha256 = strings.Repeat("ab", 32)
+
+func setUpProcessingVideo(t *testing.T) (*mocks.MockMediaService, storage.Storage, string) {
+	mockMediaService := mocks.NewMockMediaService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	key := storage.BlobKey(videoSha256, "webm")
+	if err := mediaStorage.Put(key, strings.NewReader("video"), 5, "video/webm"); err != nil {
+		t.Fatalf("Error storing file: %v", err)
+	}
+	mockMediaService.Media[1] = mocks.MediaRecord{Url: key, UserId: 1, Sha256: videoSha256, Status: models.MediaStatusProcessing}
+	mockMediaService.Media[2] = mocks.MediaRecord{Url: key, UserId: 2, Sha256: videoSha256, Status: models.MediaStatusProcessing}
+	return mockMediaService, mediaStorage, key
+}
+
+func TestTranscodeMedia(t *testing.T) {
+	mockMediaService, mediaStorage, key := setUpProcessingVideo(t)
+	transcoder := &fakeTranscoder{}
+	err := jobs.TranscodeMedia(context.Background(), mockMediaService, mediaStorage, transcoder, t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{1, 2} {
+		media := mockMediaService.Media[id]
+		if media.Status != models.MediaStatusReady || media.Width != 640 || media.Height != 360 || media.DurationMs != 3000 {
+			t.Errorf("Expected media %d to be ready, got %+v", id, media)
+		}
+	}
+	outputs := video.OutputKeys(key)
+	for _, outputKey := range []string{outputs.Mp4, outputs.Poster, outputs.Playlist, video.OutputKey(key, "hls/360p/seg_000.ts")} {
+		object, err := mediaStorage.Stat(outputKey)
+		if err != nil {
+			t.Errorf("Expected %s to be stored: %v", outputKey, err)
+		}
+		if outputKey == outputs.Playlist && object.ContentType != "application/vnd.apple.mpegurl" {
+			t.Errorf("Unexpected content type %s for the playlist", object.ContentType)
+		}
+	}
+
+	// the other media sharing the video is done too
+	err = jobs.TranscodeMedia(context.Background(), mockMediaService, mediaStorage, transcoder, t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transcoder.calls != 1 {
+		t.Errorf("Expected the video to be transcoded once, got %d", transcoder.calls)
+	}
+}
+
+func TestTranscodeMedia_ReadySibling(t *testing.T) {
+	mockMediaService, mediaStorage, _ := setUpProcessingVideo(t)
+	ready := mockMediaService.Media[2]
+	ready.Status, ready.Width, ready.Height, ready.DurationMs = models.MediaStatusReady, 1280, 720, 5000
+	mockMediaService.Media[2] = ready
+	transcoder := &fakeTranscoder{}
+	err := jobs.TranscodeMedia(context.Background(), mockMediaService, mediaStorage, transcoder, t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transcoder.calls != 0 {
+		t.Error("Expected a video transcoded before not to be transcoded again")
+	}
+	if media := mockMediaService.Media[1]; media.Status != models.MediaStatusReady || media.DurationMs != 5000 {
+		t.Errorf("Expected media to take over what is known of the video, got %+v", media)
+	}
+}
+
+func TestTranscodeMedia_Failed(t *testing.T) {
+	mockMediaService, mediaStorage, key := setUpProcessingVideo(t)
+	transcoder := &fakeTranscoder{err: errors.New("ffmpeg: exit status 1")}
+	err := jobs.TranscodeMedia(context.Background(), mockMediaService, mediaStorage, transcoder, t.TempDir(), 1)
+	if err == nil {
+		t.Error("Expected the transcoder error")
+	}
+	for _, id := range []int{1, 2} {
+		if media := mockMediaService.Media[id]; media.Status != models.MediaStatusFailed {
+			t.Errorf("Expected media %d to have failed, got %s", id, media.Status)
+		}
+	}
+	if _, err := mediaStorage.Stat(video.OutputKeys(key).Poster); err == nil {
+		t.Error("Expected no poster for a failed video")
+	}
+}
+
+func TestTranscodeMedia_NotProcessing(t *testing.T) {
+	mockMediaService, mediaStorage, _ := setUpProcessingVideo(t)
+	transcoder := &fakeTranscoder{}
+	for _, id := range []int{1, 2} {
+		media := mockMediaService.Media[id]
+		media.Status = models.MediaStatusFailed
+		mockMediaService.Media[id] = media
+	}
+	if err := jobs.TranscodeMedia(context.Background(), mockMediaService, mediaStorage, transcoder, t.TempDir(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.TranscodeMedia(context.Background(), mockMediaService, mediaStorage, transcoder, t.TempDir(), 99); err != nil {
+		t.Errorf("Expected deleted media to be skipped, got %v", err)
+	}
+	if transcoder.calls != 0 {
+		t.Error("Expected nothing to be transcoded")
+	}
+}
+
+// lockedMediaService guards the mock against the workers of a queue and tells
+// when media has been processed.
+type lockedMediaService struct {
+	services.MediaService
+	lock      sync.Mutex
+	processed chan string
+}
+
+func (mediaService *lockedMediaService) GetById(ctx context.Context, id int) (models.Media, error) {
+	mediaService.lock.Lock()
+	defer mediaService.lock.Unlock()
+	return mediaService.MediaService.GetById(ctx, id)
+}
+
+func (mediaService *lockedMediaService) ListByKey(ctx context.Context, key string) ([]models.Media, error) {
+	mediaService.lock.Lock()
+	defer mediaService.lock.Unlock()
+	return mediaService.MediaService.ListByKey(ctx, key)
+}
+
+func (mediaService *lockedMediaService) ListByStatus(ctx context.Context, status string) ([]models.Media, error) {
+	mediaService.lock.Lock()
+	defer mediaService.lock.Unlock()
+	return mediaService.MediaService.ListByStatus(ctx, status)
+}
+
+func (mediaService *lockedMediaService) UpdateProcessed(ctx context.Context, sha256 string, status string, width int, height int, durationMs int64) error {
+	mediaService.lock.Lock()
+	err := mediaService.MediaService.UpdateProcessed(ctx, sha256, status, width, height, durationMs)
+	mediaService.lock.Unlock()
+	mediaService.processed <- status
+	return err
+}
+
+func TestTranscodeQueue(t *testing.T) {
+	mockMediaService, mediaStorage, _ := setUpProcessingVideo(t)
+	lockedMediaService := &lockedMediaService{MediaService: mockMediaService, processed: make(chan string, 10)}
+	queue := jobs.NewTranscodeQueue(lockedMediaService, mediaStorage, &fakeTranscoder{}, t.TempDir())
+	// media left processing is queued on start
+	group := jobs.NewGroup()
+	defer group.Stop(context.Background())
+	queue.Start(group, 1, nil)
+	select {
+	case status := <-lockedMediaService.processed:
+		if status != models.MediaStatusReady {
+			t.Errorf("Expected the video to be ready, got %s", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the video left processing to be transcoded")
+	}
+	lockedMediaService.lock.Lock()
+	defer lockedMediaService.lock.Unlock()
+	for _, id := range []int{1, 2} {
+		if media := mockMediaService.Media[id]; media.Status != models.MediaStatusReady {
+			t.Errorf("Expected media %d to be ready, got %s", id, media.Status)
+		}
+	}
+}
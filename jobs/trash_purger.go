@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/imaging"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+)
+
+// PurgeTrash hard-deletes posts, comments and accounts that have been in the
+// trash for longer than services.TrashRetention, then removes the files of the
+// media purged with them unless other media still shares them. Posts go first
+// so that their media is collected before deleting an account cascades to
+// whatever is left. Only the files of media rows are removed: profile image
+// urls are whatever the client sent and are never trusted as keys.
+func PurgeTrash(ctx context.Context, userService services.UserService, postService services.PostService,
+	commentService services.CommentService, mediaService services.MediaService,
+	mediaStorage storage.Storage, now time.Time) error {
+	cutoff := now.Add(-services.TrashRetention)
+
+	media, err := postService.PurgeDeletedBefore(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if err := commentService.PurgeDeletedBefore(ctx, cutoff); err != nil {
+		return err
+	}
+	userMedia, err := userService.PurgeDeletedBefore(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+
+	var urls []string
+	for _, m := range append(media, userMedia...) {
+		if !storage.IsUploadKey(m.Url) {
+			log.Printf("trash purge: not removing %q of media %d, it is not an upload", m.Url, m.Id)
+			continue
+		}
+		urls = append(urls, m.Url)
+	}
+	referenced, err := mediaService.ReferencedKeys(ctx, urls, nil)
+	if err != nil {
+		return err
+	}
+	for _, url := range urls {
+		if referenced[url] {
+			continue
+		}
+		// a blob is removed under its lock so that an upload of the same
+		// bytes cannot start using it in between
+		if _, ok := storage.BlobSha256(url); ok {
+			_, err = mediaService.RemoveBlob(ctx, url, nil, func() error {
+				return removeFiles(mediaStorage, url)
+			})
+		} else {
+			err = removeFiles(mediaStorage, url)
+		}
+		if err != nil {
+			log.Printf("trash purge: unable to remove the files of %s: %v", url, err)
+		}
+	}
+	return nil
+}
+
+// removeFiles removes the file stored under url along with its derived files.
+func removeFiles(mediaStorage storage.Storage, url string) error {
+	files, err := derivedFiles(mediaStorage, url)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := mediaStorage.Delete(file); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// derivedFiles returns the file stored under url along with everything made
+// from it: the variants of an image, the renditions of a video.
+func derivedFiles(mediaStorage storage.Storage, url string) ([]string, error) {
+	files := []string{url}
+	for _, variantKey := range imaging.VariantKeys(url) {
+		files = append(files, variantKey)
+	}
+	sha256, ok := storage.BlobSha256(url)
+	if !ok {
+		return files, nil
+	}
+	files = files[:0]
+	err := mediaStorage.List(storage.BlobPrefix(sha256), func(object storage.Object) error {
+		files = append(files, object.Key)
+		return nil
+	})
+	return files, err
+}
+
+// StartTrashPurger runs PurgeTrash every interval in group.
+func StartTrashPurger(group *Group, userService services.UserService, postService services.PostService,
+	commentService services.CommentService, mediaService services.MediaService,
+	mediaStorage storage.Storage, interval time.Duration, monitor *Monitor) {
+	every(group, monitor, "trash_purger", interval, func(ctx context.Context, now time.Time) {
+		if err := PurgeTrash(ctx, userService, postService, commentService, mediaService, mediaStorage, now); err != nil {
+			log.Printf("trash purge failed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package jobs_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/jobs"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"gorm.io/gorm"
+)
+
+func TestPurgeTrash(t *testing.T) {
+	mockCommentService := mocks.NewMockCommentService()
+	mockPostService := mockCommentService.PostService
+	mockUserService := mockCommentService.UserService
+
+	root := t.TempDir()
+	mediaStorage := storage.NewLocalStorage(root, "/media", []byte("secret"))
+	expiredFile := "uploads/2024-01-01/expired.jpg"
+	recentFile := "uploads/2024-01-01/recent.jpg"
+	profileImage := "uploads/2024-01-01/profile.jpg"
+	sharedFile := "uploads/2024-01-01/shared.jpg"
+	// neither a profile image url nor a media url outside the uploads is
+	// ever removed
+	plantedFile := ".env"
+	if err := os.WriteFile(filepath.Join(root, plantedFile), []byte("JWT_SECRET=secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{expiredFile, recentFile, profileImage, sharedFile} {
+		if err := mediaStorage.Put(file, strings.NewReader("data"), 4, "image/jpeg"); err != nil {
+			t.Fatalf("Error storing file: %v", err)
+		}
+	}
+
+	now := time.Now()
+	expired := now.Add(-services.TrashRetention - time.Hour)
+	recent := now.Add(-time.Hour)
+
+	mockPostService.DeletedPosts[1] = mocks.PostRecord{UserId: 1, DeletedAt: expired}
+	mockPostService.DeletedPosts[2] = mocks.PostRecord{UserId: 1, DeletedAt: recent}
+	mockPostService.MediaService.Media[1] = mocks.MediaRecord{Url: expiredFile, PostId: 1}
+	mockPostService.MediaService.Media[2] = mocks.MediaRecord{Url: recentFile, PostId: 2}
+	mockPostService.DeletedPosts[3] = mocks.PostRecord{UserId: 1, DeletedAt: expired}
+	mockPostService.Posts[4] = mocks.PostRecord{UserId: 3}
+	mockPostService.MediaService.Media[3] = mocks.MediaRecord{Url: sharedFile, PostId: 3}
+	mockPostService.MediaService.Media[4] = mocks.MediaRecord{Url: sharedFile, PostId: 4}
+	mockCommentService.DeletedComments[1] = mocks.CommentRecord{PostId: 2, UserId: 1, DeletedAt: expired}
+	mockUserService.MediaService = mockPostService.MediaService
+	mockPostService.MediaService.Media[5] = mocks.MediaRecord{Url: profileImage, UserId: 2}
+	mockPostService.MediaService.Media[6] = mocks.MediaRecord{Url: plantedFile, UserId: 2}
+	mockUserService.DeletedUsers["expired@example.com"] = models.User{
+		Id:              2,
+		ProfileImageUrl: profileImage,
+		DeletedAt:       gorm.DeletedAt{Time: expired, Valid: true},
+	}
+	mockUserService.DeletedUsers["planted@example.com"] = models.User{
+		Id:              5,
+		ProfileImageUrl: plantedFile,
+		DeletedAt:       gorm.DeletedAt{Time: expired, Valid: true},
+	}
+
+	if err := jobs.PurgeTrash(context.Background(), mockUserService, mockPostService, mockCommentService, mockPostService.MediaService, mediaStorage, now); err != nil {
+		t.Fatalf("Error purging trash: %v", err)
+	}
+
+	if _, ok := mockPostService.DeletedPosts[1]; ok {
+		t.Errorf("Expected expired post to be purged")
+	}
+	if _, ok := mockPostService.DeletedPosts[2]; !ok {
+		t.Errorf("Expected recently deleted post to be kept")
+	}
+	if len(mockCommentService.DeletedComments) != 0 {
+		t.Errorf("Expected expired comment to be purged, got %v", mockCommentService.DeletedComments)
+	}
+	if len(mockUserService.DeletedUsers) != 0 {
+		t.Errorf("Expected expired user to be purged, got %v", mockUserService.DeletedUsers)
+	}
+	for _, file := range []string{expiredFile, profileImage} {
+		if _, err := mediaStorage.Stat(file); err != storage.ErrNotFound {
+			t.Errorf("Expected %s to be removed", file)
+		}
+	}
+	if _, ok := mockPostService.MediaService.Media[5]; ok {
+		t.Errorf("Expected the media of the expired user to be purged")
+	}
+	for _, file := range []string{recentFile, sharedFile} {
+		if _, err := mediaStorage.Stat(file); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", file, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, plantedFile)); err != nil {
+		t.Errorf("Expected %s to be kept, got %v", plantedFile, err)
+	}
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+)
+
+// ExpireUploads removes resumable uploads that were not finalized before they
+// expired, along with the chunks staged for them.
+func ExpireUploads(ctx context.Context, uploadSessionService services.UploadSessionService, mediaStorage storage.Storage, now time.Time) error {
+	sessions, err := uploadSessionService.ListExpiredBefore(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := storage.DeleteStaged(mediaStorage, session.Id); err != nil {
+			log.Printf("upload expiry: unable to remove the chunks of upload %s: %v", session.Id, err)
+			continue
+		}
+		if err := uploadSessionService.DeleteById(ctx, session.Id); err != nil {
+			return err
+		}
+		log.Printf("upload expiry: removed upload %s of user %d", session.Id, session.UserId)
+	}
+	return nil
+}
+
+// StartUploadExpirer runs ExpireUploads every interval in group.
+func StartUploadExpirer(group *Group, uploadSessionService services.UploadSessionService, mediaStorage storage.Storage,
+	interval time.Duration, monitor *Monitor) {
+	every(group, monitor, "upload_expirer", interval, func(ctx context.Context, now time.Time) {
+		if err := ExpireUploads(ctx, uploadSessionService, mediaStorage, now); err != nil {
+			log.Printf("upload expiry failed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package jobs_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/jobs"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/storage"
+)
+
+func TestExpireUploads(t *testing.T) {
+	mockUploadSessionService := mocks.NewMockUploadSessionService()
+	mediaStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	now := time.Now()
+	mockUploadSessionService.Sessions["expired"] = models.UploadSession{Id: "expired", UserId: 1, ExpiresAt: now.Add(-time.Minute)}
+	mockUploadSessionService.Sessions["pending"] = models.UploadSession{Id: "pending", UserId: 1, ExpiresAt: now.Add(time.Hour)}
+	for _, id := range []string{"expired", "pending"} {
+		if err := mediaStorage.Put(storage.StagingKey(id, 0, 4, "nonce"), strings.NewReader("data"), 4, "application/octet-stream"); err != nil {
+			t.Fatalf("Error staging chunk: %v", err)
+		}
+	}
+
+	if err := jobs.ExpireUploads(context.Background(), mockUploadSessionService, mediaStorage, now); err != nil {
+		t.Fatalf("Error expiring uploads: %v", err)
+	}
+	if _, ok := mockUploadSessionService.Sessions["expired"]; ok {
+		t.Errorf("Expected expired upload to be removed")
+	}
+	if chunks, _ := storage.ListStaged(mediaStorage, "expired"); len(chunks) != 0 {
+		t.Errorf("Expected the chunks of the expired upload to be removed, got %+v", chunks)
+	}
+	if _, ok := mockUploadSessionService.Sessions["pending"]; !ok {
+		t.Errorf("Expected pending upload to be kept")
+	}
+	if chunks, _ := storage.ListStaged(mediaStorage, "pending"); len(chunks) != 1 {
+		t.Errorf("Expected the chunks of the pending upload to be kept, got %+v", chunks)
+	}
+}
@@ -0,0 +1,109 @@
+// Package logging sets up the structured logs of the server: JSON lines
+// carrying the id of the request and of the user they were logged for, with
+// passwords, tokens and other secrets redacted.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces the value of secret attributes.
+const Redacted = "[redacted]"
+
+// secretKeys are the attributes whose values are never logged, matched
+// without regard to case, dashes or underscores.
+var secretKeys = map[string]bool{
+	"password":      true,
+	"passwordhash":  true,
+	"oldpassword":   true,
+	"newpassword":   true,
+	"token":         true,
+	"accesstoken":   true,
+	"refreshtoken":  true,
+	"authorization": true,
+	"secret":        true,
+	"jwtsecret":     true,
+	"signingsecret": true,
+}
+
+// IsSecret reports whether the values of attributes named key are redacted.
+func IsSecret(key string) bool {
+	key = strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+	return secretKeys[key]
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if IsSecret(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
+
+// New returns a logger writing JSON lines to w, dropping records below
+// level. Records logged with a context carry its request, user and trace ids.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redact})
+	return slog.New(contextHandler{handler})
+}
+
+type requestIdKey struct{}
+
+type userIdKey struct{}
+
+// WithRequestId returns a copy of ctx carrying the id of the request it is
+// for.
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// RequestId returns the id of the request ctx is for, or "".
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+// WithUserId returns a copy of ctx carrying the id of the user the request is
+// made by.
+func WithUserId(ctx context.Context, userId int) context.Context {
+	return context.WithValue(ctx, userIdKey{}, userId)
+}
+
+// UserId returns the id of the user the request ctx is for is made by, or 0.
+func UserId(ctx context.Context) int {
+	userId, _ := ctx.Value(userIdKey{}).(int)
+	return userId
+}
+
+// contextHandler adds the request and user ids and the trace id of the
+// context a record is logged with to it.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (handler contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if requestId := RequestId(ctx); requestId != "" {
+			record.AddAttrs(slog.String("request_id", requestId))
+		}
+		if userId := UserId(ctx); userId != 0 {
+			record.AddAttrs(slog.Int("user_id", userId))
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()))
+		}
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{handler.Handler.WithGroup(name)}
+}
@@ -0,0 +1,72 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/logging"
+)
+
+func logLine(t *testing.T, buffer *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var line map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &line); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", buffer.String(), err)
+	}
+	return line
+}
+
+func TestNew_RedactsSecrets(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := logging.New(&buffer, slog.LevelInfo)
+	logger.Info("login", "email", "alice@test.com", "password", "Passw0rd!", "Password_Hash", "hash",
+		slog.Group("headers", "Authorization", "Bearer abc"), "access-token", "abc")
+
+	line := logLine(t, &buffer)
+	if line["email"] != "alice@test.com" {
+		t.Errorf("Expected the email to be logged, got %v", line["email"])
+	}
+	for _, key := range []string{"password", "Password_Hash", "access-token"} {
+		if line[key] != logging.Redacted {
+			t.Errorf("Expected %s to be redacted, got %v", key, line[key])
+		}
+	}
+	if headers, _ := line["headers"].(map[string]interface{}); headers["Authorization"] != logging.Redacted {
+		t.Errorf("Expected the authorization header to be redacted, got %v", line["headers"])
+	}
+}
+
+func TestNew_AddsContextIds(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := logging.New(&buffer, slog.LevelInfo).With("component", "test")
+	ctx := logging.WithUserId(logging.WithRequestId(context.Background(), "request-1"), 7)
+	logger.InfoContext(ctx, "hello")
+
+	line := logLine(t, &buffer)
+	if line["request_id"] != "request-1" || line["user_id"] != float64(7) || line["component"] != "test" {
+		t.Errorf("Expected the request and user ids, got %v", line)
+	}
+
+	buffer.Reset()
+	logger.InfoContext(context.Background(), "hello")
+	line = logLine(t, &buffer)
+	if _, ok := line["request_id"]; ok {
+		t.Errorf("Expected no request id outside of a request, got %v", line)
+	}
+}
+
+func TestNew_Level(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := logging.New(&buffer, slog.LevelWarn)
+	logger.Info("hidden")
+	if buffer.Len() != 0 {
+		t.Errorf("Expected info to be dropped at warn level, got %q", buffer.String())
+	}
+	logger.Warn("shown")
+	if line := logLine(t, &buffer); line["msg"] != "shown" {
+		t.Errorf("Expected the warning to be logged, got %v", line)
+	}
+}
@@ -1,13 +1,85 @@
 package main
 
 import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ChenSongJian/ginstagram/app"
+	"github.com/ChenSongJian/ginstagram/config"
 	"github.com/ChenSongJian/ginstagram/db"
-	"github.com/ChenSongJian/ginstagram/web"
+	"github.com/ChenSongJian/ginstagram/logging"
+	"github.com/ChenSongJian/ginstagram/migrations"
+	"github.com/ChenSongJian/ginstagram/tracing"
+	"gorm.io/gorm"
 )
 
 func main() {
-	db.InitDB()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		// migrations only need the database settings
+		cfg, err := config.Read(nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		openDB := func() *gorm.DB {
+			database, err := db.Open(cfg.DB)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return database
+		}
+		if err := migrations.Command(os.Args[2:], openDB, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	cfg.Print(os.Stderr)
+	// the log package and GORM end up in this logger too
+	slog.SetDefault(logging.New(os.Stderr, cfg.LogLevel))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("tracing setup failed", "error", err)
+		os.Exit(1)
+	}
+	server, err := app.New(cfg)
+	if err != nil {
+		slog.Error("startup failed", "error", err)
+		os.Exit(1)
+	}
+	server.StartJobs()
+
+	signals, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Run() }()
+	slog.Info("listening", "port", cfg.Port)
 
-	r := web.NewRouter()
-	r.Run()
+	exitCode := 0
+	select {
+	case err := <-stopped:
+		slog.Error("server stopped", "error", err)
+		exitCode = 1
+	case <-signals.Done():
+		slog.Info("shutting down", "drain_delay", cfg.Shutdown.DrainDelay, "timeout", cfg.Shutdown.Timeout)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.DrainDelay+cfg.Shutdown.Timeout)
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("shutdown failed", "error", err)
+			exitCode = 1
+		}
+		cancel()
+		<-stopped
+	}
+	stop()
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Error("flushing traces failed", "error", err)
+	}
+	os.Exit(exitCode)
 }
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const startKey = "ginstagram:metrics_start"
+
+// GORMPlugin times the statements of a database into DBQueryDuration.
+type GORMPlugin struct{}
+
+func (GORMPlugin) Name() string {
+	return "ginstagram:metrics"
+}
+
+func (GORMPlugin) Initialize(database *gorm.DB) error {
+	type registerer interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}
+	callbacks := database.Callback()
+	for _, operation := range []struct {
+		name          string
+		before, after registerer
+	}{
+		{"create", callbacks.Create().Before("*"), callbacks.Create().After("*")},
+		{"query", callbacks.Query().Before("*"), callbacks.Query().After("*")},
+		{"update", callbacks.Update().Before("*"), callbacks.Update().After("*")},
+		{"delete", callbacks.Delete().Before("*"), callbacks.Delete().After("*")},
+		{"row", callbacks.Row().Before("*"), callbacks.Row().After("*")},
+		{"raw", callbacks.Raw().Before("*"), callbacks.Raw().After("*")},
+	} {
+		if err := operation.before.Register("ginstagram:metrics_start", start); err != nil {
+			return err
+		}
+		if err := operation.after.Register("ginstagram:metrics_observe", observe(operation.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func start(tx *gorm.DB) {
+	tx.InstanceSet(startKey, time.Now())
+}
+
+func observe(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		started, ok := tx.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		table := tx.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		DBQueryDuration.WithLabelValues(operation, table).Observe(time.Since(started.(time.Time)).Seconds())
+	}
+}
@@ -0,0 +1,127 @@
+// Package metrics holds the Prometheus metrics of the server, served at
+// /metrics: HTTP requests, database queries and connections, uploads, logins
+// and what users create.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ginstagram"
+
+// Registry holds the metrics below and the Go runtime and process metrics.
+// It is shared by every App in the process.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by method, route template and status.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database queries, by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	Uploads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_total",
+		Help:      "Media uploaded, by content type.",
+	}, []string{"media_type"})
+	UploadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes of media uploaded, by content type.",
+	}, []string{"media_type"})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts, by result, success or failure.",
+	}, []string{"result"})
+
+	PostsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_created_total",
+		Help:      "Posts created.",
+	})
+	CommentsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "comments_created_total",
+		Help:      "Comments created.",
+	})
+	LikesCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "likes_created_total",
+		Help:      "Likes created, by what was liked, post or comment.",
+	}, []string{"target"})
+	FollowsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "follows_created_total",
+		Help:      "Follows created.",
+	})
+)
+
+// The values of the labels of Logins and LikesCreated.
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+	LikePost     = "post"
+	LikeComment  = "comment"
+)
+
+var database dbStatsCollector
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPRequestDuration, DBQueryDuration,
+		Uploads, UploadBytes, Logins,
+		PostsCreated, CommentsCreated, LikesCreated, FollowsCreated,
+		&database,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// SetDB makes the connection pool metrics those of sqlDB, the database of
+// the last App built.
+func SetDB(sqlDB *sql.DB) {
+	database.db.Store(sqlDB)
+}
+
+// dbStatsCollector collects the connection pool stats of the database set
+// with SetDB, if there is one.
+type dbStatsCollector struct {
+	db atomic.Pointer[sql.DB]
+}
+
+func (collector *dbStatsCollector) Describe(descs chan<- *prometheus.Desc) {
+	collectors.NewDBStatsCollector(nil, namespace).Describe(descs)
+}
+
+func (collector *dbStatsCollector) Collect(metrics chan<- prometheus.Metric) {
+	if sqlDB := collector.db.Load(); sqlDB != nil {
+		collectors.NewDBStatsCollector(sqlDB, namespace).Collect(metrics)
+	}
+}
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/models"
+)
+
+// CheckAccountStatus returns why the account may not be used, or nil.
+// Shadow-banned accounts keep working so their owners don't notice.
+func CheckAccountStatus(user models.User) error {
+	switch user.Status {
+	case models.UserStatusBanned:
+		return errors.New("account is banned")
+	case models.UserStatusSuspended:
+		if user.SuspendedUntil == nil {
+			return errors.New("account is suspended")
+		}
+		if user.SuspendedUntil.After(time.Now()) {
+			return fmt.Errorf("account is suspended until %s", user.SuspendedUntil.Format("2006-01-02 15:04:05"))
+		}
+	}
+	return nil
+}
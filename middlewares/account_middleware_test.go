@@ -0,0 +1,116 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/middlewares"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckAccountStatus(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	testCases := []struct {
+		user     models.User
+		expected string
+	}{
+		{models.User{Status: models.UserStatusActive}, ""},
+		{models.User{Status: ""}, ""},
+		{models.User{Status: models.UserStatusShadowBanned}, ""},
+		{models.User{Status: models.UserStatusSuspended, SuspendedUntil: &past}, ""},
+		{models.User{Status: models.UserStatusSuspended, SuspendedUntil: &future}, "account is suspended until"},
+		{models.User{Status: models.UserStatusSuspended}, "account is suspended"},
+		{models.User{Status: models.UserStatusBanned}, "account is banned"},
+	}
+
+	for _, tc := range testCases {
+		err := middlewares.CheckAccountStatus(tc.user)
+		if tc.expected == "" && err != nil {
+			t.Errorf("CheckAccountStatus(%s) = %v; expected nil", tc.user.Status, err)
+		}
+		if tc.expected != "" && (err == nil || !strings.Contains(err.Error(), tc.expected)) {
+			t.Errorf("CheckAccountStatus(%s) = %v; expected %s", tc.user.Status, err, tc.expected)
+		}
+	}
+}
+
+func TestAuthMiddleware_BannedUser(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	user := models.User{
+		Id:           1,
+		Username:     "username",
+		PasswordHash: "PasswordHash",
+		Email:        "email",
+	}
+	token, _ := middlewares.GenerateToken(testJWTSecret, user, true)
+	user.Status = models.UserStatusBanned
+	mockUserService.Users["email"] = user
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+	middlewares.AuthMiddleware(testJWTSecret, mockUserService)(context)
+
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+	expectedResponseBodyString := "account is banned"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body to contain %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestAuthMiddleware_ShadowBannedUser(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	user := models.User{
+		Id:           1,
+		Username:     "username",
+		PasswordHash: "PasswordHash",
+		Email:        "email",
+	}
+	token, _ := middlewares.GenerateToken(testJWTSecret, user, true)
+	user.Status = models.UserStatusShadowBanned
+	mockUserService.Users["email"] = user
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+	middlewares.AuthMiddleware(testJWTSecret, mockUserService)(context)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	tokenUser := context.MustGet("tokenUser").(models.User)
+	if tokenUser.Status != models.UserStatusShadowBanned {
+		t.Errorf("Expected user status %s, got %s", models.UserStatusShadowBanned, tokenUser.Status)
+	}
+}
+
+func TestAuthMiddleware_DeletedUser(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	user := models.User{
+		Id:           1,
+		Username:     "username",
+		PasswordHash: "PasswordHash",
+		Email:        "email",
+	}
+	token, _ := middlewares.GenerateToken(testJWTSecret, user, true)
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Request.Header.Set("Authorization", "Bearer "+token)
+	middlewares.AuthMiddleware(testJWTSecret, mockUserService)(context)
+
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.Code)
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"github.com/gin-contrib/cors"
 )
 
-func NewCorsConfig() cors.Config {
+func NewCorsConfig(allowOrigins []string) cors.Config {
 	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"http://localhost:3000"}
-	config.AllowHeaders = []string{"Authorization", "Content-Type"}
+	config.AllowOrigins = allowOrigins
+	config.AllowHeaders = []string{"Authorization", "Content-Type", "Upload-Offset", "Tus-Resumable"}
+	config.ExposeHeaders = []string{"Location", "Upload-Offset", "Upload-Length", "Upload-Expires", "Tus-Resumable"}
 	return config
 }
@@ -7,14 +7,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ChenSongJian/ginstagram/logging"
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-var jwtSecret = "my-jwt-key"
-
-func GenerateToken(user models.User, active bool) (string, error) {
+// GenerateToken issues an access token for user signed with jwtSecret.
+func GenerateToken(jwtSecret string, user models.User, active bool) (string, error) {
 	if user == (models.User{}) {
 		return "", errors.New("invalid user")
 	}
@@ -27,17 +29,20 @@ func GenerateToken(user models.User, active bool) (string, error) {
 	return token.SignedString([]byte(jwtSecret))
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware accepts access tokens signed with jwtSecret. The account
+// state is loaded from userService on every request, so suspensions and bans
+// also apply to tokens issued before the sanction.
+func AuthMiddleware(jwtSecret string, userService services.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "Authorization header is required"))
 			return
 		}
 
 		splitToken := strings.Split(authHeader, " ")
 		if len(splitToken) != 2 || splitToken[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization header"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "Invalid Authorization header"))
 			return
 		}
 
@@ -45,34 +50,46 @@ func AuthMiddleware() gin.HandlerFunc {
 			return []byte(jwtSecret), nil
 		})
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, err.Error()))
 			return
 		}
 
 		if !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "Invalid token"))
 			return
 		}
 
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Failed to extract claims"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "Failed to extract claims"))
 			return
 		}
 
 		active, ok := claims["active"].(bool)
 		if !ok || !active {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token is not active"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "Token is not active"))
 			return
 		}
 
 		user, err := extractUserFromClaims(claims)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Failed to extract user information: %s", err)})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, fmt.Sprintf("Failed to extract user information: %s", err)))
+			return
+		}
+
+		currentUser, err := userService.GetById(c.Request.Context(), user.Id)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "user not found"))
+			return
+		}
+		if err := CheckAccountStatus(currentUser); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, err.Error()))
 			return
 		}
+		user.Status = currentUser.Status
 
 		c.Set("tokenUser", user)
+		c.Request = c.Request.WithContext(logging.WithUserId(c.Request.Context(), user.Id))
 		c.Next()
 	}
 }
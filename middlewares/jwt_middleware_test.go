@@ -1,6 +1,7 @@
 package middlewares_test
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -9,11 +10,22 @@ import (
 
 	"github.com/ChenSongJian/ginstagram/middlewares"
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
 	"github.com/gin-gonic/gin"
 )
 
+const testJWTSecret = "test-jwt-secret"
+
+// activeUsers finds every user as an active account, for tests that only need
+// AuthMiddleware to read the token.
+type activeUsers struct{ services.UserService }
+
+func (activeUsers) GetById(ctx context.Context, userId int) (models.User, error) {
+	return models.User{Id: userId, Status: models.UserStatusActive}, nil
+}
+
 func TestGenerateToken_MissingUser(t *testing.T) {
-	token, err := middlewares.GenerateToken(models.User{}, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, models.User{}, true)
 	if err == nil {
 		t.Error("Expected error, got nil")
 	}
@@ -29,7 +41,7 @@ func TestGenerateToken_ValidUser(t *testing.T) {
 		PasswordHash: "PasswordHash",
 		Email:        "email",
 	}
-	token, err := middlewares.GenerateToken(user, true)
+	token, err := middlewares.GenerateToken(testJWTSecret, user, true)
 	if err != nil {
 		t.Error("Expected no error, got", err)
 	}
@@ -42,7 +54,7 @@ func TestAuthMiddleware_NoAuthorizationHeader(t *testing.T) {
 	response := httptest.NewRecorder()
 	context, _ := gin.CreateTestContext(response)
 	context.Request, _ = http.NewRequest("GET", "/", nil)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	if response.Code != http.StatusUnauthorized {
 		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.Code)
 	}
@@ -57,7 +69,7 @@ func TestAuthMiddleware_InvalidAuthorizationFormat(t *testing.T) {
 	context, _ := gin.CreateTestContext(response)
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "token")
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	if response.Code != http.StatusUnauthorized {
 		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.Code)
 	}
@@ -72,7 +84,7 @@ func TestAuthMiddleware_InvalidToken(t *testing.T) {
 	context, _ := gin.CreateTestContext(response)
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", "Bearer invalid_token")
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 	if response.Code != http.StatusUnauthorized {
 		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.Code)
 	}
@@ -92,12 +104,12 @@ func TestAuthMiddleware_InactiveValidToken(t *testing.T) {
 		PasswordHash: "PasswordHash",
 		Email:        "email",
 	}
-	token, _ := middlewares.GenerateToken(user, false)
+	token, _ := middlewares.GenerateToken(testJWTSecret, user, false)
 	formatted_token := fmt.Sprintf("Bearer %s", token)
 
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", formatted_token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 
 	if response.Code != http.StatusUnauthorized {
 		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.Code)
@@ -118,12 +130,12 @@ func TestAuthMiddleware_ValidToken(t *testing.T) {
 		PasswordHash: "PasswordHash",
 		Email:        "email",
 	}
-	token, _ := middlewares.GenerateToken(user, true)
+	token, _ := middlewares.GenerateToken(testJWTSecret, user, true)
 	formatted_token := fmt.Sprintf("Bearer %s", token)
 
 	context.Request, _ = http.NewRequest("GET", "/", nil)
 	context.Request.Header.Set("Authorization", formatted_token)
-	middlewares.AuthMiddleware()(context)
+	middlewares.AuthMiddleware(testJWTSecret, activeUsers{})(context)
 
 	if response.Code != http.StatusOK {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
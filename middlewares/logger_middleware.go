@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIdHeader carries the id of a request, from the client or a proxy in
+// front of the server, and back in the response.
+const RequestIdHeader = "X-Request-ID"
+
+// requestIdPattern is what request ids from clients must look like to be
+// trusted, anything else could break or forge log lines.
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// probes are the routes load balancers and orchestrators poll.
+var probes = map[string]bool{"/ping": true, "/healthz": true, "/readyz": true}
+
+func newRequestId() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// RequestIdMiddleware gives every request an id, the one in the X-Request-ID
+// header if there is a valid one, and puts it in the request context for
+// logging and in the response headers.
+func RequestIdMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(RequestIdHeader)
+		if !requestIdPattern.MatchString(requestId) {
+			requestId = newRequestId()
+		}
+		c.Header(RequestIdHeader, requestId)
+		c.Request = c.Request.WithContext(logging.WithRequestId(c.Request.Context(), requestId))
+		c.Next()
+	}
+}
+
+// LoggerMiddleware logs every request once it is served, at error level if
+// it failed on the server and at warn level if the client got it wrong.
+// Health probes that pass are only logged at debug level.
+func LoggerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		if status >= 500 {
+			level = slog.LevelError
+		} else if status >= 400 {
+			level = slog.LevelWarn
+		} else if probes[route] {
+			level = slog.LevelDebug
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("size", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.Any("errors", c.Errors.Errors()))
+		}
+		slog.Default().LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
@@ -0,0 +1,88 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/logging"
+	"github.com/ChenSongJian/ginstagram/middlewares"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/gin-gonic/gin"
+)
+
+// captureLogs makes the default logger write to the returned buffer until the
+// test ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buffer bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buffer, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buffer
+}
+
+func newLoggedRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(middlewares.RequestIdMiddleware(), middlewares.LoggerMiddleware())
+	r.GET("/users/:userId", middlewares.AuthMiddleware(testJWTSecret, activeUsers{}), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"request_id": logging.RequestId(c.Request.Context())})
+	})
+	return r
+}
+
+func TestRequestIdMiddleware_GeneratesId(t *testing.T) {
+	captureLogs(t)
+	response := httptest.NewRecorder()
+	newLoggedRouter().ServeHTTP(response, httptest.NewRequest("GET", "/users/1", nil))
+	requestId := response.Header().Get(middlewares.RequestIdHeader)
+	if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(requestId) {
+		t.Errorf("Expected a generated request id, got %q", requestId)
+	}
+}
+
+func TestRequestIdMiddleware_KeepsValidId(t *testing.T) {
+	captureLogs(t)
+	for header, kept := range map[string]bool{"abc-123": true, "bad id\n{}": false} {
+		request := httptest.NewRequest("GET", "/users/1", nil)
+		request.Header.Set(middlewares.RequestIdHeader, header)
+		response := httptest.NewRecorder()
+		newLoggedRouter().ServeHTTP(response, request)
+		if requestId := response.Header().Get(middlewares.RequestIdHeader); (requestId == header) != kept {
+			t.Errorf("Expected %q to be kept: %v, got %q", header, kept, requestId)
+		}
+	}
+}
+
+func TestLoggerMiddleware(t *testing.T) {
+	logs := captureLogs(t)
+	token, err := middlewares.GenerateToken(testJWTSecret, models.User{Id: 3, Username: "username", PasswordHash: "PasswordHash", Email: "email"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest("GET", "/users/42", nil)
+	request.Header.Set(middlewares.RequestIdHeader, "request-1")
+	request.Header.Set("Authorization", "Bearer "+token)
+	response := httptest.NewRecorder()
+	newLoggedRouter().ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("Expected one JSON line, got %q: %v", logs.String(), err)
+	}
+	expected := map[string]interface{}{
+		"msg": "request", "level": "INFO", "method": "GET", "route": "/users/:userId",
+		"status": float64(200), "request_id": "request-1", "user_id": float64(3),
+	}
+	for key, value := range expected {
+		if line[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, line[key])
+		}
+	}
+}
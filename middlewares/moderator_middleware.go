@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ModeratorMiddleware must run after AuthMiddleware. The moderator flag is
+// read from the database rather than the token so revoking it takes effect
+// immediately.
+func ModeratorMiddleware(userService services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenUser, exists := c.Get("tokenUser")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "user not found in token"))
+			return
+		}
+		modelTokenUser, ok := tokenUser.(models.User)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.NewErrorResponse(http.StatusUnauthorized, "invalid token user type"))
+			return
+		}
+		user, err := userService.GetById(c.Request.Context(), modelTokenUser.Id)
+		if err != nil || !user.IsModerator {
+			c.AbortWithStatusJSON(http.StatusForbidden, utils.NewErrorResponse(http.StatusForbidden, "moderator permission required"))
+			return
+		}
+		c.Next()
+	}
+}
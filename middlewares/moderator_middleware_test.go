@@ -0,0 +1,70 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/middlewares"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestModeratorMiddleware_MissingToken(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+
+	middlewares.ModeratorMiddleware(mockUserService)(context)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, response.Code)
+	}
+}
+
+func TestModeratorMiddleware_NotModerator(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockUserService.Users["test@test.com"] = models.User{
+		Id:    1,
+		Email: "test@test.com",
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Set("tokenUser", models.User{Id: 1, Email: "test@test.com"})
+
+	middlewares.ModeratorMiddleware(mockUserService)(context)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, response.Code)
+	}
+	expectedResponseBodyString := "moderator permission required"
+	if !strings.Contains(response.Body.String(), expectedResponseBodyString) {
+		t.Errorf("Expected response body to contain %s, got %s", expectedResponseBodyString, response.Body.String())
+	}
+}
+
+func TestModeratorMiddleware_Moderator(t *testing.T) {
+	mockUserService := mocks.NewMockUserService()
+	mockUserService.Users["test@test.com"] = models.User{
+		Id:          1,
+		Email:       "test@test.com",
+		IsModerator: true,
+	}
+
+	response := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(response)
+	context.Request, _ = http.NewRequest("GET", "/", nil)
+	context.Set("tokenUser", models.User{Id: 1, Email: "test@test.com"})
+
+	middlewares.ModeratorMiddleware(mockUserService)(context)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, response.Code)
+	}
+	if context.IsAborted() {
+		t.Error("Expected request not to be aborted")
+	}
+}
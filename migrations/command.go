@@ -0,0 +1,119 @@
+package migrations
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+const usage = `usage: ginstagram migrate <command>
+
+commands:
+  up [n]         apply n pending migrations, all of them by default
+  down [n]       revert the last n applied migrations, 1 by default
+  status         list migrations and when they were applied
+  create <name>  add an empty migration for every database to -dir
+`
+
+// Command runs the migrate subcommand with args. openDB is only called by
+// commands that need the database.
+func Command(args []string, openDB func() *gorm.DB, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dir := flags.String("dir", Dir, "directory holding the migrations of every database")
+	flags.Usage = func() {
+		fmt.Fprint(out, usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing migrate command")
+	}
+	command, rest := flags.Arg(0), flags.Args()[1:]
+
+	count := func(defaultCount int) (int, error) {
+		if len(rest) == 0 {
+			return defaultCount, nil
+		}
+		n, err := strconv.Atoi(rest[0])
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid number of migrations %q", rest[0])
+		}
+		return n, nil
+	}
+
+	switch command {
+	case "create":
+		if len(rest) != 1 {
+			return errors.New("usage: migrate create <name>")
+		}
+		for _, dialect := range Dialects {
+			up, down, err := Create(filepath.Join(*dir, dialect), rest[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "created %s\ncreated %s\n", up, down)
+		}
+		return nil
+	case "up", "down", "status":
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+
+	db := openDB()
+	migrations, err := Embedded(db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	migrator := NewMigrator(db, migrations)
+	switch command {
+	case "up":
+		n, err := count(0)
+		if err != nil {
+			return err
+		}
+		applied, err := migrator.Up(n)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+	case "down":
+		n, err := count(1)
+		if err != nil {
+			return err
+		}
+		reverted, err := migrator.Down(n)
+		for _, migration := range reverted {
+			fmt.Fprintf(out, "reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	default:
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if status.Up == "" {
+				appliedAt += " (unknown to this build)"
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,311 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The schema is defined by numbered migrations, each a pair of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql, applied in order of
+// their version and recorded in schema_migrations. Every database the
+// services run on has its own copy of them, in a directory named after its
+// gorm dialect.
+//
+//go:embed sql/postgres/*.sql sql/sqlite/*.sql
+var embedded embed.FS
+
+// Dir is where the migrations are kept in the source tree.
+const Dir = "migrations/sql"
+
+// Dialects are the databases there are migrations for.
+var Dialects = []string{"postgres", "sqlite"}
+
+// lockKey names the advisory lock held while migrating, so that replicas
+// starting at the same time do not apply the same migration twice.
+const lockKey = 4_151_337_402_913_207
+
+// baselineVersion is the migration holding the schema setup.sql used to
+// create, and baselineTable a table it creates. A database that has the table
+// but no migrations recorded was made by setup.sql, and Up marks the baseline
+// applied instead of failing to create what is already there.
+const (
+	baselineVersion = 1
+	baselineTable   = "users"
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration along with when it was applied, if it was.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type SchemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// Embedded returns the migrations built into the binary for a dialect.
+func Embedded(dialect string) ([]Migration, error) {
+	if !slices.Contains(Dialects, dialect) {
+		return nil, fmt.Errorf("no migrations for %s", dialect)
+	}
+	fsys, err := fs.Sub(embedded, "sql/"+dialect)
+	if err != nil {
+		return nil, err
+	}
+	return Load(fsys)
+}
+
+// Load reads the migrations at the root of fsys, ordered by version. Every
+// migration needs both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: name is not <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d: named both %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Create adds an empty migration to dir, numbered after the last one there,
+// and returns the paths of its up and down files.
+func Create(dir string, name string) (string, string, error) {
+	if !regexp.MustCompile(`^[a-z0-9_]+$`).MatchString(name) {
+		return "", "", errors.New("migration name may only contain lowercase letters, digits and underscores")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	version := int64(1)
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	up, down := base+".up.sql", base+".down.sql"
+	if err := os.WriteFile(up, []byte("-- "+name+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down, []byte("-- undo "+name+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	return up, down, nil
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Up applies up to limit pending migrations, all of them if limit is 0, and
+// returns those applied.
+func (migrator *Migrator) Up(limit int) ([]Migration, error) {
+	var applied []Migration
+	err := migrator.locked(func(conn *gorm.DB, done map[int64]SchemaMigration) error {
+		if len(done) == 0 && conn.Migrator().HasTable(baselineTable) {
+			for _, migration := range migrator.migrations {
+				if migration.Version != baselineVersion {
+					continue
+				}
+				record := SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+				if err := conn.Session(&gorm.Session{}).Create(&record).Error; err != nil {
+					return err
+				}
+				log.Printf("migrations: found a schema made by setup.sql, marked %d_%s applied", migration.Version, migration.Name)
+				done[migration.Version] = record
+			}
+		}
+		for _, migration := range migrator.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if limit > 0 && len(applied) == limit {
+				break
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Printf("migrations: applied %d_%s", migration.Version, migration.Name)
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts up to limit applied migrations, latest first, and returns those
+// reverted.
+func (migrator *Migrator) Down(limit int) ([]Migration, error) {
+	var reverted []Migration
+	err := migrator.locked(func(conn *gorm.DB, done map[int64]SchemaMigration) error {
+		for i := len(migrator.migrations) - 1; i >= 0 && len(reverted) < limit; i-- {
+			migration := migrator.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Printf("migrations: reverted %d_%s", migration.Version, migration.Name)
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every migration with when it was applied. Versions recorded in
+// the database that this binary does not know come last, without SQL.
+func (migrator *Migrator) Status() ([]Status, error) {
+	var statuses []Status
+	err := migrator.locked(func(conn *gorm.DB, done map[int64]SchemaMigration) error {
+		for _, migration := range migrator.migrations {
+			status := Status{Migration: migration}
+			if record, ok := done[migration.Version]; ok {
+				status.AppliedAt = &record.AppliedAt
+				delete(done, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+		var unknown []Status
+		for _, record := range done {
+			appliedAt := record.AppliedAt
+			unknown = append(unknown, Status{Migration: Migration{Version: record.Version, Name: record.Name}, AppliedAt: &appliedAt})
+		}
+		sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+		statuses = append(statuses, unknown...)
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending returns the migrations not applied yet. Unlike Status it does not
+// wait for the migration lock, so health checks can use it while migrations
+// run.
+func (migrator *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	conn := migrator.db.WithContext(ctx)
+	if !conn.Migrator().HasTable(&SchemaMigration{}) {
+		return migrator.migrations, nil
+	}
+	var versions []int64
+	if err := conn.Model(&SchemaMigration{}).Pluck("version", &versions).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int64]bool, len(versions))
+	for _, version := range versions {
+		done[version] = true
+	}
+	var pending []Migration
+	for _, migration := range migrator.migrations {
+		if !done[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// locked runs fn on a single connection holding the migration lock, passing
+// the migrations applied so far by version. SQLite has no advisory locks, but
+// neither does it have replicas.
+func (migrator *Migrator) locked(fn func(conn *gorm.DB, done map[int64]SchemaMigration) error) error {
+	return migrator.db.Connection(func(conn *gorm.DB) error {
+		if conn.Dialector.Name() == "postgres" {
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", lockKey).Error; err != nil {
+				return err
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", lockKey)
+		}
+
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return err
+		}
+		var records []SchemaMigration
+		if err := conn.Find(&records).Error; err != nil {
+			return err
+		}
+		done := make(map[int64]SchemaMigration, len(records))
+		for _, record := range records {
+			done[record.Version] = record
+		}
+		return fn(conn, done)
+	})
+}
@@ -0,0 +1,201 @@
+package migrations_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ChenSongJian/ginstagram/db"
+	"github.com/ChenSongJian/ginstagram/migrations"
+	"gorm.io/gorm"
+)
+
+func TestEmbedded(t *testing.T) {
+	for _, dialect := range migrations.Dialects {
+		embedded, err := migrations.Embedded(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(embedded) == 0 || embedded[0].Version != 1 {
+			t.Fatalf("%s: expected the initial schema first, got %+v", dialect, embedded)
+		}
+		for i, migration := range embedded {
+			if i > 0 && migration.Version <= embedded[i-1].Version {
+				t.Errorf("%s: expected migrations in order, got %d after %d", dialect, migration.Version, embedded[i-1].Version)
+			}
+		}
+		if !strings.Contains(embedded[0].Up, "CREATE TABLE users") || !strings.Contains(embedded[0].Down, "DROP TABLE users") {
+			t.Errorf("%s: expected the initial schema to create and drop users", dialect)
+		}
+	}
+
+	postgres, _ := migrations.Embedded("postgres")
+	sqlite, _ := migrations.Embedded("sqlite")
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("Expected the same migrations for every database, got %d and %d", len(postgres), len(sqlite))
+	}
+	for i := range postgres {
+		if postgres[i].Version != sqlite[i].Version || postgres[i].Name != sqlite[i].Name {
+			t.Errorf("Expected the same migrations for every database, got %d_%s and %d_%s",
+				postgres[i].Version, postgres[i].Name, sqlite[i].Version, sqlite[i].Name)
+		}
+	}
+
+	if _, err := migrations.Embedded("mysql"); err == nil {
+		t.Error("Expected an unknown database to be rejected")
+	}
+}
+
+func TestMigrator_SQLite(t *testing.T) {
+	database, err := db.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := migrations.Embedded("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator := migrations.NewMigrator(database, embedded)
+	if pending, err := migrator.Pending(context.Background()); err != nil || len(pending) != len(embedded) {
+		t.Errorf("Expected every migration to be pending, got %d, %v", len(pending), err)
+	}
+
+	applied, err := migrator.Up(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(embedded) {
+		t.Errorf("Expected %d migrations applied, got %d", len(embedded), len(applied))
+	}
+	if !database.Migrator().HasTable("users") {
+		t.Error("Expected the users table to exist")
+	}
+	if applied, err := migrator.Up(0); err != nil || len(applied) != 0 {
+		t.Errorf("Expected nothing left to apply, got %+v, %v", applied, err)
+	}
+	if pending, err := migrator.Pending(context.Background()); err != nil || len(pending) != 0 {
+		t.Errorf("Expected nothing pending, got %+v, %v", pending, err)
+	}
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("Expected %d_%s to be applied", status.Version, status.Name)
+		}
+	}
+
+	if _, err := migrator.Down(len(embedded)); err != nil {
+		t.Fatal(err)
+	}
+	if database.Migrator().HasTable("users") {
+		t.Error("Expected the users table to be dropped")
+	}
+}
+
+func TestMigrator_Baseline(t *testing.T) {
+	database, err := db.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := migrations.Embedded("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a database made by setup.sql has the initial schema but no record of it
+	if err := database.Exec(embedded[0].Up).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	migrator := migrations.NewMigrator(database, embedded)
+	applied, err := migrator.Up(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(embedded)-1 || applied[0].Version != embedded[1].Version {
+		t.Errorf("Expected every migration after the initial schema to be applied, got %+v", applied)
+	}
+	if pending, err := migrator.Pending(context.Background()); err != nil || len(pending) != 0 {
+		t.Errorf("Expected nothing pending, got %+v, %v", pending, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_bio.up.sql":        {Data: []byte("ALTER TABLE users ADD bio TEXT;")},
+		"0002_add_bio.down.sql":      {Data: []byte("ALTER TABLE users DROP bio;")},
+		"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+	loaded, err := migrations.Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || loaded[0].Name != "create_users" || loaded[1].Version != 2 || loaded[1].Down != "ALTER TABLE users DROP bio;" {
+		t.Errorf("Unexpected migrations %+v", loaded)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	testCases := map[string]fstest.MapFS{
+		"missing down": {
+			"0001_create_users.up.sql": {Data: []byte("CREATE TABLE users (id INT);")},
+		},
+		"bad name": {
+			"create_users.sql": {Data: []byte("CREATE TABLE users (id INT);")},
+		},
+		"one version, two names": {
+			"0001_create_users.up.sql": {Data: []byte("CREATE TABLE users (id INT);")},
+			"0001_users.down.sql":      {Data: []byte("DROP TABLE users;")},
+		},
+	}
+	for name, fsys := range testCases {
+		if _, err := migrations.Load(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "0007_create_users.up.sql"), []byte("CREATE TABLE users (id INT);"), 0o644)
+	os.WriteFile(filepath.Join(dir, "0007_create_users.down.sql"), []byte("DROP TABLE users;"), 0o644)
+
+	up, down, err := migrations.Create(dir, "add_bio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0008_add_bio.up.sql" || filepath.Base(down) != "0008_add_bio.down.sql" {
+		t.Errorf("Unexpected files %s and %s", up, down)
+	}
+	if loaded, err := migrations.Load(os.DirFS(dir)); err != nil || len(loaded) != 2 {
+		t.Errorf("Expected the new migration to load, got %+v, %v", loaded, err)
+	}
+	if _, _, err := migrations.Create(dir, "Add Bio"); err == nil {
+		t.Error("Expected an invalid name to be rejected")
+	}
+}
+
+func TestCommand_Create(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	openDB := func() *gorm.DB {
+		t.Fatal("Expected create not to need the database")
+		return nil
+	}
+	if err := migrations.Command([]string{"-dir", dir, "create", "add_bio"}, openDB, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), filepath.Join(dir, "postgres", "0001_add_bio.up.sql")) ||
+		!strings.Contains(out.String(), filepath.Join(dir, "sqlite", "0001_add_bio.up.sql")) {
+		t.Errorf("Unexpected output %s", out.String())
+	}
+	if err := migrations.Command([]string{"sideways"}, openDB, &out); err == nil {
+		t.Error("Expected an unknown command to be rejected")
+	}
+}
@@ -0,0 +1,12 @@
+DROP TABLE moderation_actions;
+DROP TABLE reports;
+DROP TABLE bookmarks;
+DROP TABLE collections;
+DROP TABLE comment_likes;
+DROP TABLE post_likes;
+DROP TABLE comments;
+DROP TABLE upload_sessions;
+DROP TABLE media;
+DROP TABLE posts;
+DROP TABLE follows;
+DROP TABLE users;
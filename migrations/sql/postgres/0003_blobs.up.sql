@@ -0,0 +1,4 @@
+CREATE TABLE blobs (
+    sha256 CHAR(64) PRIMARY KEY,
+    referenced_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,167 @@
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    username VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(1023) NOT NULL,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    is_private BOOLEAN DEFAULT false,
+    bio TEXT,
+    profile_image_url VARCHAR(1023),
+    is_moderator BOOLEAN DEFAULT false,
+    status VARCHAR(31) NOT NULL DEFAULT 'active',
+    status_reason TEXT,
+    suspended_until DATETIME,
+    deleted_at DATETIME,
+    CONSTRAINT valid_user_status CHECK (status IN ('active', 'suspended', 'banned', 'shadow_banned'))
+);
+
+CREATE INDEX users_deleted_at_idx ON users (deleted_at);
+
+CREATE TABLE follows (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL,
+    follower_id INT NOT NULL,
+    CONSTRAINT different_user_and_follower CHECK (user_id != follower_id),
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_follower FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT unique_user_follower_pair UNIQUE (user_id, follower_id)
+);
+
+CREATE TABLE posts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    title VARCHAR(255),
+    content TEXT,
+    user_id INT,
+    is_archived BOOLEAN NOT NULL DEFAULT false,
+    deleted_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX posts_deleted_at_idx ON posts (deleted_at);
+
+CREATE TABLE media (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    user_id INT NOT NULL,
+    post_id INT,
+    url VARCHAR(1023) NOT NULL,
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    content_type VARCHAR(127) NOT NULL,
+    size BIGINT NOT NULL,
+    width INT NOT NULL DEFAULT 0,
+    height INT NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    sha256 CHAR(64) NOT NULL,
+    status VARCHAR(31) NOT NULL DEFAULT 'ready',
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    CONSTRAINT valid_media_status CHECK (status IN ('processing', 'ready', 'failed'))
+);
+
+-- also counts the recent uploads of a user for the hourly upload limit
+CREATE INDEX media_user_id_idx ON media (user_id, created_at);
+CREATE INDEX media_post_id_idx ON media (post_id);
+-- identical uploads share a blob, so several rows can have the same url
+CREATE INDEX media_url_idx ON media (url);
+-- files derived from a blob are traced back to it by its checksum
+CREATE INDEX media_sha256_idx ON media (sha256);
+CREATE INDEX media_processing_idx ON media (id) WHERE status = 'processing';
+
+CREATE TABLE upload_sessions (
+    id CHAR(32) PRIMARY KEY,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    user_id INT NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    "offset" BIGINT NOT NULL DEFAULT 0,
+    expires_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT offset_within_size CHECK ("offset" >= 0 AND "offset" <= size)
+);
+
+CREATE INDEX upload_sessions_user_id_idx ON upload_sessions (user_id);
+CREATE INDEX upload_sessions_expires_at_idx ON upload_sessions (expires_at);
+
+CREATE TABLE comments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    post_id INT NOT NULL,
+    user_id INT NOT NULL,
+    content TEXT,
+    deleted_at DATETIME,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX comments_deleted_at_idx ON comments (deleted_at);
+
+CREATE TABLE post_likes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT,
+    post_id INT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    CONSTRAINT unique_post_user_pair UNIQUE (post_id, user_id)
+);
+
+CREATE TABLE comment_likes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT,
+    comment_id INT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    CONSTRAINT unique_comment_user_pair UNIQUE (comment_id, user_id)
+);
+
+CREATE TABLE collections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    user_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT unique_user_collection_name UNIQUE (user_id, name)
+);
+
+CREATE TABLE bookmarks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    user_id INT NOT NULL,
+    post_id INT NOT NULL,
+    collection_id INT,
+    position INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE SET NULL,
+    CONSTRAINT unique_bookmark_user_post_pair UNIQUE (user_id, post_id)
+);
+
+CREATE TABLE reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    reporter_id INT NOT NULL,
+    target_type VARCHAR(31) NOT NULL,
+    target_id INT NOT NULL,
+    reason VARCHAR(63) NOT NULL,
+    description TEXT,
+    status VARCHAR(31) NOT NULL DEFAULT 'open',
+    FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT valid_report_target_type CHECK (target_type IN ('post', 'comment', 'user')),
+    CONSTRAINT unique_reporter_target UNIQUE (reporter_id, target_type, target_id)
+);
+
+CREATE INDEX reports_status_idx ON reports (status, created_at);
+
+CREATE TABLE moderation_actions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    report_id INT,
+    moderator_id INT NOT NULL,
+    target_type VARCHAR(31) NOT NULL,
+    target_id INT NOT NULL,
+    action VARCHAR(31) NOT NULL,
+    note TEXT
+);
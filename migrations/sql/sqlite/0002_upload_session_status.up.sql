@@ -0,0 +1,2 @@
+ALTER TABLE upload_sessions ADD COLUMN status VARCHAR(31) NOT NULL DEFAULT 'uploading'
+    CONSTRAINT valid_upload_session_status CHECK (status IN ('uploading', 'finalizing'));
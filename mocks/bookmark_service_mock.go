@@ -0,0 +1,276 @@
+package mocks
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/ChenSongJian/ginstagram/db"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/utils"
+)
+
+type MockBookmarkService struct {
+	Bookmarks   map[int]BookmarkRecord
+	Collections map[int]CollectionRecord
+	PostService *MockPostService
+}
+
+func NewMockBookmarkService() *MockBookmarkService {
+	return &MockBookmarkService{
+		Bookmarks:   make(map[int]BookmarkRecord),
+		Collections: make(map[int]CollectionRecord),
+		PostService: NewMockPostService(),
+	}
+}
+
+type BookmarkRecord struct {
+	UserId       int
+	PostId       int
+	CollectionId int
+	Position     int
+}
+
+type CollectionRecord struct {
+	UserId   int
+	Name     string
+	Position int
+}
+
+var BookmarkRecordId = 0
+var CollectionRecordId = 0
+
+func (bookmarkService *MockBookmarkService) ListByUserId(ctx context.Context, userId int, collectionId int, pageNum string, pageSize string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+	pageNumInt, err := strconv.Atoi(pageNum)
+	if err != nil {
+		pageNumInt = 1
+	}
+	pageSizeInt, err := strconv.Atoi(pageSize)
+	if err != nil {
+		pageSizeInt = 10
+	}
+
+	filterUserIds := bookmarkService.PostService.visibleUserIds(userId)
+
+	var bookmarks []BookmarkRecord
+	for _, bookmark := range bookmarkService.Bookmarks {
+		if bookmark.UserId != userId {
+			continue
+		}
+		if collectionId != 0 && bookmark.CollectionId != collectionId {
+			continue
+		}
+		post, ok := bookmarkService.PostService.Posts[bookmark.PostId]
+		if !ok || post.IsArchived || !utils.IsInIntSlice(post.UserId, filterUserIds) {
+			continue
+		}
+		bookmarks = append(bookmarks, bookmark)
+	}
+	sort.Slice(bookmarks, func(i, j int) bool {
+		return bookmarks[i].Position > bookmarks[j].Position
+	})
+
+	var posts []models.Post
+	var postIds []int
+	for _, bookmark := range bookmarks {
+		post := bookmarkService.PostService.Posts[bookmark.PostId]
+		posts = append(posts, models.Post{
+			Id:      bookmark.PostId,
+			Title:   post.Title,
+			Content: post.Content,
+			UserId:  post.UserId,
+		})
+		postIds = append(postIds, bookmark.PostId)
+	}
+	mediaMap := make(map[int][]models.Media)
+	for _, m := range bookmarkService.PostService.MediaService.Media {
+		if utils.IsInIntSlice(m.PostId, postIds) {
+			mediaMap[m.PostId] = append(mediaMap[m.PostId], models.Media{
+				Url: m.Url,
+			})
+		}
+	}
+
+	totalCount := len(posts)
+	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
+
+	offset := (pageNumInt - 1) * pageSizeInt
+	if offset < 0 {
+		offset = 0
+	}
+
+	if offset >= totalCount {
+		return []models.Post{}, map[int][]models.Media{}, utils.PageResponse{
+			TotalPages:   totalPages,
+			TotalRecords: totalCount,
+		}, nil
+	}
+
+	endIndex := offset + pageSizeInt
+	if endIndex > totalCount {
+		endIndex = totalCount
+	}
+
+	pageResponse := utils.PageResponse{
+		PageNum:      pageNumInt,
+		PageSize:     pageSizeInt,
+		TotalPages:   totalPages,
+		TotalRecords: totalCount,
+	}
+	return posts[offset:endIndex], mediaMap, pageResponse, nil
+}
+
+func (bookmarkService *MockBookmarkService) GetByUserIdAndPostId(ctx context.Context, userId int, postId int) (models.Bookmark, error) {
+	for k, v := range bookmarkService.Bookmarks {
+		if v.UserId == userId && v.PostId == postId {
+			bookmark := models.Bookmark{
+				Id:       k,
+				UserId:   v.UserId,
+				PostId:   v.PostId,
+				Position: v.Position,
+			}
+			if v.CollectionId != 0 {
+				collectionId := v.CollectionId
+				bookmark.CollectionId = &collectionId
+			}
+			return bookmark, nil
+		}
+	}
+	return models.Bookmark{}, errNotFound
+}
+
+func (bookmarkService *MockBookmarkService) Create(ctx context.Context, userId int, postId int, collectionId int) error {
+	if _, ok := bookmarkService.PostService.Posts[postId]; !ok {
+		return constraintError(db.ConstraintForeignKey, "bookmarks", "bookmarks_post_id_fkey")
+	}
+	if _, ok := bookmarkService.Collections[collectionId]; collectionId != 0 && !ok {
+		return constraintError(db.ConstraintForeignKey, "bookmarks", "bookmarks_collection_id_fkey")
+	}
+	position := 0
+	for _, v := range bookmarkService.Bookmarks {
+		if v.UserId == userId && v.PostId == postId {
+			return constraintError(db.ConstraintUnique, "bookmarks", "unique_bookmark_user_post_pair")
+		}
+		if v.UserId == userId && v.Position > position {
+			position = v.Position
+		}
+	}
+	BookmarkRecordId++
+	bookmarkService.Bookmarks[BookmarkRecordId] = BookmarkRecord{
+		UserId:       userId,
+		PostId:       postId,
+		CollectionId: collectionId,
+		Position:     position + 1,
+	}
+	return nil
+}
+
+func (bookmarkService *MockBookmarkService) UpdateCollection(ctx context.Context, bookmarkId int, collectionId int) error {
+	bookmark, ok := bookmarkService.Bookmarks[bookmarkId]
+	if !ok {
+		return errNotFound
+	}
+	bookmark.CollectionId = collectionId
+	bookmarkService.Bookmarks[bookmarkId] = bookmark
+	return nil
+}
+
+func (bookmarkService *MockBookmarkService) DeleteById(ctx context.Context, bookmarkId int) error {
+	delete(bookmarkService.Bookmarks, bookmarkId)
+	return nil
+}
+
+func (bookmarkService *MockBookmarkService) Reorder(ctx context.Context, userId int, postIds []int) error {
+	base := 0
+	for _, v := range bookmarkService.Bookmarks {
+		if v.UserId == userId && v.Position > base {
+			base = v.Position
+		}
+	}
+	for i, postId := range postIds {
+		for k, v := range bookmarkService.Bookmarks {
+			if v.UserId == userId && v.PostId == postId {
+				v.Position = base + len(postIds) - i
+				bookmarkService.Bookmarks[k] = v
+			}
+		}
+	}
+	return nil
+}
+
+func (bookmarkService *MockBookmarkService) ListCollectionsByUserId(ctx context.Context, userId int) ([]models.Collection, error) {
+	var collections = make([]models.Collection, 0)
+	for k, v := range bookmarkService.Collections {
+		if v.UserId == userId {
+			collections = append(collections, models.Collection{
+				Id:       k,
+				UserId:   v.UserId,
+				Name:     v.Name,
+				Position: v.Position,
+			})
+		}
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].Position > collections[j].Position
+	})
+	return collections, nil
+}
+
+func (bookmarkService *MockBookmarkService) GetCollectionById(ctx context.Context, collectionId int) (models.Collection, error) {
+	if v, ok := bookmarkService.Collections[collectionId]; ok {
+		return models.Collection{
+			Id:       collectionId,
+			UserId:   v.UserId,
+			Name:     v.Name,
+			Position: v.Position,
+		}, nil
+	}
+	return models.Collection{}, errNotFound
+}
+
+func (bookmarkService *MockBookmarkService) CreateCollection(ctx context.Context, userId int, name string) error {
+	position := 0
+	for _, v := range bookmarkService.Collections {
+		if v.UserId == userId && v.Name == name {
+			return constraintError(db.ConstraintUnique, "collections", "unique_user_collection_name")
+		}
+		if v.UserId == userId && v.Position > position {
+			position = v.Position
+		}
+	}
+	CollectionRecordId++
+	bookmarkService.Collections[CollectionRecordId] = CollectionRecord{
+		UserId:   userId,
+		Name:     name,
+		Position: position + 1,
+	}
+	return nil
+}
+
+func (bookmarkService *MockBookmarkService) DeleteCollectionById(ctx context.Context, collectionId int) error {
+	delete(bookmarkService.Collections, collectionId)
+	for k, v := range bookmarkService.Bookmarks {
+		if v.CollectionId == collectionId {
+			v.CollectionId = 0
+			bookmarkService.Bookmarks[k] = v
+		}
+	}
+	return nil
+}
+
+func (bookmarkService *MockBookmarkService) ReorderCollections(ctx context.Context, userId int, collectionIds []int) error {
+	base := 0
+	for _, v := range bookmarkService.Collections {
+		if v.UserId == userId && v.Position > base {
+			base = v.Position
+		}
+	}
+	for i, collectionId := range collectionIds {
+		if v, ok := bookmarkService.Collections[collectionId]; ok && v.UserId == userId {
+			v.Position = base + len(collectionIds) - i
+			bookmarkService.Collections[collectionId] = v
+		}
+	}
+	return nil
+}
@@ -1,39 +1,44 @@
 package mocks
 
 import (
-	"errors"
+	"context"
 	"math"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/ChenSongJian/ginstagram/models"
 	"github.com/ChenSongJian/ginstagram/utils"
 )
 
 type MockCommentService struct {
-	Comments      map[int]CommentRecord
-	UserService   *MockUserService
-	FollowService *MockFollowService
-	PostService   *MockPostService
+	Comments        map[int]CommentRecord
+	DeletedComments map[int]CommentRecord
+	UserService     *MockUserService
+	FollowService   *MockFollowService
+	PostService     *MockPostService
 }
 
 func NewMockCommentService() *MockCommentService {
 	return &MockCommentService{
-		Comments:      make(map[int]CommentRecord),
-		UserService:   NewMockUserService(),
-		FollowService: NewMockFollowService(),
-		PostService:   NewMockPostService(),
+		Comments:        make(map[int]CommentRecord),
+		DeletedComments: make(map[int]CommentRecord),
+		UserService:     NewMockUserService(),
+		FollowService:   NewMockFollowService(),
+		PostService:     NewMockPostService(),
 	}
 }
 
 type CommentRecord struct {
-	Content string
-	PostId  int
-	UserId  int
+	Content   string
+	PostId    int
+	UserId    int
+	DeletedAt time.Time
 }
 
 var commentRecordId = 0
 
-func (mockCommentService *MockCommentService) ListByPostId(postId int, pageNum string, pageSize string) ([]models.Comment, utils.PageResponse, error) {
+func (mockCommentService *MockCommentService) ListByPostId(ctx context.Context, postId int, viewerId int, pageNum string, pageSize string) ([]models.Comment, utils.PageResponse, error) {
 	pageNumInt, err := strconv.Atoi(pageNum)
 	if err != nil {
 		pageNumInt = 1
@@ -43,15 +48,19 @@ func (mockCommentService *MockCommentService) ListByPostId(postId int, pageNum s
 		pageSizeInt = 10
 	}
 	var comments []models.Comment
-	for _, commentRecord := range mockCommentService.Comments {
-		if commentRecord.PostId == postId {
+	for id, commentRecord := range mockCommentService.Comments {
+		if commentRecord.PostId == postId && (commentRecord.UserId == viewerId || !mockCommentService.isShadowBanned(commentRecord.UserId)) {
 			comments = append(comments, models.Comment{
+				Id:      id,
 				Content: commentRecord.Content,
 				PostId:  commentRecord.PostId,
 				UserId:  commentRecord.UserId,
 			})
 		}
 	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].Id > comments[j].Id
+	})
 
 	totalCount := len(comments)
 	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
@@ -85,7 +94,7 @@ func (mockCommentService *MockCommentService) ListByPostId(postId int, pageNum s
 	return pagedComment, pageResponse, nil
 }
 
-func (mockCommentService *MockCommentService) Create(postId int, userId int, content string) error {
+func (mockCommentService *MockCommentService) Create(ctx context.Context, postId int, userId int, content string) error {
 	commentRecordId++
 	commentRecord := CommentRecord{
 		Content: content,
@@ -96,19 +105,42 @@ func (mockCommentService *MockCommentService) Create(postId int, userId int, con
 	return nil
 }
 
-func (mockCommentService *MockCommentService) GetById(commentId int) (models.Comment, error) {
+func (mockCommentService *MockCommentService) GetById(ctx context.Context, commentId int) (models.Comment, error) {
 	commentRecord, ok := mockCommentService.Comments[commentId]
 	if !ok {
-		return models.Comment{}, errors.New("record not found")
+		return models.Comment{}, errNotFound
 	}
 	return models.Comment{
+		Id:      commentId,
 		Content: commentRecord.Content,
 		PostId:  commentRecord.PostId,
 		UserId:  commentRecord.UserId,
 	}, nil
 }
 
-func (mockCommentService *MockCommentService) DeleteById(commentId int) error {
-	delete(mockCommentService.Comments, commentId)
+func (mockCommentService *MockCommentService) DeleteById(ctx context.Context, commentId int) error {
+	if comment, ok := mockCommentService.Comments[commentId]; ok {
+		comment.DeletedAt = time.Now()
+		mockCommentService.DeletedComments[commentId] = comment
+		delete(mockCommentService.Comments, commentId)
+	}
+	return nil
+}
+
+func (mockCommentService *MockCommentService) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) error {
+	for commentId, comment := range mockCommentService.DeletedComments {
+		if comment.DeletedAt.Before(cutoff) {
+			delete(mockCommentService.DeletedComments, commentId)
+		}
+	}
 	return nil
 }
+
+func (mockCommentService *MockCommentService) isShadowBanned(userId int) bool {
+	for _, user := range mockCommentService.UserService.Users {
+		if user.Id == userId {
+			return user.Status == models.UserStatusShadowBanned
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package mocks
+
+import (
+	"github.com/ChenSongJian/ginstagram/db"
+	"github.com/ChenSongJian/ginstagram/services"
+	"gorm.io/gorm"
+)
+
+// errNotFound is the error the services fail with when a record is missing.
+var errNotFound = services.TranslateError(gorm.ErrRecordNotFound)
+
+// constraintError is the error the services fail with when a write breaks a
+// constraint of the schema.
+func constraintError(kind string, table string, constraint string) error {
+	return services.TranslateError(&db.ConstraintError{Kind: kind, Table: table, Constraint: constraint})
+}
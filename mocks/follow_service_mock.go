@@ -1,9 +1,12 @@
 package mocks
 
 import (
+	"context"
 	"errors"
 
+	"github.com/ChenSongJian/ginstagram/db"
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
 )
 
 type MockFollowService struct {
@@ -25,7 +28,7 @@ type FollowRecord struct {
 
 var followRecordId = 0
 
-func (followService *MockFollowService) GetById(followId int) (models.Follow, error) {
+func (followService *MockFollowService) GetById(ctx context.Context, followId int) (models.Follow, error) {
 	if follow, ok := followService.Follows[followId]; ok {
 		return models.Follow{
 			Id:         followId,
@@ -33,10 +36,10 @@ func (followService *MockFollowService) GetById(followId int) (models.Follow, er
 			UserId:     follow.FolloweeId,
 		}, nil
 	}
-	return models.Follow{}, errors.New("record not found")
+	return models.Follow{}, errNotFound
 }
 
-func (followService *MockFollowService) GetByFollowerId(followerId int) ([]models.Follow, error) {
+func (followService *MockFollowService) GetByFollowerId(ctx context.Context, followerId int) ([]models.Follow, error) {
 	var result = make([]models.Follow, 0)
 	for k, v := range followService.Follows {
 		if v.FollowerId == followerId {
@@ -50,7 +53,7 @@ func (followService *MockFollowService) GetByFollowerId(followerId int) ([]model
 	return result, nil
 }
 
-func (followService *MockFollowService) GetByFolloweeId(followeeId int) ([]models.Follow, error) {
+func (followService *MockFollowService) GetByFolloweeId(ctx context.Context, followeeId int) ([]models.Follow, error) {
 	var result = make([]models.Follow, 0)
 	for k, v := range followService.Follows {
 		if v.FolloweeId == followeeId {
@@ -64,21 +67,21 @@ func (followService *MockFollowService) GetByFolloweeId(followeeId int) ([]model
 	return result, nil
 }
 
-func (followService *MockFollowService) Create(followerId int, followeeId int) error {
-	if _, err := followService.UserService.GetById(followerId); err != nil {
-		if err.Error() == "record not found" {
-			return errors.New("ERROR: insert or update on table \"follows\" violates foreign key constraint \"fk_user\"")
+func (followService *MockFollowService) Create(ctx context.Context, followerId int, followeeId int) error {
+	if _, err := followService.UserService.GetById(ctx, followerId); err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return constraintError(db.ConstraintForeignKey, "follows", "fk_user")
 		}
 		return err
 	}
-	if _, err := followService.UserService.GetById(followeeId); err != nil {
-		if err.Error() == "record not found" {
-			return errors.New("ERROR: insert or update on table \"follows\" violates foreign key constraint \"fk_user\"")
+	if _, err := followService.UserService.GetById(ctx, followeeId); err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return constraintError(db.ConstraintForeignKey, "follows", "fk_user")
 		}
 		return err
 	}
 	if followerId == followeeId {
-		return errors.New("ERROR: new row for relation \"follows\" violates check constraint \"different_user_and_follower\"")
+		return constraintError(db.ConstraintCheck, "follows", "different_user_and_follower")
 	}
 
 	record := FollowRecord{
@@ -88,7 +91,7 @@ func (followService *MockFollowService) Create(followerId int, followeeId int) e
 
 	for _, v := range followService.Follows {
 		if v == record {
-			return errors.New("ERROR: duplicate key value violates unique constraint \"follows_pkey\"")
+			return constraintError(db.ConstraintUnique, "follows", "unique_user_follower_pair")
 		}
 	}
 	followRecordId++
@@ -96,12 +99,12 @@ func (followService *MockFollowService) Create(followerId int, followeeId int) e
 	return nil
 }
 
-func (followService *MockFollowService) Delete(followId int) error {
+func (followService *MockFollowService) Delete(ctx context.Context, followId int) error {
 	delete(followService.Follows, followId)
 	return nil
 }
 
-func (followService *MockFollowService) IsFollowing(followerId int, followeeId int) bool {
+func (followService *MockFollowService) IsFollowing(ctx context.Context, followerId int, followeeId int) bool {
 	for _, v := range followService.Follows {
 		if v.FollowerId == followerId && v.FolloweeId == followeeId {
 			return true
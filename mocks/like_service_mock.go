@@ -1,8 +1,9 @@
 package mocks
 
 import (
-	"errors"
+	"context"
 
+	"github.com/ChenSongJian/ginstagram/db"
 	"github.com/ChenSongJian/ginstagram/models"
 )
 
@@ -38,10 +39,10 @@ type CommentLikeRecord struct {
 var PostLikeRecordId = 0
 var CommentLikeRecordId = 0
 
-func (likeService *MockLikeService) ListPostLikesByPostId(postId int) ([]models.PostLike, error) {
+func (likeService *MockLikeService) ListPostLikesByPostId(ctx context.Context, postId int, viewerId int) ([]models.PostLike, error) {
 	var postLikes []models.PostLike
 	for k, like := range likeService.PostLikes {
-		if like.PostId == postId {
+		if like.PostId == postId && (like.UserId == viewerId || !likeService.isShadowBanned(like.UserId)) {
 			postLikes = append(postLikes, models.PostLike{
 				Id:     k,
 				UserId: like.UserId,
@@ -52,17 +53,18 @@ func (likeService *MockLikeService) ListPostLikesByPostId(postId int) ([]models.
 	return postLikes, nil
 }
 
-func (likeService *MockLikeService) GetByPostLikeId(postLikeId int) (models.PostLike, error) {
+func (likeService *MockLikeService) GetByPostLikeId(ctx context.Context, postLikeId int) (models.PostLike, error) {
 	if like, ok := likeService.PostLikes[postLikeId]; ok {
 		return models.PostLike{
+			Id:     postLikeId,
 			UserId: like.UserId,
 			PostId: like.PostId,
 		}, nil
 	}
-	return models.PostLike{}, errors.New("record not found")
+	return models.PostLike{}, errNotFound
 }
 
-func (likeService *MockLikeService) CreatePostLike(userId int, postId int) error {
+func (likeService *MockLikeService) CreatePostLike(ctx context.Context, postId int, userId int) error {
 	userFound := false
 	for _, user := range likeService.UserService.Users {
 		if user.Id == userId {
@@ -70,16 +72,16 @@ func (likeService *MockLikeService) CreatePostLike(userId int, postId int) error
 		}
 	}
 	if !userFound {
-		return errors.New("violates foreign key constraint \"post_likes_user_id_fkey\"")
+		return constraintError(db.ConstraintForeignKey, "post_likes", "post_likes_user_id_fkey")
 	}
 
 	if _, ok := likeService.PostService.Posts[postId]; !ok {
-		return errors.New("violates foreign key constraint \"post_likes_post_id_fkey\"")
+		return constraintError(db.ConstraintForeignKey, "post_likes", "post_likes_post_id_fkey")
 	}
 
 	for _, like := range likeService.PostLikes {
 		if like.UserId == userId && like.PostId == postId {
-			return errors.New("violates unique constraint \"unique_post_user_pair\"")
+			return constraintError(db.ConstraintUnique, "post_likes", "unique_post_user_pair")
 		}
 	}
 
@@ -91,22 +93,23 @@ func (likeService *MockLikeService) CreatePostLike(userId int, postId int) error
 	return nil
 }
 
-func (likeService *MockLikeService) DeletePostLikeById(postLikeId int) error {
+func (likeService *MockLikeService) DeletePostLikeById(ctx context.Context, postLikeId int) error {
 	delete(likeService.PostLikes, postLikeId)
 	return nil
 }
 
-func (likeService *MockLikeService) GetByCommentLikeId(commentLikeId int) (models.CommentLike, error) {
+func (likeService *MockLikeService) GetByCommentLikeId(ctx context.Context, commentLikeId int) (models.CommentLike, error) {
 	if like, ok := likeService.CommentLikes[commentLikeId]; ok {
 		return models.CommentLike{
+			Id:        commentLikeId,
 			UserId:    like.UserId,
 			CommentId: like.CommentId,
 		}, nil
 	}
-	return models.CommentLike{}, errors.New("record not found")
+	return models.CommentLike{}, errNotFound
 }
 
-func (likeService *MockLikeService) CreateCommentLike(commentId int, userId int) error {
+func (likeService *MockLikeService) CreateCommentLike(ctx context.Context, commentId int, userId int) error {
 	userFound := false
 	for _, user := range likeService.UserService.Users {
 		if user.Id == userId {
@@ -114,27 +117,36 @@ func (likeService *MockLikeService) CreateCommentLike(commentId int, userId int)
 		}
 	}
 	if !userFound {
-		return errors.New("violates foreign key constraint \"comment_likes_user_id_fkey\"")
+		return constraintError(db.ConstraintForeignKey, "comment_likes", "comment_likes_user_id_fkey")
 	}
 
 	if _, ok := likeService.CommentService.Comments[commentId]; !ok {
-		return errors.New("violates foreign key constraint \"comment_likes_comment_id_fkey\"")
+		return constraintError(db.ConstraintForeignKey, "comment_likes", "comment_likes_comment_id_fkey")
 	}
 
 	for _, like := range likeService.CommentLikes {
 		if like.UserId == userId && like.CommentId == commentId {
-			return errors.New("violates unique constraint \"unique_comment_user_pair\"")
+			return constraintError(db.ConstraintUnique, "comment_likes", "unique_comment_user_pair")
 		}
 	}
-	commentRecordId++
-	likeService.CommentLikes[commentRecordId] = CommentLikeRecord{
+	CommentLikeRecordId++
+	likeService.CommentLikes[CommentLikeRecordId] = CommentLikeRecord{
 		UserId:    userId,
 		CommentId: commentId,
 	}
 	return nil
 }
 
-func (likeService *MockLikeService) DeleteCommentLikeById(commentLikeId int) error {
+func (likeService *MockLikeService) DeleteCommentLikeById(ctx context.Context, commentLikeId int) error {
 	delete(likeService.CommentLikes, commentLikeId)
 	return nil
 }
+
+func (likeService *MockLikeService) isShadowBanned(userId int) bool {
+	for _, user := range likeService.UserService.Users {
+		if user.Id == userId {
+			return user.Status == models.UserStatusShadowBanned
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+package mocks
+
+type MockMediaQueue struct {
+	Enqueued []int
+}
+
+func NewMockMediaQueue() *MockMediaQueue {
+	return &MockMediaQueue{}
+}
+
+func (mediaQueue *MockMediaQueue) Enqueue(mediaId int) {
+	mediaQueue.Enqueued = append(mediaQueue.Enqueued, mediaId)
+}
@@ -1,46 +1,169 @@
 package mocks
 
-import "github.com/ChenSongJian/ginstagram/models"
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/imaging"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/utils"
+)
 
 type MockMediaService struct {
-	Media map[int]MediaRecord
+	Media       map[int]MediaRecord
+	UserService *MockUserService
 }
 
 func NewMockMediaService() *MockMediaService {
 	return &MockMediaService{
-		Media: map[int]MediaRecord{},
+		Media:       map[int]MediaRecord{},
+		UserService: NewMockUserService(),
 	}
 }
 
 type MediaRecord struct {
-	Url    string
-	PostId int
+	Url         string
+	Filename    string
+	PostId      int
+	UserId      int
+	ContentType string
+	Size        int64
+	Width       int
+	Height      int
+	DurationMs  int64
+	Sha256      string
+	Status      string
+	CreatedAt   time.Time
 }
 
 var MediaRecordId = 0
 
-func (mediaService *MockMediaService) Create(media []models.Media) error {
-	for _, m := range media {
-		MediaRecordId++
-		mediaService.Media[MediaRecordId] = MediaRecord{
-			Url:    m.Url,
-			PostId: m.PostId,
-		}
+func (m MediaRecord) toModel(id int) models.Media {
+	return models.Media{
+		Id:          id,
+		Url:         m.Url,
+		Filename:    m.Filename,
+		PostId:      m.PostId,
+		UserId:      m.UserId,
+		ContentType: m.ContentType,
+		Size:        m.Size,
+		Width:       m.Width,
+		Height:      m.Height,
+		DurationMs:  m.DurationMs,
+		Sha256:      m.Sha256,
+		Status:      m.Status,
+		CreatedAt:   m.CreatedAt,
 	}
-	return nil
 }
 
-func (mediaService *MockMediaService) GetByPostId(postId int) ([]models.Media, error) {
+func (mediaService *MockMediaService) Create(ctx context.Context, media models.Media) (int, error) {
+	MediaRecordId++
+	mediaService.Media[MediaRecordId] = MediaRecord{
+		Url:         media.Url,
+		Filename:    media.Filename,
+		PostId:      media.PostId,
+		UserId:      media.UserId,
+		ContentType: media.ContentType,
+		Size:        media.Size,
+		Width:       media.Width,
+		Height:      media.Height,
+		DurationMs:  media.DurationMs,
+		Sha256:      media.Sha256,
+		Status:      media.Status,
+		CreatedAt:   time.Now(),
+	}
+	return MediaRecordId, nil
+}
+
+func (mediaService *MockMediaService) GetByPostId(ctx context.Context, postId int) ([]models.Media, error) {
 	media := []models.Media{}
-	for _, m := range mediaService.Media {
+	for k, m := range mediaService.Media {
 		if m.PostId == postId {
-			media = append(media, models.Media{Url: m.Url})
+			media = append(media, m.toModel(k))
+		}
+	}
+	sort.Slice(media, func(i, j int) bool { return media[i].Id < media[j].Id })
+	return media, nil
+}
+
+func (mediaService *MockMediaService) GetById(ctx context.Context, id int) (models.Media, error) {
+	m, ok := mediaService.Media[id]
+	if !ok {
+		return models.Media{}, errNotFound
+	}
+	return m.toModel(id), nil
+}
+
+func (mediaService *MockMediaService) ListByKey(ctx context.Context, key string) ([]models.Media, error) {
+	media := []models.Media{}
+	for k, m := range mediaService.Media {
+		if m.belongsTo(key) {
+			media = append(media, m.toModel(k))
+		}
+	}
+	sort.Slice(media, func(i, j int) bool { return media[i].Id < media[j].Id })
+	return media, nil
+}
+
+func (mediaService *MockMediaService) ListByStatus(ctx context.Context, status string) ([]models.Media, error) {
+	media := []models.Media{}
+	for k, m := range mediaService.Media {
+		if m.Status == status {
+			media = append(media, m.toModel(k))
 		}
 	}
+	sort.Slice(media, func(i, j int) bool { return media[i].Id < media[j].Id })
 	return media, nil
 }
 
-func (mediaService *MockMediaService) DeleteByPostId(postId int) error {
+// belongsTo reports whether the file stored under key is this media or was
+// derived from it.
+func (m MediaRecord) belongsTo(key string) bool {
+	if sha256, ok := storage.BlobSha256(key); ok {
+		blobSha256, _ := storage.BlobSha256(m.Url)
+		return m.Sha256 == sha256 || blobSha256 == sha256
+	}
+	return m.Url == imaging.OriginalKey(key)
+}
+
+func (mediaService *MockMediaService) GetByIds(ctx context.Context, ids []int) ([]models.Media, error) {
+	media := []models.Media{}
+	for _, id := range ids {
+		if m, ok := mediaService.Media[id]; ok {
+			media = append(media, m.toModel(id))
+		}
+	}
+	return media, nil
+}
+
+func (mediaService *MockMediaService) checkAttachable(userId int, mediaIds []int) error {
+	for _, id := range mediaIds {
+		m, ok := mediaService.Media[id]
+		if !ok || m.UserId != userId || m.PostId != 0 {
+			return &services.Error{Kind: services.ErrConflict, Err: errors.New("media is not available to attach")}
+		}
+	}
+	return nil
+}
+
+func (mediaService *MockMediaService) AttachToPost(ctx context.Context, postId int, userId int, mediaIds []int) error {
+	if err := mediaService.checkAttachable(userId, mediaIds); err != nil {
+		return err
+	}
+	for _, id := range mediaIds {
+		m := mediaService.Media[id]
+		m.PostId = postId
+		mediaService.Media[id] = m
+	}
+	return nil
+}
+
+func (mediaService *MockMediaService) DeleteByPostId(ctx context.Context, postId int) error {
 	var mediaId int
 	for k, v := range mediaService.Media {
 		if v.PostId == postId {
@@ -51,3 +174,98 @@ func (mediaService *MockMediaService) DeleteByPostId(postId int) error {
 	delete(mediaService.Media, mediaId)
 	return nil
 }
+
+func (mediaService *MockMediaService) ListUnattachedBefore(ctx context.Context, cutoff time.Time) ([]models.Media, error) {
+	media := []models.Media{}
+	for k, m := range mediaService.Media {
+		if m.PostId != 0 || !m.CreatedAt.Before(cutoff) || mediaService.isProfileImage(m.Url) {
+			continue
+		}
+		media = append(media, m.toModel(k))
+	}
+	sort.Slice(media, func(i, j int) bool { return media[i].Id < media[j].Id })
+	return media, nil
+}
+
+func (mediaService *MockMediaService) DeleteById(ctx context.Context, id int) error {
+	delete(mediaService.Media, id)
+	return nil
+}
+
+func (mediaService *MockMediaService) ReferencedKeys(ctx context.Context, keys []string, ignoredMediaIds []int) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for _, key := range keys {
+		if mediaService.isProfileImage(key) {
+			referenced[key] = true
+		}
+		for k, m := range mediaService.Media {
+			if m.belongsTo(key) && !utils.IsInIntSlice(k, ignoredMediaIds) {
+				referenced[key] = true
+			}
+		}
+	}
+	return referenced, nil
+}
+
+func (mediaService *MockMediaService) RemoveBlob(ctx context.Context, key string, ignoredMediaIds []int, remove func() error) (bool, error) {
+	if _, ok := storage.BlobSha256(key); !ok {
+		return false, &services.Error{Kind: services.ErrValidation, Err: errors.New(key + " is not a blob")}
+	}
+	referenced, _ := mediaService.ReferencedKeys(ctx, []string{key}, ignoredMediaIds)
+	if referenced[key] {
+		return false, nil
+	}
+	if err := remove(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (mediaService *MockMediaService) UpdateProcessed(ctx context.Context, sha256 string, status string, width int, height int, durationMs int64) error {
+	for k, m := range mediaService.Media {
+		if m.Sha256 == sha256 && m.Status == models.MediaStatusProcessing {
+			m.Status, m.Width, m.Height, m.DurationMs = status, width, height, durationMs
+			mediaService.Media[k] = m
+		}
+	}
+	return nil
+}
+
+func (mediaService *MockMediaService) UsageByUserId(ctx context.Context, userId int, since time.Time) (models.MediaUsage, error) {
+	var usage models.MediaUsage
+	blobSizes := make(map[string]int64)
+	for k, m := range mediaService.Media {
+		if m.UserId != userId {
+			continue
+		}
+		blob := m.Sha256
+		if blob == "" {
+			blob = strconv.Itoa(k)
+		}
+		blobSizes[blob] = max(blobSizes[blob], m.Size)
+		usage.MediaCount++
+		if !m.CreatedAt.Before(since) {
+			usage.RecentUploads++
+			if usage.OldestRecentUpload.IsZero() || m.CreatedAt.Before(usage.OldestRecentUpload) {
+				usage.OldestRecentUpload = m.CreatedAt
+			}
+		}
+	}
+	for _, size := range blobSizes {
+		usage.StoredBytes += size
+	}
+	return usage, nil
+}
+
+// isProfileImage reports whether the file stored under key is the profile
+// image of an account or was derived from one.
+func (mediaService *MockMediaService) isProfileImage(key string) bool {
+	for _, users := range []map[string]models.User{mediaService.UserService.Users, mediaService.UserService.DeletedUsers} {
+		for _, user := range users {
+			if user.ProfileImageUrl != "" && (MediaRecord{Url: user.ProfileImageUrl}).belongsTo(key) {
+				return true
+			}
+		}
+	}
+	return false
+}
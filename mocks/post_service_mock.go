@@ -1,16 +1,21 @@
 package mocks
 
 import (
-	"errors"
+	"context"
 	"math"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ChenSongJian/ginstagram/models"
 	"github.com/ChenSongJian/ginstagram/utils"
+	"gorm.io/gorm"
 )
 
 type MockPostService struct {
 	Posts         map[int]PostRecord
+	DeletedPosts  map[int]PostRecord
 	UserService   *MockUserService
 	FollowService *MockFollowService
 	MediaService  *MockMediaService
@@ -19,6 +24,7 @@ type MockPostService struct {
 func NewMockPostService() *MockPostService {
 	return &MockPostService{
 		Posts:         map[int]PostRecord{},
+		DeletedPosts:  map[int]PostRecord{},
 		UserService:   NewMockUserService(),
 		FollowService: NewMockFollowService(),
 		MediaService:  NewMockMediaService(),
@@ -26,14 +32,16 @@ func NewMockPostService() *MockPostService {
 }
 
 type PostRecord struct {
-	Title   string
-	Content string
-	UserId  int
+	Title      string
+	Content    string
+	UserId     int
+	IsArchived bool
+	DeletedAt  time.Time
 }
 
 var PostRecordId = 0
 
-func (postService *MockPostService) List(pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+func (postService *MockPostService) List(ctx context.Context, pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
 	pageNumInt, err := strconv.Atoi(pageNum)
 	if err != nil {
 		pageNumInt = 1
@@ -45,7 +53,7 @@ func (postService *MockPostService) List(pageNum string, pageSize string, keywor
 
 	filterUserIds := []int{}
 	for _, user := range postService.UserService.Users {
-		if !user.IsPrivate {
+		if !user.IsPrivate && user.Status != models.UserStatusShadowBanned {
 			filterUserIds = append(filterUserIds, user.Id)
 		}
 	}
@@ -54,7 +62,7 @@ func (postService *MockPostService) List(pageNum string, pageSize string, keywor
 	var postIds []int
 	if keyword != "" {
 		for id, post := range postService.Posts {
-			if (post.Title == keyword || post.Content == keyword) && utils.IsInIntSlice(post.UserId, filterUserIds) {
+			if (strings.Contains(post.Title, keyword) || strings.Contains(post.Content, keyword)) && utils.IsInIntSlice(post.UserId, filterUserIds) && !post.IsArchived {
 				posts = append(posts, models.Post{
 					Id:      id,
 					Title:   post.Title,
@@ -66,7 +74,7 @@ func (postService *MockPostService) List(pageNum string, pageSize string, keywor
 		}
 	} else {
 		for id, post := range postService.Posts {
-			if utils.IsInIntSlice(post.UserId, filterUserIds) {
+			if utils.IsInIntSlice(post.UserId, filterUserIds) && !post.IsArchived {
 				posts = append(posts, models.Post{
 					Id:      id,
 					Title:   post.Title,
@@ -77,12 +85,17 @@ func (postService *MockPostService) List(pageNum string, pageSize string, keywor
 			}
 		}
 	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Id > posts[j].Id
+	})
 	mediaMap := make(map[int][]models.Media)
 	if len(postIds) > 0 {
 		for _, m := range postService.MediaService.Media {
 			if utils.IsInIntSlice(m.PostId, postIds) {
 				mediaMap[m.PostId] = append(mediaMap[m.PostId], models.Media{
-					Url: m.Url,
+					Url:         m.Url,
+					ContentType: m.ContentType,
+					Status:      m.Status,
 				})
 			}
 		}
@@ -119,7 +132,7 @@ func (postService *MockPostService) List(pageNum string, pageSize string, keywor
 	return pagedPost, mediaMap, pageResponse, nil
 }
 
-func (postService *MockPostService) ListByUserId(userId int, pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+func (postService *MockPostService) ListByUserId(ctx context.Context, userId int, pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
 	pageNumInt, err := strconv.Atoi(pageNum)
 	if err != nil {
 		pageNumInt = 1
@@ -129,23 +142,13 @@ func (postService *MockPostService) ListByUserId(userId int, pageNum string, pag
 		pageSizeInt = 10
 	}
 
-	filterUserIds := []int{userId}
-	for _, user := range postService.UserService.Users {
-		if user.Id != userId && !user.IsPrivate {
-			filterUserIds = append(filterUserIds, user.Id)
-		}
-	}
-	for _, follow := range postService.FollowService.Follows {
-		if follow.FollowerId == userId {
-			filterUserIds = append(filterUserIds, follow.FolloweeId)
-		}
-	}
+	filterUserIds := postService.visibleUserIds(userId)
 
 	var posts []models.Post
 	var postIds []int
 	if keyword != "" {
 		for id, post := range postService.Posts {
-			if (post.Title == keyword || post.Content == keyword) && utils.IsInIntSlice(post.UserId, filterUserIds) {
+			if (strings.Contains(post.Title, keyword) || strings.Contains(post.Content, keyword)) && utils.IsInIntSlice(post.UserId, filterUserIds) && !post.IsArchived {
 				posts = append(posts, models.Post{
 					Id:      id,
 					Title:   post.Title,
@@ -157,7 +160,7 @@ func (postService *MockPostService) ListByUserId(userId int, pageNum string, pag
 		}
 	} else {
 		for id, post := range postService.Posts {
-			if utils.IsInIntSlice(post.UserId, filterUserIds) {
+			if utils.IsInIntSlice(post.UserId, filterUserIds) && !post.IsArchived {
 				posts = append(posts, models.Post{
 					Id:      id,
 					Title:   post.Title,
@@ -168,12 +171,17 @@ func (postService *MockPostService) ListByUserId(userId int, pageNum string, pag
 			}
 		}
 	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Id > posts[j].Id
+	})
 	mediaMap := make(map[int][]models.Media)
 	if len(postIds) > 0 {
 		for _, m := range postService.MediaService.Media {
 			if utils.IsInIntSlice(m.PostId, postIds) {
 				mediaMap[m.PostId] = append(mediaMap[m.PostId], models.Media{
-					Url: m.Url,
+					Url:         m.Url,
+					ContentType: m.ContentType,
+					Status:      m.Status,
 				})
 			}
 		}
@@ -210,21 +218,25 @@ func (postService *MockPostService) ListByUserId(userId int, pageNum string, pag
 	return pagedPost, mediaMap, pageResponse, nil
 }
 
-func (postService *MockPostService) GetById(postId int) (models.Post, error) {
+func (postService *MockPostService) GetById(ctx context.Context, postId int) (models.Post, error) {
 	postRecord, ok := postService.Posts[postId]
 	if !ok {
-		return models.Post{}, errors.New("record not found")
+		return models.Post{}, errNotFound
 	}
 	post := models.Post{
-		Id:      postId,
-		Title:   postRecord.Title,
-		Content: postRecord.Content,
-		UserId:  postRecord.UserId,
+		Id:         postId,
+		Title:      postRecord.Title,
+		Content:    postRecord.Content,
+		UserId:     postRecord.UserId,
+		IsArchived: postRecord.IsArchived,
 	}
 	return post, nil
 }
 
-func (postService *MockPostService) Create(post models.Post) (int, error) {
+func (postService *MockPostService) Create(ctx context.Context, post models.Post, mediaIds []int) (int, error) {
+	if err := postService.MediaService.checkAttachable(post.UserId, mediaIds); err != nil {
+		return 0, err
+	}
 	PostRecordId++
 	postRecord := PostRecord{
 		Title:   post.Title,
@@ -232,11 +244,214 @@ func (postService *MockPostService) Create(post models.Post) (int, error) {
 		UserId:  post.UserId,
 	}
 	postService.Posts[PostRecordId] = postRecord
-	return PostRecordId, nil
+	return PostRecordId, postService.MediaService.AttachToPost(ctx, PostRecordId, post.UserId, mediaIds)
+}
+
+func (postService *MockPostService) DeleteById(ctx context.Context, postId int) error {
+	if post, ok := postService.Posts[postId]; ok {
+		post.DeletedAt = time.Now()
+		postService.DeletedPosts[postId] = post
+		delete(postService.Posts, postId)
+	}
+	return nil
+}
+
+func (postService *MockPostService) ListArchivedByUserId(ctx context.Context, userId int, pageNum string, pageSize string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+	pageNumInt, err := strconv.Atoi(pageNum)
+	if err != nil {
+		pageNumInt = 1
+	}
+	pageSizeInt, err := strconv.Atoi(pageSize)
+	if err != nil {
+		pageSizeInt = 10
+	}
+
+	var posts []models.Post
+	var postIds []int
+	for id, post := range postService.Posts {
+		if post.UserId == userId && post.IsArchived {
+			posts = append(posts, models.Post{
+				Id:         id,
+				Title:      post.Title,
+				Content:    post.Content,
+				UserId:     post.UserId,
+				IsArchived: post.IsArchived,
+			})
+			postIds = append(postIds, id)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Id > posts[j].Id
+	})
+	mediaMap := make(map[int][]models.Media)
+	for _, m := range postService.MediaService.Media {
+		if utils.IsInIntSlice(m.PostId, postIds) {
+			mediaMap[m.PostId] = append(mediaMap[m.PostId], models.Media{
+				Url:         m.Url,
+				ContentType: m.ContentType,
+				Status:      m.Status,
+			})
+		}
+	}
+
+	totalCount := len(posts)
+	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
+
+	offset := (pageNumInt - 1) * pageSizeInt
+	if offset < 0 {
+		offset = 0
+	}
+
+	if offset >= totalCount {
+		return []models.Post{}, map[int][]models.Media{}, utils.PageResponse{
+			TotalPages:   totalPages,
+			TotalRecords: totalCount,
+		}, nil
+	}
+
+	endIndex := offset + pageSizeInt
+	if endIndex > totalCount {
+		endIndex = totalCount
+	}
+
+	pageResponse := utils.PageResponse{
+		PageNum:      pageNumInt,
+		PageSize:     pageSizeInt,
+		TotalPages:   totalPages,
+		TotalRecords: totalCount,
+	}
+	return posts[offset:endIndex], mediaMap, pageResponse, nil
+}
+
+func (postService *MockPostService) UpdateArchived(ctx context.Context, postId int, archived bool) error {
+	post, ok := postService.Posts[postId]
+	if !ok {
+		return errNotFound
+	}
+	post.IsArchived = archived
+	postService.Posts[postId] = post
+	return nil
+}
+
+func (postService *MockPostService) ListDeletedByUserId(ctx context.Context, userId int, pageNum string, pageSize string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+	pageNumInt, err := strconv.Atoi(pageNum)
+	if err != nil {
+		pageNumInt = 1
+	}
+	pageSizeInt, err := strconv.Atoi(pageSize)
+	if err != nil {
+		pageSizeInt = 10
+	}
+
+	var posts []models.Post
+	var postIds []int
+	for id, post := range postService.DeletedPosts {
+		if post.UserId == userId {
+			posts = append(posts, models.Post{
+				Id:        id,
+				Title:     post.Title,
+				Content:   post.Content,
+				UserId:    post.UserId,
+				DeletedAt: gorm.DeletedAt{Time: post.DeletedAt, Valid: true},
+			})
+			postIds = append(postIds, id)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].DeletedAt.Time.After(posts[j].DeletedAt.Time)
+	})
+	mediaMap := make(map[int][]models.Media)
+	for _, m := range postService.MediaService.Media {
+		if utils.IsInIntSlice(m.PostId, postIds) {
+			mediaMap[m.PostId] = append(mediaMap[m.PostId], models.Media{
+				Url:         m.Url,
+				ContentType: m.ContentType,
+				Status:      m.Status,
+			})
+		}
+	}
+
+	totalCount := len(posts)
+	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
+
+	offset := (pageNumInt - 1) * pageSizeInt
+	if offset < 0 {
+		offset = 0
+	}
+
+	if offset >= totalCount {
+		return []models.Post{}, map[int][]models.Media{}, utils.PageResponse{
+			TotalPages:   totalPages,
+			TotalRecords: totalCount,
+		}, nil
+	}
+
+	endIndex := offset + pageSizeInt
+	if endIndex > totalCount {
+		endIndex = totalCount
+	}
+
+	pageResponse := utils.PageResponse{
+		PageNum:      pageNumInt,
+		PageSize:     pageSizeInt,
+		TotalPages:   totalPages,
+		TotalRecords: totalCount,
+	}
+	return posts[offset:endIndex], mediaMap, pageResponse, nil
+}
+
+func (postService *MockPostService) GetDeletedById(ctx context.Context, postId int) (models.Post, error) {
+	postRecord, ok := postService.DeletedPosts[postId]
+	if !ok {
+		return models.Post{}, errNotFound
+	}
+	return models.Post{
+		Id:        postId,
+		Title:     postRecord.Title,
+		Content:   postRecord.Content,
+		UserId:    postRecord.UserId,
+		DeletedAt: gorm.DeletedAt{Time: postRecord.DeletedAt, Valid: true},
+	}, nil
 }
 
-func (postService *MockPostService) DeleteById(postId int) error {
-	delete(postService.Posts, postId)
-	postService.MediaService.DeleteByPostId(postId)
+func (postService *MockPostService) RestoreById(ctx context.Context, postId int) error {
+	if post, ok := postService.DeletedPosts[postId]; ok {
+		post.DeletedAt = time.Time{}
+		postService.Posts[postId] = post
+		delete(postService.DeletedPosts, postId)
+	}
 	return nil
 }
+
+func (postService *MockPostService) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) ([]models.Media, error) {
+	var media []models.Media
+	for postId, post := range postService.DeletedPosts {
+		if post.DeletedAt.Before(cutoff) {
+			purged, _ := postService.MediaService.GetByPostId(ctx, postId)
+			media = append(media, purged...)
+			postService.MediaService.DeleteByPostId(ctx, postId)
+			delete(postService.DeletedPosts, postId)
+		}
+	}
+	return media, nil
+}
+
+func (postService *MockPostService) visibleUserIds(userId int) []int {
+	shadowBannedUserIds := []int{}
+	filterUserIds := []int{userId}
+	for _, user := range postService.UserService.Users {
+		if user.Status == models.UserStatusShadowBanned {
+			shadowBannedUserIds = append(shadowBannedUserIds, user.Id)
+			continue
+		}
+		if user.Id != userId && !user.IsPrivate {
+			filterUserIds = append(filterUserIds, user.Id)
+		}
+	}
+	for _, follow := range postService.FollowService.Follows {
+		if follow.FollowerId == userId && !utils.IsInIntSlice(follow.FolloweeId, shadowBannedUserIds) {
+			filterUserIds = append(filterUserIds, follow.FolloweeId)
+		}
+	}
+	return filterUserIds
+}
@@ -0,0 +1,191 @@
+package mocks
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/db"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/utils"
+)
+
+type MockReportService struct {
+	Reports        map[int]models.Report
+	Actions        []models.ModerationAction
+	UserService    *MockUserService
+	PostService    *MockPostService
+	CommentService *MockCommentService
+}
+
+func NewMockReportService() *MockReportService {
+	return &MockReportService{
+		Reports:        make(map[int]models.Report),
+		Actions:        []models.ModerationAction{},
+		UserService:    NewMockUserService(),
+		PostService:    NewMockPostService(),
+		CommentService: NewMockCommentService(),
+	}
+}
+
+var ReportRecordId = 0
+
+func (reportService *MockReportService) List(ctx context.Context, status string, pageNum string, pageSize string) ([]models.Report, utils.PageResponse, error) {
+	pageNumInt, err := strconv.Atoi(pageNum)
+	if err != nil {
+		pageNumInt = 1
+	}
+	pageSizeInt, err := strconv.Atoi(pageSize)
+	if err != nil {
+		pageSizeInt = 10
+	}
+
+	var reports []models.Report
+	for _, report := range reportService.Reports {
+		if status == "" || report.Status == status {
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Id < reports[j].Id
+	})
+
+	totalCount := len(reports)
+	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
+
+	offset := (pageNumInt - 1) * pageSizeInt
+	if offset < 0 {
+		offset = 0
+	}
+
+	if offset >= totalCount {
+		return []models.Report{}, utils.PageResponse{
+			TotalPages:   totalPages,
+			TotalRecords: totalCount,
+		}, nil
+	}
+
+	endIndex := offset + pageSizeInt
+	if endIndex > totalCount {
+		endIndex = totalCount
+	}
+
+	pageResponse := utils.PageResponse{
+		PageNum:      pageNumInt,
+		PageSize:     pageSizeInt,
+		TotalPages:   totalPages,
+		TotalRecords: totalCount,
+	}
+	return reports[offset:endIndex], pageResponse, nil
+}
+
+func (reportService *MockReportService) GetById(ctx context.Context, reportId int) (models.Report, error) {
+	if report, ok := reportService.Reports[reportId]; ok {
+		return report, nil
+	}
+	return models.Report{}, errNotFound
+}
+
+func (reportService *MockReportService) Create(ctx context.Context, report models.Report) error {
+	for _, v := range reportService.Reports {
+		if v.ReporterId == report.ReporterId && v.TargetType == report.TargetType && v.TargetId == report.TargetId {
+			return constraintError(db.ConstraintUnique, "reports", "unique_reporter_target")
+		}
+	}
+	ReportRecordId++
+	report.Id = ReportRecordId
+	report.Status = models.ReportStatusOpen
+	reportService.Reports[ReportRecordId] = report
+	reportService.Actions = append(reportService.Actions, models.ModerationAction{
+		Id:          len(reportService.Actions) + 1,
+		ReportId:    report.Id,
+		ModeratorId: report.ReporterId,
+		TargetType:  report.TargetType,
+		TargetId:    report.TargetId,
+		Action:      models.ModerationActionReport,
+		Note:        report.Reason,
+	})
+	return nil
+}
+
+func (reportService *MockReportService) Resolve(ctx context.Context, report models.Report, moderatorId int, action string, note string, suspendedUntil *time.Time) error {
+	switch action {
+	case models.ModerationActionRemoveContent:
+		switch report.TargetType {
+		case models.ReportTargetPost:
+			delete(reportService.PostService.Posts, report.TargetId)
+			delete(reportService.PostService.DeletedPosts, report.TargetId)
+			reportService.PostService.MediaService.DeleteByPostId(ctx, report.TargetId)
+		case models.ReportTargetComment:
+			reportService.CommentService.DeleteById(ctx, report.TargetId)
+		default:
+			return &services.Error{Kind: services.ErrValidation, Err: errors.New("can not remove a user, suspend instead")}
+		}
+	case models.ModerationActionSuspendUser:
+		ownerId := report.TargetId
+		switch report.TargetType {
+		case models.ReportTargetPost:
+			post, ok := reportService.PostService.Posts[report.TargetId]
+			if !ok {
+				return errNotFound
+			}
+			ownerId = post.UserId
+		case models.ReportTargetComment:
+			comment, ok := reportService.CommentService.Comments[report.TargetId]
+			if !ok {
+				return errNotFound
+			}
+			ownerId = comment.UserId
+		}
+		if err := reportService.UserService.UpdateStatus(ctx, ownerId, models.UserStatusSuspended, note, suspendedUntil); err != nil {
+			return err
+		}
+	}
+	for k, v := range reportService.Reports {
+		if action == models.ModerationActionDismiss {
+			if k == report.Id {
+				v.Status = models.ReportStatusDismissed
+				reportService.Reports[k] = v
+			}
+			continue
+		}
+		if v.TargetType == report.TargetType && v.TargetId == report.TargetId && v.Status == models.ReportStatusOpen {
+			v.Status = models.ReportStatusActioned
+			reportService.Reports[k] = v
+		}
+	}
+	reportService.Actions = append(reportService.Actions, models.ModerationAction{
+		Id:          len(reportService.Actions) + 1,
+		ReportId:    report.Id,
+		ModeratorId: moderatorId,
+		TargetType:  report.TargetType,
+		TargetId:    report.TargetId,
+		Action:      action,
+		Note:        note,
+	})
+	return nil
+}
+
+func (reportService *MockReportService) ListActions(ctx context.Context, targetType string, targetId int) ([]models.ModerationAction, error) {
+	var actions = make([]models.ModerationAction, 0)
+	for _, action := range reportService.Actions {
+		if targetType != "" && action.TargetType != targetType {
+			continue
+		}
+		if targetId != 0 && action.TargetId != targetId {
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+func (reportService *MockReportService) RecordAction(ctx context.Context, action models.ModerationAction) error {
+	action.Id = len(reportService.Actions) + 1
+	reportService.Actions = append(reportService.Actions, action)
+	return nil
+}
@@ -0,0 +1,87 @@
+package mocks
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/db"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+)
+
+type MockUploadSessionService struct {
+	Sessions map[string]models.UploadSession
+}
+
+func NewMockUploadSessionService() *MockUploadSessionService {
+	return &MockUploadSessionService{
+		Sessions: map[string]models.UploadSession{},
+	}
+}
+
+func (uploadSessionService *MockUploadSessionService) Create(ctx context.Context, session models.UploadSession) error {
+	if _, ok := uploadSessionService.Sessions[session.Id]; ok {
+		return constraintError(db.ConstraintUnique, "upload_sessions", "upload_sessions_pkey")
+	}
+	session.CreatedAt = time.Now()
+	if session.Status == "" {
+		session.Status = models.UploadStatusUploading
+	}
+	uploadSessionService.Sessions[session.Id] = session
+	return nil
+}
+
+func (uploadSessionService *MockUploadSessionService) GetById(ctx context.Context, id string) (models.UploadSession, error) {
+	session, ok := uploadSessionService.Sessions[id]
+	if !ok {
+		return models.UploadSession{}, errNotFound
+	}
+	return session, nil
+}
+
+func (uploadSessionService *MockUploadSessionService) UpdateOffset(ctx context.Context, id string, from int64, to int64) error {
+	session, ok := uploadSessionService.Sessions[id]
+	if !ok || session.Offset != from {
+		return errNotFound
+	}
+	session.Offset = to
+	uploadSessionService.Sessions[id] = session
+	return nil
+}
+
+func (uploadSessionService *MockUploadSessionService) UpdateStatus(ctx context.Context, id string, from string, to string) error {
+	session, ok := uploadSessionService.Sessions[id]
+	if !ok || session.Status != from {
+		return &services.Error{Kind: services.ErrConflict, Err: errors.New("upload is not " + from)}
+	}
+	session.Status = to
+	uploadSessionService.Sessions[id] = session
+	return nil
+}
+
+func (uploadSessionService *MockUploadSessionService) DeleteById(ctx context.Context, id string) error {
+	delete(uploadSessionService.Sessions, id)
+	return nil
+}
+
+func (uploadSessionService *MockUploadSessionService) SumPendingByUserId(ctx context.Context, userId int, now time.Time) (int64, int64, error) {
+	var count, total int64
+	for _, session := range uploadSessionService.Sessions {
+		if session.UserId == userId && session.ExpiresAt.After(now) {
+			count++
+			total += session.Size
+		}
+	}
+	return count, total, nil
+}
+
+func (uploadSessionService *MockUploadSessionService) ListExpiredBefore(ctx context.Context, cutoff time.Time) ([]models.UploadSession, error) {
+	sessions := []models.UploadSession{}
+	for _, session := range uploadSessionService.Sessions {
+		if !session.ExpiresAt.After(cutoff) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
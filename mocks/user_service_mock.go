@@ -1,34 +1,60 @@
 package mocks
 
 import (
-	"errors"
+	"context"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ChenSongJian/ginstagram/db"
 	"github.com/ChenSongJian/ginstagram/models"
 	"github.com/ChenSongJian/ginstagram/utils"
+	"gorm.io/gorm"
 )
 
 type MockUserService struct {
-	Users map[string]models.User
+	Users        map[string]models.User
+	DeletedUsers map[string]models.User
+	// MediaService, when set, holds the media purged along with accounts.
+	MediaService *MockMediaService
 }
 
 func NewMockUserService() *MockUserService {
 	return &MockUserService{
-		Users: make(map[string]models.User),
+		Users:        make(map[string]models.User),
+		DeletedUsers: make(map[string]models.User),
 	}
 }
 
-func (userService *MockUserService) Create(user models.User) error {
+func (userService *MockUserService) Create(ctx context.Context, user models.User) error {
 	if _, ok := userService.Users[user.Email]; ok {
-		return errors.New("ERROR: duplicate key value violates unique constraint")
+		return constraintError(db.ConstraintUnique, "users", "users_email_key")
 	}
+	if user.Id == 0 {
+		user.Id = userService.nextId()
+	}
+	user.Status = models.UserStatusActive
 	userService.Users[user.Email] = user
 	return nil
 }
 
-func (userService *MockUserService) List(pageNum string, pageSize string, keyword string) ([]models.User, utils.PageResponse, error) {
+// nextId numbers created users after those already there, whether added
+// through Create or directly.
+func (userService *MockUserService) nextId() int {
+	id := 0
+	for _, users := range []map[string]models.User{userService.Users, userService.DeletedUsers} {
+		for _, user := range users {
+			if user.Id > id {
+				id = user.Id
+			}
+		}
+	}
+	return id + 1
+}
+
+func (userService *MockUserService) List(ctx context.Context, pageNum string, pageSize string, keyword string) ([]models.User, utils.PageResponse, error) {
 	pageNumInt, err := strconv.Atoi(pageNum)
 	if err != nil {
 		pageNumInt = 1
@@ -44,6 +70,9 @@ func (userService *MockUserService) List(pageNum string, pageSize string, keywor
 			filteredUsers = append(filteredUsers, user)
 		}
 	}
+	sort.Slice(filteredUsers, func(i, j int) bool {
+		return filteredUsers[i].Id < filteredUsers[j].Id
+	})
 
 	totalRecords := len(filteredUsers)
 	totalPages := int(math.Ceil(float64(totalRecords) / float64(pageSizeInt)))
@@ -78,36 +107,88 @@ func (userService *MockUserService) List(pageNum string, pageSize string, keywor
 	return pagedUsers, pageResponse, nil
 }
 
-func (userService *MockUserService) GetById(userId int) (models.User, error) {
+func (userService *MockUserService) GetById(ctx context.Context, userId int) (models.User, error) {
 	for _, user := range userService.Users {
 		if user.Id == userId {
 			return user, nil
 		}
 	}
-	return models.User{}, errors.New("record not found")
+	return models.User{}, errNotFound
 }
 
-func (userService *MockUserService) GetByEmail(email string) (models.User, error) {
+func (userService *MockUserService) GetByEmail(ctx context.Context, email string) (models.User, error) {
 	if user, ok := userService.Users[email]; ok {
 		return user, nil
 	}
-	return models.User{}, errors.New("record not found")
+	return models.User{}, errNotFound
 }
 
-func (userService *MockUserService) UpdateByModel(user models.User) error {
+func (userService *MockUserService) UpdateByModel(ctx context.Context, user models.User) error {
 	if _, ok := userService.Users[user.Email]; ok {
 		userService.Users[user.Email] = user
 		return nil
 	}
-	return errors.New("record not found")
+	return errNotFound
 }
 
-func (userService *MockUserService) DeleteById(userId int) error {
+func (userService *MockUserService) DeleteById(ctx context.Context, userId int) error {
 	for _, user := range userService.Users {
 		if user.Id == userId {
+			user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			userService.DeletedUsers[user.Email] = user
 			delete(userService.Users, user.Email)
 			return nil
 		}
 	}
-	return errors.New("record not found")
+	return errNotFound
+}
+
+func (userService *MockUserService) UpdateStatus(ctx context.Context, userId int, status string, reason string, suspendedUntil *time.Time) error {
+	for email, user := range userService.Users {
+		if user.Id == userId {
+			user.Status = status
+			user.StatusReason = reason
+			user.SuspendedUntil = suspendedUntil
+			userService.Users[email] = user
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+func (userService *MockUserService) GetDeletedByEmail(ctx context.Context, email string) (models.User, error) {
+	if user, ok := userService.DeletedUsers[email]; ok {
+		return user, nil
+	}
+	return models.User{}, errNotFound
+}
+
+func (userService *MockUserService) RestoreById(ctx context.Context, userId int) error {
+	for email, user := range userService.DeletedUsers {
+		if user.Id == userId {
+			user.DeletedAt = gorm.DeletedAt{}
+			userService.Users[email] = user
+			delete(userService.DeletedUsers, email)
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+func (userService *MockUserService) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) ([]models.Media, error) {
+	var media []models.Media
+	for email, user := range userService.DeletedUsers {
+		if user.DeletedAt.Time.Before(cutoff) {
+			if userService.MediaService != nil {
+				for id, m := range userService.MediaService.Media {
+					if m.UserId == user.Id {
+						media = append(media, m.toModel(id))
+						delete(userService.MediaService.Media, id)
+					}
+				}
+			}
+			delete(userService.DeletedUsers, email)
+		}
+	}
+	return media, nil
 }
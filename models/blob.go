@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Blob is a content-addressed file in storage, shared by every media row with
+// its sha256. Uploads and cleanup jobs lock its row, so that its files are
+// never removed while an upload of the same bytes is starting to use them.
+type Blob struct {
+	Sha256       string `gorm:"primaryKey"`
+	ReferencedAt time.Time
+}
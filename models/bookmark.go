@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type Bookmark struct {
+	Id           int
+	CreatedAt    time.Time
+	UserId       int
+	PostId       int
+	CollectionId *int
+	Position     int
+}
+
+type Collection struct {
+	Id        int
+	CreatedAt time.Time
+	UserId    int
+	Name      string
+	Position  int
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Comment struct {
 	Id        int
@@ -8,4 +12,5 @@ type Comment struct {
 	PostId    int
 	UserId    int
 	Content   string
+	DeletedAt gorm.DeletedAt
 }
@@ -1,7 +1,37 @@
 package models
 
+import "time"
+
+// Videos are transcoded after upload; until then they are processing.
+const (
+	MediaStatusProcessing = "processing"
+	MediaStatusReady      = "ready"
+	MediaStatusFailed     = "failed"
+)
+
+// Media is an uploaded file. It belongs to the user who uploaded it and has no
+// post until it is attached to one.
 type Media struct {
-	Id     int
-	Url    string
-	PostId int
+	Id          int
+	CreatedAt   time.Time
+	UserId      int
+	PostId      int `gorm:"default:null"`
+	Url         string
+	Filename    string
+	ContentType string
+	Size        int64
+	Width       int
+	Height      int
+	DurationMs  int64
+	Sha256      string
+	Status      string
+}
+
+// MediaUsage is what a user has uploaded: in total, and since some point in
+// time.
+type MediaUsage struct {
+	StoredBytes        int64
+	MediaCount         int64
+	RecentUploads      int64
+	OldestRecentUpload time.Time
 }
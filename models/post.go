@@ -1,11 +1,17 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Post struct {
-	Id        int
-	CreatedAt time.Time
-	Title     string
-	Content   string
-	UserId    int
+	Id         int
+	CreatedAt  time.Time
+	Title      string
+	Content    string
+	UserId     int
+	IsArchived bool
+	DeletedAt  gorm.DeletedAt
 }
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetUser    = "user"
+
+	ReportStatusOpen      = "open"
+	ReportStatusDismissed = "dismissed"
+	ReportStatusActioned  = "actioned"
+
+	ModerationActionReport        = "report"
+	ModerationActionDismiss       = "dismiss"
+	ModerationActionRemoveContent = "remove_content"
+	ModerationActionSuspendUser   = "suspend_user"
+	ModerationActionBanUser       = "ban_user"
+	ModerationActionShadowBanUser = "shadow_ban_user"
+	ModerationActionReinstateUser = "reinstate_user"
+)
+
+type Report struct {
+	Id          int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ReporterId  int
+	TargetType  string
+	TargetId    int
+	Reason      string
+	Description string
+	Status      string
+}
+
+// ModerationAction is an audit trail entry. ReportId is 0 when a moderator
+// acted directly rather than in response to a report. Reports being filed are
+// recorded too, as ModerationActionReport by the reporter in ModeratorId.
+type ModerationAction struct {
+	Id          int
+	CreatedAt   time.Time
+	ReportId    int
+	ModeratorId int
+	TargetType  string
+	TargetId    int
+	Action      string
+	Note        string
+}
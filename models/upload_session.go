@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// An upload is uploading until its owner finalizes it. Only one request can
+// move it on to finalizing, so an upload becomes media at most once.
+const (
+	UploadStatusUploading  = "uploading"
+	UploadStatusFinalizing = "finalizing"
+)
+
+// UploadSession is a resumable upload in progress. Its chunks are staged in
+// storage until the upload is finalized into media.
+type UploadSession struct {
+	Id        string
+	CreatedAt time.Time
+	UserId    int
+	Filename  string
+	Size      int64
+	Offset    int64
+	Status    string `gorm:"default:uploading"`
+	ExpiresAt time.Time
+}
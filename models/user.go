@@ -1,6 +1,17 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	UserStatusActive       = "active"
+	UserStatusSuspended    = "suspended"
+	UserStatusBanned       = "banned"
+	UserStatusShadowBanned = "shadow_banned"
+)
 
 type User struct {
 	Id              int
@@ -12,4 +23,9 @@ type User struct {
 	IsPrivate       bool
 	Bio             string
 	ProfileImageUrl string
+	IsModerator     bool
+	Status          string
+	StatusReason    string
+	SuspendedUntil  *time.Time
+	DeletedAt       gorm.DeletedAt
 }
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/tracing"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"gorm.io/gorm"
+)
+
+type BookmarkService interface {
+	ListByUserId(ctx context.Context, userId int, collectionId int, pageNum string, pageSize string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error)
+	GetByUserIdAndPostId(ctx context.Context, userId int, postId int) (models.Bookmark, error)
+	Create(ctx context.Context, userId int, postId int, collectionId int) error
+	UpdateCollection(ctx context.Context, bookmarkId int, collectionId int) error
+	DeleteById(ctx context.Context, bookmarkId int) error
+	Reorder(ctx context.Context, userId int, postIds []int) error
+
+	ListCollectionsByUserId(ctx context.Context, userId int) ([]models.Collection, error)
+	GetCollectionById(ctx context.Context, collectionId int) (models.Collection, error)
+	CreateCollection(ctx context.Context, userId int, name string) error
+	DeleteCollectionById(ctx context.Context, collectionId int) error
+	ReorderCollections(ctx context.Context, userId int, collectionIds []int) error
+}
+
+type DBBookmarkService struct {
+	db *gorm.DB
+}
+
+func NewDBBookmarkService(db *gorm.DB) *DBBookmarkService {
+	return &DBBookmarkService{db: translateErrors(db)}
+}
+
+// ListByUserId returns the posts bookmarked by userId, optionally limited to a
+// single collection. Posts the user is no longer allowed to see, for example
+// after a private author stopped being followed, are left out.
+func (bookmarkService *DBBookmarkService) ListByUserId(ctx context.Context, userId int, collectionId int, pageNum string, pageSize string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.ListByUserId")
+	defer span.End()
+	pageNumInt, err := strconv.Atoi(pageNum)
+	if err != nil {
+		pageNumInt = 1
+	}
+	pageSizeInt, err := strconv.Atoi(pageSize)
+	if err != nil {
+		pageSizeInt = 10
+	}
+	offset := (pageNumInt - 1) * pageSizeInt
+
+	filterUserIds := visibleUserIds(bookmarkService.db.WithContext(ctx), userId)
+
+	query := bookmarkService.db.WithContext(ctx).Model(&models.Post{}).
+		Joins("JOIN bookmarks ON bookmarks.post_id = posts.id").
+		Where("bookmarks.user_id = ? AND posts.user_id IN ? AND posts.is_archived = false", userId, filterUserIds)
+	if collectionId != 0 {
+		query = query.Where("bookmarks.collection_id = ?", collectionId)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var totalCount int64
+	if err := query.Count(&totalCount).Error; err != nil {
+		return nil, nil, utils.PageResponse{}, err
+	}
+	var posts []models.Post
+	if err := query.Select("posts.*").Order("bookmarks.position desc, bookmarks.id desc").
+		Offset(offset).Limit(pageSizeInt).Find(&posts).Error; err != nil {
+		return nil, nil, utils.PageResponse{}, err
+	}
+	mediaMap := mediaByPostId(bookmarkService.db.WithContext(ctx), posts)
+	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
+	pageResponse := utils.PageResponse{
+		PageNum:      pageNumInt,
+		PageSize:     pageSizeInt,
+		TotalPages:   totalPages,
+		TotalRecords: int(totalCount),
+	}
+	return posts, mediaMap, pageResponse, nil
+}
+
+func (bookmarkService *DBBookmarkService) GetByUserIdAndPostId(ctx context.Context, userId int, postId int) (models.Bookmark, error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.GetByUserIdAndPostId")
+	defer span.End()
+	var bookmark models.Bookmark
+	err := bookmarkService.db.WithContext(ctx).Where("user_id = ? AND post_id = ?", userId, postId).First(&bookmark).Error
+	return bookmark, err
+}
+
+func (bookmarkService *DBBookmarkService) Create(ctx context.Context, userId int, postId int, collectionId int) error {
+	ctx, span := tracing.Start(ctx, "BookmarkService.Create")
+	defer span.End()
+	bookmark := models.Bookmark{
+		UserId:   userId,
+		PostId:   postId,
+		Position: maxPosition(bookmarkService.db.WithContext(ctx).Model(&models.Bookmark{}), userId) + 1,
+	}
+	if collectionId != 0 {
+		bookmark.CollectionId = &collectionId
+	}
+	return bookmarkService.db.WithContext(ctx).Create(&bookmark).Error
+}
+
+func (bookmarkService *DBBookmarkService) UpdateCollection(ctx context.Context, bookmarkId int, collectionId int) error {
+	ctx, span := tracing.Start(ctx, "BookmarkService.UpdateCollection")
+	defer span.End()
+	var value interface{}
+	if collectionId != 0 {
+		value = collectionId
+	}
+	return bookmarkService.db.WithContext(ctx).Model(&models.Bookmark{}).Where("id = ?", bookmarkId).
+		Update("collection_id", value).Error
+}
+
+func (bookmarkService *DBBookmarkService) DeleteById(ctx context.Context, bookmarkId int) error {
+	ctx, span := tracing.Start(ctx, "BookmarkService.DeleteById")
+	defer span.End()
+	return bookmarkService.db.WithContext(ctx).Delete(&models.Bookmark{}, bookmarkId).Error
+}
+
+// Reorder moves the bookmarks of the given posts to the top of the user's
+// list, in the order the post ids are given.
+func (bookmarkService *DBBookmarkService) Reorder(ctx context.Context, userId int, postIds []int) error {
+	ctx, span := tracing.Start(ctx, "BookmarkService.Reorder")
+	defer span.End()
+	return bookmarkService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		base := maxPosition(tx.Model(&models.Bookmark{}), userId)
+		for i, postId := range postIds {
+			err := tx.Model(&models.Bookmark{}).Where("user_id = ? AND post_id = ?", userId, postId).
+				Update("position", base+len(postIds)-i).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bookmarkService *DBBookmarkService) ListCollectionsByUserId(ctx context.Context, userId int) ([]models.Collection, error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.ListCollectionsByUserId")
+	defer span.End()
+	var collections = make([]models.Collection, 0)
+	err := bookmarkService.db.WithContext(ctx).Where("user_id = ?", userId).Order("position desc, id desc").Find(&collections).Error
+	return collections, err
+}
+
+func (bookmarkService *DBBookmarkService) GetCollectionById(ctx context.Context, collectionId int) (models.Collection, error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.GetCollectionById")
+	defer span.End()
+	var collection models.Collection
+	err := bookmarkService.db.WithContext(ctx).First(&collection, collectionId).Error
+	return collection, err
+}
+
+func (bookmarkService *DBBookmarkService) CreateCollection(ctx context.Context, userId int, name string) error {
+	ctx, span := tracing.Start(ctx, "BookmarkService.CreateCollection")
+	defer span.End()
+	return bookmarkService.db.WithContext(ctx).Create(&models.Collection{
+		UserId:   userId,
+		Name:     name,
+		Position: maxPosition(bookmarkService.db.WithContext(ctx).Model(&models.Collection{}), userId) + 1,
+	}).Error
+}
+
+func (bookmarkService *DBBookmarkService) DeleteCollectionById(ctx context.Context, collectionId int) error {
+	ctx, span := tracing.Start(ctx, "BookmarkService.DeleteCollectionById")
+	defer span.End()
+	return bookmarkService.db.WithContext(ctx).Delete(&models.Collection{}, collectionId).Error
+}
+
+// ReorderCollections moves the given collections to the top of the user's
+// list, in the order the collection ids are given.
+func (bookmarkService *DBBookmarkService) ReorderCollections(ctx context.Context, userId int, collectionIds []int) error {
+	ctx, span := tracing.Start(ctx, "BookmarkService.ReorderCollections")
+	defer span.End()
+	return bookmarkService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		base := maxPosition(tx.Model(&models.Collection{}), userId)
+		for i, collectionId := range collectionIds {
+			err := tx.Model(&models.Collection{}).Where("user_id = ? AND id = ?", userId, collectionId).
+				Update("position", base+len(collectionIds)-i).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func maxPosition(query *gorm.DB, userId int) int {
+	var position int
+	query.Where("user_id = ?", userId).Select("COALESCE(MAX(position), 0)").Scan(&position)
+	return position
+}
@@ -1,31 +1,38 @@
 package services
 
 import (
+	"context"
 	"math"
 	"strconv"
+	"time"
 
-	"github.com/ChenSongJian/ginstagram/db"
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/tracing"
 	"github.com/ChenSongJian/ginstagram/utils"
 	"gorm.io/gorm"
 )
 
 type CommentService interface {
-	ListByPostId(postId int, pageNum string, pageSize string) ([]models.Comment, utils.PageResponse, error)
-	GetById(commentId int) (models.Comment, error)
-	Create(postId int, userId int, content string) error
-	DeleteById(commentId int) error
+	ListByPostId(ctx context.Context, postId int, viewerId int, pageNum string, pageSize string) ([]models.Comment, utils.PageResponse, error)
+	GetById(ctx context.Context, commentId int) (models.Comment, error)
+	Create(ctx context.Context, postId int, userId int, content string) error
+	DeleteById(ctx context.Context, commentId int) error
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time) error
 }
 
 type DBCommentService struct {
 	db *gorm.DB
 }
 
-func NewDBCommentService() *DBCommentService {
-	return &DBCommentService{db: db.DB}
+func NewDBCommentService(db *gorm.DB) *DBCommentService {
+	return &DBCommentService{db: translateErrors(db)}
 }
 
-func (commentService *DBCommentService) ListByPostId(postId int, pageNum string, pageSize string) ([]models.Comment, utils.PageResponse, error) {
+// ListByPostId hides comments by shadow-banned users from everyone but the
+// commenters themselves.
+func (commentService *DBCommentService) ListByPostId(ctx context.Context, postId int, viewerId int, pageNum string, pageSize string) ([]models.Comment, utils.PageResponse, error) {
+	ctx, span := tracing.Start(ctx, "CommentService.ListByPostId")
+	defer span.End()
 	pageNumInt, err := strconv.Atoi(pageNum)
 	if err != nil {
 		pageNumInt = 1
@@ -37,10 +44,15 @@ func (commentService *DBCommentService) ListByPostId(postId int, pageNum string,
 	offset := (pageNumInt - 1) * pageSizeInt
 
 	var comments []models.Comment
-	query := commentService.db.Where("post_id = ?", postId).Find(&comments)
+	query := commentService.db.WithContext(ctx).Model(&models.Comment{}).Where("post_id = ? AND (user_id = ? OR user_id NOT IN (?))",
+		postId, viewerId, shadowBannedUserIds(commentService.db.WithContext(ctx))).Session(&gorm.Session{})
 	var totalCount int64
-	query.Count(&totalCount).Order("created_at desc").Offset(offset).Limit(pageSizeInt)
-	query.Find(&comments)
+	if err := query.Count(&totalCount).Error; err != nil {
+		return nil, utils.PageResponse{}, err
+	}
+	if err := query.Order("created_at desc, id desc").Offset(offset).Limit(pageSizeInt).Find(&comments).Error; err != nil {
+		return nil, utils.PageResponse{}, err
+	}
 	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
 	pageResponse := utils.PageResponse{
 		PageNum:      pageNumInt,
@@ -51,20 +63,32 @@ func (commentService *DBCommentService) ListByPostId(postId int, pageNum string,
 	return comments, pageResponse, nil
 }
 
-func (commentService *DBCommentService) Create(postId int, userId int, content string) error {
-	return commentService.db.Create(&models.Comment{
+func (commentService *DBCommentService) Create(ctx context.Context, postId int, userId int, content string) error {
+	ctx, span := tracing.Start(ctx, "CommentService.Create")
+	defer span.End()
+	return commentService.db.WithContext(ctx).Create(&models.Comment{
 		PostId:  postId,
 		UserId:  userId,
 		Content: content,
 	}).Error
 }
 
-func (commentService *DBCommentService) GetById(commentId int) (models.Comment, error) {
+func (commentService *DBCommentService) GetById(ctx context.Context, commentId int) (models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "CommentService.GetById")
+	defer span.End()
 	var comment models.Comment
-	err := commentService.db.First(&comment, commentId).Error
+	err := commentService.db.WithContext(ctx).First(&comment, commentId).Error
 	return comment, err
 }
 
-func (commentService *DBCommentService) DeleteById(commentId int) error {
-	return commentService.db.Delete(&models.Comment{}, commentId).Error
+func (commentService *DBCommentService) DeleteById(ctx context.Context, commentId int) error {
+	ctx, span := tracing.Start(ctx, "CommentService.DeleteById")
+	defer span.End()
+	return commentService.db.WithContext(ctx).Delete(&models.Comment{}, commentId).Error
+}
+
+func (commentService *DBCommentService) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) error {
+	ctx, span := tracing.Start(ctx, "CommentService.PurgeDeletedBefore")
+	defer span.End()
+	return commentService.db.WithContext(ctx).Unscoped().Where("deleted_at < ?", cutoff).Delete(&models.Comment{}).Error
 }
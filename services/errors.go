@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/ChenSongJian/ginstagram/db"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// The kinds of errors services fail with, whatever the database. Check for
+// them with errors.Is.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrForbidden  = errors.New("forbidden")
+	ErrValidation = errors.New("validation failed")
+)
+
+// Error is an error of one of the kinds above. Constraint names the database
+// constraint the error broke, if it broke one.
+type Error struct {
+	Kind       error
+	Constraint string
+	Err        error
+}
+
+func (err *Error) Error() string {
+	return err.Err.Error()
+}
+
+func (err *Error) Is(target error) bool {
+	return target == err.Kind
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// TranslateError returns err as an Error if it is of a known kind: a missing
+// record, or a constraint Postgres or SQLite refused a write over. Other
+// errors are returned as they are.
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var translated *Error
+	if errors.As(err, &translated) {
+		return err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &Error{Kind: ErrNotFound, Err: err}
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return sqlStateError(pgErr.Code, pgErr.ConstraintName, err)
+	}
+	var constraintErr *db.ConstraintError
+	if errors.As(err, &constraintErr) {
+		return sqlStateError(constraintErr.SQLState(), constraintErr.Constraint, err)
+	}
+	return err
+}
+
+func sqlStateError(code string, constraint string, err error) error {
+	switch code {
+	case "23505": // unique_violation
+		return &Error{Kind: ErrConflict, Constraint: constraint, Err: err}
+	case "23503": // foreign_key_violation, the row referred to is missing
+		return &Error{Kind: ErrNotFound, Constraint: constraint, Err: err}
+	case "23502", "23514", "22001", "22003", "22P02": // not null, check, too long, out of range, malformed
+		return &Error{Kind: ErrValidation, Constraint: constraint, Err: err}
+	}
+	return err
+}
+
+// IsConstraint reports whether err broke the named database constraint.
+func IsConstraint(err error, constraint string) bool {
+	var translated *Error
+	return errors.As(err, &translated) && translated.Constraint == constraint
+}
+
+// errorTranslator is a GORM plugin passing the error of every statement
+// through TranslateError, so that the services fail with Errors without each
+// translating its own.
+type errorTranslator struct{}
+
+func (errorTranslator) Name() string {
+	return "ginstagram:error_translator"
+}
+
+func (errorTranslator) Initialize(database *gorm.DB) error {
+	translate := func(tx *gorm.DB) {
+		tx.Error = TranslateError(tx.Error)
+	}
+	callbacks := database.Callback()
+	for _, processor := range []interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}{
+		callbacks.Create().After("*"), callbacks.Query().After("*"), callbacks.Update().After("*"),
+		callbacks.Delete().After("*"), callbacks.Row().After("*"), callbacks.Raw().After("*"),
+	} {
+		if err := processor.Register("ginstagram:translate_error", translate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// translateErrors makes the statements on database fail with Errors. The
+// services call it on the database they are given; it is done once.
+func translateErrors(database *gorm.DB) *gorm.DB {
+	if err := database.Use(errorTranslator{}); err != nil && !errors.Is(err, gorm.ErrRegistered) {
+		panic(err)
+	}
+	return database
+}
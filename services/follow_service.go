@@ -1,61 +1,75 @@
 package services
 
 import (
-	"github.com/ChenSongJian/ginstagram/db"
+	"context"
+
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/tracing"
 	"gorm.io/gorm"
 )
 
 type FollowService interface {
-	GetById(followId int) (models.Follow, error)
-	GetByFollowerId(followId int) ([]models.Follow, error)
-	GetByFolloweeId(followId int) ([]models.Follow, error)
-	Create(followerId int, followeeId int) error
-	Delete(followId int) error
-	IsFollowing(followerId int, followeeId int) bool
+	GetById(ctx context.Context, followId int) (models.Follow, error)
+	GetByFollowerId(ctx context.Context, followId int) ([]models.Follow, error)
+	GetByFolloweeId(ctx context.Context, followId int) ([]models.Follow, error)
+	Create(ctx context.Context, followerId int, followeeId int) error
+	Delete(ctx context.Context, followId int) error
+	IsFollowing(ctx context.Context, followerId int, followeeId int) bool
 }
 
 type DBFollowService struct {
 	db *gorm.DB
 }
 
-func NewDBFollowService() *DBFollowService {
-	return &DBFollowService{db: db.DB}
+func NewDBFollowService(db *gorm.DB) *DBFollowService {
+	return &DBFollowService{db: translateErrors(db)}
 }
 
-func (followService *DBFollowService) GetById(followId int) (models.Follow, error) {
+func (followService *DBFollowService) GetById(ctx context.Context, followId int) (models.Follow, error) {
+	ctx, span := tracing.Start(ctx, "FollowService.GetById")
+	defer span.End()
 	var follow models.Follow
-	result := followService.db.First(&follow, followId)
+	result := followService.db.WithContext(ctx).First(&follow, followId)
 	return follow, result.Error
 }
 
-func (followService *DBFollowService) GetByFollowerId(followerId int) ([]models.Follow, error) {
+func (followService *DBFollowService) GetByFollowerId(ctx context.Context, followerId int) ([]models.Follow, error) {
+	ctx, span := tracing.Start(ctx, "FollowService.GetByFollowerId")
+	defer span.End()
 	var follows []models.Follow
-	result := followService.db.Where("follower_id = ?", followerId).Find(&follows)
+	result := followService.db.WithContext(ctx).Where("follower_id = ?", followerId).Find(&follows)
 	return follows, result.Error
 }
 
-func (followService *DBFollowService) GetByFolloweeId(followeeId int) ([]models.Follow, error) {
+func (followService *DBFollowService) GetByFolloweeId(ctx context.Context, followeeId int) ([]models.Follow, error) {
+	ctx, span := tracing.Start(ctx, "FollowService.GetByFolloweeId")
+	defer span.End()
 	var follows []models.Follow
-	result := followService.db.Where("user_id = ?", followeeId).Find(&follows)
+	result := followService.db.WithContext(ctx).Where("user_id = ?", followeeId).Find(&follows)
 	return follows, result.Error
 }
 
-func (followService *DBFollowService) Create(followerId int, followeeId int) error {
-	result := followService.db.Create(&models.Follow{
+func (followService *DBFollowService) Create(ctx context.Context, followerId int, followeeId int) error {
+	ctx, span := tracing.Start(ctx, "FollowService.Create")
+	defer span.End()
+	result := followService.db.WithContext(ctx).Create(&models.Follow{
 		FollowerId: followerId,
 		UserId:     followeeId,
 	})
 	return result.Error
 }
 
-func (followService *DBFollowService) Delete(followId int) error {
-	result := followService.db.Delete(&models.Follow{}, followId)
+func (followService *DBFollowService) Delete(ctx context.Context, followId int) error {
+	ctx, span := tracing.Start(ctx, "FollowService.Delete")
+	defer span.End()
+	result := followService.db.WithContext(ctx).Delete(&models.Follow{}, followId)
 	return result.Error
 }
 
-func (followService *DBFollowService) IsFollowing(followerId int, followeeId int) bool {
+func (followService *DBFollowService) IsFollowing(ctx context.Context, followerId int, followeeId int) bool {
+	ctx, span := tracing.Start(ctx, "FollowService.IsFollowing")
+	defer span.End()
 	var follow models.Follow
-	result := followService.db.Where("follower_id = ? AND user_id = ?", followerId, followeeId).First(&follow)
+	result := followService.db.WithContext(ctx).Where("follower_id = ? AND user_id = ?", followerId, followeeId).First(&follow)
 	return result.RowsAffected > 0
 }
@@ -1,60 +1,79 @@
 package services
 
 import (
-	"github.com/ChenSongJian/ginstagram/db"
+	"context"
+
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/tracing"
 	"gorm.io/gorm"
 )
 
 type LikeService interface {
-	ListPostLikesByPostId(postId int) ([]models.PostLike, error)
-	GetByPostLikeId(postLikeId int) (models.PostLike, error)
-	CreatePostLike(postId int, userId int) error
-	DeletePostLikeById(postLikeId int) error
+	ListPostLikesByPostId(ctx context.Context, postId int, viewerId int) ([]models.PostLike, error)
+	GetByPostLikeId(ctx context.Context, postLikeId int) (models.PostLike, error)
+	CreatePostLike(ctx context.Context, postId int, userId int) error
+	DeletePostLikeById(ctx context.Context, postLikeId int) error
 
-	GetByCommentLikeId(commentId int) (models.CommentLike, error)
-	CreateCommentLike(commentId int, userId int) error
-	DeleteCommentLikeById(commentLikeId int) error
+	GetByCommentLikeId(ctx context.Context, commentId int) (models.CommentLike, error)
+	CreateCommentLike(ctx context.Context, commentId int, userId int) error
+	DeleteCommentLikeById(ctx context.Context, commentLikeId int) error
 }
 
 type DBLikeService struct {
 	db *gorm.DB
 }
 
-func NewDBLikeService() *DBLikeService {
-	return &DBLikeService{db: db.DB}
+func NewDBLikeService(db *gorm.DB) *DBLikeService {
+	return &DBLikeService{db: translateErrors(db)}
 }
 
-func (likeService *DBLikeService) ListPostLikesByPostId(postId int) ([]models.PostLike, error) {
+// ListPostLikesByPostId hides likes by shadow-banned users from everyone but
+// the likers themselves.
+func (likeService *DBLikeService) ListPostLikesByPostId(ctx context.Context, postId int, viewerId int) ([]models.PostLike, error) {
+	ctx, span := tracing.Start(ctx, "LikeService.ListPostLikesByPostId")
+	defer span.End()
 	var postLikes []models.PostLike
-	err := likeService.db.Where("post_id = ?", postId).Find(&postLikes).Error
+	err := likeService.db.WithContext(ctx).Where("post_id = ? AND (user_id = ? OR user_id NOT IN (?))",
+		postId, viewerId, shadowBannedUserIds(likeService.db.WithContext(ctx))).Find(&postLikes).Error
 	return postLikes, err
 }
 
-func (likeService *DBLikeService) GetByPostLikeId(postLikeId int) (models.PostLike, error) {
+func (likeService *DBLikeService) GetByPostLikeId(ctx context.Context, postLikeId int) (models.PostLike, error) {
+	ctx, span := tracing.Start(ctx, "LikeService.GetByPostLikeId")
+	defer span.End()
 	var postLike models.PostLike
-	err := likeService.db.First(&postLike, postLikeId).Error
+	err := likeService.db.WithContext(ctx).First(&postLike, postLikeId).Error
 	return postLike, err
 }
 
-func (likeService *DBLikeService) CreatePostLike(postId int, userId int) error {
-	return likeService.db.Create(&models.PostLike{PostId: postId, UserId: userId}).Error
+func (likeService *DBLikeService) CreatePostLike(ctx context.Context, postId int, userId int) error {
+	ctx, span := tracing.Start(ctx, "LikeService.CreatePostLike")
+	defer span.End()
+	return likeService.db.WithContext(ctx).Create(&models.PostLike{PostId: postId, UserId: userId}).Error
 }
 
-func (likeService *DBLikeService) DeletePostLikeById(postLikeId int) error {
-	return likeService.db.Delete(&models.PostLike{}, postLikeId).Error
+func (likeService *DBLikeService) DeletePostLikeById(ctx context.Context, postLikeId int) error {
+	ctx, span := tracing.Start(ctx, "LikeService.DeletePostLikeById")
+	defer span.End()
+	return likeService.db.WithContext(ctx).Delete(&models.PostLike{}, postLikeId).Error
 }
 
-func (likeService *DBLikeService) GetByCommentLikeId(commentId int) (models.CommentLike, error) {
+func (likeService *DBLikeService) GetByCommentLikeId(ctx context.Context, commentId int) (models.CommentLike, error) {
+	ctx, span := tracing.Start(ctx, "LikeService.GetByCommentLikeId")
+	defer span.End()
 	var commentLike models.CommentLike
-	err := likeService.db.First(&commentLike, commentId).Error
+	err := likeService.db.WithContext(ctx).First(&commentLike, commentId).Error
 	return commentLike, err
 }
 
-func (likeService *DBLikeService) CreateCommentLike(commentId int, userId int) error {
-	return likeService.db.Create(&models.CommentLike{CommentId: commentId, UserId: userId}).Error
+func (likeService *DBLikeService) CreateCommentLike(ctx context.Context, commentId int, userId int) error {
+	ctx, span := tracing.Start(ctx, "LikeService.CreateCommentLike")
+	defer span.End()
+	return likeService.db.WithContext(ctx).Create(&models.CommentLike{CommentId: commentId, UserId: userId}).Error
 }
 
-func (likeService *DBLikeService) DeleteCommentLikeById(commentLikeId int) error {
-	return likeService.db.Delete(&models.CommentLike{}, commentLikeId).Error
+func (likeService *DBLikeService) DeleteCommentLikeById(ctx context.Context, commentLikeId int) error {
+	ctx, span := tracing.Start(ctx, "LikeService.DeleteCommentLikeById")
+	defer span.End()
+	return likeService.db.WithContext(ctx).Delete(&models.CommentLike{}, commentLikeId).Error
 }
@@ -1,30 +1,298 @@
 package services
 
 import (
-	"github.com/ChenSongJian/ginstagram/db"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/imaging"
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/tracing"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MediaService interface {
-	GetByPostId(postId int) ([]models.Media, error)
-	Create(media []models.Media) error
+	GetById(ctx context.Context, id int) (models.Media, error)
+	GetByPostId(ctx context.Context, postId int) ([]models.Media, error)
+	ListByKey(ctx context.Context, key string) ([]models.Media, error)
+	ListByStatus(ctx context.Context, status string) ([]models.Media, error)
+	GetByIds(ctx context.Context, ids []int) ([]models.Media, error)
+	Create(ctx context.Context, media models.Media) (int, error)
+	AttachToPost(ctx context.Context, postId int, userId int, mediaIds []int) error
+	ListUnattachedBefore(ctx context.Context, cutoff time.Time) ([]models.Media, error)
+	DeleteById(ctx context.Context, id int) error
+	ReferencedKeys(ctx context.Context, keys []string, ignoredMediaIds []int) (map[string]bool, error)
+	RemoveBlob(ctx context.Context, key string, ignoredMediaIds []int, remove func() error) (bool, error)
+	UpdateProcessed(ctx context.Context, sha256 string, status string, width int, height int, durationMs int64) error
+	UsageByUserId(ctx context.Context, userId int, since time.Time) (models.MediaUsage, error)
 }
 
 type DBMediaService struct {
 	db *gorm.DB
 }
 
-func NewDBMediaService() *DBMediaService {
-	return &DBMediaService{db: db.DB}
+func NewDBMediaService(db *gorm.DB) *DBMediaService {
+	return &DBMediaService{db: translateErrors(db)}
+}
+
+// Create creates a media row. Media with a sha256 takes the lock on its blob
+// first, so once Create returns the blob's files are safe from RemoveBlob and
+// the caller may store them if they are missing.
+func (mediaService *DBMediaService) Create(ctx context.Context, media models.Media) (int, error) {
+	ctx, span := tracing.Start(ctx, "MediaService.Create")
+	defer span.End()
+	err := mediaService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if media.Sha256 != "" {
+			if err := lockBlob(tx, media.Sha256); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&media).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return media.Id, nil
+}
+
+// lockBlob locks the row of a blob, creating it if need be, until tx ends.
+func lockBlob(tx *gorm.DB, sha256 string) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sha256"}},
+		DoUpdates: clause.AssignmentColumns([]string{"referenced_at"}),
+	}).Create(&models.Blob{Sha256: sha256, ReferencedAt: time.Now()}).Error
+}
+
+// RemoveBlob calls remove to delete the files of the blob key belongs to,
+// unless media other than ignoredMediaIds or a profile image still refers to
+// it, and reports whether it did. The blob stays locked meanwhile, so an
+// upload of the same bytes waits until the files are gone and stores them
+// again. Keys that are not content-addressed are an ErrValidation.
+func (mediaService *DBMediaService) RemoveBlob(ctx context.Context, key string, ignoredMediaIds []int, remove func() error) (bool, error) {
+	ctx, span := tracing.Start(ctx, "MediaService.RemoveBlob")
+	defer span.End()
+	sha256, ok := storage.BlobSha256(key)
+	if !ok {
+		return false, &Error{Kind: ErrValidation, Err: errors.New(key + " is not a blob")}
+	}
+	removed := false
+	err := mediaService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockBlob(tx, sha256); err != nil {
+			return err
+		}
+		referenced, err := referencedKeys(tx, []string{key}, ignoredMediaIds)
+		if err != nil || referenced[key] {
+			return err
+		}
+		if err := remove(); err != nil {
+			return err
+		}
+		removed = true
+		return tx.Delete(&models.Blob{}, "sha256 = ?", sha256).Error
+	})
+	return removed && err == nil, err
+}
+
+func (mediaService *DBMediaService) GetByPostId(ctx context.Context, postId int) ([]models.Media, error) {
+	ctx, span := tracing.Start(ctx, "MediaService.GetByPostId")
+	defer span.End()
+	var media = make([]models.Media, 0)
+	err := mediaService.db.WithContext(ctx).Where("post_id = ?", postId).Order("id").Find(&media).Error
+	return media, err
+}
+
+func (mediaService *DBMediaService) GetById(ctx context.Context, id int) (models.Media, error) {
+	ctx, span := tracing.Start(ctx, "MediaService.GetById")
+	defer span.End()
+	var media models.Media
+	err := mediaService.db.WithContext(ctx).First(&media, id).Error
+	return media, err
+}
+
+// ListByKey lists every media row the file stored under key belongs to: the
+// rows sharing its blob when it is content-addressed, the rows of the image
+// it is a variant of otherwise.
+func (mediaService *DBMediaService) ListByKey(ctx context.Context, key string) ([]models.Media, error) {
+	ctx, span := tracing.Start(ctx, "MediaService.ListByKey")
+	defer span.End()
+	var media = make([]models.Media, 0)
+	query := mediaService.db.WithContext(ctx).Where("url = ?", imaging.OriginalKey(key))
+	if sha256, ok := storage.BlobSha256(key); ok {
+		query = mediaService.db.WithContext(ctx).Where("sha256 = ?", sha256)
+	}
+	err := query.Order("id").Find(&media).Error
+	return media, err
 }
 
-func (mediaService *DBMediaService) Create(media []models.Media) error {
-	return mediaService.db.Create(&media).Error
+func (mediaService *DBMediaService) ListByStatus(ctx context.Context, status string) ([]models.Media, error) {
+	ctx, span := tracing.Start(ctx, "MediaService.ListByStatus")
+	defer span.End()
+	var media = make([]models.Media, 0)
+	err := mediaService.db.WithContext(ctx).Where("status = ?", status).Order("id").Find(&media).Error
+	return media, err
 }
 
-func (mediaService *DBMediaService) GetByPostId(postId int) ([]models.Media, error) {
+func (mediaService *DBMediaService) GetByIds(ctx context.Context, ids []int) ([]models.Media, error) {
+	ctx, span := tracing.Start(ctx, "MediaService.GetByIds")
+	defer span.End()
 	var media = make([]models.Media, 0)
-	err := mediaService.db.Where("post_id = ?", postId).Find(&media).Error
+	err := mediaService.db.WithContext(ctx).Where("id IN ?", ids).Find(&media).Error
 	return media, err
 }
+
+// AttachToPost attaches media owned by userId that is not attached yet. Either
+// all of it is attached or, when any of it is not available anymore, none and
+// an ErrConflict is returned.
+func (mediaService *DBMediaService) AttachToPost(ctx context.Context, postId int, userId int, mediaIds []int) error {
+	ctx, span := tracing.Start(ctx, "MediaService.AttachToPost")
+	defer span.End()
+	return mediaService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return attachMedia(tx, postId, userId, mediaIds)
+	})
+}
+
+func attachMedia(tx *gorm.DB, postId int, userId int, mediaIds []int) error {
+	if len(mediaIds) == 0 {
+		return nil
+	}
+	result := tx.Model(&models.Media{}).Where("id IN ? AND user_id = ? AND post_id IS NULL", mediaIds, userId).
+		Update("post_id", postId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != int64(len(mediaIds)) {
+		return &Error{Kind: ErrConflict, Err: errors.New("media is not available to attach")}
+	}
+	return nil
+}
+
+// ListUnattachedBefore lists media uploaded before cutoff that never made it
+// into a post. Uploads used as a profile image are not included.
+func (mediaService *DBMediaService) ListUnattachedBefore(ctx context.Context, cutoff time.Time) ([]models.Media, error) {
+	ctx, span := tracing.Start(ctx, "MediaService.ListUnattachedBefore")
+	defer span.End()
+	var media = make([]models.Media, 0)
+	err := mediaService.db.WithContext(ctx).Where("post_id IS NULL AND created_at < ?", cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM users WHERE users.profile_image_url = media.url)").
+		Find(&media).Error
+	return media, err
+}
+
+func (mediaService *DBMediaService) DeleteById(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "MediaService.DeleteById")
+	defer span.End()
+	return mediaService.db.WithContext(ctx).Delete(&models.Media{}, id).Error
+}
+
+// ReferencedKeys reports which of the files stored under keys are still in
+// use, either by a media row or as the profile image of an account, deleted
+// accounts included. Files are matched the way ListByKey matches them. Media
+// rows in ignoredMediaIds do not count, which lets a caller ask what would be
+// left unreferenced once they are gone.
+func (mediaService *DBMediaService) ReferencedKeys(ctx context.Context, keys []string, ignoredMediaIds []int) (map[string]bool, error) {
+	ctx, span := tracing.Start(ctx, "MediaService.ReferencedKeys")
+	defer span.End()
+	return referencedKeys(mediaService.db.WithContext(ctx), keys, ignoredMediaIds)
+}
+
+func referencedKeys(db *gorm.DB, keys []string, ignoredMediaIds []int) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	if len(keys) == 0 {
+		return referenced, nil
+	}
+	var urls, checksums []string
+	for _, key := range keys {
+		if sha256, ok := storage.BlobSha256(key); ok {
+			checksums = append(checksums, sha256)
+		} else {
+			urls = append(urls, imaging.OriginalKey(key))
+		}
+	}
+	var foundUrls, foundChecksums []string
+	query := db.Model(&models.Media{}).Where("url IN ? OR sha256 IN ?", append(urls, ""), append(checksums, ""))
+	if len(ignoredMediaIds) > 0 {
+		query = query.Where("id NOT IN ?", ignoredMediaIds)
+	}
+	var rows []models.Media
+	if err := query.Select("url", "sha256").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		foundUrls = append(foundUrls, row.Url)
+		foundChecksums = append(foundChecksums, row.Sha256)
+	}
+	profileQuery := db.Unscoped().Model(&models.User{}).Where("profile_image_url IN ?", append(urls, ""))
+	for _, sha256 := range checksums {
+		profileQuery = profileQuery.Or("profile_image_url LIKE ?", storage.BlobPrefix(sha256)+".%")
+	}
+	var profileImages []string
+	if err := profileQuery.Pluck("profile_image_url", &profileImages).Error; err != nil {
+		return nil, err
+	}
+	for _, url := range profileImages {
+		if sha256, ok := storage.BlobSha256(url); ok {
+			foundChecksums = append(foundChecksums, sha256)
+		} else {
+			foundUrls = append(foundUrls, url)
+		}
+	}
+
+	inUse := make(map[string]bool)
+	for _, url := range foundUrls {
+		inUse[url] = true
+	}
+	for _, sha256 := range foundChecksums {
+		inUse[sha256] = true
+	}
+	for _, key := range keys {
+		if sha256, ok := storage.BlobSha256(key); ok {
+			referenced[key] = inUse[sha256]
+		} else {
+			referenced[key] = inUse[imaging.OriginalKey(key)]
+		}
+	}
+	return referenced, nil
+}
+
+// UpdateProcessed records the outcome of processing the blob with the given
+// sha256 on every media row sharing it that was still processing.
+func (mediaService *DBMediaService) UpdateProcessed(ctx context.Context, sha256 string, status string, width int, height int, durationMs int64) error {
+	ctx, span := tracing.Start(ctx, "MediaService.UpdateProcessed")
+	defer span.End()
+	return mediaService.db.WithContext(ctx).Model(&models.Media{}).
+		Where("sha256 = ? AND status = ?", sha256, models.MediaStatusProcessing).
+		Updates(map[string]interface{}{"status": status, "width": width, "height": height, "duration_ms": durationMs}).Error
+}
+
+// UsageByUserId sums up the media of a user, counting what was uploaded since
+// the given time apart. Identical uploads share one blob, so the bytes of each
+// blob are counted once however many of the user's media rows share it.
+func (mediaService *DBMediaService) UsageByUserId(ctx context.Context, userId int, since time.Time) (models.MediaUsage, error) {
+	ctx, span := tracing.Start(ctx, "MediaService.UsageByUserId")
+	defer span.End()
+	var usage models.MediaUsage
+	if err := mediaService.db.WithContext(ctx).Model(&models.Media{}).Where("user_id = ?", userId).
+		Count(&usage.MediaCount).Error; err != nil {
+		return usage, err
+	}
+	blobs := mediaService.db.WithContext(ctx).Model(&models.Media{}).Where("user_id = ?", userId).
+		Select("MAX(size) AS size").Group("COALESCE(NULLIF(sha256, ''), CAST(id AS TEXT))")
+	err := mediaService.db.WithContext(ctx).Table("(?) AS blobs", blobs).
+		Select("COALESCE(SUM(size), 0)").Scan(&usage.StoredBytes).Error
+	if err != nil {
+		return usage, err
+	}
+	recent := mediaService.db.WithContext(ctx).Model(&models.Media{}).Where("user_id = ? AND created_at >= ?", userId, since)
+	if err := recent.Session(&gorm.Session{}).Count(&usage.RecentUploads).Error; err != nil {
+		return usage, err
+	}
+	// the oldest row rather than MIN(created_at), which SQLite returns as text
+	var oldest []time.Time
+	err = recent.Order("created_at").Limit(1).Pluck("created_at", &oldest).Error
+	if len(oldest) > 0 {
+		usage.OldestRecentUpload = oldest[0]
+	}
+	return usage, err
+}
@@ -1,32 +1,46 @@
 package services
 
 import (
+	"context"
 	"math"
 	"strconv"
+	"time"
 
-	"github.com/ChenSongJian/ginstagram/db"
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/tracing"
 	"github.com/ChenSongJian/ginstagram/utils"
 	"gorm.io/gorm"
 )
 
 type PostService interface {
-	List(pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error)
-	ListByUserId(userId int, pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error)
-	GetById(postId int) (models.Post, error)
-	Create(post models.Post) (int, error)
-	DeleteById(id int) error
+	List(ctx context.Context, pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error)
+	ListByUserId(ctx context.Context, userId int, pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error)
+	GetById(ctx context.Context, postId int) (models.Post, error)
+	Create(ctx context.Context, post models.Post, mediaIds []int) (int, error)
+	DeleteById(ctx context.Context, id int) error
+	ListDeletedByUserId(ctx context.Context, userId int, pageNum string, pageSize string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error)
+	GetDeletedById(ctx context.Context, postId int) (models.Post, error)
+	RestoreById(ctx context.Context, postId int) error
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time) ([]models.Media, error)
+	ListArchivedByUserId(ctx context.Context, userId int, pageNum string, pageSize string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error)
+	UpdateArchived(ctx context.Context, postId int, archived bool) error
 }
 
+// TrashRetention is how long soft-deleted posts and accounts can be restored
+// before the purge job removes them for good.
+const TrashRetention = 30 * 24 * time.Hour
+
 type DBPostService struct {
 	db *gorm.DB
 }
 
-func NewDBPostService() *DBPostService {
-	return &DBPostService{db: db.DB}
+func NewDBPostService(db *gorm.DB) *DBPostService {
+	return &DBPostService{db: translateErrors(db)}
 }
 
-func (postService *DBPostService) List(pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+func (postService *DBPostService) List(ctx context.Context, pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+	ctx, span := tracing.Start(ctx, "PostService.List")
+	defer span.End()
 	pageNumInt, err := strconv.Atoi(pageNum)
 	if err != nil {
 		pageNumInt = 1
@@ -37,34 +51,22 @@ func (postService *DBPostService) List(pageNum string, pageSize string, keyword
 	}
 	offset := (pageNumInt - 1) * pageSizeInt
 
-	filterUserIds := []int{}
-	var publicUsers []models.User
-	postService.db.Where("is_private=false").Find(&publicUsers)
-	for _, publicUser := range publicUsers {
-		filterUserIds = append(filterUserIds, publicUser.Id)
-	}
+	filterUserIds := publicUserIds(postService.db.WithContext(ctx))
 
 	var posts []models.Post
-	query := postService.db.Model(&models.Post{})
+	query := postService.db.WithContext(ctx).Model(&models.Post{}).Where("is_archived = false")
 	if keyword != "" {
 		query = query.Where("title LIKE ? OR content LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
 	}
-	query = query.Where("user_id IN ?", filterUserIds).Find(&posts)
+	query = query.Where("user_id IN ?", filterUserIds).Session(&gorm.Session{})
 	var totalCount int64
-	query.Count(&totalCount)
-	query.Order("created_at desc").Offset(offset).Limit(pageSizeInt).Find(&posts)
-	var postIds []int
-	for _, post := range posts {
-		postIds = append(postIds, post.Id)
+	if err := query.Count(&totalCount).Error; err != nil {
+		return nil, nil, utils.PageResponse{}, err
 	}
-	mediaMap := make(map[int][]models.Media)
-	if len(postIds) > 0 {
-		var media []models.Media
-		postService.db.Where("post_id IN ?", postIds).Find(&media)
-		for _, m := range media {
-			mediaMap[m.PostId] = append(mediaMap[m.PostId], m)
-		}
+	if err := query.Order("created_at desc, id desc").Offset(offset).Limit(pageSizeInt).Find(&posts).Error; err != nil {
+		return nil, nil, utils.PageResponse{}, err
 	}
+	mediaMap := mediaByPostId(postService.db.WithContext(ctx), posts)
 	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
 	pageResponse := utils.PageResponse{
 		PageNum:      pageNumInt,
@@ -75,7 +77,9 @@ func (postService *DBPostService) List(pageNum string, pageSize string, keyword
 	return posts, mediaMap, pageResponse, nil
 }
 
-func (postService *DBPostService) ListByUserId(userId int, pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+func (postService *DBPostService) ListByUserId(ctx context.Context, userId int, pageNum string, pageSize string, keyword string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+	ctx, span := tracing.Start(ctx, "PostService.ListByUserId")
+	defer span.End()
 	pageNumInt, err := strconv.Atoi(pageNum)
 	if err != nil {
 		pageNumInt = 1
@@ -86,39 +90,22 @@ func (postService *DBPostService) ListByUserId(userId int, pageNum string, pageS
 	}
 	offset := (pageNumInt - 1) * pageSizeInt
 
-	filterUserIds := []int{userId}
-	var followingUsers []models.Follow
-	postService.db.Where("follower_id = ?", userId).Find(&followingUsers)
-	for _, followingUser := range followingUsers {
-		filterUserIds = append(filterUserIds, followingUser.UserId)
-	}
-	var publicUsers []models.User
-	postService.db.Where("is_private=false").Find(&publicUsers)
-	for _, publicUser := range publicUsers {
-		filterUserIds = append(filterUserIds, publicUser.Id)
-	}
+	filterUserIds := visibleUserIds(postService.db.WithContext(ctx), userId)
 
 	var posts []models.Post
-	query := postService.db.Model(&models.Post{})
+	query := postService.db.WithContext(ctx).Model(&models.Post{}).Where("is_archived = false")
 	if keyword != "" {
 		query = query.Where("title LIKE ? OR content LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
 	}
-	query = query.Where("user_id IN ?", filterUserIds).Find(&posts)
+	query = query.Where("user_id IN ?", filterUserIds).Session(&gorm.Session{})
 	var totalCount int64
-	query.Count(&totalCount)
-	query.Order("created_at desc").Offset(offset).Limit(pageSizeInt).Find(&posts)
-	var postIds []int
-	for _, post := range posts {
-		postIds = append(postIds, post.Id)
+	if err := query.Count(&totalCount).Error; err != nil {
+		return nil, nil, utils.PageResponse{}, err
 	}
-	mediaMap := make(map[int][]models.Media)
-	if len(postIds) > 0 {
-		var media []models.Media
-		postService.db.Where("post_id IN ?", postIds).Find(&media)
-		for _, m := range media {
-			mediaMap[m.PostId] = append(mediaMap[m.PostId], m)
-		}
+	if err := query.Order("created_at desc, id desc").Offset(offset).Limit(pageSizeInt).Find(&posts).Error; err != nil {
+		return nil, nil, utils.PageResponse{}, err
 	}
+	mediaMap := mediaByPostId(postService.db.WithContext(ctx), posts)
 	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
 	pageResponse := utils.PageResponse{
 		PageNum:      pageNumInt,
@@ -129,27 +116,204 @@ func (postService *DBPostService) ListByUserId(userId int, pageNum string, pageS
 	return posts, mediaMap, pageResponse, nil
 }
 
-func (postService *DBPostService) GetById(postId int) (models.Post, error) {
+func (postService *DBPostService) GetById(ctx context.Context, postId int) (models.Post, error) {
+	ctx, span := tracing.Start(ctx, "PostService.GetById")
+	defer span.End()
 	var post models.Post
-	result := postService.db.First(&post, postId)
+	result := postService.db.WithContext(ctx).First(&post, postId)
 	if result.Error != nil {
 		return post, result.Error
 	}
 	return post, nil
 }
 
-func (postService *DBPostService) Create(post models.Post) (int, error) {
-	result := postService.db.Create(&post)
-	if result.Error != nil {
-		return 0, result.Error
+// Create creates a post with the given media of its author attached, in one
+// transaction: when any of the media is not available to attach, no post is
+// created and an ErrConflict is returned.
+func (postService *DBPostService) Create(ctx context.Context, post models.Post, mediaIds []int) (int, error) {
+	ctx, span := tracing.Start(ctx, "PostService.Create")
+	defer span.End()
+	err := postService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		return attachMedia(tx, post.Id, post.UserId, mediaIds)
+	})
+	if err != nil {
+		return 0, err
 	}
 	return post.Id, nil
 }
 
-func (postService *DBPostService) DeleteById(id int) error {
-	result := postService.db.Delete(&models.Post{}, id)
+func (postService *DBPostService) DeleteById(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "PostService.DeleteById")
+	defer span.End()
+	result := postService.db.WithContext(ctx).Delete(&models.Post{}, id)
 	if result.Error != nil {
 		return result.Error
 	}
 	return nil
 }
+
+// ListArchivedByUserId lists the posts the user has hidden from their profile
+// and the feed.
+func (postService *DBPostService) ListArchivedByUserId(ctx context.Context, userId int, pageNum string, pageSize string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+	ctx, span := tracing.Start(ctx, "PostService.ListArchivedByUserId")
+	defer span.End()
+	pageNumInt, err := strconv.Atoi(pageNum)
+	if err != nil {
+		pageNumInt = 1
+	}
+	pageSizeInt, err := strconv.Atoi(pageSize)
+	if err != nil {
+		pageSizeInt = 10
+	}
+	offset := (pageNumInt - 1) * pageSizeInt
+
+	query := postService.db.WithContext(ctx).Model(&models.Post{}).
+		Where("user_id = ? AND is_archived = true", userId).Session(&gorm.Session{})
+	var totalCount int64
+	if err := query.Count(&totalCount).Error; err != nil {
+		return nil, nil, utils.PageResponse{}, err
+	}
+	var posts []models.Post
+	if err := query.Order("created_at desc").Offset(offset).Limit(pageSizeInt).Find(&posts).Error; err != nil {
+		return nil, nil, utils.PageResponse{}, err
+	}
+	mediaMap := mediaByPostId(postService.db.WithContext(ctx), posts)
+	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
+	pageResponse := utils.PageResponse{
+		PageNum:      pageNumInt,
+		PageSize:     pageSizeInt,
+		TotalPages:   totalPages,
+		TotalRecords: int(totalCount),
+	}
+	return posts, mediaMap, pageResponse, nil
+}
+
+func (postService *DBPostService) UpdateArchived(ctx context.Context, postId int, archived bool) error {
+	ctx, span := tracing.Start(ctx, "PostService.UpdateArchived")
+	defer span.End()
+	return postService.db.WithContext(ctx).Model(&models.Post{}).Where("id = ?", postId).Update("is_archived", archived).Error
+}
+
+// ListDeletedByUserId lists the user's trash, most recently deleted first.
+func (postService *DBPostService) ListDeletedByUserId(ctx context.Context, userId int, pageNum string, pageSize string) ([]models.Post, map[int][]models.Media, utils.PageResponse, error) {
+	ctx, span := tracing.Start(ctx, "PostService.ListDeletedByUserId")
+	defer span.End()
+	pageNumInt, err := strconv.Atoi(pageNum)
+	if err != nil {
+		pageNumInt = 1
+	}
+	pageSizeInt, err := strconv.Atoi(pageSize)
+	if err != nil {
+		pageSizeInt = 10
+	}
+	offset := (pageNumInt - 1) * pageSizeInt
+
+	query := postService.db.WithContext(ctx).Unscoped().Model(&models.Post{}).
+		Where("user_id = ? AND deleted_at IS NOT NULL", userId).Session(&gorm.Session{})
+	var totalCount int64
+	if err := query.Count(&totalCount).Error; err != nil {
+		return nil, nil, utils.PageResponse{}, err
+	}
+	var posts []models.Post
+	if err := query.Order("deleted_at desc").Offset(offset).Limit(pageSizeInt).Find(&posts).Error; err != nil {
+		return nil, nil, utils.PageResponse{}, err
+	}
+	mediaMap := mediaByPostId(postService.db.WithContext(ctx), posts)
+	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
+	pageResponse := utils.PageResponse{
+		PageNum:      pageNumInt,
+		PageSize:     pageSizeInt,
+		TotalPages:   totalPages,
+		TotalRecords: int(totalCount),
+	}
+	return posts, mediaMap, pageResponse, nil
+}
+
+func (postService *DBPostService) GetDeletedById(ctx context.Context, postId int) (models.Post, error) {
+	ctx, span := tracing.Start(ctx, "PostService.GetDeletedById")
+	defer span.End()
+	var post models.Post
+	err := postService.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").First(&post, postId).Error
+	return post, err
+}
+
+func (postService *DBPostService) RestoreById(ctx context.Context, postId int) error {
+	ctx, span := tracing.Start(ctx, "PostService.RestoreById")
+	defer span.End()
+	return postService.db.WithContext(ctx).Unscoped().Model(&models.Post{}).Where("id = ?", postId).Update("deleted_at", nil).Error
+}
+
+// PurgeDeletedBefore hard-deletes posts trashed before cutoff. Their likes,
+// comments and media rows go with them through ON DELETE CASCADE; the media is
+// returned so the caller can remove the uploaded files.
+func (postService *DBPostService) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) ([]models.Media, error) {
+	ctx, span := tracing.Start(ctx, "PostService.PurgeDeletedBefore")
+	defer span.End()
+	var media []models.Media
+	err := postService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expiredPostIds := tx.Unscoped().Model(&models.Post{}).Select("id").Where("deleted_at < ?", cutoff)
+		if err := tx.Where("post_id IN (?)", expiredPostIds).Find(&media).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("deleted_at < ?", cutoff).Delete(&models.Post{}).Error
+	})
+	return media, err
+}
+
+// visibleUserIds returns the ids of the authors whose posts userId is allowed
+// to see: the user themselves, everyone they follow and every public user.
+// Shadow-banned authors are only visible to themselves.
+func visibleUserIds(db *gorm.DB, userId int) []int {
+	ctx, span := tracing.Start(db.Statement.Context, "visibleUserIds")
+	defer span.End()
+	db = db.WithContext(ctx)
+	filterUserIds := []int{userId}
+	var followingUsers []models.Follow
+	db.Where("follower_id = ? AND user_id NOT IN (?)", userId, shadowBannedUserIds(db)).Find(&followingUsers)
+	for _, followingUser := range followingUsers {
+		filterUserIds = append(filterUserIds, followingUser.UserId)
+	}
+	return append(filterUserIds, publicUserIds(db)...)
+}
+
+// publicUserIds returns the ids of the users whose posts anyone may see.
+func publicUserIds(db *gorm.DB) []int {
+	ctx, span := tracing.Start(db.Statement.Context, "publicUserIds")
+	defer span.End()
+	db = db.WithContext(ctx)
+	filterUserIds := []int{}
+	var publicUsers []models.User
+	db.Where("is_private=false AND status <> ?", models.UserStatusShadowBanned).Find(&publicUsers)
+	for _, publicUser := range publicUsers {
+		filterUserIds = append(filterUserIds, publicUser.Id)
+	}
+	return filterUserIds
+}
+
+// shadowBannedUserIds is a subquery selecting the shadow-banned users.
+func shadowBannedUserIds(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.User{}).Select("id").Where("status = ?", models.UserStatusShadowBanned)
+}
+
+// mediaByPostId loads the media of the given posts grouped by post id.
+func mediaByPostId(db *gorm.DB, posts []models.Post) map[int][]models.Media {
+	ctx, span := tracing.Start(db.Statement.Context, "mediaByPostId")
+	defer span.End()
+	db = db.WithContext(ctx)
+	var postIds []int
+	for _, post := range posts {
+		postIds = append(postIds, post.Id)
+	}
+	mediaMap := make(map[int][]models.Media)
+	if len(postIds) > 0 {
+		var media []models.Media
+		db.Where("post_id IN ?", postIds).Order("id").Find(&media)
+		for _, m := range media {
+			mediaMap[m.PostId] = append(mediaMap[m.PostId], m)
+		}
+	}
+	return mediaMap
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/tracing"
+	"github.com/ChenSongJian/ginstagram/utils"
+	"gorm.io/gorm"
+)
+
+type ReportService interface {
+	List(ctx context.Context, status string, pageNum string, pageSize string) ([]models.Report, utils.PageResponse, error)
+	GetById(ctx context.Context, reportId int) (models.Report, error)
+	Create(ctx context.Context, report models.Report) error
+	Resolve(ctx context.Context, report models.Report, moderatorId int, action string, note string, suspendedUntil *time.Time) error
+	ListActions(ctx context.Context, targetType string, targetId int) ([]models.ModerationAction, error)
+	RecordAction(ctx context.Context, action models.ModerationAction) error
+}
+
+type DBReportService struct {
+	db *gorm.DB
+}
+
+func NewDBReportService(db *gorm.DB) *DBReportService {
+	return &DBReportService{db: translateErrors(db)}
+}
+
+// List returns the moderation queue, oldest reports first so nothing starves.
+func (reportService *DBReportService) List(ctx context.Context, status string, pageNum string, pageSize string) ([]models.Report, utils.PageResponse, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.List")
+	defer span.End()
+	pageNumInt, err := strconv.Atoi(pageNum)
+	if err != nil {
+		pageNumInt = 1
+	}
+	pageSizeInt, err := strconv.Atoi(pageSize)
+	if err != nil {
+		pageSizeInt = 10
+	}
+	offset := (pageNumInt - 1) * pageSizeInt
+
+	var reports []models.Report
+	query := reportService.db.WithContext(ctx).Model(&models.Report{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query = query.Session(&gorm.Session{})
+	var totalCount int64
+	if err := query.Count(&totalCount).Error; err != nil {
+		return reports, utils.PageResponse{}, err
+	}
+	if err := query.Order("created_at asc").Offset(offset).Limit(pageSizeInt).Find(&reports).Error; err != nil {
+		return reports, utils.PageResponse{}, err
+	}
+	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
+	pageResponse := utils.PageResponse{
+		PageNum:      pageNumInt,
+		PageSize:     pageSizeInt,
+		TotalPages:   totalPages,
+		TotalRecords: int(totalCount),
+	}
+	return reports, pageResponse, nil
+}
+
+func (reportService *DBReportService) GetById(ctx context.Context, reportId int) (models.Report, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.GetById")
+	defer span.End()
+	var report models.Report
+	err := reportService.db.WithContext(ctx).First(&report, reportId).Error
+	return report, err
+}
+
+// Create files the report and records it in the audit trail.
+func (reportService *DBReportService) Create(ctx context.Context, report models.Report) error {
+	ctx, span := tracing.Start(ctx, "ReportService.Create")
+	defer span.End()
+	report.Status = models.ReportStatusOpen
+	return reportService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&report).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ModerationAction{
+			ReportId:    report.Id,
+			ModeratorId: report.ReporterId,
+			TargetType:  report.TargetType,
+			TargetId:    report.TargetId,
+			Action:      models.ModerationActionReport,
+			Note:        report.Reason,
+		}).Error
+	})
+}
+
+// Resolve carries out the moderator's decision on the target of the report,
+// closes the report and records the decision in the audit trail, all or
+// nothing. Removing content deletes the reported post or comment, suspending
+// suspends whoever is responsible for the target until suspendedUntil. Acting
+// on the content closes every other open report on the same target as well,
+// since they have all been dealt with.
+func (reportService *DBReportService) Resolve(ctx context.Context, report models.Report, moderatorId int, action string, note string, suspendedUntil *time.Time) error {
+	ctx, span := tracing.Start(ctx, "ReportService.Resolve")
+	defer span.End()
+	return reportService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		switch action {
+		case models.ModerationActionRemoveContent:
+			if err := removeTarget(tx, report); err != nil {
+				return err
+			}
+		case models.ModerationActionSuspendUser:
+			ownerId, err := targetOwnerId(tx, report)
+			if err != nil {
+				return err
+			}
+			result := tx.Model(&models.User{}).Where("id = ?", ownerId).Updates(map[string]interface{}{
+				"status":          models.UserStatusSuspended,
+				"status_reason":   note,
+				"suspended_until": suspendedUntil,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return TranslateError(gorm.ErrRecordNotFound)
+			}
+		}
+
+		query := tx.Model(&models.Report{})
+		status := models.ReportStatusActioned
+		if action == models.ModerationActionDismiss {
+			status = models.ReportStatusDismissed
+			query = query.Where("id = ?", report.Id)
+		} else {
+			query = query.Where("target_type = ? AND target_id = ? AND status = ?",
+				report.TargetType, report.TargetId, models.ReportStatusOpen)
+		}
+		if err := query.Update("status", status).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ModerationAction{
+			ReportId:    report.Id,
+			ModeratorId: moderatorId,
+			TargetType:  report.TargetType,
+			TargetId:    report.TargetId,
+			Action:      action,
+			Note:        note,
+		}).Error
+	})
+}
+
+// removeTarget deletes the post or comment a report is about. A post is
+// deleted for good rather than moved to the trash, where its author could
+// restore it; its media rows go with it and the orphan reaper removes the
+// files.
+func removeTarget(tx *gorm.DB, report models.Report) error {
+	switch report.TargetType {
+	case models.ReportTargetPost:
+		return tx.Unscoped().Delete(&models.Post{}, report.TargetId).Error
+	case models.ReportTargetComment:
+		return tx.Delete(&models.Comment{}, report.TargetId).Error
+	default:
+		return &Error{Kind: ErrValidation, Err: errors.New("can not remove a user, suspend instead")}
+	}
+}
+
+// targetOwnerId returns the id of the user responsible for what a report is
+// about.
+func targetOwnerId(tx *gorm.DB, report models.Report) (int, error) {
+	var ownerId int
+	var err error
+	switch report.TargetType {
+	case models.ReportTargetPost:
+		err = tx.Model(&models.Post{}).Where("id = ?", report.TargetId).Select("user_id").Take(&ownerId).Error
+	case models.ReportTargetComment:
+		err = tx.Model(&models.Comment{}).Where("id = ?", report.TargetId).Select("user_id").Take(&ownerId).Error
+	default:
+		err = tx.Model(&models.User{}).Where("id = ?", report.TargetId).Select("id").Take(&ownerId).Error
+	}
+	return ownerId, err
+}
+
+func (reportService *DBReportService) ListActions(ctx context.Context, targetType string, targetId int) ([]models.ModerationAction, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.ListActions")
+	defer span.End()
+	var actions = make([]models.ModerationAction, 0)
+	query := reportService.db.WithContext(ctx).Model(&models.ModerationAction{})
+	if targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetId != 0 {
+		query = query.Where("target_id = ?", targetId)
+	}
+	err := query.Order("created_at desc").Find(&actions).Error
+	return actions, err
+}
+
+func (reportService *DBReportService) RecordAction(ctx context.Context, action models.ModerationAction) error {
+	ctx, span := tracing.Start(ctx, "ReportService.RecordAction")
+	defer span.End()
+	return reportService.db.WithContext(ctx).Create(&action).Error
+}
@@ -0,0 +1,180 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/db"
+	"github.com/ChenSongJian/ginstagram/migrations"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	database, err := db.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := migrations.Embedded("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.NewMigrator(database, embedded).Up(0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := database.DB()
+		sqlDB.Close()
+	})
+	return database
+}
+
+func createUser(t *testing.T, userService services.UserService, email string) models.User {
+	if err := userService.Create(context.Background(), models.User{Username: email, PasswordHash: "hash", Email: email}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := userService.GetByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func expectError(t *testing.T, err error, expected string) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected an error containing %s, got %v", expected, err)
+	}
+}
+
+func TestConstraintErrors(t *testing.T) {
+	database := newTestDB(t)
+	userService := services.NewDBUserService(database)
+	followService := services.NewDBFollowService(database)
+	postService := services.NewDBPostService(database)
+	likeService := services.NewDBLikeService(database)
+	bookmarkService := services.NewDBBookmarkService(database)
+
+	user := createUser(t, userService, "user@test.com")
+	postId, err := postService.Create(context.Background(), models.Post{Title: "title", UserId: user.Id}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = userService.Create(context.Background(), models.User{Username: "other", PasswordHash: "hash", Email: "user@test.com"})
+	expectError(t, err, `duplicate key value violates unique constraint "users_email_key"`)
+
+	if err := likeService.CreatePostLike(context.Background(), postId, user.Id); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, likeService.CreatePostLike(context.Background(), postId, user.Id), `violates unique constraint "unique_post_user_pair"`)
+	expectError(t, likeService.CreatePostLike(context.Background(), postId, 404), `violates foreign key constraint "post_likes_user_id_fkey"`)
+
+	expectError(t, followService.Create(context.Background(), user.Id, user.Id), `violates check constraint "different_user_and_follower"`)
+	expectError(t, followService.Create(context.Background(), user.Id, 404), `violates foreign key constraint "fk_user"`)
+
+	expectError(t, bookmarkService.Create(context.Background(), user.Id, postId, 404), `violates foreign key constraint "bookmarks_collection_id_fkey"`)
+	if err := bookmarkService.CreateCollection(context.Background(), user.Id, "saved"); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, bookmarkService.CreateCollection(context.Background(), user.Id, "saved"), `violates unique constraint "unique_user_collection_name"`)
+}
+
+func TestPostService_ListKeyword(t *testing.T) {
+	database := newTestDB(t)
+	userService := services.NewDBUserService(database)
+	postService := services.NewDBPostService(database)
+
+	user := createUser(t, userService, "user@test.com")
+	for _, title := range []string{"hello world", "goodbye"} {
+		if _, err := postService.Create(context.Background(), models.Post{Title: title, UserId: user.Id}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := map[string]int{"": 2, "world": 1, "o": 2, "World": 0}
+	for keyword, expected := range testCases {
+		posts, _, page, err := postService.List(context.Background(), "1", "10", keyword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != expected || page.TotalRecords != expected {
+			t.Errorf("keyword %q: expected %d posts, got %d of %d", keyword, expected, len(posts), page.TotalRecords)
+		}
+	}
+}
+
+func TestMediaService_UsageByUserId(t *testing.T) {
+	database := newTestDB(t)
+	userService := services.NewDBUserService(database)
+	mediaService := services.NewDBMediaService(database)
+
+	user := createUser(t, userService, "user@test.com")
+	// the first two uploads are identical and share one blob
+	for _, media := range []models.Media{{Sha256: strings.Repeat("a", 64), Size: 100}, {Sha256: strings.Repeat("a", 64), Size: 100},
+		{Sha256: strings.Repeat("b", 64), Size: 250}} {
+		_, err := mediaService.Create(context.Background(), models.Media{UserId: user.Id, Url: "uploads/a.png", ContentType: "image/png",
+			Size: media.Size, Sha256: media.Sha256, Status: models.MediaStatusReady})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage, err := mediaService.UsageByUserId(context.Background(), user.Id, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.StoredBytes != 350 || usage.MediaCount != 3 || usage.RecentUploads != 3 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+	if time.Since(usage.OldestRecentUpload) > time.Minute {
+		t.Errorf("Expected the oldest recent upload to be just now, got %v", usage.OldestRecentUpload)
+	}
+
+	usage, err = mediaService.UsageByUserId(context.Background(), user.Id, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.RecentUploads != 0 || !usage.OldestRecentUpload.IsZero() {
+		t.Errorf("Expected no recent uploads, got %+v", usage)
+	}
+}
+
+func TestTranslateError(t *testing.T) {
+	database := newTestDB(t)
+	userService := services.NewDBUserService(database)
+	followService := services.NewDBFollowService(database)
+
+	user := createUser(t, userService, "user@test.com")
+	testCases := []struct {
+		name       string
+		err        error
+		kind       error
+		constraint string
+	}{
+		{"missing record", func() error { _, err := userService.GetById(context.Background(), 404); return err }(), services.ErrNotFound, ""},
+		{"unique", userService.Create(context.Background(), models.User{Username: "other", PasswordHash: "hash", Email: "user@test.com"}), services.ErrConflict, "users_email_key"},
+		{"foreign key", followService.Create(context.Background(), user.Id, 404), services.ErrNotFound, "fk_user"},
+		{"check", followService.Create(context.Background(), user.Id, user.Id), services.ErrValidation, "different_user_and_follower"},
+		{"postgres unique", services.TranslateError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}), services.ErrConflict, "users_email_key"},
+		{"postgres malformed", services.TranslateError(&pgconn.PgError{Code: "22P02"}), services.ErrValidation, ""},
+	}
+	for _, testCase := range testCases {
+		if !errors.Is(testCase.err, testCase.kind) {
+			t.Errorf("%s: expected %v to be %v", testCase.name, testCase.err, testCase.kind)
+		}
+		if testCase.constraint != "" && !services.IsConstraint(testCase.err, testCase.constraint) {
+			t.Errorf("%s: expected %v to break %s", testCase.name, testCase.err, testCase.constraint)
+		}
+	}
+
+	other := errors.New("connection refused")
+	if services.TranslateError(other) != other {
+		t.Error("Expected errors of no known kind to be left as they are")
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/tracing"
+	"gorm.io/gorm"
+)
+
+// UploadSessionTTL is how long a resumable upload may take before it expires.
+const UploadSessionTTL = 24 * time.Hour
+
+type UploadSessionService interface {
+	Create(ctx context.Context, session models.UploadSession) error
+	GetById(ctx context.Context, id string) (models.UploadSession, error)
+	UpdateOffset(ctx context.Context, id string, from int64, to int64) error
+	UpdateStatus(ctx context.Context, id string, from string, to string) error
+	DeleteById(ctx context.Context, id string) error
+	SumPendingByUserId(ctx context.Context, userId int, now time.Time) (int64, int64, error)
+	ListExpiredBefore(ctx context.Context, cutoff time.Time) ([]models.UploadSession, error)
+}
+
+type DBUploadSessionService struct {
+	db *gorm.DB
+}
+
+func NewDBUploadSessionService(db *gorm.DB) *DBUploadSessionService {
+	return &DBUploadSessionService{db: translateErrors(db)}
+}
+
+func (uploadSessionService *DBUploadSessionService) Create(ctx context.Context, session models.UploadSession) error {
+	ctx, span := tracing.Start(ctx, "UploadSessionService.Create")
+	defer span.End()
+	return uploadSessionService.db.WithContext(ctx).Create(&session).Error
+}
+
+func (uploadSessionService *DBUploadSessionService) GetById(ctx context.Context, id string) (models.UploadSession, error) {
+	ctx, span := tracing.Start(ctx, "UploadSessionService.GetById")
+	defer span.End()
+	var session models.UploadSession
+	err := uploadSessionService.db.WithContext(ctx).Where("id = ?", id).First(&session).Error
+	return session, err
+}
+
+// UpdateOffset moves the offset of an upload forward, provided it is still at
+// from, so that of two requests writing the same chunk only one wins.
+func (uploadSessionService *DBUploadSessionService) UpdateOffset(ctx context.Context, id string, from int64, to int64) error {
+	ctx, span := tracing.Start(ctx, "UploadSessionService.UpdateOffset")
+	defer span.End()
+	result := uploadSessionService.db.WithContext(ctx).Model(&models.UploadSession{}).
+		Where("id = ? AND \"offset\" = ?", id, from).Update("offset", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return TranslateError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// UpdateStatus moves an upload from one status to another, provided it is
+// still in from, so that of two requests finalizing an upload only one wins.
+// The loser gets an ErrConflict.
+func (uploadSessionService *DBUploadSessionService) UpdateStatus(ctx context.Context, id string, from string, to string) error {
+	ctx, span := tracing.Start(ctx, "UploadSessionService.UpdateStatus")
+	defer span.End()
+	result := uploadSessionService.db.WithContext(ctx).Model(&models.UploadSession{}).
+		Where("id = ? AND status = ?", id, from).Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &Error{Kind: ErrConflict, Err: errors.New("upload is not " + from)}
+	}
+	return nil
+}
+
+func (uploadSessionService *DBUploadSessionService) DeleteById(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "UploadSessionService.DeleteById")
+	defer span.End()
+	return uploadSessionService.db.WithContext(ctx).Where("id = ?", id).Delete(&models.UploadSession{}).Error
+}
+
+// SumPendingByUserId returns how many uploads of the user have not expired or
+// been finalized yet, and their declared size in total.
+func (uploadSessionService *DBUploadSessionService) SumPendingByUserId(ctx context.Context, userId int, now time.Time) (int64, int64, error) {
+	ctx, span := tracing.Start(ctx, "UploadSessionService.SumPendingByUserId")
+	defer span.End()
+	var result struct {
+		Count int64
+		Total int64
+	}
+	err := uploadSessionService.db.WithContext(ctx).Model(&models.UploadSession{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS total").
+		Where("user_id = ? AND expires_at > ?", userId, now).Scan(&result).Error
+	return result.Count, result.Total, err
+}
+
+func (uploadSessionService *DBUploadSessionService) ListExpiredBefore(ctx context.Context, cutoff time.Time) ([]models.UploadSession, error) {
+	ctx, span := tracing.Start(ctx, "UploadSessionService.ListExpiredBefore")
+	defer span.End()
+	var sessions = make([]models.UploadSession, 0)
+	err := uploadSessionService.db.WithContext(ctx).Where("expires_at <= ?", cutoff).Find(&sessions).Error
+	return sessions, err
+}
@@ -1,39 +1,50 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"strconv"
+	"time"
 
-	"github.com/ChenSongJian/ginstagram/db"
 	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/tracing"
 	"github.com/ChenSongJian/ginstagram/utils"
 	"gorm.io/gorm"
 )
 
 type UserService interface {
-	Create(user models.User) error
-	List(pageNum string, pageSize string, keyword string) ([]models.User, utils.PageResponse, error)
-	GetById(userId int) (models.User, error)
-	GetByEmail(email string) (models.User, error)
-	UpdateByModel(user models.User) error
-	DeleteById(userId int) error
+	Create(ctx context.Context, user models.User) error
+	List(ctx context.Context, pageNum string, pageSize string, keyword string) ([]models.User, utils.PageResponse, error)
+	GetById(ctx context.Context, userId int) (models.User, error)
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	UpdateByModel(ctx context.Context, user models.User) error
+	DeleteById(ctx context.Context, userId int) error
+	UpdateStatus(ctx context.Context, userId int, status string, reason string, suspendedUntil *time.Time) error
+	GetDeletedByEmail(ctx context.Context, email string) (models.User, error)
+	RestoreById(ctx context.Context, userId int) error
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time) ([]models.Media, error)
 }
 
 type DBUserService struct {
 	db *gorm.DB
 }
 
-func NewDBUserService() *DBUserService {
-	return &DBUserService{db: db.DB}
+func NewDBUserService(db *gorm.DB) *DBUserService {
+	return &DBUserService{db: translateErrors(db)}
 }
 
-func (userService DBUserService) Create(user models.User) error {
-	result := userService.db.Create(&user)
+func (userService DBUserService) Create(ctx context.Context, user models.User) error {
+	ctx, span := tracing.Start(ctx, "UserService.Create")
+	defer span.End()
+	user.Status = models.UserStatusActive
+	result := userService.db.WithContext(ctx).Create(&user)
 	return result.Error
 }
 
-func (userService DBUserService) List(pageNum string, pageSize string, keyword string) ([]models.User, utils.PageResponse, error) {
+func (userService DBUserService) List(ctx context.Context, pageNum string, pageSize string, keyword string) ([]models.User, utils.PageResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.List")
+	defer span.End()
 	var users []models.User
 	pageNumInt, err := strconv.Atoi(pageNum)
 	if err != nil {
@@ -46,13 +57,16 @@ func (userService DBUserService) List(pageNum string, pageSize string, keyword s
 	offset := (pageNumInt - 1) * pageSizeInt
 
 	var totalCount int64
-	query := userService.db.Model(&models.User{})
+	query := userService.db.WithContext(ctx).Model(&models.User{})
 	if keyword != "" {
 		query = query.Where("username LIKE ? OR bio LIKE ?", fmt.Sprintf("%%%s%%", keyword), fmt.Sprintf("%%%s%%", keyword))
 	}
-	query.Count(&totalCount)
+	query = query.Session(&gorm.Session{})
+	if err := query.Count(&totalCount).Error; err != nil {
+		return users, utils.PageResponse{}, err
+	}
 	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSizeInt)))
-	if err := query.Limit(pageSizeInt).Offset(offset).Find(&users).Error; err != nil {
+	if err := query.Order("id").Limit(pageSizeInt).Offset(offset).Find(&users).Error; err != nil {
 		return users, utils.PageResponse{}, err
 	}
 
@@ -65,34 +79,117 @@ func (userService DBUserService) List(pageNum string, pageSize string, keyword s
 	return users, pageResponse, nil
 }
 
-func (userService DBUserService) GetById(userId int) (models.User, error) {
+func (userService DBUserService) GetById(ctx context.Context, userId int) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetById")
+	defer span.End()
 	var user models.User
-	result := userService.db.First(&user, userId)
+	result := userService.db.WithContext(ctx).First(&user, userId)
 	return user, result.Error
 }
 
-func (userService DBUserService) GetByEmail(email string) (models.User, error) {
+func (userService DBUserService) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByEmail")
+	defer span.End()
 	var user models.User
-	result := userService.db.Where("email = ?", email).First(&user)
+	result := userService.db.WithContext(ctx).Where("email = ?", email).First(&user)
 	return user, result.Error
 }
 
-func (userService DBUserService) UpdateByModel(modelUser models.User) error {
+func (userService DBUserService) UpdateByModel(ctx context.Context, modelUser models.User) error {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateByModel")
+	defer span.End()
 	var user models.User
-	result := userService.db.First(&user, modelUser.Id)
+	result := userService.db.WithContext(ctx).First(&user, modelUser.Id)
 	if result.Error != nil {
 		return result.Error
 	}
-	result = userService.db.Save(&modelUser)
+	// moderation fields are never taken from the caller's model
+	result = userService.db.WithContext(ctx).Omit("IsModerator", "Status", "StatusReason", "SuspendedUntil").Save(&modelUser)
 	return result.Error
 }
 
-func (userService DBUserService) DeleteById(userId int) error {
+// DeleteById moves the account to the trash together with the posts and
+// comments still live under it. They share one deleted_at so that restoring the
+// account brings back exactly what was trashed with it.
+func (userService DBUserService) DeleteById(ctx context.Context, userId int) error {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteById")
+	defer span.End()
 	var user models.User
-	result := userService.db.First(&user, userId)
+	result := userService.db.WithContext(ctx).First(&user, userId)
 	if result.Error != nil {
 		return result.Error
 	}
-	result = userService.db.Delete(&user)
-	return result.Error
+	deletedAt := time.Now()
+	return userService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Post{}).Where("user_id = ?", userId).Update("deleted_at", deletedAt).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Comment{}).Where("user_id = ?", userId).Update("deleted_at", deletedAt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("deleted_at", deletedAt).Error
+	})
+}
+
+func (userService DBUserService) UpdateStatus(ctx context.Context, userId int, status string, reason string, suspendedUntil *time.Time) error {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateStatus")
+	defer span.End()
+	result := userService.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+		"status":          status,
+		"status_reason":   reason,
+		"suspended_until": suspendedUntil,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return TranslateError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (userService DBUserService) GetDeletedByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetDeletedByEmail")
+	defer span.End()
+	var user models.User
+	result := userService.db.WithContext(ctx).Unscoped().Where("email = ? AND deleted_at IS NOT NULL", email).First(&user)
+	return user, result.Error
+}
+
+func (userService DBUserService) RestoreById(ctx context.Context, userId int) error {
+	ctx, span := tracing.Start(ctx, "UserService.RestoreById")
+	defer span.End()
+	var user models.User
+	result := userService.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").First(&user, userId)
+	if result.Error != nil {
+		return result.Error
+	}
+	return userService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Post{}).Where("user_id = ? AND deleted_at = ?", userId, user.DeletedAt.Time).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Comment{}).Where("user_id = ? AND deleted_at = ?", userId, user.DeletedAt.Time).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&user).Update("deleted_at", nil).Error
+	})
+}
+
+// PurgeDeletedBefore hard-deletes accounts trashed before cutoff, which
+// cascades to the media they uploaded, and returns that media so the caller
+// can remove its files.
+func (userService DBUserService) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) ([]models.Media, error) {
+	ctx, span := tracing.Start(ctx, "UserService.PurgeDeletedBefore")
+	defer span.End()
+	var media []models.Media
+	err := userService.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expiredUserIds := tx.Unscoped().Model(&models.User{}).Select("id").Where("deleted_at < ?", cutoff)
+		if err := tx.Where("user_id IN (?)", expiredUserIds).Find(&media).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("deleted_at < ?", cutoff).Delete(&models.User{}).Error
+	})
+	return media, err
 }
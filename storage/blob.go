@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Uploads are stored content-addressed: a blob lives under a key made of its
+// sha256, and whatever is derived from it, such as image sizes or video
+// renditions, under keys that start the same way.
+const blobPrefix = UploadPrefix + "sha256/"
+
+func init() {
+	// not in every system's mime table, and needed to serve HLS
+	mime.AddExtensionType(".m3u8", "application/vnd.apple.mpegurl")
+	mime.AddExtensionType(".ts", "video/mp2t")
+}
+
+// BlobKey is where content with the given sha256 is stored.
+func BlobKey(sha256 string, ext string) string {
+	return fmt.Sprintf("%s%s/%s.%s", blobPrefix, sha256[:2], sha256, ext)
+}
+
+// BlobPrefix is the prefix shared by a blob and everything derived from it.
+func BlobPrefix(sha256 string) string {
+	return fmt.Sprintf("%s%s/%s", blobPrefix, sha256[:2], sha256)
+}
+
+// BlobSha256 returns the sha256 of the blob a key belongs to, if it is a
+// content-addressed key at all.
+func BlobSha256(key string) (string, bool) {
+	rest, found := strings.CutPrefix(key, blobPrefix)
+	if !found || len(rest) < 3+64 || rest[2] != '/' {
+		return "", false
+	}
+	sha256 := rest[3 : 3+64]
+	if sha256[:2] != rest[:2] || strings.Trim(sha256, "0123456789abcdef") != "" {
+		return "", false
+	}
+	return sha256, true
+}
@@ -0,0 +1,36 @@
+package storage_test
+
+import (
+	"mime"
+	"strings"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/storage"
+)
+
+func TestBlobSha256(t *testing.T) {
+	sha256 := strings.Repeat("ab", 32)
+	key := storage.BlobKey(sha256, "mp4")
+	if key != "uploads/sha256/ab/"+sha256+".mp4" {
+		t.Errorf("Unexpected blob key %s", key)
+	}
+	for _, derivedKey := range []string{key, storage.BlobPrefix(sha256) + "_poster.jpg", storage.BlobPrefix(sha256) + "_hls/720p/seg_001.ts"} {
+		if found, ok := storage.BlobSha256(derivedKey); !ok || found != sha256 {
+			t.Errorf("Expected %s to belong to blob %s, got %s", derivedKey, sha256, found)
+		}
+	}
+	for _, otherKey := range []string{"uploads/2024-01-02/photo.jpg", "uploads/sha256/cd/" + sha256 + ".mp4", "uploads/sha256/ab/short.mp4"} {
+		if _, ok := storage.BlobSha256(otherKey); ok {
+			t.Errorf("Expected %s not to be a blob key", otherKey)
+		}
+	}
+}
+
+func TestBlobMimeTypes(t *testing.T) {
+	if contentType := mime.TypeByExtension(".m3u8"); contentType != "application/vnd.apple.mpegurl" {
+		t.Errorf("Unexpected content type %s for .m3u8", contentType)
+	}
+	if contentType := mime.TypeByExtension(".ts"); contentType != "video/mp2t" {
+		t.Errorf("Unexpected content type %s for .ts", contentType)
+	}
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStorage keeps objects as files under root. Signed URLs point at baseURL
+// and carry an HMAC so the serving endpoint can check them with VerifySignature.
+type LocalStorage struct {
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocalStorage(root string, baseURL string, secret []byte) *LocalStorage {
+	return &LocalStorage{
+		root:    root,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		secret:  secret,
+	}
+}
+
+func (localStorage *LocalStorage) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(localStorage.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first so that readers never see a partial
+// object.
+func (localStorage *LocalStorage) Put(key string, r io.Reader, size int64, contentType string) error {
+	filePath, err := localStorage.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+func (localStorage *LocalStorage) Get(key string) (io.ReadSeekCloser, Object, error) {
+	filePath, err := localStorage.path(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, Object{}, ErrNotFound
+		}
+		return nil, Object{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, Object{}, err
+	}
+	return file, localObject(key, info), nil
+}
+
+// Delete succeeds when the object is already gone, like S3 does.
+func (localStorage *LocalStorage) Delete(key string) error {
+	filePath, err := localStorage.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (localStorage *LocalStorage) Stat(key string) (Object, error) {
+	filePath, err := localStorage.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Object{}, ErrNotFound
+		}
+		return Object{}, err
+	}
+	return localObject(key, info), nil
+}
+
+func (localStorage *LocalStorage) List(prefix string, fn func(Object) error) error {
+	root := filepath.Join(localStorage.root, filepath.FromSlash(path.Dir("/"+prefix)))
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		relative, err := filepath.Rel(localStorage.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(localObject(key, info))
+	})
+	return err
+}
+
+func (localStorage *LocalStorage) SignedURL(key string, expiry time.Duration) (string, error) {
+	if _, err := localStorage.path(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", localStorage.sign(key, expires))
+	return fmt.Sprintf("%s/%s?%s", localStorage.baseURL, key, query.Encode()), nil
+}
+
+// VerifySignature checks the expires and signature query parameters of a URL
+// made by SignedURL.
+func (localStorage *LocalStorage) VerifySignature(key string, expires string, signature string) bool {
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresUnix {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(localStorage.sign(key, expires)))
+}
+
+func (localStorage *LocalStorage) sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, localStorage.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func localObject(key string, info os.FileInfo) Object {
+	return Object{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ETag:        fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		ModTime:     info.ModTime(),
+	}
+}
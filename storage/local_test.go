@@ -0,0 +1,122 @@
+package storage_test
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/storage"
+)
+
+func TestLocalStorage_PutGetDelete(t *testing.T) {
+	localStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	key := "uploads/2024-01-02/photo.jpg"
+
+	if err := localStorage.Put(key, strings.NewReader("image data"), 10, "image/jpeg"); err != nil {
+		t.Fatalf("Error putting object: %v", err)
+	}
+
+	reader, object, err := localStorage.Get(key)
+	if err != nil {
+		t.Fatalf("Error getting object: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "image data" {
+		t.Errorf("Expected %q, got %q", "image data", string(data))
+	}
+	if object.Size != 10 || object.ContentType != "image/jpeg" || object.ETag == "" {
+		t.Errorf("Unexpected object info %+v", object)
+	}
+
+	if err := localStorage.Delete(key); err != nil {
+		t.Fatalf("Error deleting object: %v", err)
+	}
+	if _, err := localStorage.Stat(key); err != storage.ErrNotFound {
+		t.Errorf("Expected %v, got %v", storage.ErrNotFound, err)
+	}
+	if err := localStorage.Delete(key); err != nil {
+		t.Errorf("Expected deleting a missing object to succeed, got %v", err)
+	}
+}
+
+func TestLocalStorage_InvalidKey(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".env"), []byte("JWT_SECRET=secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	localStorage := storage.NewLocalStorage(root, "/media", []byte("secret"))
+	for _, key := range []string{"", "/etc/passwd", "../secret", "uploads/../../secret", "uploads//a.jpg",
+		".env", "ginstagram.db", "avatars/c.jpg", "uploads/../.env"} {
+		if err := localStorage.Put(key, strings.NewReader("x"), 1, ""); err != storage.ErrInvalidKey {
+			t.Errorf("Expected %v for key %q, got %v", storage.ErrInvalidKey, key, err)
+		}
+	}
+	if _, _, err := localStorage.Get(".env"); err != storage.ErrInvalidKey {
+		t.Errorf("Expected files outside the uploads to be out of reach, got %v", err)
+	}
+	if err := localStorage.Delete(".env"); err != storage.ErrInvalidKey {
+		t.Errorf("Expected files outside the uploads to be out of reach, got %v", err)
+	}
+}
+
+func TestLocalStorage_SignedURL(t *testing.T) {
+	localStorage := storage.NewLocalStorage(t.TempDir(), "/media/", []byte("secret"))
+	key := "uploads/2024-01-02/photo.jpg"
+
+	signedURL, err := localStorage.SignedURL(key, time.Minute)
+	if err != nil {
+		t.Fatalf("Error signing url: %v", err)
+	}
+	parsed, err := url.Parse(signedURL)
+	if err != nil {
+		t.Fatalf("Error parsing url: %v", err)
+	}
+	if parsed.Path != "/media/"+key {
+		t.Errorf("Expected path %s, got %s", "/media/"+key, parsed.Path)
+	}
+	expires := parsed.Query().Get("expires")
+	signature := parsed.Query().Get("signature")
+	if !localStorage.VerifySignature(key, expires, signature) {
+		t.Errorf("Expected signature to verify")
+	}
+	if localStorage.VerifySignature("uploads/2024-01-02/other.jpg", expires, signature) {
+		t.Errorf("Expected signature for another key to be rejected")
+	}
+
+	expiredURL, _ := localStorage.SignedURL(key, -time.Minute)
+	parsed, _ = url.Parse(expiredURL)
+	if localStorage.VerifySignature(key, parsed.Query().Get("expires"), parsed.Query().Get("signature")) {
+		t.Errorf("Expected expired signature to be rejected")
+	}
+}
+
+func TestLocalStorage_List(t *testing.T) {
+	localStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	for _, key := range []string{"uploads/2024-01-02/a.jpg", "uploads/2024-01-03/b.jpg", "uploads/avatars/c.jpg"} {
+		if err := localStorage.Put(key, strings.NewReader("data"), 4, "image/jpeg"); err != nil {
+			t.Fatalf("Error putting object: %v", err)
+		}
+	}
+
+	var keys []string
+	err := localStorage.List("uploads/2024-", func(object storage.Object) error {
+		keys = append(keys, object.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error listing objects: %v", err)
+	}
+	expectedKeys := []string{"uploads/2024-01-02/a.jpg", "uploads/2024-01-03/b.jpg"}
+	if strings.Join(keys, ",") != strings.Join(expectedKeys, ",") {
+		t.Errorf("Expected keys %v, got %v", expectedKeys, keys)
+	}
+
+	if err := localStorage.List("missing/", func(storage.Object) error { return nil }); err != nil {
+		t.Errorf("Expected listing a missing prefix to succeed, got %v", err)
+	}
+}
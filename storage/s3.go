@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Storage keeps objects in a bucket of any S3 compatible service, such as
+// AWS S3 or MinIO.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Storage(endpoint string, accessKey string, secretKey string, bucket string, region string, useSSL bool) (*S3Storage, error) {
+	if region == "" {
+		region = "us-east-1"
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+		Region: region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Storage{client: client, bucket: bucket}, nil
+}
+
+func (s3Storage *S3Storage) Put(key string, r io.Reader, size int64, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	_, err := s3Storage.client.PutObject(context.Background(), s3Storage.bucket, key, r, size,
+		minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s3Storage *S3Storage) Get(key string) (io.ReadSeekCloser, Object, error) {
+	if err := validateKey(key); err != nil {
+		return nil, Object{}, err
+	}
+	object, err := s3Storage.client.GetObject(context.Background(), s3Storage.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, Object{}, s3Error(err)
+	}
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, Object{}, s3Error(err)
+	}
+	return object, s3Object(info), nil
+}
+
+func (s3Storage *S3Storage) Delete(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	return s3Error(s3Storage.client.RemoveObject(context.Background(), s3Storage.bucket, key, minio.RemoveObjectOptions{}))
+}
+
+func (s3Storage *S3Storage) Stat(key string) (Object, error) {
+	if err := validateKey(key); err != nil {
+		return Object{}, err
+	}
+	info, err := s3Storage.client.StatObject(context.Background(), s3Storage.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return Object{}, s3Error(err)
+	}
+	return s3Object(info), nil
+}
+
+func (s3Storage *S3Storage) List(prefix string, fn func(Object) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for info := range s3Storage.client.ListObjects(ctx, s3Storage.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return info.Err
+		}
+		if err := fn(s3Object(info)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s3Storage *S3Storage) SignedURL(key string, expiry time.Duration) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	signedURL, err := s3Storage.client.PresignedGetObject(context.Background(), s3Storage.bucket, key, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return signedURL.String(), nil
+}
+
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	response := minio.ToErrorResponse(err)
+	if response.StatusCode == http.StatusNotFound || response.Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
+
+func s3Object(info minio.ObjectInfo) Object {
+	return Object{
+		Key:         info.Key,
+		Size:        info.Size,
+		ContentType: info.ContentType,
+		ETag:        strings.Trim(info.ETag, "\""),
+		ModTime:     info.LastModified,
+	}
+}
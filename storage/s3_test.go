@@ -0,0 +1,239 @@
+package storage_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/storage"
+)
+
+// fakeS3 is a minimal in-memory stand-in for MinIO that understands the
+// object calls the S3 backend makes, with path-style bucket addressing.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeS3Object
+}
+
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readS3Body(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fake.objects[key] = fakeS3Object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now()}
+		w.Header().Set("ETag", fakeETag(data))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		if r.URL.Query().Get("list-type") == "2" {
+			fake.list(w, strings.TrimSuffix(key, "/"), r.URL.Query().Get("prefix"))
+			return
+		}
+		object, ok := fake.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+			return
+		}
+		w.Header().Set("ETag", fakeETag(object.data))
+		w.Header().Set("Content-Type", object.contentType)
+		http.ServeContent(w, r, key, object.modTime, bytes.NewReader(object.data))
+	case http.MethodDelete:
+		delete(fake.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list answers a ListObjectsV2 request with every matching object in one page.
+func (fake *fakeS3) list(w http.ResponseWriter, bucket string, prefix string) {
+	type contents struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []contents
+	}{Name: bucket, Prefix: prefix}
+	keys := make([]string, 0, len(fake.objects))
+	for key := range fake.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		objectKey := strings.TrimPrefix(key, bucket+"/")
+		if !strings.HasPrefix(key, bucket+"/") || !strings.HasPrefix(objectKey, prefix) {
+			continue
+		}
+		object := fake.objects[key]
+		result.Contents = append(result.Contents, contents{
+			Key:          objectKey,
+			LastModified: object.modTime.UTC().Format(time.RFC3339),
+			ETag:         fakeETag(object.data),
+			Size:         len(object.data),
+		})
+	}
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// readS3Body decodes aws-chunked uploads, which the client uses over plain
+// http, and returns other bodies as they are.
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data []byte
+	reader := bufio.NewReader(r.Body)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(header), ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+func fakeETag(data []byte) string {
+	sum := md5.Sum(data)
+	return "\"" + hex.EncodeToString(sum[:]) + "\""
+}
+
+func newTestS3Storage(t *testing.T) *storage.S3Storage {
+	server := httptest.NewServer(&fakeS3{objects: map[string]fakeS3Object{}})
+	t.Cleanup(server.Close)
+	endpoint, _ := url.Parse(server.URL)
+	s3Storage, err := storage.NewS3Storage(endpoint.Host, "access", "secret", "media", "", false)
+	if err != nil {
+		t.Fatalf("Error creating s3 storage: %v", err)
+	}
+	return s3Storage
+}
+
+func TestS3Storage_PutGetDelete(t *testing.T) {
+	s3Storage := newTestS3Storage(t)
+	key := "uploads/2024-01-02/photo.jpg"
+
+	if err := s3Storage.Put(key, strings.NewReader("image data"), 10, "image/jpeg"); err != nil {
+		t.Fatalf("Error putting object: %v", err)
+	}
+
+	object, err := s3Storage.Stat(key)
+	if err != nil {
+		t.Fatalf("Error stating object: %v", err)
+	}
+	if object.Size != 10 || object.ContentType != "image/jpeg" || object.ETag == "" {
+		t.Errorf("Unexpected object info %+v", object)
+	}
+
+	reader, _, err := s3Storage.Get(key)
+	if err != nil {
+		t.Fatalf("Error getting object: %v", err)
+	}
+	if _, err := reader.Seek(6, io.SeekStart); err != nil {
+		t.Fatalf("Error seeking object: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "data" {
+		t.Errorf("Expected %q, got %q", "data", string(data))
+	}
+
+	if err := s3Storage.Delete(key); err != nil {
+		t.Fatalf("Error deleting object: %v", err)
+	}
+	if _, err := s3Storage.Stat(key); err != storage.ErrNotFound {
+		t.Errorf("Expected %v, got %v", storage.ErrNotFound, err)
+	}
+	if _, _, err := s3Storage.Get(key); err != storage.ErrNotFound {
+		t.Errorf("Expected %v, got %v", storage.ErrNotFound, err)
+	}
+}
+
+func TestS3Storage_SignedURL(t *testing.T) {
+	s3Storage := newTestS3Storage(t)
+	key := "uploads/2024-01-02/photo.jpg"
+
+	signedURL, err := s3Storage.SignedURL(key, time.Minute)
+	if err != nil {
+		t.Fatalf("Error signing url: %v", err)
+	}
+	parsed, err := url.Parse(signedURL)
+	if err != nil {
+		t.Fatalf("Error parsing url: %v", err)
+	}
+	if parsed.Path != "/media/"+key || parsed.Query().Get("X-Amz-Signature") == "" {
+		t.Errorf("Unexpected signed url %s", signedURL)
+	}
+	if _, err := s3Storage.SignedURL("../secret", time.Minute); err != storage.ErrInvalidKey {
+		t.Errorf("Expected %v, got %v", storage.ErrInvalidKey, err)
+	}
+}
+
+func TestS3Storage_List(t *testing.T) {
+	s3Storage := newTestS3Storage(t)
+	for _, key := range []string{"uploads/2024-01-02/a.jpg", "uploads/2024-01-03/b.jpg", "uploads/avatars/c.jpg"} {
+		if err := s3Storage.Put(key, strings.NewReader("data"), 4, "image/jpeg"); err != nil {
+			t.Fatalf("Error putting object: %v", err)
+		}
+	}
+
+	var keys []string
+	err := s3Storage.List("uploads/2024-", func(object storage.Object) error {
+		keys = append(keys, object.Key)
+		if object.Size != 4 {
+			t.Errorf("Expected size 4, got %d", object.Size)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error listing objects: %v", err)
+	}
+	expectedKeys := []string{"uploads/2024-01-02/a.jpg", "uploads/2024-01-03/b.jpg"}
+	if strings.Join(keys, ",") != strings.Join(expectedKeys, ",") {
+		t.Errorf("Expected keys %v, got %v", expectedKeys, keys)
+	}
+}
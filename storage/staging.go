@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StagingPrefix starts the keys of the chunks of resumable uploads, which are
+// staged in storage until the upload is finalized so that any instance can
+// take the next chunk. No media row refers to them.
+const StagingPrefix = UploadPrefix + "staging/"
+
+// Chunk is a staged chunk holding bytes [Start, End) of an upload.
+type Chunk struct {
+	Key   string
+	Start int64
+	End   int64
+}
+
+func stagingPrefix(uploadId string) string {
+	return StagingPrefix + uploadId + "/"
+}
+
+// StagingKey names a chunk holding bytes [start, end) of an upload. The nonce
+// keeps chunks written by concurrent requests for the same bytes apart.
+func StagingKey(uploadId string, start int64, end int64, nonce string) string {
+	return fmt.Sprintf("%s%020d-%020d-%s", stagingPrefix(uploadId), start, end, nonce)
+}
+
+// ListStaged lists the chunks staged for an upload in key order, which is the
+// order of their first byte.
+func ListStaged(s Storage, uploadId string) ([]Chunk, error) {
+	var chunks []Chunk
+	err := s.List(stagingPrefix(uploadId), func(object Object) error {
+		parts := strings.Split(strings.TrimPrefix(object.Key, stagingPrefix(uploadId)), "-")
+		if len(parts) != 3 {
+			return nil
+		}
+		start, startErr := strconv.ParseInt(parts[0], 10, 64)
+		end, endErr := strconv.ParseInt(parts[1], 10, 64)
+		if startErr == nil && endErr == nil && start < end {
+			chunks = append(chunks, Chunk{Key: object.Key, Start: start, End: end})
+		}
+		return nil
+	})
+	return chunks, err
+}
+
+// DeleteStaged removes every chunk staged for an upload.
+func DeleteStaged(s Storage, uploadId string) error {
+	var keys []string
+	err := s.List(stagingPrefix(uploadId), func(object Object) error {
+		keys = append(keys, object.Key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s.Delete(key); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
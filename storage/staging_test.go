@@ -0,0 +1,38 @@
+package storage_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/storage"
+)
+
+func TestStaging(t *testing.T) {
+	localStorage := storage.NewLocalStorage(t.TempDir(), "/media", []byte("secret"))
+	for _, key := range []string{storage.StagingKey("a", 10, 20, "n2"), storage.StagingKey("a", 0, 10, "n1"), storage.StagingKey("b", 0, 5, "n1")} {
+		if !storage.IsUploadKey(key) || !strings.HasPrefix(key, storage.StagingPrefix) {
+			t.Errorf("Expected %s to be a staging key", key)
+		}
+		if err := localStorage.Put(key, strings.NewReader("data"), 4, "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chunks, err := storage.ListStaged(localStorage, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 || chunks[0].Start != 0 || chunks[0].End != 10 || chunks[1].Start != 10 || chunks[1].End != 20 {
+		t.Errorf("Expected the chunks of upload a in order, got %+v", chunks)
+	}
+
+	if err := storage.DeleteStaged(localStorage, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if chunks, _ := storage.ListStaged(localStorage, "a"); len(chunks) != 0 {
+		t.Errorf("Expected the chunks of upload a to be removed, got %+v", chunks)
+	}
+	if chunks, _ := storage.ListStaged(localStorage, "b"); len(chunks) != 1 {
+		t.Errorf("Expected the chunks of upload b to be kept, got %+v", chunks)
+	}
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ChenSongJian/ginstagram/config"
+)
+
+// Object describes a stored file.
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// UploadPrefix starts the key of every uploaded file and of everything made
+// from one.
+const UploadPrefix = "uploads/"
+
+var ErrNotFound = errors.New("object not found")
+var ErrInvalidKey = errors.New("invalid object key")
+
+// Storage is where uploaded media lives. Keys are slash separated paths such
+// as "uploads/2024-01-02/<name>.jpg" and are what gets saved as a media url.
+type Storage interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadSeekCloser, Object, error)
+	Delete(key string) error
+	Stat(key string) (Object, error)
+	SignedURL(key string, expiry time.Duration) (string, error)
+	// List calls fn for every object whose key starts with prefix, stopping at
+	// the first error fn returns.
+	List(prefix string, fn func(Object) error) error
+}
+
+// SignatureVerifier is implemented by backends whose signed URLs point back at
+// the media endpoint instead of the backend itself.
+type SignatureVerifier interface {
+	VerifySignature(key string, expires string, signature string) bool
+}
+
+// validateKey rejects keys that are not in clean form or not under
+// UploadPrefix, so that no backend can be made to read or write anything but
+// uploads, whatever else shares its root.
+func validateKey(key string) error {
+	if !strings.HasPrefix(key, UploadPrefix) || strings.TrimPrefix(path.Clean("/"+key), "/") != key {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// IsUploadKey reports whether key is a valid key, that is one an uploaded
+// file or something made from one could be stored under.
+func IsUploadKey(key string) bool {
+	return validateKey(key) == nil
+}
+
+// New returns the configured backend.
+func New(cfg config.Storage) (Storage, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocalStorage(cfg.LocalRoot, cfg.BaseURL, []byte(cfg.SigningSecret)), nil
+	case "s3":
+		s3Storage, err := NewS3Storage(cfg.S3Endpoint, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Bucket, cfg.S3Region, cfg.S3UseSSL)
+		if err != nil {
+			return nil, err
+		}
+		return s3Storage, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "ginstagram:tracing_span"
+
+// GORMPlugin makes a span of every statement of a database, a child of the
+// span in the context of the statement. The SQL is recorded without its
+// parameters.
+type GORMPlugin struct{}
+
+func (GORMPlugin) Name() string {
+	return "ginstagram:tracing"
+}
+
+func (GORMPlugin) Initialize(database *gorm.DB) error {
+	type registerer interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}
+	callbacks := database.Callback()
+	for _, operation := range []struct {
+		name          string
+		before, after registerer
+	}{
+		{"create", callbacks.Create().Before("*"), callbacks.Create().After("*")},
+		{"query", callbacks.Query().Before("*"), callbacks.Query().After("*")},
+		{"update", callbacks.Update().Before("*"), callbacks.Update().After("*")},
+		{"delete", callbacks.Delete().Before("*"), callbacks.Delete().After("*")},
+		{"row", callbacks.Row().Before("*"), callbacks.Row().After("*")},
+		{"raw", callbacks.Raw().Before("*"), callbacks.Raw().After("*")},
+	} {
+		if err := operation.before.Register("ginstagram:tracing_start", startStatement(operation.name)); err != nil {
+			return err
+		}
+		if err := operation.after.Register("ginstagram:tracing_end", endStatement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startStatement(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		_, span := Start(tx.Statement.Context, "db."+operation,
+			semconv.DBSystemKey.String(tx.Dialector.Name()),
+			attribute.String("db.operation.name", operation),
+		)
+		tx.InstanceSet(spanKey, span)
+	}
+}
+
+func endStatement(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("db.query.text", tx.Statement.SQL.String()),
+		attribute.String("db.collection.name", tx.Statement.Table),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+}
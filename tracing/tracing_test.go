@@ -0,0 +1,43 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/config"
+	"github.com/ChenSongJian/ginstagram/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	shutdown, err := tracing.Setup(context.Background(), config.Tracing{Exporter: "none"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, span := tracing.Start(context.Background(), "unexported"); span.IsRecording() {
+		t.Error("Expected spans not to be recorded without an exporter")
+	}
+	shutdown(context.Background())
+
+	shutdown, err = tracing.Setup(context.Background(), config.Tracing{Exporter: "stdout", SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	_, child := tracing.Start(ctx, "child")
+	if !parent.IsRecording() || child.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Error("Expected spans to be recorded in one trace")
+	}
+	child.End()
+	parent.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected the spans to be flushed, got %v", err)
+	}
+
+	if _, err := tracing.Setup(context.Background(), config.Tracing{Exporter: "zipkin"}); err == nil {
+		t.Error("Expected an unknown exporter to fail")
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import "net/http"
+
+// ErrorResponse is the body of every error response: a message for people
+// and a code for programs to branch on.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// Error codes, one per status an error response may have.
+const (
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeUnauthorized         = "unauthorized"
+	ErrorCodeForbidden            = "forbidden"
+	ErrorCodeNotFound             = "not_found"
+	ErrorCodeConflict             = "conflict"
+	ErrorCodeGone                 = "gone"
+	ErrorCodeTooLarge             = "too_large"
+	ErrorCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrorCodeRangeNotSatisfiable  = "range_not_satisfiable"
+	ErrorCodeRateLimited          = "rate_limited"
+	ErrorCodeInternal             = "internal_error"
+	ErrorCodeUnavailable          = "unavailable"
+)
+
+var errorCodes = map[int]string{
+	http.StatusBadRequest:                   ErrorCodeInvalidRequest,
+	http.StatusUnauthorized:                 ErrorCodeUnauthorized,
+	http.StatusForbidden:                    ErrorCodeForbidden,
+	http.StatusNotFound:                     ErrorCodeNotFound,
+	http.StatusConflict:                     ErrorCodeConflict,
+	http.StatusGone:                         ErrorCodeGone,
+	http.StatusRequestEntityTooLarge:        ErrorCodeTooLarge,
+	http.StatusUnsupportedMediaType:         ErrorCodeUnsupportedMediaType,
+	http.StatusRequestedRangeNotSatisfiable: ErrorCodeRangeNotSatisfiable,
+	http.StatusTooManyRequests:              ErrorCodeRateLimited,
+	http.StatusInternalServerError:          ErrorCodeInternal,
+	http.StatusServiceUnavailable:           ErrorCodeUnavailable,
+}
+
+// NewErrorResponse returns the error response with a status and message.
+func NewErrorResponse(status int, message string) ErrorResponse {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = ErrorCodeInternal
+		if status < http.StatusInternalServerError {
+			code = ErrorCodeInvalidRequest
+		}
+	}
+	return ErrorResponse{Error: message, Code: code}
+}
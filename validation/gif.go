@@ -0,0 +1,65 @@
+package validation
+
+import "errors"
+
+var errInvalidGif = errors.New("invalid gif")
+
+// gifPixels adds up the pixels of every frame of a GIF by walking its blocks,
+// without decompressing any of them, which bounds what decoding all frames
+// takes.
+func gifPixels(data []byte) (int, error) {
+	if len(data) < 13 {
+		return 0, errInvalidGif
+	}
+	offset := 13 + colorTableSize(data[10])
+	pixels := 0
+	for offset < len(data) {
+		switch data[offset] {
+		case 0x21: // extension: label, then data sub-blocks
+			end, err := skipSubBlocks(data, offset+2)
+			if err != nil {
+				return 0, err
+			}
+			offset = end
+		case 0x2c: // image descriptor, local color table, LZW code size, data sub-blocks
+			if offset+10 > len(data) {
+				return 0, errInvalidGif
+			}
+			width := int(data[offset+5]) | int(data[offset+6])<<8
+			height := int(data[offset+7]) | int(data[offset+8])<<8
+			pixels += width * height
+			end, err := skipSubBlocks(data, offset+11+colorTableSize(data[offset+9]))
+			if err != nil {
+				return 0, err
+			}
+			offset = end
+		case 0x3b: // trailer
+			return pixels, nil
+		default:
+			return 0, errInvalidGif
+		}
+	}
+	return 0, errInvalidGif
+}
+
+func colorTableSize(flags byte) int {
+	if flags&0x80 == 0 {
+		return 0
+	}
+	return 3 << (flags&0x07 + 1)
+}
+
+// skipSubBlocks returns the offset just past the sub-blocks starting at offset.
+func skipSubBlocks(data []byte, offset int) (int, error) {
+	for {
+		if offset >= len(data) {
+			return 0, errInvalidGif
+		}
+		size := int(data[offset])
+		offset++
+		if size == 0 {
+			return offset, nil
+		}
+		offset += size
+	}
+}
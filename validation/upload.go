@@ -0,0 +1,199 @@
+package validation
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ChenSongJian/ginstagram/video"
+	_ "golang.org/x/image/webp"
+)
+
+type Kind string
+
+const (
+	KindImage Kind = "image"
+	KindVideo Kind = "video"
+)
+
+// MediaType is an accepted upload type. The extension files are stored with
+// comes from here, never from the name the client sent.
+type MediaType struct {
+	ContentType string
+	Ext         string
+	Kind        Kind
+}
+
+// allowedTypes lists exactly what may be uploaded, keyed by the type
+// http.DetectContentType reports for it. Every type must be verifiable past
+// its magic bytes, which is why WebM is not accepted.
+var allowedTypes = map[string]MediaType{
+	"image/jpeg": {ContentType: "image/jpeg", Ext: "jpg", Kind: KindImage},
+	"image/png":  {ContentType: "image/png", Ext: "png", Kind: KindImage},
+	"image/webp": {ContentType: "image/webp", Ext: "webp", Kind: KindImage},
+	"image/gif":  {ContentType: "image/gif", Ext: "gif", Kind: KindImage},
+	"video/mp4":  {ContentType: "video/mp4", Ext: "mp4", Kind: KindVideo},
+}
+
+var ErrEmptyFile = errors.New("uploaded file is empty")
+var ErrUnsupportedType = errors.New("unsupported file type")
+var ErrFileTooLarge = errors.New("file size exceeds limit")
+
+// InvalidFileError is returned for files of an allowed type that do not decode
+// as one.
+type InvalidFileError struct {
+	Kind Kind
+	Err  error
+}
+
+func (err *InvalidFileError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", err.Kind, err.Err)
+}
+
+func (err *InvalidFileError) Unwrap() error {
+	return err.Err
+}
+
+// Limits bounds uploads per kind of media. Videos may be larger when sent as a
+// resumable upload. Each user may also store no more than MaxStoredBytes and
+// upload no more than MaxUploadsPerHour files an hour. Unfinished resumable
+// uploads are bounded by MaxPendingUploads and MaxPendingUploadBytes per user,
+// and each by MaxUploadChunks.
+type Limits struct {
+	MaxImageSize          int64
+	MaxImagePixels        int
+	MaxVideoSize          int64
+	MaxResumableSize      int64
+	MaxStoredBytes        int64
+	MaxUploadsPerHour     int
+	MaxPendingUploads     int
+	MaxPendingUploadBytes int64
+	MaxUploadChunks       int
+}
+
+var DefaultLimits = Limits{
+	MaxImageSize:          5 << 20,
+	MaxImagePixels:        40_000_000,
+	MaxVideoSize:          20 << 20,
+	MaxResumableSize:      1 << 30,
+	MaxStoredBytes:        10 << 30,
+	MaxUploadsPerHour:     60,
+	MaxPendingUploads:     5,
+	MaxPendingUploadBytes: 2 << 30,
+	MaxUploadChunks:       1000,
+}
+
+// MaxSize is the largest upload accepted for a kind of media.
+func (limits Limits) MaxSize(kind Kind, resumable bool) int64 {
+	if kind == KindImage {
+		return limits.MaxImageSize
+	}
+	if resumable {
+		return limits.MaxResumableSize
+	}
+	return limits.MaxVideoSize
+}
+
+// Detect sniffs the type of file from its content and rewinds it.
+func Detect(file io.ReadSeeker) (MediaType, error) {
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return MediaType{}, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return MediaType{}, err
+	}
+	if n == 0 {
+		return MediaType{}, ErrEmptyFile
+	}
+	mediaType, ok := allowedTypes[http.DetectContentType(buffer[:n])]
+	if !ok {
+		return MediaType{}, ErrUnsupportedType
+	}
+	return mediaType, nil
+}
+
+// Check detects the type of an upload of the given size, checks it against the
+// limits and decodes it in full to make sure it is what it claims to be. The
+// file is rewound afterwards.
+func (limits Limits) Check(file io.ReadSeeker, size int64, resumable bool) (MediaType, error) {
+	mediaType, err := Detect(file)
+	if err != nil {
+		return MediaType{}, err
+	}
+	if size > limits.MaxSize(mediaType.Kind, resumable) {
+		return MediaType{}, ErrFileTooLarge
+	}
+	if err := limits.verify(file, mediaType); err != nil {
+		return MediaType{}, &InvalidFileError{Kind: mediaType.Kind, Err: err}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return MediaType{}, err
+	}
+	return mediaType, nil
+}
+
+func (limits Limits) verify(file io.ReadSeeker, mediaType MediaType) error {
+	switch mediaType.ContentType {
+	case "video/mp4":
+		_, err := video.Probe(file)
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > limits.MaxImagePixels {
+		return errors.New("image dimensions exceed limit")
+	}
+	if mediaType.ContentType == "image/gif" {
+		// every frame is decoded, not just the logical screen
+		pixels, err := gifPixels(data)
+		if err != nil {
+			return err
+		}
+		if pixels > limits.MaxImagePixels {
+			return errors.New("image dimensions exceed limit")
+		}
+		_, err = gif.DecodeAll(bytes.NewReader(data))
+		return err
+	}
+	_, _, err = image.Decode(bytes.NewReader(data))
+	return err
+}
+
+// SanitizeFilename makes a client supplied file name safe to store and show:
+// no directories, no control or separator characters and at most 255 bytes.
+func SanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '/' || r == ':' || r == '"' || r == '<' || r == '>' || r == '|' || r == '*' || r == '?' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" {
+		return "upload"
+	}
+	return name
+}
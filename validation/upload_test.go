@@ -0,0 +1,145 @@
+package validation_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/validation"
+)
+
+// gifBytes encodes an animation of frames width×height frames.
+func gifBytes(width int, height int, frames int) []byte {
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9))
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var buffer bytes.Buffer
+	gif.EncodeAll(&buffer, animation)
+	return buffer.Bytes()
+}
+
+func pngBytes(width int, height int) []byte {
+	var buffer bytes.Buffer
+	png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, width, height)))
+	return buffer.Bytes()
+}
+
+func TestCheck_Image(t *testing.T) {
+	content := pngBytes(2, 2)
+	file := bytes.NewReader(content)
+
+	mediaType, err := validation.DefaultLimits.Check(file, int64(len(content)), false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if mediaType.ContentType != "image/png" || mediaType.Ext != "png" || mediaType.Kind != validation.KindImage {
+		t.Errorf("Unexpected media type %+v", mediaType)
+	}
+	if offset, _ := file.Seek(0, 1); offset != 0 {
+		t.Errorf("Expected file to be rewound, at %d", offset)
+	}
+}
+
+func TestCheck_Animation(t *testing.T) {
+	content := gifBytes(2, 2, 3)
+	mediaType, err := validation.DefaultLimits.Check(bytes.NewReader(content), int64(len(content)), false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if mediaType.ContentType != "image/gif" {
+		t.Errorf("Unexpected media type %+v", mediaType)
+	}
+}
+
+func TestCheck_Rejected(t *testing.T) {
+	content := pngBytes(4, 4)
+	smallLimits := validation.DefaultLimits
+	smallLimits.MaxImageSize = 10
+	fewPixels := validation.DefaultLimits
+	fewPixels.MaxImagePixels = 15
+
+	testCases := []struct {
+		name     string
+		limits   validation.Limits
+		content  []byte
+		expected error
+	}{
+		{name: "empty", limits: validation.DefaultLimits, content: nil, expected: validation.ErrEmptyFile},
+		{name: "text", limits: validation.DefaultLimits, content: []byte("plain text"), expected: validation.ErrUnsupportedType},
+		{name: "html", limits: validation.DefaultLimits, content: []byte("<html><script></script></html>"), expected: validation.ErrUnsupportedType},
+		{name: "webm", limits: validation.DefaultLimits, content: []byte{0x1a, 0x45, 0xdf, 0xa3, 0x9f, 0x42, 0x86, 0x81, 0x01}, expected: validation.ErrUnsupportedType},
+		{name: "too large", limits: smallLimits, content: content, expected: validation.ErrFileTooLarge},
+	}
+	for _, testCase := range testCases {
+		_, err := testCase.limits.Check(bytes.NewReader(testCase.content), int64(len(testCase.content)), false)
+		if !errors.Is(err, testCase.expected) {
+			t.Errorf("%s: expected %v, got %v", testCase.name, testCase.expected, err)
+		}
+	}
+
+	for name, check := range map[string]func() error{
+		"truncated": func() error {
+			_, err := validation.DefaultLimits.Check(bytes.NewReader(content[:60]), 60, false)
+			return err
+		},
+		"too many pixels": func() error {
+			_, err := fewPixels.Check(bytes.NewReader(content), int64(len(content)), false)
+			return err
+		},
+		"too many frames": func() error {
+			animation := gifBytes(2, 2, 4)
+			_, err := fewPixels.Check(bytes.NewReader(animation), int64(len(animation)), false)
+			return err
+		},
+		"truncated frames": func() error {
+			animation := gifBytes(2, 2, 4)
+			_, err := validation.DefaultLimits.Check(bytes.NewReader(animation[:len(animation)-1]), int64(len(animation)-1), false)
+			return err
+		},
+	} {
+		var invalidFile *validation.InvalidFileError
+		if err := check(); !errors.As(err, &invalidFile) || invalidFile.Kind != validation.KindImage {
+			t.Errorf("%s: expected an invalid image error, got %v", name, err)
+		}
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	limits := validation.DefaultLimits
+	if limits.MaxSize(validation.KindImage, true) != limits.MaxImageSize {
+		t.Errorf("Expected resumable images to keep the image limit")
+	}
+	if limits.MaxSize(validation.KindVideo, false) != limits.MaxVideoSize {
+		t.Errorf("Expected the video limit")
+	}
+	if limits.MaxSize(validation.KindVideo, true) != limits.MaxResumableSize {
+		t.Errorf("Expected the resumable limit")
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	testCases := map[string]string{
+		"photo.jpg":                 "photo.jpg",
+		"noextension":               "noextension",
+		"../../etc/passwd":          "passwd",
+		"C:\\Users\\me\\cat.png":    "cat.png",
+		"bad\x00name\n.png":         "badname.png",
+		"  ..hidden.  ":             "hidden",
+		"":                          "upload",
+		"..":                        "upload",
+		"<script>alert(1)</script>": "script",
+		strings.Repeat("é", 200):    strings.Repeat("é", 127),
+	}
+	for name, expected := range testCases {
+		if sanitized := validation.SanitizeFilename(name); sanitized != expected {
+			t.Errorf("SanitizeFilename(%q): expected %q, got %q", name, expected, sanitized)
+		}
+	}
+}
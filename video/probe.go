@@ -0,0 +1,147 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// Info is what Probe reads from the header of a video.
+type Info struct {
+	Width    int
+	Height   int
+	Duration time.Duration
+}
+
+var ErrInvalidVideo = errors.New("invalid video")
+
+// maxMoovSize bounds how much of the file is read into memory to find the
+// movie header.
+const maxMoovSize = 16 << 20
+
+// Probe reads the dimensions and duration of an MP4 or QuickTime file from its
+// moov box, without decoding any frames.
+func Probe(r io.ReadSeeker) (Info, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Info{}, err
+	}
+	for offset := int64(0); offset < end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return Info{}, err
+		}
+		boxType, headerSize, boxSize, err := readBoxHeader(r, end-offset)
+		if err != nil {
+			return Info{}, err
+		}
+		if boxType == "moov" {
+			if boxSize-headerSize > maxMoovSize {
+				return Info{}, ErrInvalidVideo
+			}
+			moov := make([]byte, boxSize-headerSize)
+			if _, err := io.ReadFull(r, moov); err != nil {
+				return Info{}, ErrInvalidVideo
+			}
+			return parseMoov(moov)
+		}
+		offset += boxSize
+	}
+	return Info{}, ErrInvalidVideo
+}
+
+func readBoxHeader(r io.Reader, remaining int64) (string, int64, int64, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", 0, 0, ErrInvalidVideo
+	}
+	boxType := string(header[4:8])
+	headerSize := int64(8)
+	boxSize := int64(binary.BigEndian.Uint32(header))
+	switch boxSize {
+	case 0:
+		boxSize = remaining
+	case 1:
+		if _, err := io.ReadFull(r, header); err != nil {
+			return "", 0, 0, ErrInvalidVideo
+		}
+		headerSize = 16
+		boxSize = int64(binary.BigEndian.Uint64(header))
+	}
+	if boxSize < headerSize || boxSize > remaining {
+		return "", 0, 0, ErrInvalidVideo
+	}
+	return boxType, headerSize, boxSize, nil
+}
+
+// boxes splits data into its child boxes by type.
+func boxes(data []byte, visit func(boxType string, body []byte)) error {
+	for len(data) > 0 {
+		boxType, headerSize, boxSize, err := readBoxHeader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+		visit(boxType, data[headerSize:boxSize])
+		data = data[boxSize:]
+	}
+	return nil
+}
+
+func parseMoov(moov []byte) (Info, error) {
+	var info Info
+	foundHeader := false
+	err := boxes(moov, func(boxType string, body []byte) {
+		switch boxType {
+		case "mvhd":
+			if duration, ok := parseMvhd(body); ok {
+				info.Duration = duration
+				foundHeader = true
+			}
+		case "trak":
+			boxes(body, func(boxType string, body []byte) {
+				if boxType != "tkhd" || info.Width > 0 {
+					return
+				}
+				info.Width, info.Height = parseTkhd(body)
+			})
+		}
+	})
+	if err != nil || !foundHeader {
+		return Info{}, ErrInvalidVideo
+	}
+	return info, nil
+}
+
+func parseMvhd(body []byte) (time.Duration, bool) {
+	var timescale, duration uint64
+	switch {
+	case len(body) >= 20 && body[0] == 0:
+		timescale = uint64(binary.BigEndian.Uint32(body[12:]))
+		duration = uint64(binary.BigEndian.Uint32(body[16:]))
+	case len(body) >= 32 && body[0] == 1:
+		timescale = uint64(binary.BigEndian.Uint32(body[20:]))
+		duration = binary.BigEndian.Uint64(body[24:])
+	default:
+		return 0, false
+	}
+	if timescale == 0 {
+		return 0, false
+	}
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), true
+}
+
+// parseTkhd returns the presentation size of a track, which is zero for
+// tracks that are not video.
+func parseTkhd(body []byte) (int, int) {
+	offset := 76
+	if len(body) > 0 && body[0] == 1 {
+		offset = 88
+	}
+	if len(body) < offset+8 {
+		return 0, 0
+	}
+	width := int(binary.BigEndian.Uint32(body[offset:]) >> 16)
+	height := int(binary.BigEndian.Uint32(body[offset+4:]) >> 16)
+	return width, height
+}
@@ -0,0 +1,67 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func box(boxType string, body ...[]byte) []byte {
+	content := bytes.Join(body, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(content)))
+	copy(header[4:], boxType)
+	return append(header, content...)
+}
+
+func mvhd(timescale uint32, duration uint32) []byte {
+	body := make([]byte, 100)
+	binary.BigEndian.PutUint32(body[12:], timescale)
+	binary.BigEndian.PutUint32(body[16:], duration)
+	return box("mvhd", body)
+}
+
+func tkhd(width uint32, height uint32) []byte {
+	body := make([]byte, 84)
+	binary.BigEndian.PutUint32(body[76:], width<<16)
+	binary.BigEndian.PutUint32(body[80:], height<<16)
+	return box("tkhd", body)
+}
+
+func TestProbe(t *testing.T) {
+	file := bytes.Join([][]byte{
+		box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41")),
+		box("mdat", make([]byte, 64)),
+		box("moov",
+			mvhd(1000, 12500),
+			box("trak", tkhd(0, 0)),
+			box("trak", tkhd(1280, 720)),
+		),
+	}, nil)
+
+	info, err := Probe(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if info.Width != 1280 || info.Height != 720 {
+		t.Errorf("Expected 1280x720, got %dx%d", info.Width, info.Height)
+	}
+	if info.Duration != 12500*time.Millisecond {
+		t.Errorf("Expected duration 12.5s, got %v", info.Duration)
+	}
+}
+
+func TestProbe_NoMoov(t *testing.T) {
+	file := box("ftyp", []byte("isom\x00\x00\x02\x00"))
+	if _, err := Probe(bytes.NewReader(file)); err != ErrInvalidVideo {
+		t.Errorf("Expected %v, got %v", ErrInvalidVideo, err)
+	}
+}
+
+func TestProbe_Truncated(t *testing.T) {
+	file := box("moov", mvhd(1000, 1000))
+	if _, err := Probe(bytes.NewReader(file[:len(file)-10])); err != ErrInvalidVideo {
+		t.Errorf("Expected %v, got %v", ErrInvalidVideo, err)
+	}
+}
@@ -0,0 +1,195 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transcoder turns an uploaded video into the renditions that are served. It
+// writes them to outDir laid out as:
+//
+//	h264.mp4             an H.264/AAC MP4 that plays everywhere
+//	poster.jpg           a frame to show before playback
+//	hls/index.m3u8       the HLS master playlist
+//	hls/<name>/...       one media playlist and its segments per rendition
+type Transcoder interface {
+	Transcode(ctx context.Context, input string, outDir string) (Info, error)
+}
+
+// Rendition is one quality level of the HLS output.
+type Rendition struct {
+	Name         string
+	Height       int
+	VideoBitrate int
+	AudioBitrate int
+}
+
+var DefaultRenditions = []Rendition{
+	{Name: "360p", Height: 360, VideoBitrate: 800_000, AudioBitrate: 96_000},
+	{Name: "720p", Height: 720, VideoBitrate: 2_800_000, AudioBitrate: 128_000},
+	{Name: "1080p", Height: 1080, VideoBitrate: 5_000_000, AudioBitrate: 192_000},
+}
+
+// Outputs are the storage keys of what a Transcoder made of the video stored
+// under a key.
+type Outputs struct {
+	Mp4      string `json:"mp4"`
+	Poster   string `json:"poster"`
+	Playlist string `json:"hls"`
+}
+
+// OutputKeys returns where the outputs of the video stored under key go. Any
+// file a Transcoder writes maps to OutputKey(key, its path in outDir).
+func OutputKeys(key string) Outputs {
+	return Outputs{
+		Mp4:      OutputKey(key, "h264.mp4"),
+		Poster:   OutputKey(key, "poster.jpg"),
+		Playlist: OutputKey(key, "hls/index.m3u8"),
+	}
+}
+
+// OutputKey returns the storage key of the file at name, a slash separated
+// path in the output directory of a Transcoder, for the video stored under key.
+func OutputKey(key string, name string) string {
+	return strings.TrimSuffix(key, filepath.Ext(key)) + "_" + name
+}
+
+// FFmpeg is a Transcoder running the ffmpeg and ffprobe binaries.
+type FFmpeg struct {
+	FFmpegPath  string
+	FFprobePath string
+	Renditions  []Rendition
+}
+
+// NewFFmpeg runs the given binaries, looked up in PATH unless they are paths,
+// to make the default renditions.
+func NewFFmpeg(ffmpegPath string, ffprobePath string) *FFmpeg {
+	return &FFmpeg{FFmpegPath: ffmpegPath, FFprobePath: ffprobePath, Renditions: DefaultRenditions}
+}
+
+func (ffmpeg *FFmpeg) Transcode(ctx context.Context, input string, outDir string) (Info, error) {
+	mp4 := filepath.Join(outDir, "h264.mp4")
+	err := ffmpeg.run(ctx, "-i", input, "-map", "0:v:0", "-map", "0:a:0?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		"-c:a", "aac", "-b:a", "128k", "-movflags", "+faststart", mp4)
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := ffmpeg.probe(ctx, mp4)
+	if err != nil {
+		return Info{}, err
+	}
+
+	renditions := SelectRenditions(ffmpeg.Renditions, info.Height)
+	for _, rendition := range renditions {
+		dir := filepath.Join(outDir, "hls", rendition.Name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return Info{}, err
+		}
+		err := ffmpeg.run(ctx, "-i", mp4, "-map", "0:v:0", "-map", "0:a:0?",
+			"-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p",
+			"-vf", fmt.Sprintf("scale=-2:%d", rendition.Height),
+			"-b:v", strconv.Itoa(rendition.VideoBitrate), "-maxrate", strconv.Itoa(rendition.VideoBitrate),
+			"-bufsize", strconv.Itoa(2*rendition.VideoBitrate),
+			"-c:a", "aac", "-b:a", strconv.Itoa(rendition.AudioBitrate),
+			"-f", "hls", "-hls_time", "6", "-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(dir, "seg_%03d.ts"), filepath.Join(dir, "index.m3u8"))
+		if err != nil {
+			return Info{}, err
+		}
+	}
+	playlist := MasterPlaylist(renditions, info)
+	if err := os.WriteFile(filepath.Join(outDir, "hls", "index.m3u8"), []byte(playlist), 0o644); err != nil {
+		return Info{}, err
+	}
+
+	// a second in, past the black frame many videos open with, unless the
+	// video is shorter than that
+	at := min(time.Second, info.Duration/2)
+	err = ffmpeg.run(ctx, "-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64), "-i", mp4,
+		"-frames:v", "1", "-q:v", "3", filepath.Join(outDir, "poster.jpg"))
+	if err != nil {
+		return Info{}, err
+	}
+	return info, nil
+}
+
+// SelectRenditions returns the renditions no taller than a video of the given
+// height, or the smallest one for a video smaller than all of them.
+func SelectRenditions(renditions []Rendition, height int) []Rendition {
+	var selected []Rendition
+	for _, rendition := range renditions {
+		if rendition.Height <= height {
+			selected = append(selected, rendition)
+		}
+	}
+	if len(selected) == 0 && len(renditions) > 0 {
+		selected = renditions[:1]
+	}
+	return selected
+}
+
+// MasterPlaylist lists the media playlist of every rendition of a video.
+func MasterPlaylist(renditions []Rendition, info Info) string {
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, rendition := range renditions {
+		height := min(rendition.Height, info.Height)
+		width := height * info.Width / max(info.Height, 1)
+		width -= width % 2
+		fmt.Fprintf(&playlist, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"avc1.64001f,mp4a.40.2\"\n%s/index.m3u8\n",
+			rendition.VideoBitrate+rendition.AudioBitrate, width, height, rendition.Name)
+	}
+	return playlist.String()
+}
+
+func (ffmpeg *FFmpeg) run(ctx context.Context, args ...string) error {
+	args = append([]string{"-hide_banner", "-loglevel", "error", "-nostdin", "-y"}, args...)
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg.FFmpegPath, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (ffmpeg *FFmpeg) probe(ctx context.Context, path string) (Info, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg.FFprobePath, "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=width,height:format=duration", "-of", "json", path)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return Info{}, fmt.Errorf("ffprobe: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var result struct {
+		Streams []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return Info{}, fmt.Errorf("ffprobe: %w", err)
+	}
+	if len(result.Streams) == 0 {
+		return Info{}, ErrInvalidVideo
+	}
+	seconds, _ := strconv.ParseFloat(result.Format.Duration, 64)
+	return Info{
+		Width:    result.Streams[0].Width,
+		Height:   result.Streams[0].Height,
+		Duration: time.Duration(seconds * float64(time.Second)),
+	}, nil
+}
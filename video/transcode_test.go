@@ -0,0 +1,95 @@
+package video
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputKeys(t *testing.T) {
+	outputs := OutputKeys("uploads/sha256/ab/abcd.webm")
+	if outputs.Mp4 != "uploads/sha256/ab/abcd_h264.mp4" || outputs.Poster != "uploads/sha256/ab/abcd_poster.jpg" ||
+		outputs.Playlist != "uploads/sha256/ab/abcd_hls/index.m3u8" {
+		t.Errorf("Unexpected output keys %+v", outputs)
+	}
+	if key := OutputKey("uploads/sha256/ab/abcd.mp4", "hls/360p/seg_000.ts"); key != "uploads/sha256/ab/abcd_hls/360p/seg_000.ts" {
+		t.Errorf("Unexpected output key %s", key)
+	}
+}
+
+func TestSelectRenditions(t *testing.T) {
+	if selected := SelectRenditions(DefaultRenditions, 720); len(selected) != 2 || selected[1].Name != "720p" {
+		t.Errorf("Expected 360p and 720p for a 720p video, got %+v", selected)
+	}
+	if selected := SelectRenditions(DefaultRenditions, 240); len(selected) != 1 || selected[0].Name != "360p" {
+		t.Errorf("Expected the smallest rendition for a small video, got %+v", selected)
+	}
+}
+
+func TestMasterPlaylist(t *testing.T) {
+	playlist := MasterPlaylist(DefaultRenditions[:2], Info{Width: 1280, Height: 720})
+	if !strings.HasPrefix(playlist, "#EXTM3U\n") {
+		t.Errorf("Expected a playlist header, got %s", playlist)
+	}
+	for _, expected := range []string{"RESOLUTION=640x360", "360p/index.m3u8", "RESOLUTION=1280x720", "720p/index.m3u8"} {
+		if !strings.Contains(playlist, expected) {
+			t.Errorf("Expected %s in playlist %s", expected, playlist)
+		}
+	}
+}
+
+// fakeBinary writes a script standing in for ffmpeg or ffprobe. The fake
+// ffmpeg creates whatever file it was asked to write, its last argument.
+func fakeBinary(t *testing.T, dir string, name string, script string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFFmpeg_Transcode(t *testing.T) {
+	binDir := t.TempDir()
+	outDir := t.TempDir()
+	ffmpeg := &FFmpeg{
+		FFmpegPath: fakeBinary(t, binDir, "ffmpeg", `for last; do :; done; echo "$@" >> "$(dirname "$0")/calls"; echo out > "$last"`),
+		FFprobePath: fakeBinary(t, binDir, "ffprobe",
+			`echo '{"streams":[{"width":1280,"height":720}],"format":{"duration":"12.500"}}'`),
+		Renditions: DefaultRenditions,
+	}
+	info, err := ffmpeg.Transcode(context.Background(), "input.webm", outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != 1280 || info.Height != 720 || info.Duration != 12500*time.Millisecond {
+		t.Errorf("Unexpected info %+v", info)
+	}
+	for _, name := range []string{"h264.mp4", "poster.jpg", "hls/index.m3u8", "hls/360p/index.m3u8", "hls/720p/index.m3u8"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("Expected %s to be written: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "hls/1080p")); err == nil {
+		t.Error("Expected no rendition larger than the video")
+	}
+	calls, _ := os.ReadFile(filepath.Join(binDir, "calls"))
+	if !strings.Contains(string(calls), "-c:v libx264") || !strings.Contains(string(calls), "-c:a aac") {
+		t.Errorf("Expected H.264/AAC output, got calls %s", calls)
+	}
+}
+
+func TestFFmpeg_TranscodeFailure(t *testing.T) {
+	binDir := t.TempDir()
+	ffmpeg := &FFmpeg{
+		FFmpegPath:  fakeBinary(t, binDir, "ffmpeg", `echo "Invalid data found when processing input" >&2; exit 1`),
+		FFprobePath: fakeBinary(t, binDir, "ffprobe", `exit 1`),
+		Renditions:  DefaultRenditions,
+	}
+	_, err := ffmpeg.Transcode(context.Background(), "input.mp4", t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "Invalid data found") {
+		t.Errorf("Expected the ffmpeg error, got %v", err)
+	}
+}
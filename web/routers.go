@@ -2,79 +2,152 @@ package web
 
 import (
 	"github.com/ChenSongJian/ginstagram/handlers"
+	"github.com/ChenSongJian/ginstagram/health"
+	"github.com/ChenSongJian/ginstagram/jobs"
+	"github.com/ChenSongJian/ginstagram/metrics"
 	"github.com/ChenSongJian/ginstagram/middlewares"
 	"github.com/ChenSongJian/ginstagram/services"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/validation"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-var userService services.UserService
-var followService services.FollowService
-var postService services.PostService
-var mediaService services.MediaService
-var commentService services.CommentService
-var likeService services.LikeService
-
-func initServices() {
-	userService = services.NewDBUserService()
-	followService = services.NewDBFollowService()
-	postService = services.NewDBPostService()
-	mediaService = services.NewDBMediaService()
-	commentService = services.NewDBCommentService()
-	likeService = services.NewDBLikeService()
+// Deps are what the router serves requests with.
+type Deps struct {
+	UserService          services.UserService
+	FollowService        services.FollowService
+	PostService          services.PostService
+	MediaService         services.MediaService
+	CommentService       services.CommentService
+	LikeService          services.LikeService
+	BookmarkService      services.BookmarkService
+	ReportService        services.ReportService
+	UploadSessionService services.UploadSessionService
+	MediaStorage         storage.Storage
+	TranscodeQueue       jobs.MediaQueue
+	UploadLimits         validation.Limits
+	UploadSpoolDir       string
+	JWTSecret            string
+	CORSOrigins          []string
+	// Readiness is what /readyz checks, nothing if nil.
+	Readiness *health.Checker
 }
 
-func NewRouter() *gin.Engine {
-	r := gin.Default()
+func NewRouter(deps Deps) *gin.Engine {
+	r := gin.New()
+	r.Use(middlewares.RequestIdMiddleware(), middlewares.TracingMiddleware(), middlewares.LoggerMiddleware(),
+		middlewares.MetricsMiddleware(), gin.Recovery())
 
-	corsConfig := middlewares.NewCorsConfig()
+	corsConfig := middlewares.NewCorsConfig(deps.CORSOrigins)
 	r.Use(cors.New(corsConfig))
 
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	readiness := deps.Readiness
+	if readiness == nil {
+		readiness = health.NewChecker()
+	}
+	r.GET("/healthz", handlers.Liveness())
+	r.GET("/readyz", handlers.Readiness(readiness))
+
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "pong",
 		})
 	})
 
-	initServices()
+	userService := deps.UserService
+	followService := deps.FollowService
+	postService := deps.PostService
+	mediaService := deps.MediaService
+	commentService := deps.CommentService
+	likeService := deps.LikeService
+	bookmarkService := deps.BookmarkService
+	reportService := deps.ReportService
+	uploadSessionService := deps.UploadSessionService
+	mediaStorage := deps.MediaStorage
+	transcodeQueue := deps.TranscodeQueue
+	uploadLimits := deps.UploadLimits
+	uploadSpoolDir := deps.UploadSpoolDir
+	jwtSecret := deps.JWTSecret
+	authMiddleware := middlewares.AuthMiddleware(jwtSecret, userService)
 
 	apiV1Group := r.Group("/api/v1")
 
 	uploadV1Group := apiV1Group.Group("/upload")
-	uploadV1Group.POST("/", middlewares.AuthMiddleware(), handlers.UploadMedia)
+	uploadV1Group.POST("/", authMiddleware, handlers.UploadMedia(mediaService, mediaStorage, uploadLimits, transcodeQueue))
+	uploadV1Group.GET("/usage", authMiddleware, handlers.GetUploadUsage(mediaService, uploadSessionService, uploadLimits))
+	uploadV1Group.POST("/resumable", authMiddleware, handlers.CreateUpload(uploadSessionService, mediaService, uploadLimits))
+	uploadV1Group.HEAD("/resumable/:uploadId", authMiddleware, handlers.GetUploadOffset(uploadSessionService))
+	uploadV1Group.PATCH("/resumable/:uploadId", authMiddleware, handlers.UploadChunk(uploadSessionService, mediaStorage, uploadSpoolDir, uploadLimits))
+	uploadV1Group.POST("/resumable/:uploadId/finalize", authMiddleware, handlers.FinalizeUpload(uploadSessionService, mediaService, mediaStorage, uploadSpoolDir, uploadLimits, transcodeQueue))
+	uploadV1Group.DELETE("/resumable/:uploadId", authMiddleware, handlers.DeleteUpload(uploadSessionService, mediaStorage))
+
+	apiV1Group.GET("/media/*key", handlers.ServeMedia(userService, followService, postService, mediaService, mediaStorage, jwtSecret))
+	apiV1Group.HEAD("/media/*key", handlers.ServeMedia(userService, followService, postService, mediaService, mediaStorage, jwtSecret))
+	apiV1Group.GET("/signed_url/*key", authMiddleware, handlers.SignMediaUrl(userService, followService, postService, mediaService, mediaStorage))
 
 	userV1Group := apiV1Group.Group("/user")
 	userV1Group.POST("/", handlers.RegisterUser(userService))
 	userV1Group.GET("/", handlers.ListUsers(userService))
 	userV1Group.GET("/:userId", handlers.GetUserById(userService))
-	userV1Group.PUT("/:userId", middlewares.AuthMiddleware(), handlers.UpdateUser(userService))
-	userV1Group.DELETE("/:userId", middlewares.AuthMiddleware(), handlers.DeleteUser(userService))
-	userV1Group.GET("/info", middlewares.AuthMiddleware(), handlers.GetCurrentUserInfo(userService))
-	userV1Group.POST("/login", handlers.LoginUser(userService))
-	userV1Group.POST("/logout", middlewares.AuthMiddleware(), handlers.LogoutUser(userService))
-	userV1Group.GET("/refresh", middlewares.AuthMiddleware(), handlers.RefreshToken(userService))
+	userV1Group.PUT("/:userId", authMiddleware, handlers.UpdateUser(userService, mediaService))
+	userV1Group.DELETE("/:userId", authMiddleware, handlers.DeleteUser(userService))
+	userV1Group.GET("/info", authMiddleware, handlers.GetCurrentUserInfo(userService))
+	userV1Group.POST("/login", handlers.LoginUser(userService, jwtSecret))
+	userV1Group.POST("/restore", handlers.RestoreUser(userService))
+	userV1Group.POST("/logout", authMiddleware, handlers.LogoutUser(userService, jwtSecret))
+	userV1Group.GET("/refresh", authMiddleware, handlers.RefreshToken(userService, jwtSecret))
 
 	followV1Group := apiV1Group.Group("/follow")
 	followV1Group.GET("/", handlers.ListFollows(followService))
-	followV1Group.POST("/", middlewares.AuthMiddleware(), handlers.FollowUser(followService))
-	followV1Group.DELETE("/:followId", middlewares.AuthMiddleware(), handlers.UnfollowUser(followService))
+	followV1Group.POST("/", authMiddleware, handlers.FollowUser(followService))
+	followV1Group.DELETE("/:followId", authMiddleware, handlers.UnfollowUser(followService))
 
 	postV1Group := apiV1Group.Group("/post")
 	// postV1Group.GET("/public", handlers.ListPublicPosts(postService, mediaService))
-	postV1Group.GET("/", middlewares.AuthMiddleware(), handlers.ListPosts(postService, mediaService))
-	postV1Group.GET("/:postId", handlers.GetPostById(userService, followService, postService, mediaService))
-	postV1Group.POST("/", middlewares.AuthMiddleware(), handlers.CreatePost(postService, mediaService))
-	postV1Group.DELETE("/:postId", middlewares.AuthMiddleware(), handlers.DeletePost(postService, mediaService))
-	postV1Group.GET("/:postId/like", middlewares.AuthMiddleware(), handlers.ListLikesByPostId(userService, followService, postService, likeService))
-	postV1Group.POST("/:postId/like", middlewares.AuthMiddleware(), handlers.LikePost(userService, followService, postService, likeService))
-
-	postV1Group.GET("/:postId/comment", middlewares.AuthMiddleware(), handlers.ListCommentsByPostId(userService, followService, postService, commentService))
-	postV1Group.POST("/:postId/comment", middlewares.AuthMiddleware(), handlers.CreateComment(userService, followService, postService, commentService))
-	postV1Group.DELETE("/:postId/comment/:commentId", middlewares.AuthMiddleware(), handlers.DeleteComment(userService, followService, postService, commentService))
-	postV1Group.POST("/:postId/comment/:commentId/like", middlewares.AuthMiddleware(), handlers.LikeComment(userService, followService, postService, commentService, likeService))
-
-	apiV1Group.DELETE("/post_like/:postLikeId", middlewares.AuthMiddleware(), handlers.UnlikePost(userService, followService, postService, likeService))
-	apiV1Group.DELETE("/comment_like/:commentLikeId", middlewares.AuthMiddleware(), handlers.UnlikeComment(userService, followService, commentService, likeService))
+	postV1Group.GET("/", authMiddleware, handlers.ListPosts(postService, mediaService))
+	postV1Group.GET("/trash", authMiddleware, handlers.ListDeletedPosts(postService))
+	postV1Group.GET("/archive", authMiddleware, handlers.ListArchivedPosts(postService))
+	postV1Group.GET("/:postId", handlers.GetPostById(userService, followService, postService, mediaService, jwtSecret))
+	postV1Group.POST("/", authMiddleware, handlers.CreatePost(postService, mediaService))
+	postV1Group.DELETE("/:postId", authMiddleware, handlers.DeletePost(postService, mediaService))
+	postV1Group.POST("/:postId/restore", authMiddleware, handlers.RestorePost(postService))
+	postV1Group.POST("/:postId/archive", authMiddleware, handlers.ArchivePost(postService))
+	postV1Group.DELETE("/:postId/archive", authMiddleware, handlers.UnarchivePost(postService))
+	postV1Group.GET("/:postId/like", authMiddleware, handlers.ListLikesByPostId(userService, followService, postService, likeService))
+	postV1Group.POST("/:postId/like", authMiddleware, handlers.LikePost(userService, followService, postService, likeService))
+
+	postV1Group.GET("/:postId/comment", authMiddleware, handlers.ListCommentsByPostId(userService, followService, postService, commentService))
+	postV1Group.POST("/:postId/comment", authMiddleware, handlers.CreateComment(userService, followService, postService, commentService))
+	postV1Group.DELETE("/:postId/comment/:commentId", authMiddleware, handlers.DeleteComment(userService, followService, postService, commentService))
+	postV1Group.POST("/:postId/comment/:commentId/like", authMiddleware, handlers.LikeComment(userService, followService, postService, commentService, likeService))
+
+	postV1Group.POST("/:postId/bookmark", authMiddleware, handlers.BookmarkPost(userService, followService, postService, bookmarkService))
+	postV1Group.PUT("/:postId/bookmark", authMiddleware, handlers.MoveBookmark(bookmarkService))
+	postV1Group.DELETE("/:postId/bookmark", authMiddleware, handlers.UnbookmarkPost(bookmarkService))
+
+	bookmarkV1Group := apiV1Group.Group("/bookmark")
+	bookmarkV1Group.GET("/", authMiddleware, handlers.ListBookmarks(bookmarkService))
+	bookmarkV1Group.PUT("/order", authMiddleware, handlers.ReorderBookmarks(bookmarkService))
+
+	collectionV1Group := apiV1Group.Group("/collection")
+	collectionV1Group.GET("/", authMiddleware, handlers.ListCollections(bookmarkService))
+	collectionV1Group.POST("/", authMiddleware, handlers.CreateCollection(bookmarkService))
+	collectionV1Group.DELETE("/:collectionId", authMiddleware, handlers.DeleteCollection(bookmarkService))
+	collectionV1Group.PUT("/order", authMiddleware, handlers.ReorderCollections(bookmarkService))
+
+	apiV1Group.DELETE("/post_like/:postLikeId", authMiddleware, handlers.UnlikePost(userService, followService, postService, likeService))
+	apiV1Group.DELETE("/comment_like/:commentLikeId", authMiddleware, handlers.UnlikeComment(userService, followService, commentService, likeService))
+
+	reportV1Group := apiV1Group.Group("/report")
+	reportV1Group.POST("/", authMiddleware, handlers.CreateReport(userService, postService, commentService, reportService))
+
+	moderationV1Group := apiV1Group.Group("/moderation", authMiddleware, middlewares.ModeratorMiddleware(userService))
+	moderationV1Group.GET("/report", handlers.ListReports(reportService))
+	moderationV1Group.POST("/report/:reportId/resolve", handlers.ResolveReport(reportService))
+	moderationV1Group.GET("/action", handlers.ListModerationActions(reportService))
+	moderationV1Group.PUT("/user/:userId/status", handlers.UpdateUserStatus(userService, reportService))
 
 	return r
 }
@@ -0,0 +1,100 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ChenSongJian/ginstagram/middlewares"
+	"github.com/ChenSongJian/ginstagram/mocks"
+	"github.com/ChenSongJian/ginstagram/models"
+	"github.com/ChenSongJian/ginstagram/storage"
+	"github.com/ChenSongJian/ginstagram/validation"
+	"github.com/ChenSongJian/ginstagram/web"
+	"github.com/gin-gonic/gin"
+)
+
+const testJWTSecret = "test-jwt-secret"
+
+func newDeps(t *testing.T, userService *mocks.MockUserService) web.Deps {
+	return web.Deps{
+		UserService:          userService,
+		FollowService:        mocks.NewMockFollowService(),
+		PostService:          mocks.NewMockPostService(),
+		MediaService:         mocks.NewMockMediaService(),
+		CommentService:       mocks.NewMockCommentService(),
+		LikeService:          mocks.NewMockLikeService(),
+		BookmarkService:      mocks.NewMockBookmarkService(),
+		ReportService:        mocks.NewMockReportService(),
+		UploadSessionService: mocks.NewMockUploadSessionService(),
+		MediaStorage:         storage.NewLocalStorage(t.TempDir(), "/api/v1/media", []byte("secret")),
+		TranscodeQueue:       mocks.NewMockMediaQueue(),
+		UploadLimits:         validation.DefaultLimits,
+		UploadSpoolDir:       t.TempDir(),
+		JWTSecret:            testJWTSecret,
+		CORSOrigins:          []string{"http://localhost:3000"},
+	}
+}
+
+func TestNewRouter_IndependentDeps(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := models.User{Id: 1, Username: "username", PasswordHash: "PasswordHash", Email: "email"}
+	token, _ := middlewares.GenerateToken(testJWTSecret, user, true)
+
+	activeUsers := mocks.NewMockUserService()
+	activeUsers.Users["email"] = user
+	bannedUsers := mocks.NewMockUserService()
+	banned := user
+	banned.Status = models.UserStatusBanned
+	bannedUsers.Users["email"] = banned
+
+	activeRouter := web.NewRouter(newDeps(t, activeUsers))
+	bannedRouter := web.NewRouter(newDeps(t, bannedUsers))
+
+	for _, testCase := range []struct {
+		name     string
+		router   *gin.Engine
+		expected int
+	}{
+		{"active", activeRouter, http.StatusOK},
+		{"banned", bannedRouter, http.StatusForbidden},
+	} {
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/api/v1/user/info", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		testCase.router.ServeHTTP(response, request)
+		if response.Code != testCase.expected {
+			t.Errorf("%s: expected status code %d, got %d: %s", testCase.name, testCase.expected, response.Code, response.Body.String())
+		}
+	}
+}
+
+func TestNewRouter_IndependentJWTSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := models.User{Id: 1, Username: "username", PasswordHash: "PasswordHash", Email: "email"}
+	token, _ := middlewares.GenerateToken(testJWTSecret, user, true)
+
+	users := mocks.NewMockUserService()
+	users.Users["email"] = user
+	deps := newDeps(t, users)
+	router := web.NewRouter(deps)
+	deps.JWTSecret = "other-jwt-secret"
+	otherRouter := web.NewRouter(deps)
+
+	for _, testCase := range []struct {
+		name     string
+		router   *gin.Engine
+		expected int
+	}{
+		{"same secret", router, http.StatusOK},
+		{"other secret", otherRouter, http.StatusUnauthorized},
+	} {
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/api/v1/user/info", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		testCase.router.ServeHTTP(response, request)
+		if response.Code != testCase.expected {
+			t.Errorf("%s: expected status code %d, got %d: %s", testCase.name, testCase.expected, response.Code, response.Body.String())
+		}
+	}
+}